@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/config"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/services"
+)
+
+const (
+	// defaultAlertEvaluationInterval is how often the alerting rules are evaluated when not configured
+	defaultAlertEvaluationInterval = 10 * time.Second
+
+	// defaultWebhookTimeout bounds every delivery attempt of a webhook when not configured
+	defaultWebhookTimeout = 10 * time.Second
+)
+
+// newWebhooks builds the webhooks defined in the alerting configuration, by name
+func newWebhooks(cfg *config.AlertingConfig, logger *slog.Logger) map[string]*services.Webhook {
+	webhooks := make(map[string]*services.Webhook, len(cfg.Webhooks))
+	for _, webhookCfg := range cfg.Webhooks {
+		timeout := webhookCfg.Timeout.Duration
+		if timeout == 0 {
+			timeout = defaultWebhookTimeout
+		}
+		webhooks[webhookCfg.Name] = services.NewWebhook(webhookCfg.Name, webhookCfg.URL, webhookCfg.Secret, webhookCfg.MaxRetries, &http.Client{Timeout: timeout}, logger)
+	}
+	return webhooks
+}
+
+// newAlertEngine builds the alert engine of the rules defined in the configuration.
+// Returns nil when no rule is defined.
+func newAlertEngine(cfg *config.AlertingConfig, stream services.StreamService, webhooks map[string]*services.Webhook, logger *slog.Logger) *services.AlertEngine {
+	if len(cfg.Rules) == 0 {
+		return nil
+	}
+
+	rules := make([]services.AlertRule, 0, len(cfg.Rules))
+	for _, ruleCfg := range cfg.Rules {
+		rule := services.AlertRule{
+			Name:       ruleCfg.Name,
+			Metric:     ruleCfg.Metric,
+			Condition:  models.AlertCondition(ruleCfg.Condition),
+			Operator:   ruleCfg.Operator,
+			Value:      ruleCfg.Value,
+			Window:     ruleCfg.Window.Duration,
+			Cooldown:   ruleCfg.Cooldown.Duration,
+			Hysteresis: ruleCfg.Hysteresis,
+		}
+		for _, name := range ruleCfg.Webhooks {
+			rule.Notifiers = append(rule.Notifiers, webhooks[name])
+		}
+		rules = append(rules, rule)
+	}
+
+	interval := cfg.EvaluationInterval.Duration
+	if interval == 0 {
+		interval = defaultAlertEvaluationInterval
+	}
+
+	return services.NewAlertEngine(stream, rules, interval, logger)
+}
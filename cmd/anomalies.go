@@ -0,0 +1,44 @@
+package main
+
+import (
+	"cmp"
+	"log/slog"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/config"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/services"
+)
+
+// Defaults of the anomaly detection settings left unset in the configuration
+const (
+	defaultAnomalyBucket      = time.Minute
+	defaultAnomalyZScoreLimit = 3
+	defaultAnomalyAlpha       = 0.3
+	defaultAnomalyWindow      = 30
+	defaultAnomalyMinBuckets  = 10
+	defaultAnomalyMinPosts    = 5
+)
+
+// newAnomalyDetector builds the anomaly detector from the configuration.
+// Returns nil when anomaly detection is disabled.
+func newAnomalyDetector(cfg *config.AnomaliesConfig, stream services.StreamService, webhooks map[string]*services.Webhook, logger *slog.Logger) *services.AnomalyDetector {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	opts := services.AnomalyOptions{
+		Method:      cmp.Or(cfg.Method, models.AnomalyMethodEWMA),
+		Bucket:      cmp.Or(cfg.Bucket.Duration, defaultAnomalyBucket),
+		ZScoreLimit: cmp.Or(cfg.ZScoreLimit, defaultAnomalyZScoreLimit),
+		Alpha:       cmp.Or(cfg.Alpha, defaultAnomalyAlpha),
+		Window:      cmp.Or(cfg.Window, defaultAnomalyWindow),
+		MinBuckets:  cmp.Or(cfg.MinBuckets, defaultAnomalyMinBuckets),
+		MinPosts:    cmp.Or(cfg.MinPosts, defaultAnomalyMinPosts),
+	}
+	for _, name := range cfg.Webhooks {
+		opts.Notifiers = append(opts.Notifiers, webhooks[name])
+	}
+
+	return services.NewAnomalyDetector(stream, opts, logger)
+}
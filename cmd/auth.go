@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/config"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/handlers"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// newAuthenticator builds the authenticator of the API keys defined in the configuration and the keys file.
+// Returns nil when no key is defined, the API is then open.
+func newAuthenticator(cfg *config.AuthConfig, logger *slog.Logger) (*handlers.Authenticator, error) {
+	keyCfgs := cfg.Keys
+	if cfg.KeysFile != "" {
+		fileKeys, err := config.ReadKeysFile(cfg.KeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read API keys: %w", err)
+		}
+		keyCfgs = append(keyCfgs[:len(keyCfgs):len(keyCfgs)], fileKeys...)
+	}
+
+	if len(keyCfgs) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]models.APIKey, 0, len(keyCfgs))
+	for _, keyCfg := range keyCfgs {
+		keys = append(keys, models.APIKey{
+			Name:              keyCfg.Name,
+			Hash:              keyCfg.Hash,
+			Endpoints:         keyCfg.Endpoints,
+			MaxDuration:       keyCfg.MaxDuration.Duration,
+			RequestsPerMinute: keyCfg.RequestsPerMinute,
+			Burst:             keyCfg.Burst,
+			MaxConcurrent:     keyCfg.MaxConcurrent,
+		})
+	}
+
+	return handlers.NewAuthenticator(cfg.Header, keys, cfg.PublicEndpoints, logger), nil
+}
@@ -1,36 +1,132 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"strings"
+	"sync/atomic"
 
 	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/config"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/handlers"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/logging"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/metrics"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/services"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/store"
 )
 
+// version is set at build time, see the build target of the Makefile
+var version = "dev"
+
 // application holds the application configuration and dependencies
 type application struct {
-	config *config.Config
+	// configPath is the configuration file reloaded on SIGHUP or when it changes (the default path when empty)
+	configPath string
+
 	logger *slog.Logger
 	server *http.Server
+
+	// history is nil when the history store is disabled
+	history *store.FileHistory
+
+	// archive is nil when the post archive is disabled
+	archive *store.FileArchive
+
+	// limiter bounds the concurrent analyses across the generations
+	limiter *services.ConcurrencyLimiter
+
+	// metrics are exposed on '/metrics', the components of the current generation are registered in them
+	metrics *appMetrics
+
+	// probe checks the upstream stream of the current generation
+	probe *services.UpstreamProbe
+
+	// lifecycle reports the version and the uptime, and tells the readiness probes that the service is shutting down
+	lifecycle *handlers.Lifecycle
+
+	// generation serves the requests, it is replaced when the configuration is reloaded
+	generation atomic.Pointer[generation]
+}
+
+// generation holds the configuration and the components built from it, replaced as a whole on reload.
+// The requests in progress finish on the generation they started on.
+type generation struct {
+	config  *config.Config
+	handler http.Handler
+
+	// stream is the shared stream connection of the generation, checked by the upstream probe
+	stream services.StreamService
+
+	// archiver is nil when the post archive is disabled
+	archiver *services.PostArchiver
+
+	scheduler *services.Scheduler
+
+	// authenticator is nil when no API key is defined, rateLimiter when no rate limit is defined
+	authenticator *handlers.Authenticator
+	rateLimiter   *handlers.RateLimiter
+
+	// alerts is nil when no alerting rule is defined
+	alerts *services.AlertEngine
+
+	// anomalies is nil when anomaly detection is disabled
+	anomalies *services.AnomalyDetector
+
+	// collectors are the metrics of the components, by registration name
+	collectors map[string]metrics.Collector
 }
 
 func main() {
-	// Initialize the logger
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	configPath := flag.String("config", "", "path to the configuration file (default: "+config.DefaultPath+", skipped if missing)")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with the secrets redacted, then exit")
+	validateConfig := flag.Bool("validate-config", false, "report every problem of the configuration, then exit (status 1 when invalid)")
+	hashAPIKey := flag.Bool("hash-api-key", false, "print the hash of the API key read from the standard input, for auth.keys, then exit")
+	flag.Parse()
+
+	if *hashAPIKey {
+		os.Exit(printAPIKeyHash())
+	}
+
+	if *validateConfig {
+		os.Exit(reportConfig(*configPath))
+	}
 
-	logger.Info("Starting application")
+	// Initialize the logger
+	// The records emitted for a request or a job run carry its request_id or job_id
+	logger := slog.New(logging.NewContextHandler(slog.NewTextHandler(os.Stdout, nil)))
 
-	// Load the config
+	// Load the config: built-in defaults, overridden by the config file, overridden by the USA_* environment variables
 	var cfg config.Config
-	err := config.Load(&cfg)
+	err := config.Load(&cfg, *configPath)
 	if err != nil {
 		logger.Error("Failed to load config", "err", err.Error())
 		os.Exit(1)
 	}
 
+	if *printConfig {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "\t")
+		if err := encoder.Encode(cfg.Redacted()); err != nil {
+			logger.Error("Failed to print config", "err", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	logger.Info("Starting application", "version", version)
+
 	// Create and initialize the application
-	app := New(&cfg, logger)
+	app, err := New(&cfg, *configPath, logger)
+	if err != nil {
+		logger.Error("Failed to create application", "err", err.Error())
+		os.Exit(1)
+	}
 
 	// Run the application
 	if err := app.Run(); err != nil {
@@ -40,3 +136,45 @@ func main() {
 
 	logger.Info("Application stopped successfully")
 }
+
+// reportConfig loads the configuration and prints every problem found, one field per line.
+// Returns the exit status: 0 when the configuration is valid, 1 otherwise.
+func reportConfig(configPath string) int {
+	var cfg config.Config
+	err := config.Load(&cfg, configPath)
+	if err == nil {
+		fmt.Println("Config is valid")
+		return 0
+	}
+
+	var validationErr *config.ValidationError
+	if !errors.As(err, &validationErr) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Config is invalid, %d problems found:\n", len(validationErr.Errors))
+	for _, fieldErr := range validationErr.Errors {
+		fmt.Fprintf(os.Stderr, "  %s\n", fieldErr)
+	}
+	return 1
+}
+
+// printAPIKeyHash reads an API key from the standard input and prints its hash, so that the key itself is never written in the configuration.
+// Returns the exit status.
+func printAPIKeyHash() int {
+	key, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	key = strings.TrimSpace(key)
+	if key == "" {
+		fmt.Fprintln(os.Stderr, "no API key read from the standard input")
+		return 1
+	}
+
+	fmt.Println(handlers.HashAPIKey(key))
+	return 0
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/handlers"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/metrics"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/services"
+)
+
+// appMetrics holds the registry exposed on '/metrics' and the metrics outliving the reloads of the configuration
+type appMetrics struct {
+	registry          *metrics.Registry
+	requests          *handlers.RequestMetrics
+	analysisDurations *metrics.Histogram
+}
+
+// newAppMetrics creates the registry with the request metrics, the analysis durations, the concurrency limiter and the upstream probe
+func newAppMetrics(limiter *services.ConcurrencyLimiter, probe *services.UpstreamProbe) *appMetrics {
+	m := &appMetrics{
+		registry:          metrics.NewRegistry(),
+		requests:          handlers.NewRequestMetrics(),
+		analysisDurations: services.NewAnalysisDurations(),
+	}
+
+	m.registry.Register("http", m.requests)
+	m.registry.Register("analysis_durations", m.analysisDurations)
+	m.registry.Register("limiter", limiter)
+	m.registry.Register("probe", probe)
+
+	return m
+}
+
+// registerGeneration replaces the metrics of the components of the previous generation (nil on start) by those of the next one.
+// The counters of the components rebuilt by a reload start over, which Prometheus handles as a counter reset.
+func (m *appMetrics) registerGeneration(previous, next *generation) {
+	if previous != nil {
+		for name := range previous.collectors {
+			m.registry.Unregister(name)
+		}
+	}
+	for name, collector := range next.collectors {
+		m.registry.Register(name, collector)
+	}
+}
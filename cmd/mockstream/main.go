@@ -0,0 +1,118 @@
+// Command mockstream serves a synthetic Upfluence-like SSE feed for local development and load testing.
+//
+// Usage:
+//
+//	go run ./cmd/mockstream -addr localhost:8081 -rate 50 -malformed 0.01 -dist likes=uniform:0:1000
+//
+// Point the analyzer at it by setting "stream.url" to "http://localhost:8081/stream".
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/testutil"
+)
+
+// distributionFlags collects repeated -dist flags
+type distributionFlags map[string]testutil.Distribution
+
+func (d distributionFlags) String() string {
+	specs := make([]string, 0, len(d))
+	for dimension, dist := range d {
+		specs = append(specs, fmt.Sprintf("%s=%s:%v:%v", dimension, dist.Kind, dist.A, dist.B))
+	}
+	return strings.Join(specs, ",")
+}
+
+func (d distributionFlags) Set(spec string) error {
+	dimension, dist, err := testutil.ParseDistribution(spec)
+	if err != nil {
+		return err
+	}
+	d[dimension] = dist
+	return nil
+}
+
+func main() {
+	distributions := distributionFlags{}
+
+	addr := flag.String("addr", "localhost:8081", "address to listen on")
+	rate := flag.Float64("rate", 20, "events per second on each connection (0 = as fast as possible)")
+	types := flag.String("types", "", "comma-separated post types to emit (default: all)")
+	malformed := flag.Float64("malformed", 0, "ratio of malformed events, between 0 and 1")
+	disconnectAfter := flag.Int("disconnect-after", 0, "close each connection after this many events (0 = never)")
+	keepAlive := flag.Duration("keepalive", 15*time.Second, "interval between keep-alive comments (0 = disabled)")
+	seed := flag.Uint64("seed", 0, "random seed for reproducible feeds (0 = random)")
+	flag.Var(distributions, "dist", "dimension distribution as dimension=kind:a[:b], repeatable (kinds: constant, uniform, normal, lognormal)")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	opts := testutil.MockStreamOptions{
+		GeneratorOptions: testutil.GeneratorOptions{
+			Distributions:  distributions,
+			MalformedRatio: *malformed,
+			Seed:           *seed,
+		},
+		Rate:              *rate,
+		DisconnectAfter:   *disconnectAfter,
+		KeepAliveInterval: *keepAlive,
+	}
+
+	if *types != "" {
+		opts.PostTypes = strings.Split(*types, ",")
+	}
+
+	stream, err := testutil.NewMockStream(opts)
+	if err != nil {
+		logger.Error("Invalid mock stream options", "err", err.Error())
+		os.Exit(2)
+	}
+
+	// Serve the feed on '/stream' and expose counters on '/stats'
+	mux := http.NewServeMux()
+	mux.Handle("GET /stream", stream)
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stream.Stats())
+	})
+
+	server := &http.Server{
+		Addr:    *addr,
+		Handler: mux,
+	}
+
+	go func() {
+		signalCh := make(chan os.Signal, 1)
+		signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
+		<-signalCh
+
+		// Open streams never end on their own, give them a short grace period only
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			server.Close()
+		}
+	}()
+
+	logger.Info("Mock stream listening", "address", *addr, "rate", *rate, "malformed", *malformed, "disconnect_after", *disconnectAfter)
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("Mock stream server failed", "err", err.Error())
+		os.Exit(1)
+	}
+
+	logger.Info("Mock stream stopped", "events", stream.Stats().Events)
+}
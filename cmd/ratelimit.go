@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/config"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/handlers"
+)
+
+// newClientResolver builds the client resolver trusting the X-Forwarded-For header of the configured proxies
+func newClientResolver(cfg *config.RateLimitConfig) (*handlers.ClientResolver, error) {
+	trusted := make([]netip.Prefix, 0, len(cfg.TrustedProxies))
+	for _, proxy := range cfg.TrustedProxies {
+		prefix, err := config.ParseTrustedProxy(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		trusted = append(trusted, prefix)
+	}
+	return handlers.NewClientResolver(trusted), nil
+}
+
+// newRateLimiter builds the rate limiter of the routes defined in the configuration.
+// Returns nil when no route is defined.
+func newRateLimiter(cfg *config.RateLimitConfig, logger *slog.Logger) *handlers.RateLimiter {
+	if len(cfg.Routes) == 0 {
+		return nil
+	}
+
+	routes := make([]handlers.RateLimitRoute, 0, len(cfg.Routes))
+	for _, routeCfg := range cfg.Routes {
+		routes = append(routes, handlers.RateLimitRoute{
+			Path:              routeCfg.Path,
+			RequestsPerMinute: routeCfg.RequestsPerMinute,
+			Burst:             routeCfg.Burst,
+		})
+	}
+	return handlers.NewRateLimiter(routes, logger)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/config"
+)
+
+// configWatchInterval is how often the configuration file is checked for changes
+const configWatchInterval = 5 * time.Second
+
+// watchConfig reloads the configuration on SIGHUP or when the configuration file changes, until the context is done.
+// A valid configuration replaces the current generation, whose background services are then stopped with stopGeneration.
+// An invalid one is logged and never applied.
+func (app *application) watchConfig(ctx context.Context, stopGeneration context.CancelFunc) {
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGHUP)
+	defer signal.Stop(signalCh)
+
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+
+	path := cmp.Or(app.configPath, config.DefaultPath)
+	version := configFileVersion(path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			stopGeneration()
+			return
+		case sig := <-signalCh:
+			app.logger.Info("Reload signal received", "signal", sig.String())
+
+			// The file is read now, do not reload it again when the watcher sees the change
+			version = configFileVersion(path)
+		case <-ticker.C:
+			current := configFileVersion(path)
+			if current == version {
+				continue
+			}
+			version = current
+			app.logger.Info("Config file changed", "path", path)
+		}
+
+		gen, err := app.reloadConfig()
+		if err != nil {
+			app.logger.Error("Config reload rejected, keeping the current config", "err", err.Error())
+			continue
+		}
+
+		// Start the new generation before stopping the old one, so that the archive misses no post (compaction drops the duplicates).
+		// The requests in progress finish on the old generation, whose stream connection closes with its last reader.
+		genCtx, stop := context.WithCancel(ctx)
+		gen.start(ctx, genCtx)
+		app.limiter.SetLimits(concurrencyLimits(&gen.config.Analysis))
+		previous := app.generation.Swap(gen)
+		app.metrics.registerGeneration(previous, gen)
+		app.probe.Configure(gen.stream, gen.config.Stream.Probe.Interval.Duration, gen.config.Stream.Probe.Timeout.Duration)
+		stopGeneration()
+		stopGeneration = stop
+
+		app.logger.Info("Config reloaded")
+	}
+}
+
+// reloadConfig loads and validates the configuration, and builds its generation on top of the stores and the state of the current generation.
+// The server, history and archive settings, the maximum analysis duration and the queue timeout (which the write timeout derives from) require a restart, their changes are ignored.
+func (app *application) reloadConfig() (*generation, error) {
+	var cfg config.Config
+	if err := config.Load(&cfg, app.configPath); err != nil {
+		return nil, err
+	}
+
+	previous := app.generation.Load()
+	current := previous.config
+	if ignored := restartSettings(current, &cfg); len(ignored) > 0 {
+		app.logger.Warn("Config changes ignored until restart", "settings", ignored)
+		cfg.Server, cfg.History, cfg.Archive = current.Server, current.History, current.Archive
+		cfg.Analysis.MaxDuration, cfg.Analysis.QueueTimeout = current.Analysis.MaxDuration, current.Analysis.QueueTimeout
+	}
+
+	return newGeneration(&cfg, previous, app.history, app.archive, app.limiter, app.probe, app.lifecycle, app.metrics, app.logger)
+}
+
+// restartSettings returns the sections changed between the configurations that cannot be reloaded
+func restartSettings(current, next *config.Config) []string {
+	var changed []string
+	if current.Server != next.Server {
+		changed = append(changed, "server")
+	}
+	if current.History != next.History {
+		changed = append(changed, "history")
+	}
+	if current.Archive != next.Archive {
+		changed = append(changed, "archive")
+	}
+	if current.Analysis.MaxDuration != next.Analysis.MaxDuration {
+		changed = append(changed, "analysis.max_duration")
+	}
+	if current.Analysis.QueueTimeout != next.Analysis.QueueTimeout {
+		changed = append(changed, "analysis.queue_timeout")
+	}
+	return changed
+}
+
+// configFileVersion identifies the content of the configuration file by its modification time and size (zero when missing)
+func configFileVersion(path string) [2]int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return [2]int64{}
+	}
+	return [2]int64{info.ModTime().UnixNano(), info.Size()}
+}
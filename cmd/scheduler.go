@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/config"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/cron"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/services"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/store"
+)
+
+// webhookSinkTimeout bounds the delivery of the job results to a webhook sink
+const webhookSinkTimeout = 10 * time.Second
+
+// newScheduler builds the scheduler of the jobs defined in the configuration.
+// The history may be nil when the history store is disabled.
+func newScheduler(cfg *config.SchedulerConfig, stream services.StreamService, history store.HistoryStore, logger *slog.Logger) (*services.Scheduler, error) {
+	jobs := make([]services.Job, 0, len(cfg.Jobs))
+
+	for _, jobCfg := range cfg.Jobs {
+		job := services.Job{
+			Name:       jobCfg.Name,
+			Duration:   jobCfg.Duration.Duration,
+			Dimensions: jobCfg.Dimensions,
+			PostTypes:  jobCfg.Filters.PostTypes,
+			Paused:     jobCfg.Paused,
+		}
+
+		if jobCfg.Cron != "" {
+			schedule, err := cron.Parse(jobCfg.Cron)
+			if err != nil {
+				return nil, fmt.Errorf("invalid job %q cron: %w", jobCfg.Name, err)
+			}
+			job.Schedule = schedule
+		} else {
+			job.Schedule = services.IntervalSchedule(jobCfg.Interval.Duration)
+		}
+
+		switch jobCfg.Sink.Type {
+		case "log":
+			job.Sink = services.NewLogSink(logger)
+		case "file":
+			job.Sink = services.NewFileSink(jobCfg.Sink.Path)
+		case "webhook":
+			job.Sink = services.NewWebhookSink(jobCfg.Sink.URL, &http.Client{Timeout: webhookSinkTimeout})
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return services.NewScheduler(stream, history, jobs, logger), nil
+}
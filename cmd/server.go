@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -14,32 +16,344 @@ import (
 
 	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/config"
 	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/handlers"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/metrics"
 	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/services"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/store"
 )
 
-// New creates and initializes a new application instance with all dependencies
-func New(cfg *config.Config, logger *slog.Logger) *application {
+const (
+	// historyPruneInterval is how often the retention policy of the history is applied
+	historyPruneInterval = time.Hour
+
+	// archiveMaintenanceInterval is how often the post archive is compacted and pruned
+	archiveMaintenanceInterval = time.Hour
+
+	// writeTimeoutMargin is added to the maximum analysis duration and queue wait when the write timeout is derived from them
+	writeTimeoutMargin = 30 * time.Second
+)
+
+// New creates and initializes a new application instance with all dependencies.
+// The configuration is reloaded from configPath (the default path when empty).
+func New(cfg *config.Config, configPath string, logger *slog.Logger) (*application, error) {
+	var err error
+
+	// The stores outlive the reloads of the configuration, their settings require a restart
+	// Save every completed analysis in the history when enabled
+	var history *store.FileHistory
+	if cfg.History.Path != "" {
+		retention := store.Retention{
+			MaxAge:     cfg.History.Retention.MaxAge.Duration,
+			MaxRecords: cfg.History.Retention.MaxRecords,
+		}
+		history, err = store.OpenFileHistory(cfg.History.Path, retention, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open analysis history: %w", err)
+		}
+	}
+
+	// Archive every parsed post when enabled, so that past time ranges can be analyzed without waiting
+	var archive *store.FileArchive
+	if cfg.Archive.Dir != "" {
+		retention := store.ArchiveRetention{
+			MaxAge:   cfg.Archive.Retention.MaxAge.Duration,
+			MaxBytes: cfg.Archive.Retention.MaxBytes,
+		}
+		archive, err = store.OpenFileArchive(cfg.Archive.Dir, cfg.Archive.SegmentDuration.Duration, retention, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open post archive: %w", err)
+		}
+	}
+
+	// The concurrency limiter also outlives the reloads, so that the analyses in progress keep counting against the new limits
+	limiter := services.NewConcurrencyLimiter(concurrencyLimits(&cfg.Analysis), logger)
+
+	// The upstream probe and the lifecycle outlive the reloads as well, so that the readiness does not flap while the new stream is probed
+	probe := services.NewUpstreamProbe(logger)
+	lifecycle := handlers.NewLifecycle(version)
+
+	// The metrics outlive the reloads too, so that the counters of the requests and of the analyses are not reset
+	appMetrics := newAppMetrics(limiter, probe)
+
+	gen, err := newGeneration(cfg, nil, history, archive, limiter, probe, lifecycle, appMetrics, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	app := &application{
+		configPath: configPath,
+		logger:     logger,
+		history:    history,
+		archive:    archive,
+		limiter:    limiter,
+		metrics:    appMetrics,
+		probe:      probe,
+		lifecycle:  lifecycle,
+	}
+	app.generation.Store(gen)
+	appMetrics.registerGeneration(nil, gen)
+	probe.Configure(gen.stream, cfg.Stream.Probe.Interval.Duration, cfg.Stream.Probe.Timeout.Duration)
+
+	// The response of an analysis is written once it ends, derive the write timeout from the longest analysis allowed after the longest wait in the queue
+	writeTimeout := cfg.Server.WriteTimeout.Duration
+	if writeTimeout == 0 {
+		writeTimeout = cfg.Analysis.MaxDuration.Duration + cfg.Analysis.QueueTimeout.Duration + writeTimeoutMargin
+	}
+
+	tlsConfig, err := newServerTLSConfig(&cfg.Server.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure TLS: %w", err)
+	}
+
+	// Configure HTTP server.
+	// Every request is served by the generation current when it arrives, and finishes on it even if the configuration is reloaded meanwhile.
+	app.server = &http.Server{
+		Addr: cfg.GetServerAddress(),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			app.generation.Load().handler.ServeHTTP(w, r)
+		}),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout.Duration,
+		ReadTimeout:       cfg.Server.ReadTimeout.Duration,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout.Duration,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+		TLSConfig:         tlsConfig,
+	}
+
+	return app, nil
+}
+
+// newServerTLSConfig builds the TLS settings verifying the client certificates against the client CA when set.
+// Returns nil when the server is not configured for mutual TLS, the certificate itself is loaded when the server starts.
+func newServerTLSConfig(cfg *config.ServerTLSConfig) (*tls.Config, error) {
+	if cfg.ClientCAFile == "" {
+		return nil, nil
+	}
+
+	pem, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA: %w", err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in client CA %s", cfg.ClientCAFile)
+	}
+
+	// Require a client certificate unless it is optional
+	clientAuth := tls.RequireAndVerifyClientCert
+	if cfg.ClientAuth == "optional" {
+		clientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientCAs:  clientCAs,
+		ClientAuth: clientAuth,
+	}, nil
+}
+
+// concurrencyLimits returns the concurrency limits of the analyses from the configuration
+func concurrencyLimits(cfg *config.AnalysisConfig) services.ConcurrencyLimits {
+	return services.ConcurrencyLimits{
+		MaxConcurrent:          cfg.MaxConcurrent,
+		MaxConcurrentPerClient: cfg.MaxConcurrentPerClient,
+		QueueSize:              cfg.QueueSize,
+		QueueTimeout:           cfg.QueueTimeout.Duration,
+	}
+}
+
+// newGeneration builds the services and the handlers of a configuration on top of the stores, the concurrency limiter, the upstream probe, the lifecycle and the metrics.
+// The state of the scheduled jobs, of the API keys and of the rate limits is carried over from the previous generation (nil on start).
+// The history and the archive may be nil when disabled.
+// The metrics of the components are registered once the generation is in use, see appMetrics.registerGeneration.
+func newGeneration(cfg *config.Config, previous *generation, history *store.FileHistory, archive *store.FileArchive, limiter *services.ConcurrencyLimiter, probe *services.UpstreamProbe, lifecycle *handlers.Lifecycle, appMetrics *appMetrics, logger *slog.Logger) (*generation, error) {
 	// Initialize services with dependency injection
-	streamClient := services.NewStreamClient(cfg.GetStreamURL(), logger)
-	streamAnalyzer := services.NewStreamAnalyzer(streamClient, logger)
-	streamAnalysisHandler := handlers.NewStreamAnalysisHandler(streamAnalyzer, logger)
+	streamClient, err := newStreamService(cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stream client: %w", err)
+	}
+
+	// Wrap the stream client in a circuit breaker when enabled, so that analyses fail fast while the stream is down
+	var analyzedStream services.StreamService = streamClient
+	var breaker services.BreakerReporter
+	if cfg.Stream.Breaker.FailureThreshold > 0 {
+		circuitBreaker := services.NewCircuitBreaker(streamClient, cfg.Stream.Breaker.FailureThreshold, cfg.Stream.Breaker.OpenTimeout.Duration, logger)
+		analyzedStream = circuitBreaker
+		breaker = circuitBreaker
+	}
+
+	// Share a single stream connection between the analyses, the archiver, the scheduled jobs, the alerts and the anomaly detection
+	hub := services.NewStreamHub(analyzedStream, logger)
+
+	var streamAnalyzer services.AnalyzerService = services.NewInstrumentedAnalyzer(services.NewStreamAnalyzer(hub, logger), appMetrics.analysisDurations)
+
+	// Save every completed analysis in the history when enabled
+	var historyStore store.HistoryStore
+	if history != nil {
+		historyStore = history
+		streamAnalyzer = services.NewRecordingAnalyzer(streamAnalyzer, history, services.SourceAPI, logger)
+	}
+
+	// Archive every parsed post when enabled
+	var archiver *services.PostArchiver
+	var rangeAnalyzer services.RangeAnalyzerService
+	if archive != nil {
+		archiver = services.NewPostArchiver(hub, archive, logger)
+		rangeAnalyzer = services.NewArchiveAnalyzer(archive, logger)
+	}
+
+	scheduler, err := newScheduler(&cfg.Scheduler, hub, historyStore, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scheduler: %w", err)
+	}
+
+	// Evaluate the alerting rules continuously when defined
+	webhooks := newWebhooks(&cfg.Alerting, logger)
+	alertEngine := newAlertEngine(&cfg.Alerting, hub, webhooks, logger)
+	var alerts services.AlertReporter
+	if alertEngine != nil {
+		alerts = alertEngine
+	}
+
+	// Detect anomalies continuously when enabled, and report them in the analysis results
+	anomalyDetector := newAnomalyDetector(&cfg.Anomalies, hub, webhooks, logger)
+	var anomalies services.AnomalyReporter
+	if anomalyDetector != nil {
+		anomalies = anomalyDetector
+		streamAnalyzer = services.NewAnomalyAnalyzer(streamAnalyzer, anomalyDetector)
+		if rangeAnalyzer != nil {
+			rangeAnalyzer = services.NewAnomalyRangeAnalyzer(rangeAnalyzer, anomalyDetector)
+		}
+	}
+
+	// Identify the clients behind the trusted proxies, and limit their request rate when routes are defined
+	clientResolver, err := newClientResolver(&cfg.RateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client resolver: %w", err)
+	}
+	rateLimiter := newRateLimiter(&cfg.RateLimit, logger)
+
+	// Require an API key when keys are defined
+	authenticator, err := newAuthenticator(&cfg.Auth, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authenticator: %w", err)
+	}
+	var keys handlers.KeyReporter
+	if authenticator != nil {
+		keys = authenticator
+	}
+
+	streamAnalysisHandler := handlers.NewStreamAnalysisHandler(streamAnalyzer, rangeAnalyzer, limiter, cfg.Analysis.MinDuration.Duration, cfg.Analysis.MaxDuration.Duration, logger)
+	compareHandler := handlers.NewCompareHandler(rangeAnalyzer, historyStore, logger)
+	historyHandler := handlers.NewHistoryHandler(historyStore, logger)
+	anomalyHandler := handlers.NewAnomalyHandler(anomalies, logger)
+	healthHandler := handlers.NewHealthHandler(streamClient, probe, limiter, lifecycle, logger)
+	adminHandler := handlers.NewAdminHandler(breaker, scheduler, alerts, limiter, keys, logger)
+	metricsHandler := handlers.NewMetricsHandler(appMetrics.registry, logger)
 
 	// Setup HTTP router.
-	// Accept only HTTP GET requests for the '/analysis' endpoint.
+	// Accept only HTTP GET requests for the '/analysis', '/analysis/compare', '/analyses/history', '/anomalies', '/health/stream', '/healthz', '/readyz', '/status', '/metrics' and '/admin/...' endpoints,
+	// and HTTP POST requests for the job actions, which need an API key scoped to '/admin' and are rejected with a 403 response when the API is open.
 	// Return a 404 response for all other routes.
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /analysis", streamAnalysisHandler.HandleAnalysis)
+	mux.HandleFunc("GET /analysis/compare", compareHandler.HandleCompare)
+	mux.HandleFunc("GET /analyses/history", historyHandler.HandleHistory)
+	mux.HandleFunc("GET /anomalies", anomalyHandler.HandleAnomalies)
+	mux.HandleFunc("GET /health/stream", healthHandler.HandleStreamHealth)
+	mux.HandleFunc("GET /healthz", healthHandler.HandleLiveness)
+	mux.HandleFunc("GET /readyz", healthHandler.HandleReadiness)
+	mux.HandleFunc("GET /status", healthHandler.HandleStatus)
+	mux.HandleFunc("GET /metrics", metricsHandler.HandleMetrics)
+	mux.HandleFunc("GET /admin/breaker", adminHandler.HandleBreaker)
+	mux.HandleFunc("GET /admin/alerts", adminHandler.HandleAlerts)
+	mux.HandleFunc("GET /admin/analyses", adminHandler.HandleAnalyses)
+	mux.HandleFunc("GET /admin/keys", adminHandler.HandleKeys)
+	mux.HandleFunc("GET /admin/jobs", adminHandler.HandleJobs)
+	mux.HandleFunc("GET /admin/jobs/{name}", adminHandler.HandleJob)
+	pauseJob, resumeJob, triggerJob := adminHandler.HandlePauseJob, adminHandler.HandleResumeJob, adminHandler.HandleTriggerJob
+	if authenticator == nil {
+		pauseJob, resumeJob, triggerJob = adminHandler.HandleAdminKeyRequired, adminHandler.HandleAdminKeyRequired, adminHandler.HandleAdminKeyRequired
+	}
+	mux.HandleFunc("POST /admin/jobs/{name}/pause", pauseJob)
+	mux.HandleFunc("POST /admin/jobs/{name}/resume", resumeJob)
+	mux.HandleFunc("POST /admin/jobs/{name}/trigger", triggerJob)
+
+	// Identify and measure the request, identify the client, then authenticate the request and limit its rate (per API key, or per IP address when the API is open), before routing it
+	var handler http.Handler = mux
+	if rateLimiter != nil {
+		handler = rateLimiter.Middleware(handler)
+	}
+	if authenticator != nil {
+		handler = authenticator.Middleware(handler)
+	}
+	handler = clientResolver.Middleware(handler)
+	handler = appMetrics.requests.Middleware(mux, handler)
+	handler = handlers.RequestIDMiddleware(handler)
 
-	// Configure HTTP server
-	server := &http.Server{
-		Addr:    cfg.GetServerAddress(),
-		Handler: mux,
+	// The stream client and the hub are always measured, the authenticator and the rate limiter when enabled
+	collectors := map[string]metrics.Collector{
+		"stream": streamClient,
+		"hub":    hub,
+	}
+	if authenticator != nil {
+		collectors["auth"] = authenticator
+	}
+	if rateLimiter != nil {
+		collectors["rate_limit"] = rateLimiter
 	}
 
-	return &application{
-		config: cfg,
-		logger: logger,
-		server: server,
+	// Keep the paused jobs paused, the quotas and the rates of the clients, the alert states and the anomaly baselines where they were
+	if previous != nil {
+		scheduler.Inherit(previous.scheduler)
+		if authenticator != nil && previous.authenticator != nil {
+			authenticator.Inherit(previous.authenticator)
+		}
+		if rateLimiter != nil && previous.rateLimiter != nil {
+			rateLimiter.Inherit(previous.rateLimiter)
+		}
+		if alertEngine != nil && previous.alerts != nil {
+			alertEngine.Inherit(previous.alerts)
+		}
+		if anomalyDetector != nil && previous.anomalies != nil {
+			anomalyDetector.Inherit(previous.anomalies)
+		}
+	}
+
+	return &generation{
+		config:        cfg,
+		handler:       handler,
+		stream:        hub,
+		archiver:      archiver,
+		scheduler:     scheduler,
+		authenticator: authenticator,
+		rateLimiter:   rateLimiter,
+		alerts:        alertEngine,
+		anomalies:     anomalyDetector,
+		collectors:    collectors,
+	}, nil
+}
+
+// start runs the background services of the generation until the context is done.
+// The runs of the scheduled jobs in progress then finish, unless the server context is done as well.
+func (gen *generation) start(serverCtx, ctx context.Context) {
+	// Archive the stream in the background
+	if gen.archiver != nil {
+		go gen.archiver.Run(ctx)
+	}
+
+	// Run the scheduled jobs in the background, a reload only stops scheduling them
+	go gen.scheduler.Run(serverCtx)
+	context.AfterFunc(ctx, gen.scheduler.Stop)
+
+	// Evaluate the alerting rules in the background
+	if gen.alerts != nil {
+		go gen.alerts.Run(ctx)
+	}
+
+	// Detect anomalies in the background
+	if gen.anomalies != nil {
+		go gen.anomalies.Run(ctx)
 	}
 }
 
@@ -48,8 +362,9 @@ func New(cfg *config.Config, logger *slog.Logger) *application {
 func (app *application) Run() error {
 	// Create a context that will be cancelled when shutdown is initiated.
 	// This context is used as the BaseContext for the HTTP server.
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Its cause tells the interrupted analyses apart from those abandoned by their client.
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
 
 	// Set BaseContext for graceful shutdown propagation.
 	// This is called for each incoming request to create the request's context.
@@ -58,6 +373,25 @@ func (app *application) Run() error {
 		return ctx
 	}
 
+	// Apply the history retention policy in the background, and close the history once the server is stopped
+	if app.history != nil {
+		go app.history.RunRetention(ctx, historyPruneInterval)
+		defer app.history.Close()
+	}
+
+	// Maintain the archive in the background
+	if app.archive != nil {
+		go app.archive.RunMaintenance(ctx, archiveMaintenanceInterval)
+	}
+
+	// Probe the upstream stream in the background, the readiness depends on it
+	go app.probe.Run(ctx)
+
+	// Run the background services of the current generation, and replace them when the configuration is reloaded
+	genCtx, stopGeneration := context.WithCancel(ctx)
+	app.generation.Load().start(ctx, genCtx)
+	go app.watchConfig(ctx, stopGeneration)
+
 	// Channel to communicate shutdown errors from the shutdown goroutine
 	shutdownErrCh := make(chan error)
 
@@ -71,11 +405,27 @@ func (app *application) Run() error {
 		sig := <-signalCh
 		app.logger.Info("Shutdown signal received", "signal", sig.String())
 
+		// Report not ready right away, and keep serving for the drain delay so that the load balancers stop sending traffic first.
+		// The server settings require a restart, the current generation holds those the server started with.
+		app.lifecycle.Drain()
+		serverCfg := app.generation.Load().config.Server
+		if drainDelay := serverCfg.DrainDelay.Duration; drainDelay > 0 {
+			app.logger.Info("Draining traffic before shutting down", "drain_delay", drainDelay.String())
+
+			// A second signal skips the rest of the delay
+			select {
+			case <-time.After(drainDelay):
+			case sig := <-signalCh:
+				app.logger.Info("Second shutdown signal received, skipping the drain delay", "signal", sig.String())
+			}
+		}
+
 		// Cancel the base context (this signals all active requests that shutdown is happening)
-		cancel()
+		cancel(services.ErrShuttingDown)
 
 		// Create a context with timeout for the shutdown process itself
-		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		shutdownTimeout := serverCfg.ShutdownTimeout.Duration
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
 		defer shutdownCancel()
 
 		// Attempt graceful shutdown
@@ -90,11 +440,17 @@ func (app *application) Run() error {
 		shutdownErrCh <- nil
 	}()
 
-	// Start the server (this blocks until the server is shut down)
-	app.logger.Info("HTTP server starting", "address", app.config.GetServerAddress())
-	err := app.server.ListenAndServe()
+	// Start the server over TLS when a certificate is configured (this blocks until the server is shut down)
+	tlsCfg := app.generation.Load().config.Server.TLS
+	app.logger.Info("HTTP server starting", "address", app.server.Addr, "tls", tlsCfg.CertFile != "")
+	var err error
+	if tlsCfg.CertFile != "" {
+		err = app.server.ListenAndServeTLS(tlsCfg.CertFile, tlsCfg.KeyFile)
+	} else {
+		err = app.server.ListenAndServe()
+	}
 
-	// ListenAndServe always returns an error.
+	// ListenAndServe and ListenAndServeTLS always return an error.
 	// After Shutdown or Close, the error is ErrServerClosed.
 	// This is expected and not an error condition.
 	if !errors.Is(err, http.ErrServerClosed) {
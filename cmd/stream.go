@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/config"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/metrics"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/services"
+)
+
+// streamService is a stream source that also reports the health of its connections
+type streamService interface {
+	services.StreamService
+	services.HealthReporter
+	metrics.Collector
+}
+
+// newStreamService selects the stream service implementation based on the stream URL scheme.
+// WebSocket URLs (ws, wss) use the WebSocket client, anything else uses the SSE client.
+func newStreamService(cfg *config.Config, logger *slog.Logger) (streamService, error) {
+	websocket := cfg.IsWebSocketStream()
+
+	httpClient, err := newStreamHTTPClient(&cfg.Stream, websocket)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := streamHeaders(&cfg.Stream)
+
+	if websocket {
+		return services.NewWebSocketClient(
+			cfg.GetStreamURL(),
+			logger,
+			services.WithWebSocketHTTPClient(httpClient),
+			services.WithWebSocketHeaders(headers),
+		), nil
+	}
+
+	return services.NewStreamClient(
+		cfg.GetStreamURL(),
+		logger,
+		services.WithHTTPClient(httpClient),
+		services.WithHeaders(headers),
+		services.WithStallDetection(cfg.Stream.StallTimeout.Duration, cfg.Stream.StallAction == "reconnect"),
+	), nil
+}
+
+// newStreamHTTPClient builds the HTTP client of the stream services from the stream configuration.
+// Only the connection establishment is bounded: the client has no overall timeout since the stream never ends.
+func newStreamHTTPClient(cfg *config.StreamConfig, websocket bool) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stream proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if cfg.Timeouts.Dial.Duration > 0 {
+		dialer := &net.Dialer{
+			Timeout:   cfg.Timeouts.Dial.Duration,
+			KeepAlive: 30 * time.Second,
+		}
+		transport.DialContext = dialer.DialContext
+	}
+
+	if cfg.Timeouts.TLSHandshake.Duration > 0 {
+		transport.TLSHandshakeTimeout = cfg.Timeouts.TLSHandshake.Duration
+	}
+
+	transport.ResponseHeaderTimeout = cfg.Timeouts.ResponseHeader.Duration
+
+	tlsConfig, err := newStreamTLSConfig(&cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if websocket {
+		services.DisableHTTP2(transport)
+	}
+
+	return &http.Client{Timeout: 0, Transport: transport}, nil
+}
+
+// newStreamTLSConfig loads the additional CAs and the client certificate of the stream connection
+func newStreamTLSConfig(cfg *config.StreamTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CAFile != "" {
+		// Additional CAs are trusted on top of the system ones
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		caBytes, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stream ca file: %w", err)
+		}
+
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("failed to parse stream ca file: no PEM certificate found")
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load stream client certificate: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// streamHeaders builds the headers sent with every stream request (authentication, User-Agent, custom headers)
+func streamHeaders(cfg *config.StreamConfig) http.Header {
+	headers := http.Header{}
+
+	for name, value := range cfg.Headers {
+		headers.Set(name, value)
+	}
+
+	if cfg.UserAgent != "" {
+		headers.Set("User-Agent", cfg.UserAgent)
+	}
+
+	switch cfg.Auth.Type {
+	case "bearer":
+		headers.Set("Authorization", "Bearer "+cfg.Auth.Token)
+	case "basic":
+		credentials := base64.StdEncoding.EncodeToString([]byte(cfg.Auth.Username + ":" + cfg.Auth.Password))
+		headers.Set("Authorization", "Basic "+credentials)
+	}
+
+	return headers
+}
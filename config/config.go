@@ -2,42 +2,477 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
+	"net/netip"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Stream StreamConfig `json:"stream"`
-	Server ServerConfig `json:"server"`
+	Stream    StreamConfig    `json:"stream"`
+	Server    ServerConfig    `json:"server"`
+	Analysis  AnalysisConfig  `json:"analysis"`
+	Auth      AuthConfig      `json:"auth"`
+	RateLimit RateLimitConfig `json:"rate_limit"`
+	History   HistoryConfig   `json:"history"`
+	Archive   ArchiveConfig   `json:"archive"`
+	Scheduler SchedulerConfig `json:"scheduler"`
+	Alerting  AlertingConfig  `json:"alerting"`
+	Anomalies AnomaliesConfig `json:"anomalies"`
 }
 
 type StreamConfig struct {
 	URL string `json:"url"`
+
+	// StallTimeout is the idle time after which a silent connection is considered stalled (disabled when zero)
+	StallTimeout Duration `json:"stall_timeout"`
+
+	// StallAction is what happens on a stall: "error" (default) ends the stream, "reconnect" opens a new connection
+	StallAction string `json:"stall_action"`
+
+	// Proxy is the URL of the HTTP(S) or SOCKS5 proxy used to reach the stream (environment proxy when empty)
+	Proxy string `json:"proxy"`
+
+	// TLS configures the trusted CAs and the client certificate
+	TLS StreamTLSConfig `json:"tls"`
+
+	// Auth configures the authentication sent with every stream request
+	Auth StreamAuthConfig `json:"auth"`
+
+	// UserAgent overrides the User-Agent header
+	UserAgent string `json:"user_agent"`
+
+	// Headers are additional headers sent with every stream request
+	Headers map[string]string `json:"headers"`
+
+	// Timeouts bound the establishment of the connection only, reading the stream stays unbounded
+	Timeouts StreamTimeoutsConfig `json:"timeouts"`
+
+	// Breaker configures the circuit breaker failing fast while the stream is unreachable
+	Breaker BreakerConfig `json:"breaker"`
+
+	// Probe configures the periodic check that the stream is reachable, reported by /readyz
+	Probe ProbeConfig `json:"probe"`
+}
+
+type StreamTLSConfig struct {
+	// CAFile is a PEM bundle of additional trusted certificate authorities
+	CAFile string `json:"ca_file"`
+
+	// CertFile and KeyFile are the PEM client certificate and private key (mutual TLS)
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+}
+
+type StreamAuthConfig struct {
+	// Type is one of: bearer, basic (no authentication when empty)
+	Type string `json:"type"`
+
+	// Token is the bearer token
+	Token string `json:"token"`
+
+	// Username and Password are the basic authentication credentials
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type StreamTimeoutsConfig struct {
+	// Dial bounds the TCP connection establishment (default: 30s)
+	Dial Duration `json:"dial"`
+
+	// TLSHandshake bounds the TLS handshake (default: 10s)
+	TLSHandshake Duration `json:"tls_handshake"`
+
+	// ResponseHeader bounds the wait for the response headers once the request is sent (unbounded when zero)
+	ResponseHeader Duration `json:"response_header"`
+}
+
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive connection failures opening the breaker (disabled when zero)
+	FailureThreshold int `json:"failure_threshold"`
+
+	// OpenTimeout is how long the breaker stays open before letting a probe through
+	OpenTimeout Duration `json:"open_timeout"`
+}
+
+type ProbeConfig struct {
+	// Interval is the time between two probes (default: 30s, disabled when zero: the readiness ignores the stream)
+	Interval Duration `json:"interval"`
+
+	// Timeout bounds the connection of a probe (default: 5s)
+	Timeout Duration `json:"timeout"`
+}
+
+type HistoryConfig struct {
+	// Path is the JSONL file the completed analyses are saved to (history disabled when empty)
+	Path string `json:"path"`
+
+	// Retention bounds the size of the history
+	Retention HistoryRetentionConfig `json:"retention"`
+}
+
+type HistoryRetentionConfig struct {
+	// MaxAge drops the analyses completed longer ago than this (no bound when zero)
+	MaxAge Duration `json:"max_age"`
+
+	// MaxRecords keeps only the most recent analyses (no bound when zero)
+	MaxRecords int `json:"max_records"`
+}
+
+type ArchiveConfig struct {
+	// Dir is the directory the parsed posts are archived to (archive disabled when empty)
+	Dir string `json:"dir"`
+
+	// SegmentDuration is the span of post timestamps covered by a segment file (default: 1h)
+	SegmentDuration Duration `json:"segment_duration"`
+
+	// Retention bounds the size of the archive
+	Retention ArchiveRetentionConfig `json:"retention"`
+}
+
+type ArchiveRetentionConfig struct {
+	// MaxAge drops the posts whose timestamp is older than this (no bound when zero)
+	MaxAge Duration `json:"max_age"`
+
+	// MaxBytes drops the oldest segments once the archive grows larger than this (no bound when zero)
+	MaxBytes int64 `json:"max_bytes"`
+}
+
+type SchedulerConfig struct {
+	// Jobs are the analyses run in the background
+	Jobs []JobConfig `json:"jobs"`
+}
+
+type JobConfig struct {
+	// Name identifies the job in the admin endpoints and in the history
+	Name string `json:"name"`
+
+	// Interval or Cron (5-field expression, exactly one of them) sets when the job runs
+	Interval Duration `json:"interval"`
+	Cron     string   `json:"cron"`
+
+	// Duration is how long the stream is analyzed at every run
+	Duration Duration `json:"duration"`
+
+	// Dimensions are analyzed together on the same posts
+	Dimensions []string `json:"dimensions"`
+
+	// Filters restrict the analyzed posts
+	Filters JobFiltersConfig `json:"filters"`
+
+	// Sink receives the results of every run, on top of the history
+	Sink JobSinkConfig `json:"sink"`
+
+	// Paused jobs skip their scheduled runs until resumed
+	Paused bool `json:"paused"`
+}
+
+type JobFiltersConfig struct {
+	// PostTypes keeps only the posts of these types, e.g. "tweet" (all posts when empty)
+	PostTypes []string `json:"post_types"`
+}
+
+type JobSinkConfig struct {
+	// Type is one of: log, file, webhook (history only when empty)
+	Type string `json:"type"`
+
+	// Path is the JSONL file of the file sink
+	Path string `json:"path"`
+
+	// URL is the endpoint of the webhook sink
+	URL string `json:"url"`
+}
+
+type AlertingConfig struct {
+	// EvaluationInterval is how often the rules are evaluated (default: 10s)
+	EvaluationInterval Duration `json:"evaluation_interval"`
+
+	// Webhooks are the notification targets, referenced by name in the rules
+	Webhooks []WebhookConfig `json:"webhooks"`
+
+	// Rules are evaluated continuously against the recent posts (alerting disabled when empty)
+	Rules []AlertRuleConfig `json:"rules"`
+}
+
+type WebhookConfig struct {
+	// Name identifies the webhook in the rules
+	Name string `json:"name"`
+
+	// URL is the endpoint the notifications are posted to
+	URL string `json:"url"`
+
+	// Secret signs the notifications with HMAC-SHA256 (unsigned when empty)
+	Secret string `json:"secret"`
+
+	// MaxRetries is the number of retries of a failed delivery
+	MaxRetries int `json:"max_retries"`
+
+	// Timeout bounds every delivery attempt (default: 10s)
+	Timeout Duration `json:"timeout"`
+}
+
+type AlertRuleConfig struct {
+	// Name identifies the rule in the notifications
+	Name string `json:"name"`
+
+	// Metric is "total_posts" or "avg_<dimension>", e.g. "avg_retweets"
+	Metric string `json:"metric"`
+
+	// Condition is one of: threshold, rate_of_change (change in percent from the previous window), absence
+	Condition string `json:"condition"`
+
+	// Operator (>, >=, <, <=) and Value define the threshold of the threshold and rate_of_change conditions
+	Operator string  `json:"operator"`
+	Value    float64 `json:"value"`
+
+	// Window is the span of the recent posts the metric is computed on
+	Window Duration `json:"window"`
+
+	// Cooldown is the minimum delay between two firing notifications of the rule
+	Cooldown Duration `json:"cooldown"`
+
+	// Hysteresis is how far back past the threshold the value must go for the rule to resolve
+	Hysteresis float64 `json:"hysteresis"`
+
+	// Webhooks are the names of the webhooks notified by the rule
+	Webhooks []string `json:"webhooks"`
+}
+
+type AuthConfig struct {
+	// Header carries the API key of the requests (default: X-API-Key)
+	Header string `json:"header"`
+
+	// Keys are the accepted API keys, the API requires a key once one is defined here or in the keys file
+	Keys []APIKeyConfig `json:"keys"`
+
+	// KeysFile is a JSON file of more API keys, {"keys": [...]}, so that they can be managed apart from the configuration
+	KeysFile string `json:"keys_file"`
+
+	// PublicEndpoints are the path prefixes served without API key (default: /health, /healthz and /readyz)
+	PublicEndpoints []string `json:"public_endpoints"`
+}
+
+type APIKeyConfig struct {
+	// Name identifies the key in the logs and the admin endpoints
+	Name string `json:"name"`
+
+	// Hash is the SHA-256 of the key, "sha256:" followed by 64 hexadecimal digits (see -hash-api-key)
+	Hash string `json:"hash"`
+
+	// Endpoints are the path prefixes the key may call, e.g. "/analysis" or "/admin" (all when empty)
+	Endpoints []string `json:"endpoints"`
+
+	// MaxDuration bounds the analyses of the key, below analysis.max_duration (no additional bound when zero)
+	MaxDuration Duration `json:"max_duration"`
+
+	// RequestsPerMinute bounds the request rate of the key (unlimited when zero)
+	RequestsPerMinute int `json:"requests_per_minute"`
+
+	// Burst is the number of requests allowed at once (default: requests_per_minute)
+	Burst int `json:"burst"`
+
+	// MaxConcurrent bounds the requests of the key in progress (unlimited when zero)
+	MaxConcurrent int `json:"max_concurrent"`
+}
+
+// KeysFile is the content of the API keys file
+type KeysFile struct {
+	Keys []APIKeyConfig `json:"keys"`
+}
+
+type RateLimitConfig struct {
+	// Routes are the request rates allowed per client on path prefixes, the longest matching prefix applies (unlimited when none matches)
+	Routes []RateLimitRouteConfig `json:"routes"`
+
+	// TrustedProxies are the IP addresses or CIDR ranges of the reverse proxies whose X-Forwarded-For header identifies the clients
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+type RateLimitRouteConfig struct {
+	// Path is the prefix of the limited paths, e.g. "/analysis" (which includes "/analysis/compare"), or "/" for every path
+	Path string `json:"path"`
+
+	// RequestsPerMinute bounds the request rate of every client on the route
+	RequestsPerMinute int `json:"requests_per_minute"`
+
+	// Burst is the number of requests allowed at once (default: requests_per_minute)
+	Burst int `json:"burst"`
+}
+
+type AnomaliesConfig struct {
+	// Enabled turns the anomaly detection on
+	Enabled bool `json:"enabled"`
+
+	// Method is the baseline of the series: ewma (default) or mad (median and median absolute deviation)
+	Method string `json:"method"`
+
+	// Bucket is the span of the time buckets the series are made of (default: 1m)
+	Bucket Duration `json:"bucket"`
+
+	// ZScoreLimit flags the buckets whose absolute z-score is greater (default: 3)
+	ZScoreLimit float64 `json:"z_score_limit"`
+
+	// Alpha is the smoothing factor of the ewma baseline, in (0, 1] (default: 0.3)
+	Alpha float64 `json:"alpha"`
+
+	// Window is the number of recent buckets of the mad baseline (default: 30)
+	Window int `json:"window"`
+
+	// MinBuckets is the number of buckets a series needs before its buckets are scored (default: 10)
+	MinBuckets int `json:"min_buckets"`
+
+	// MinPosts is the number of posts carrying the dimension a bucket needs to be scored (default: 5)
+	MinPosts int `json:"min_posts"`
+
+	// Webhooks are the names of the alerting webhooks notified of every anomaly
+	Webhooks []string `json:"webhooks"`
 }
 
 type ServerConfig struct {
 	Host string `json:"host"`
 	Port int    `json:"port"`
+
+	// ReadHeaderTimeout bounds the reading of the request headers (default: 10s)
+	ReadHeaderTimeout Duration `json:"read_header_timeout"`
+
+	// ReadTimeout bounds the reading of the whole request (default: 30s)
+	ReadTimeout Duration `json:"read_timeout"`
+
+	// WriteTimeout bounds the handling of a request, it must leave time for the longest analysis (default: analysis.max_duration plus 30s)
+	WriteTimeout Duration `json:"write_timeout"`
+
+	// IdleTimeout bounds the wait for the next request on a keep-alive connection (default: 2m)
+	IdleTimeout Duration `json:"idle_timeout"`
+
+	// MaxHeaderBytes bounds the size of the request headers (default: 1 MB)
+	MaxHeaderBytes int `json:"max_header_bytes"`
+
+	// DrainDelay is how long the server keeps serving after the shutdown signal, with /readyz failing,
+	// so that the load balancers stop sending traffic before the shutdown starts (default: 5s)
+	DrainDelay Duration `json:"drain_delay"`
+
+	// ShutdownTimeout is how long the requests in progress get to complete on shutdown (default: 10s)
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+
+	// TLS serves the API over HTTPS when a certificate is set
+	TLS ServerTLSConfig `json:"tls"`
 }
 
-func Load(cfg *Config) error {
-	// Open the configuration file
-	cfgFile, err := os.Open("./config/config.json")
-	if err != nil {
-		return fmt.Errorf("failed to open config: %w", err)
+type ServerTLSConfig struct {
+	// CertFile and KeyFile are the PEM server certificate and private key (HTTP when empty)
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+
+	// ClientCAFile is a PEM bundle of the certificate authorities the client certificates are verified against (mutual TLS)
+	ClientCAFile string `json:"client_ca_file"`
+
+	// ClientAuth is one of: require (default with a client CA), optional (verified only when presented)
+	ClientAuth string `json:"client_auth"`
+}
+
+type AnalysisConfig struct {
+	// MaxDuration bounds the live analyses, including those only limited by max_posts (default: 1h)
+	MaxDuration Duration `json:"max_duration"`
+
+	// MinDuration is the shortest duration accepted (default: 1s)
+	MinDuration Duration `json:"min_duration"`
+
+	// MaxConcurrent bounds the analyses running at the same time (default: 100, unlimited when 0)
+	MaxConcurrent int `json:"max_concurrent"`
+
+	// MaxConcurrentPerClient bounds the analyses running or queued per client, by API key or IP address (default: 10, unlimited when 0)
+	MaxConcurrentPerClient int `json:"max_concurrent_per_client"`
+
+	// QueueSize bounds the analyses waiting for a slot once max_concurrent is reached (default: 0, rejected right away)
+	QueueSize int `json:"queue_size"`
+
+	// QueueTimeout bounds the wait of a queued analysis (default: 30s)
+	QueueTimeout Duration `json:"queue_timeout"`
+}
+
+const (
+	// DefaultPath is the configuration file loaded when no path is given, it may be missing
+	DefaultPath = "./config/config.json"
+
+	// redacted replaces the secrets in the printed configuration
+	redacted = "REDACTED"
+)
+
+// Default returns the built-in configuration, overridden by the configuration file and the environment
+func Default() Config {
+	return Config{
+		Stream: StreamConfig{
+			URL: "https://stream.upfluence.co/stream",
+			Probe: ProbeConfig{
+				Interval: Duration{30 * time.Second},
+				Timeout:  Duration{5 * time.Second},
+			},
+		},
+		Server: ServerConfig{
+			Host:              "localhost",
+			Port:              8080,
+			ReadHeaderTimeout: Duration{10 * time.Second},
+			ReadTimeout:       Duration{30 * time.Second},
+			IdleTimeout:       Duration{2 * time.Minute},
+			MaxHeaderBytes:    1 << 20,
+			DrainDelay:        Duration{5 * time.Second},
+			ShutdownTimeout:   Duration{10 * time.Second},
+		},
+		Analysis: AnalysisConfig{
+			MaxDuration:            Duration{time.Hour},
+			MinDuration:            Duration{time.Second},
+			MaxConcurrent:          100,
+			MaxConcurrentPerClient: 10,
+			QueueTimeout:           Duration{30 * time.Second},
+		},
+		Auth: AuthConfig{
+			Header:          "X-API-Key",
+			PublicEndpoints: []string{"/health", "/healthz", "/readyz"},
+		},
 	}
-	defer cfgFile.Close()
+}
 
-	// Read the configuration file
-	cfgBytes, err := io.ReadAll(cfgFile)
-	if err != nil {
-		return fmt.Errorf("failed to read config: %w", err)
+// Load builds the configuration from, by increasing precedence:
+//  1. the built-in defaults
+//  2. the configuration file at path (DefaultPath when empty, skipped if missing)
+//  3. the USA_* environment variables, e.g. USA_SERVER_PORT
+//
+// The merged configuration is validated.
+func Load(cfg *Config, path string) error {
+	*cfg = Default()
+
+	// A missing file is only an error when its path was given
+	optional := path == ""
+	if optional {
+		path = DefaultPath
 	}
 
-	// Unmarshal the configuration into the cfg struct
-	if err = json.Unmarshal(cfgBytes, &cfg); err != nil {
-		return fmt.Errorf("failed to unmarshal config: %w", err)
+	// Open the configuration file
+	cfgFile, err := os.Open(path)
+	switch {
+	case err == nil:
+		defer cfgFile.Close()
+
+		// Unmarshal the configuration into the cfg struct, over the defaults.
+		// Unknown fields are rejected, they are most likely misspelled settings.
+		decoder := json.NewDecoder(cfgFile)
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(cfg); err != nil {
+			return fmt.Errorf("failed to unmarshal config: %w", err)
+		}
+	case optional && errors.Is(err, fs.ErrNotExist):
+	default:
+		return fmt.Errorf("failed to open config: %w", err)
+	}
+
+	// Override the configuration with the environment variables
+	if err := applyEnv(cfg, os.LookupEnv); err != nil {
+		return fmt.Errorf("failed to apply environment: %w", err)
 	}
 
 	// Validate the configuration
@@ -48,6 +483,59 @@ func Load(cfg *Config) error {
 	return nil
 }
 
+// Redacted returns a copy of the configuration with the secrets replaced, safe to print or log
+func (c Config) Redacted() Config {
+	if c.Stream.Auth.Token != "" {
+		c.Stream.Auth.Token = redacted
+	}
+	if c.Stream.Auth.Password != "" {
+		c.Stream.Auth.Password = redacted
+	}
+
+	// The proxy URL may carry credentials
+	if proxyURL, err := url.Parse(c.Stream.Proxy); err == nil && proxyURL.User != nil {
+		if _, ok := proxyURL.User.Password(); ok {
+			proxyURL.User = url.UserPassword(proxyURL.User.Username(), redacted)
+			c.Stream.Proxy = proxyURL.String()
+		}
+	}
+
+	// Copy the webhooks rather than changing the ones of the configuration
+	webhooks := slices.Clone(c.Alerting.Webhooks)
+	for i := range webhooks {
+		if webhooks[i].Secret != "" {
+			webhooks[i].Secret = redacted
+		}
+	}
+	c.Alerting.Webhooks = webhooks
+
+	// The hashes of short keys could be brute-forced
+	keys := slices.Clone(c.Auth.Keys)
+	for i := range keys {
+		keys[i].Hash = redacted
+	}
+	c.Auth.Keys = keys
+
+	return c
+}
+
+// ReadKeysFile reads the API keys of the keys file
+func ReadKeysFile(path string) ([]APIKeyConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open keys file: %w", err)
+	}
+	defer file.Close()
+
+	var keysFile KeysFile
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&keysFile); err != nil {
+		return nil, fmt.Errorf("failed to parse keys file: %w", err)
+	}
+	return keysFile.Keys, nil
+}
+
 // GetServerAddress returns the HTTP server address in host:port format
 func (c *Config) GetServerAddress() string {
 	return fmt.Sprintf("%s:%d", c.Server.Host, c.Server.Port)
@@ -57,3 +545,24 @@ func (c *Config) GetServerAddress() string {
 func (c *Config) GetStreamURL() string {
 	return c.Stream.URL
 }
+
+// IsWebSocketStream reports whether the stream URL uses a WebSocket scheme (ws or wss)
+func (c *Config) IsWebSocketStream() bool {
+	u := strings.ToLower(c.Stream.URL)
+	return strings.HasPrefix(u, "ws://") || strings.HasPrefix(u, "wss://")
+}
+
+// ParseTrustedProxy parses a trusted proxy, an IP address or a CIDR range, into a range
+func ParseTrustedProxy(proxy string) (netip.Prefix, error) {
+	if strings.Contains(proxy, "/") {
+		prefix, err := netip.ParsePrefix(proxy)
+		return prefix.Masked(), err
+	}
+
+	addr, err := netip.ParseAddr(proxy)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
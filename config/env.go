@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix prefixes the environment variables overriding the configuration
+const EnvPrefix = "USA_"
+
+// durationType is the type of the duration fields, set from duration strings such as "30s"
+var durationType = reflect.TypeFor[Duration]()
+
+// applyEnv overrides the configuration fields with the environment variables named after their JSON path,
+// e.g. USA_SERVER_PORT for server.port and USA_STREAM_TIMEOUTS_DIAL for stream.timeouts.dial.
+// Lists of strings are comma-separated. Lists of objects (jobs, webhooks, rules) and maps are only set in the file.
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	return applyEnvStruct(reflect.ValueOf(cfg).Elem(), strings.TrimSuffix(EnvPrefix, "_"), lookup)
+}
+
+// applyEnvStruct overrides the fields of a configuration struct, recursively
+func applyEnvStruct(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+
+		fieldValue := v.Field(i)
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			if err := applyEnvStruct(fieldValue, name, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setEnvValue(fieldValue, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// setEnvValue parses an environment variable into a configuration field
+func setEnvValue(v reflect.Value, value string) error {
+	if v.Type() == durationType {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(Duration{parsed}))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(parsed)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(parsed)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("only set in the configuration file")
+		}
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("only set in the configuration file")
+	}
+
+	return nil
+}
@@ -1,43 +1,626 @@
 package config
 
-import "fmt"
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
-// Validate validates the entire configuration
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/cron"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// namePattern restricts job, webhook and rule names to characters safe in URL paths
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// hostnamePattern matches the DNS names (RFC 1123 labels separated by dots)
+var hostnamePattern = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// headerNamePattern matches the HTTP header names (RFC 9110 tokens)
+var headerNamePattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// apiKeyHashPattern matches the SHA-256 hashes of the API keys
+var apiKeyHashPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// FieldError is a problem of a configuration field, identified by its JSON path, e.g. "scheduler.jobs[0].cron"
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError collects every problem of a configuration
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d invalid fields: %s", len(e.Errors), strings.Join(messages, "; "))
+}
+
+// Unwrap returns the field errors, so that errors.As finds them
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// validator collects the field errors of a configuration
+type validator struct {
+	errs []*FieldError
+}
+
+// addf records a problem of the field at path
+func (v *validator) addf(path string, format string, args ...any) {
+	v.errs = append(v.errs, &FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// nonNegative records a negative duration
+func (v *validator) nonNegative(path string, d Duration) {
+	if d.Duration < 0 {
+		v.addf(path, "must not be negative, got %s", d)
+	}
+}
+
+// absoluteURL records a value that is not an absolute URL of one of the schemes
+func (v *validator) absoluteURL(path string, value string, schemes ...string) {
+	if value == "" {
+		v.addf(path, "is empty")
+		return
+	}
+
+	u, err := url.Parse(value)
+	if err != nil {
+		v.addf(path, "invalid url: %v", err)
+		return
+	}
+	if !slices.Contains(schemes, u.Scheme) {
+		v.addf(path, "scheme must be %s, got %q", orList(schemes), u.Scheme)
+	}
+	if u.Host == "" {
+		v.addf(path, "host is empty")
+	} else if !validHost(u.Hostname()) {
+		v.addf(path, "invalid host %q", u.Hostname())
+	}
+}
+
+// orList formats the allowed values of a field, e.g. "http or https"
+func orList(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return strings.Join(values[:len(values)-1], ", ") + " or " + values[len(values)-1]
+}
+
+// validHost reports whether the host is an IP address or a DNS name
+func validHost(host string) bool {
+	return net.ParseIP(host) != nil || (len(host) <= 253 && hostnamePattern.MatchString(host))
+}
+
+// Validate validates the entire configuration.
+// Every problem is reported, in a *ValidationError.
 func (c *Config) Validate() error {
-	checks := []func(*Config) error{
+	checks := []func(*Config, *validator){
 		validateStreamConfig,
+		validateStreamTransportConfig,
+		validateBreakerConfig,
+		validateProbeConfig,
 		validateServerConfig,
+		validateAnalysisConfig,
+		validateAuthConfig,
+		validateRateLimitConfig,
+		validateHistoryConfig,
+		validateArchiveConfig,
+		validateSchedulerConfig,
+		validateAlertingConfig,
+		validateAnomaliesConfig,
 	}
 
+	v := &validator{}
 	for _, check := range checks {
-		if err := check(c); err != nil {
-			return err
-		}
+		check(c, v)
 	}
 
+	if len(v.errs) > 0 {
+		return &ValidationError{Errors: v.errs}
+	}
 	return nil
 }
 
-func validateStreamConfig(cfg *Config) error {
-	if cfg.Stream == (StreamConfig{}) {
-		return fmt.Errorf("stream config is empty")
+func validateStreamConfig(cfg *Config, v *validator) {
+	v.absoluteURL("stream.url", cfg.Stream.URL, "http", "https", "ws", "wss")
+
+	v.nonNegative("stream.stall_timeout", cfg.Stream.StallTimeout)
+
+	switch cfg.Stream.StallAction {
+	case "", "error", "reconnect":
+	default:
+		v.addf("stream.stall_action", "must be one of: error, reconnect, got %q", cfg.Stream.StallAction)
+	}
+}
+
+func validateStreamTransportConfig(cfg *Config, v *validator) {
+	stream := cfg.Stream
+
+	if stream.Proxy != "" {
+		v.absoluteURL("stream.proxy", stream.Proxy, "http", "https", "socks5")
 	}
 
-	return nil
+	// Certificate files must exist, they are loaded when the application starts
+	files := []struct{ path, file string }{
+		{"stream.tls.ca_file", stream.TLS.CAFile},
+		{"stream.tls.cert_file", stream.TLS.CertFile},
+		{"stream.tls.key_file", stream.TLS.KeyFile},
+	}
+	for _, f := range files {
+		if f.file == "" {
+			continue
+		}
+		if _, err := os.Stat(f.file); err != nil {
+			v.addf(f.path, "%v", err)
+		}
+	}
+
+	if (stream.TLS.CertFile == "") != (stream.TLS.KeyFile == "") {
+		v.addf("stream.tls", "cert_file and key_file must be set together")
+	}
+
+	switch stream.Auth.Type {
+	case "":
+	case "bearer":
+		if stream.Auth.Token == "" {
+			v.addf("stream.auth.token", "is empty")
+		}
+	case "basic":
+		if stream.Auth.Username == "" {
+			v.addf("stream.auth.username", "is empty")
+		}
+	default:
+		v.addf("stream.auth.type", "must be one of: bearer, basic, got %q", stream.Auth.Type)
+	}
+
+	// Report the headers in a stable order
+	names := make([]string, 0, len(stream.Headers))
+	for name := range stream.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := fmt.Sprintf("stream.headers[%q]", name)
+		if !headerNamePattern.MatchString(name) {
+			v.addf(path, "invalid header name")
+		}
+		if strings.ContainsAny(stream.Headers[name], "\r\n") {
+			v.addf(path, "value must not contain line breaks")
+		}
+	}
+
+	if strings.ContainsAny(stream.UserAgent, "\r\n") {
+		v.addf("stream.user_agent", "must not contain line breaks")
+	}
+
+	v.nonNegative("stream.timeouts.dial", stream.Timeouts.Dial)
+	v.nonNegative("stream.timeouts.tls_handshake", stream.Timeouts.TLSHandshake)
+	v.nonNegative("stream.timeouts.response_header", stream.Timeouts.ResponseHeader)
+}
+
+func validateBreakerConfig(cfg *Config, v *validator) {
+	breaker := cfg.Stream.Breaker
+
+	if breaker.FailureThreshold < 0 {
+		v.addf("stream.breaker.failure_threshold", "must not be negative, got %d", breaker.FailureThreshold)
+	}
+
+	if breaker.FailureThreshold > 0 && breaker.OpenTimeout.Duration <= 0 {
+		v.addf("stream.breaker.open_timeout", "must be positive when the breaker is enabled, got %s", breaker.OpenTimeout)
+	}
 }
 
-func validateServerConfig(cfg *Config) error {
-	if cfg.Server == (ServerConfig{}) {
-		return fmt.Errorf("server config is empty")
+func validateProbeConfig(cfg *Config, v *validator) {
+	probe := cfg.Stream.Probe
+
+	v.nonNegative("stream.probe.interval", probe.Interval)
+	if probe.Interval.Duration > 0 && probe.Timeout.Duration <= 0 {
+		v.addf("stream.probe.timeout", "must be positive when the probe is enabled, got %s", probe.Timeout)
 	}
+}
+
+func validateServerConfig(cfg *Config, v *validator) {
+	server := cfg.Server
 
-	if cfg.Server.Host == "" {
-		return fmt.Errorf("server host is empty")
+	if server.Host == "" {
+		v.addf("server.host", "is empty")
+	} else if !validHost(server.Host) {
+		v.addf("server.host", "must be an IP address or a host name, got %q", server.Host)
 	}
 
-	if cfg.Server.Port < 1 || cfg.Server.Port > 65535 {
-		return fmt.Errorf("invalid server port, must be between 1 and 65535, got %d", cfg.Server.Port)
+	if server.Port < 1 || server.Port > 65535 {
+		v.addf("server.port", "must be between 1 and 65535, got %d", server.Port)
 	}
 
-	return nil
+	v.nonNegative("server.read_header_timeout", server.ReadHeaderTimeout)
+	v.nonNegative("server.read_timeout", server.ReadTimeout)
+	v.nonNegative("server.idle_timeout", server.IdleTimeout)
+
+	// The response of an analysis is written once it ends, possibly after waiting in the queue: a shorter write timeout would cut it
+	v.nonNegative("server.write_timeout", server.WriteTimeout)
+	longest := cfg.Analysis.MaxDuration.Duration + cfg.Analysis.QueueTimeout.Duration
+	if server.WriteTimeout.Duration > 0 && server.WriteTimeout.Duration <= longest {
+		v.addf("server.write_timeout", "must be greater than analysis.max_duration plus analysis.queue_timeout (%s), got %s", longest, server.WriteTimeout)
+	}
+
+	if server.MaxHeaderBytes < 0 {
+		v.addf("server.max_header_bytes", "must not be negative, got %d", server.MaxHeaderBytes)
+	}
+
+	v.nonNegative("server.drain_delay", server.DrainDelay)
+
+	if server.ShutdownTimeout.Duration <= 0 {
+		v.addf("server.shutdown_timeout", "must be positive, got %s", server.ShutdownTimeout)
+	}
+
+	// Certificate files must exist, they are loaded when the server starts
+	tlsCfg := server.TLS
+	files := []struct{ path, file string }{
+		{"server.tls.cert_file", tlsCfg.CertFile},
+		{"server.tls.key_file", tlsCfg.KeyFile},
+		{"server.tls.client_ca_file", tlsCfg.ClientCAFile},
+	}
+	for _, f := range files {
+		if f.file == "" {
+			continue
+		}
+		if _, err := os.Stat(f.file); err != nil {
+			v.addf(f.path, "%v", err)
+		}
+	}
+
+	if (tlsCfg.CertFile == "") != (tlsCfg.KeyFile == "") {
+		v.addf("server.tls", "cert_file and key_file must be set together")
+	}
+	if tlsCfg.ClientCAFile != "" && tlsCfg.CertFile == "" {
+		v.addf("server.tls.client_ca_file", "requires cert_file and key_file, client certificates are only verified over TLS")
+	}
+
+	switch tlsCfg.ClientAuth {
+	case "":
+	case "require", "optional":
+		if tlsCfg.ClientCAFile == "" {
+			v.addf("server.tls.client_auth", "requires client_ca_file")
+		}
+	default:
+		v.addf("server.tls.client_auth", "must be one of: require, optional, got %q", tlsCfg.ClientAuth)
+	}
+}
+
+func validateAnalysisConfig(cfg *Config, v *validator) {
+	analysis := cfg.Analysis
+
+	if analysis.MaxDuration.Duration <= 0 {
+		v.addf("analysis.max_duration", "must be positive, got %s", analysis.MaxDuration)
+	}
+
+	v.nonNegative("analysis.min_duration", analysis.MinDuration)
+	if analysis.MaxDuration.Duration > 0 && analysis.MinDuration.Duration > analysis.MaxDuration.Duration {
+		v.addf("analysis.min_duration", "must not be greater than max_duration (%s), got %s", analysis.MaxDuration, analysis.MinDuration)
+	}
+
+	if analysis.MaxConcurrent < 0 {
+		v.addf("analysis.max_concurrent", "must not be negative, got %d", analysis.MaxConcurrent)
+	}
+
+	if analysis.MaxConcurrentPerClient < 0 {
+		v.addf("analysis.max_concurrent_per_client", "must not be negative, got %d", analysis.MaxConcurrentPerClient)
+	} else if analysis.MaxConcurrent > 0 && analysis.MaxConcurrentPerClient > analysis.MaxConcurrent {
+		v.addf("analysis.max_concurrent_per_client", "must not be greater than max_concurrent (%d), got %d", analysis.MaxConcurrent, analysis.MaxConcurrentPerClient)
+	}
+
+	if analysis.QueueSize < 0 {
+		v.addf("analysis.queue_size", "must not be negative, got %d", analysis.QueueSize)
+	}
+
+	// Queued analyses give up after the timeout, without it they would be rejected right away
+	v.nonNegative("analysis.queue_timeout", analysis.QueueTimeout)
+	if analysis.QueueSize > 0 && analysis.QueueTimeout.Duration == 0 {
+		v.addf("analysis.queue_timeout", "must be positive with a queue")
+	}
+}
+
+func validateAuthConfig(cfg *Config, v *validator) {
+	auth := cfg.Auth
+
+	if !headerNamePattern.MatchString(auth.Header) {
+		v.addf("auth.header", "must be a header name, got %q", auth.Header)
+	}
+
+	for i, endpoint := range auth.PublicEndpoints {
+		if !strings.HasPrefix(endpoint, "/") {
+			v.addf(fmt.Sprintf("auth.public_endpoints[%d]", i), "must be a path starting with '/', got %q", endpoint)
+		}
+	}
+
+	// The names and the hashes are unique across the configuration and the keys file
+	names := make(map[string]bool)
+	hashes := make(map[string]bool)
+	validateKeys := func(prefix string, keys []APIKeyConfig) {
+		for i, key := range keys {
+			path := fmt.Sprintf("%s[%d]", prefix, i)
+
+			if !namePattern.MatchString(key.Name) {
+				v.addf(path+".name", "must only contain letters, digits, '-' and '_', got %q", key.Name)
+			} else if names[key.Name] {
+				v.addf(path+".name", "duplicate key name %q", key.Name)
+			}
+			names[key.Name] = true
+
+			if !apiKeyHashPattern.MatchString(key.Hash) {
+				v.addf(path+".hash", "must be sha256: followed by 64 lowercase hexadecimal digits")
+			} else if hashes[key.Hash] {
+				v.addf(path+".hash", "duplicate key hash")
+			}
+			hashes[key.Hash] = true
+
+			for j, endpoint := range key.Endpoints {
+				if !strings.HasPrefix(endpoint, "/") {
+					v.addf(fmt.Sprintf("%s.endpoints[%d]", path, j), "must be a path starting with '/', got %q", endpoint)
+				}
+			}
+
+			v.nonNegative(path+".max_duration", key.MaxDuration)
+			if key.RequestsPerMinute < 0 {
+				v.addf(path+".requests_per_minute", "must not be negative, got %d", key.RequestsPerMinute)
+			}
+			if key.Burst < 0 {
+				v.addf(path+".burst", "must not be negative, got %d", key.Burst)
+			} else if key.Burst > 0 && key.RequestsPerMinute == 0 {
+				v.addf(path+".burst", "requires requests_per_minute")
+			}
+			if key.MaxConcurrent < 0 {
+				v.addf(path+".max_concurrent", "must not be negative, got %d", key.MaxConcurrent)
+			}
+		}
+	}
+
+	validateKeys("auth.keys", auth.Keys)
+
+	if auth.KeysFile != "" {
+		keys, err := ReadKeysFile(auth.KeysFile)
+		if err != nil {
+			v.addf("auth.keys_file", "%v", err)
+		} else {
+			validateKeys("auth.keys_file.keys", keys)
+		}
+	}
+}
+
+func validateRateLimitConfig(cfg *Config, v *validator) {
+	rateLimit := cfg.RateLimit
+
+	paths := make(map[string]bool)
+	for i, route := range rateLimit.Routes {
+		path := fmt.Sprintf("rate_limit.routes[%d]", i)
+
+		if !strings.HasPrefix(route.Path, "/") {
+			v.addf(path+".path", "must be a path starting with '/', got %q", route.Path)
+		} else if paths[route.Path] {
+			v.addf(path+".path", "duplicate route %q", route.Path)
+		}
+		paths[route.Path] = true
+
+		if route.RequestsPerMinute <= 0 {
+			v.addf(path+".requests_per_minute", "must be positive, got %d", route.RequestsPerMinute)
+		}
+		if route.Burst < 0 {
+			v.addf(path+".burst", "must not be negative, got %d", route.Burst)
+		}
+	}
+
+	for i, proxy := range rateLimit.TrustedProxies {
+		if _, err := ParseTrustedProxy(proxy); err != nil {
+			v.addf(fmt.Sprintf("rate_limit.trusted_proxies[%d]", i), "must be an IP address or a CIDR range, got %q", proxy)
+		}
+	}
+}
+
+func validateHistoryConfig(cfg *Config, v *validator) {
+	retention := cfg.History.Retention
+
+	v.nonNegative("history.retention.max_age", retention.MaxAge)
+
+	if retention.MaxRecords < 0 {
+		v.addf("history.retention.max_records", "must not be negative, got %d", retention.MaxRecords)
+	}
+}
+
+func validateArchiveConfig(cfg *Config, v *validator) {
+	archive := cfg.Archive
+
+	// Segment files are named after whole seconds
+	if archive.SegmentDuration.Duration < 0 || archive.SegmentDuration.Duration%time.Second != 0 {
+		v.addf("archive.segment_duration", "must be a positive whole number of seconds, got %s", archive.SegmentDuration)
+	}
+
+	v.nonNegative("archive.retention.max_age", archive.Retention.MaxAge)
+
+	if archive.Retention.MaxBytes < 0 {
+		v.addf("archive.retention.max_bytes", "must not be negative, got %d", archive.Retention.MaxBytes)
+	}
+}
+
+func validateSchedulerConfig(cfg *Config, v *validator) {
+	names := make(map[string]bool)
+
+	for i, job := range cfg.Scheduler.Jobs {
+		path := fmt.Sprintf("scheduler.jobs[%d]", i)
+
+		if !namePattern.MatchString(job.Name) {
+			v.addf(path+".name", "must only contain letters, digits, '-' and '_', got %q", job.Name)
+		} else if names[job.Name] {
+			v.addf(path+".name", "duplicate job name %q", job.Name)
+		}
+		names[job.Name] = true
+
+		if (job.Interval.Duration == 0) == (job.Cron == "") {
+			v.addf(path, "must set exactly one of interval and cron")
+		}
+		if job.Interval.Duration < 0 {
+			v.addf(path+".interval", "must be positive, got %s", job.Interval)
+		}
+		if job.Cron != "" {
+			if _, err := cron.Parse(job.Cron); err != nil {
+				v.addf(path+".cron", "%v", err)
+			}
+		}
+
+		if job.Duration.Duration <= 0 {
+			v.addf(path+".duration", "must be positive, got %s", job.Duration)
+		}
+
+		if len(job.Dimensions) == 0 {
+			v.addf(path+".dimensions", "is empty")
+		}
+		for j, dimension := range job.Dimensions {
+			if !models.ValidDimensions[dimension] {
+				v.addf(fmt.Sprintf("%s.dimensions[%d]", path, j), "must be one of: likes, comments, favorites, retweets, got %q", dimension)
+			}
+		}
+
+		for j, postType := range job.Filters.PostTypes {
+			if postType == "" {
+				v.addf(fmt.Sprintf("%s.filters.post_types[%d]", path, j), "is empty")
+			}
+		}
+
+		switch job.Sink.Type {
+		case "", "log":
+		case "file":
+			if job.Sink.Path == "" {
+				v.addf(path+".sink.path", "is empty")
+			}
+		case "webhook":
+			v.absoluteURL(path+".sink.url", job.Sink.URL, "http", "https")
+		default:
+			v.addf(path+".sink.type", "must be one of: log, file, webhook, got %q", job.Sink.Type)
+		}
+	}
+}
+
+func validateAlertingConfig(cfg *Config, v *validator) {
+	alerting := cfg.Alerting
+
+	v.nonNegative("alerting.evaluation_interval", alerting.EvaluationInterval)
+
+	webhooks := make(map[string]bool)
+	for i, webhook := range alerting.Webhooks {
+		path := fmt.Sprintf("alerting.webhooks[%d]", i)
+
+		if !namePattern.MatchString(webhook.Name) {
+			v.addf(path+".name", "must only contain letters, digits, '-' and '_', got %q", webhook.Name)
+		} else if webhooks[webhook.Name] {
+			v.addf(path+".name", "duplicate webhook name %q", webhook.Name)
+		}
+		webhooks[webhook.Name] = true
+
+		v.absoluteURL(path+".url", webhook.URL, "http", "https")
+
+		if webhook.MaxRetries < 0 {
+			v.addf(path+".max_retries", "must not be negative, got %d", webhook.MaxRetries)
+		}
+		v.nonNegative(path+".timeout", webhook.Timeout)
+	}
+
+	rules := make(map[string]bool)
+	for i, rule := range alerting.Rules {
+		path := fmt.Sprintf("alerting.rules[%d]", i)
+
+		if !namePattern.MatchString(rule.Name) {
+			v.addf(path+".name", "must only contain letters, digits, '-' and '_', got %q", rule.Name)
+		} else if rules[rule.Name] {
+			v.addf(path+".name", "duplicate rule name %q", rule.Name)
+		}
+		rules[rule.Name] = true
+
+		if !models.ValidAlertMetric(rule.Metric) {
+			v.addf(path+".metric", "must be total_posts or avg_<dimension>, got %q", rule.Metric)
+		}
+
+		switch models.AlertCondition(rule.Condition) {
+		case models.AlertThreshold, models.AlertRateOfChange:
+			if !models.AlertOperators[rule.Operator] {
+				v.addf(path+".operator", "must be one of: >, >=, <, <=, got %q", rule.Operator)
+			}
+		case models.AlertAbsence:
+		default:
+			v.addf(path+".condition", "must be one of: threshold, rate_of_change, absence, got %q", rule.Condition)
+		}
+
+		// The windows are computed with a one second resolution
+		if rule.Window.Duration < time.Second || rule.Window.Duration%time.Second != 0 {
+			v.addf(path+".window", "must be a positive whole number of seconds, got %s", rule.Window)
+		}
+		v.nonNegative(path+".cooldown", rule.Cooldown)
+		if rule.Hysteresis < 0 {
+			v.addf(path+".hysteresis", "must not be negative, got %g", rule.Hysteresis)
+		}
+
+		for j, name := range rule.Webhooks {
+			if !webhooks[name] {
+				v.addf(fmt.Sprintf("%s.webhooks[%d]", path, j), "unknown webhook %q", name)
+			}
+		}
+	}
+}
+
+func validateAnomaliesConfig(cfg *Config, v *validator) {
+	anomalies := cfg.Anomalies
+
+	switch anomalies.Method {
+	case "", models.AnomalyMethodEWMA, models.AnomalyMethodMAD:
+	default:
+		v.addf("anomalies.method", "must be one of: ewma, mad, got %q", anomalies.Method)
+	}
+
+	// The buckets are aligned on whole seconds
+	if anomalies.Bucket.Duration < 0 || anomalies.Bucket.Duration%time.Second != 0 {
+		v.addf("anomalies.bucket", "must be a positive whole number of seconds, got %s", anomalies.Bucket)
+	}
+
+	if anomalies.ZScoreLimit < 0 {
+		v.addf("anomalies.z_score_limit", "must not be negative, got %g", anomalies.ZScoreLimit)
+	}
+
+	if anomalies.Alpha < 0 || anomalies.Alpha > 1 {
+		v.addf("anomalies.alpha", "must be between 0 and 1, got %g", anomalies.Alpha)
+	}
+
+	if anomalies.Window != 0 && anomalies.Window < 3 {
+		v.addf("anomalies.window", "must be at least 3 buckets, got %d", anomalies.Window)
+	}
+
+	if anomalies.MinBuckets < 0 {
+		v.addf("anomalies.min_buckets", "must not be negative, got %d", anomalies.MinBuckets)
+	}
+	if anomalies.MinPosts < 0 {
+		v.addf("anomalies.min_posts", "must not be negative, got %d", anomalies.MinPosts)
+	}
+
+	for i, name := range anomalies.Webhooks {
+		if !slices.ContainsFunc(cfg.Alerting.Webhooks, func(webhook WebhookConfig) bool { return webhook.Name == name }) {
+			v.addf(fmt.Sprintf("anomalies.webhooks[%d]", i), "unknown alerting webhook %q", name)
+		}
+	}
 }
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate_Example(t *testing.T) {
+	// The example configuration is valid as is
+	var cfg Config
+	if err := Load(&cfg, "config.example.json"); err != nil {
+		t.Fatalf("expected the example config to be valid, got %v", err)
+	}
+}
+
+func TestValidate_FieldErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(cfg *Config)
+		expected string
+	}{
+		{"stream url scheme", func(cfg *Config) { cfg.Stream.URL = "ftp://stream.example.com" }, "stream.url: scheme must be http, https, ws or wss"},
+		{"stream url host", func(cfg *Config) { cfg.Stream.URL = "https:///stream" }, "stream.url: host is empty"},
+		{"proxy scheme", func(cfg *Config) { cfg.Stream.Proxy = "ftp://proxy.example.com" }, "stream.proxy: scheme must be http, https or socks5"},
+		{"timeout", func(cfg *Config) { cfg.Stream.Timeouts.TLSHandshake = Duration{-time.Second} }, "stream.timeouts.tls_handshake: must not be negative"},
+		{"auth token", func(cfg *Config) { cfg.Stream.Auth.Type = "bearer" }, "stream.auth.token: is empty"},
+		{"header", func(cfg *Config) { cfg.Stream.Headers = map[string]string{"X-Team": "a\nb"} }, `stream.headers["X-Team"]: value must not contain line breaks`},
+		{"header name", func(cfg *Config) { cfg.Stream.Headers = map[string]string{"X-Team(1)": "a"} }, `stream.headers["X-Team(1)"]: invalid header name`},
+		{"probe timeout", func(cfg *Config) { cfg.Stream.Probe.Timeout = Duration{} }, "stream.probe.timeout: must be positive when the probe is enabled"},
+		{"server host", func(cfg *Config) { cfg.Server.Host = "local host" }, "server.host: must be an IP address or a host name"},
+		{"write timeout", func(cfg *Config) { cfg.Server.WriteTimeout = Duration{time.Minute} }, "server.write_timeout: must be greater than analysis.max_duration plus analysis.queue_timeout (1h0m30s)"},
+		{"drain delay", func(cfg *Config) { cfg.Server.DrainDelay = Duration{-time.Second} }, "server.drain_delay: must not be negative"},
+		{"shutdown timeout", func(cfg *Config) { cfg.Server.ShutdownTimeout = Duration{} }, "server.shutdown_timeout: must be positive"},
+		{"tls key", func(cfg *Config) { cfg.Server.TLS.CertFile = "config.example.json" }, "server.tls: cert_file and key_file must be set together"},
+		{"tls file", func(cfg *Config) {
+			cfg.Server.TLS = ServerTLSConfig{CertFile: "missing.pem", KeyFile: "config.example.json"}
+		}, "server.tls.cert_file: stat missing.pem"},
+		{"tls client auth", func(cfg *Config) { cfg.Server.TLS.ClientAuth = "require" }, "server.tls.client_auth: requires client_ca_file"},
+		{"analysis max duration", func(cfg *Config) { cfg.Analysis.MaxDuration = Duration{} }, "analysis.max_duration: must be positive"},
+		{"analysis min duration", func(cfg *Config) { cfg.Analysis.MinDuration = Duration{2 * time.Hour} }, "analysis.min_duration: must not be greater than max_duration"},
+		{"analysis per client", func(cfg *Config) { cfg.Analysis.MaxConcurrentPerClient = 200 }, "analysis.max_concurrent_per_client: must not be greater than max_concurrent (100)"},
+		{"analysis queue timeout", func(cfg *Config) {
+			cfg.Analysis.QueueSize = 10
+			cfg.Analysis.QueueTimeout = Duration{}
+		}, "analysis.queue_timeout: must be positive with a queue"},
+		{"auth header", func(cfg *Config) { cfg.Auth.Header = "X API Key" }, `auth.header: must be a header name, got "X API Key"`},
+		{"auth key hash", func(cfg *Config) { cfg.Auth.Keys = []APIKeyConfig{{Name: "ops", Hash: "secret"}} }, "auth.keys[0].hash: must be sha256: followed by 64 lowercase hexadecimal digits"},
+		{"auth key endpoint", func(cfg *Config) {
+			cfg.Auth.Keys = []APIKeyConfig{{Name: "ops", Hash: testKeyHash, Endpoints: []string{"admin"}}}
+		}, `auth.keys[0].endpoints[0]: must be a path starting with '/', got "admin"`},
+		{"auth key burst", func(cfg *Config) { cfg.Auth.Keys = []APIKeyConfig{{Name: "ops", Hash: testKeyHash, Burst: 5}} }, "auth.keys[0].burst: requires requests_per_minute"},
+		{"auth keys file", func(cfg *Config) { cfg.Auth.KeysFile = "missing.json" }, "auth.keys_file: failed to open keys file"},
+		{"rate limit rate", func(cfg *Config) { cfg.RateLimit.Routes = []RateLimitRouteConfig{{Path: "/analysis"}} }, "rate_limit.routes[0].requests_per_minute: must be positive, got 0"},
+		{"rate limit route", func(cfg *Config) {
+			cfg.RateLimit.Routes = []RateLimitRouteConfig{{Path: "/", RequestsPerMinute: 60}, {Path: "/", RequestsPerMinute: 10}}
+		}, `rate_limit.routes[1].path: duplicate route "/"`},
+		{"trusted proxy", func(cfg *Config) { cfg.RateLimit.TrustedProxies = []string{"10.0.0.0/8", "proxy.local"} }, `rate_limit.trusted_proxies[1]: must be an IP address or a CIDR range, got "proxy.local"`},
+		{"job dimension", func(cfg *Config) {
+			cfg.Scheduler.Jobs = []JobConfig{{Name: "job", Interval: Duration{time.Minute}, Duration: Duration{time.Second}, Dimensions: []string{"likes", "shares"}}}
+		}, `scheduler.jobs[0].dimensions[1]: must be one of: likes, comments, favorites, retweets, got "shares"`},
+		{"job sink", func(cfg *Config) {
+			cfg.Scheduler.Jobs = []JobConfig{{Name: "job", Interval: Duration{time.Minute}, Duration: Duration{time.Second}, Dimensions: []string{"likes"}, Sink: JobSinkConfig{Type: "file"}}}
+		}, "scheduler.jobs[0].sink.path: is empty"},
+		{"rule webhook", func(cfg *Config) {
+			cfg.Alerting.Rules = []AlertRuleConfig{{Name: "rule", Metric: "total_posts", Condition: "absence", Window: Duration{time.Minute}, Webhooks: []string{"ops"}}}
+		}, `alerting.rules[0].webhooks[0]: unknown webhook "ops"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Default()
+			tc.change(&cfg)
+
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("expected error %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+// testKeyHash is the hash of the API key "key"
+const testKeyHash = "sha256:2c70e12b7a0646f92279f427c7b38e7334d8e5389cff167a1dc30e73f826b683"
+
+func TestValidate_KeysFile(t *testing.T) {
+	path := writeConfigFile(t, `{"keys": [{"name": "ops", "hash": "`+testKeyHash+`"}, {"name": "ops", "hash": "sha256:"}]}`)
+
+	cfg := Default()
+	cfg.Auth.Keys = []APIKeyConfig{{Name: "dashboard", Hash: testKeyHash}}
+	cfg.Auth.KeysFile = path
+
+	// The names and the hashes must be unique across the configuration and the file
+	err := cfg.Validate()
+	for _, expected := range []string{"auth.keys_file.keys[0].hash: duplicate key hash", `auth.keys_file.keys[1].name: duplicate key name "ops"`, "auth.keys_file.keys[1].hash: must be sha256"} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestValidate_AggregatesErrors(t *testing.T) {
+	cfg := Default()
+	cfg.Stream.URL = ""
+	cfg.Server.Port = 0
+	cfg.Anomalies.Alpha = 2
+
+	var validationErr *ValidationError
+	if err := cfg.Validate(); !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+
+	// Every problem is reported, in the order of the configuration
+	var paths []string
+	for _, fieldErr := range validationErr.Errors {
+		paths = append(paths, fieldErr.Path)
+	}
+	if strings.Join(paths, ",") != "stream.url,server.port,anomalies.alpha" {
+		t.Errorf("expected the errors of the three fields, got %v", paths)
+	}
+
+	// Field errors can be matched individually
+	var fieldErr *FieldError
+	if !errors.As(validationErr, &fieldErr) || fieldErr.Path != "stream.url" {
+		t.Errorf("expected to find the first field error, got %v", fieldErr)
+	}
+}
+
+func TestLoad_UnknownField(t *testing.T) {
+	path := writeConfigFile(t, `{"server": {"prot": 8080}}`)
+
+	var cfg Config
+	if err := Load(&cfg, path); err == nil || !strings.Contains(err.Error(), `unknown field "prot"`) {
+		t.Errorf("expected the misspelled field to be rejected, got %v", err)
+	}
+}
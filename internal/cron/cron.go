@@ -0,0 +1,204 @@
+// Package cron parses standard 5-field cron expressions and computes their next activation.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// field describes the range of values of a cron field
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// macros are the supported shorthands for common expressions
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Schedule is a parsed cron expression.
+// Times are matched in the location of the time passed to Next.
+type Schedule struct {
+	expr string
+
+	// One bit per allowed value of each field
+	minute, hour, dom, month, dow uint64
+
+	// A restricted day of month and day of week match when either matches (standard cron behavior)
+	domStar, dowStar bool
+}
+
+// Parse parses a cron expression made of 5 fields: minute, hour, day of month, month and day of week.
+// Each field accepts '*', values, ranges ('1-5'), lists ('1,3,5') and steps ('*/15', '0-30/10').
+// Day of week 7 is an alias of 0 (Sunday). The @hourly, @daily, @weekly, @monthly and @yearly macros are supported.
+func Parse(expr string) (*Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if macro, ok := macros[spec]; ok {
+		spec = macro
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("invalid cron expression %q, expected %d fields, got %d", expr, len(fields), len(parts))
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, part := range parts {
+		b, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+		bits[i] = b
+	}
+
+	// Sunday can be written 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = bits[4]&^(1<<7) | 1
+	}
+
+	return &Schedule{
+		expr:    expr,
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(parts[2], "*"),
+		dowStar: strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+// parseField parses a comma-separated list of ranges into a bit set
+func parseField(part string, f field) (uint64, error) {
+	maxValue := f.max
+	if f.name == "day of week" {
+		maxValue = 7
+	}
+
+	var bits uint64
+	for _, item := range strings.Split(part, ",") {
+		rangeStr, stepStr, hasStep := strings.Cut(item, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid %s step %q", f.name, stepStr)
+			}
+		}
+
+		var low, high int
+		switch {
+		case rangeStr == "*":
+			low, high = f.min, f.max
+
+		case strings.Contains(rangeStr, "-"):
+			lowStr, highStr, _ := strings.Cut(rangeStr, "-")
+			var err error
+			if low, err = parseValue(lowStr, f.min, maxValue, f.name); err != nil {
+				return 0, err
+			}
+			if high, err = parseValue(highStr, f.min, maxValue, f.name); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid %s range %q", f.name, rangeStr)
+			}
+
+		default:
+			value, err := parseValue(rangeStr, f.min, maxValue, f.name)
+			if err != nil {
+				return 0, err
+			}
+			low, high = value, value
+			// 'value/step' means from value to the end of the range
+			if hasStep {
+				high = f.max
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
+
+// parseValue parses a single value of a field
+func parseValue(s string, minValue, maxValue int, name string) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < minValue || v > maxValue {
+		return 0, fmt.Errorf("invalid %s %q, must be between %d and %d", name, s, minValue, maxValue)
+	}
+	return v, nil
+}
+
+// String returns the cron expression
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Next returns the first activation strictly after t, or the zero time if there is none within 5 years
+func (s *Schedule) Next(t time.Time) time.Time {
+	// Start at the next whole minute
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// dayMatches reports whether the day of t matches the day of month and day of week fields
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case s.domStar && s.dowStar:
+		return true
+	case s.domStar:
+		return dowMatch
+	case s.dowStar:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
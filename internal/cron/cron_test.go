@@ -0,0 +1,135 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name               string
+		expr               string
+		expectedErrMessage string
+	}{
+		{
+			name:               "too few fields",
+			expr:               "* * * *",
+			expectedErrMessage: "expected 5 fields, got 4",
+		},
+		{
+			name:               "value out of range",
+			expr:               "60 * * * *",
+			expectedErrMessage: "invalid minute \"60\"",
+		},
+		{
+			name:               "reversed range",
+			expr:               "* 10-2 * * *",
+			expectedErrMessage: "invalid hour range",
+		},
+		{
+			name:               "invalid step",
+			expr:               "*/0 * * * *",
+			expectedErrMessage: "invalid minute step",
+		},
+		{
+			name:               "not a number",
+			expr:               "* * * jan *",
+			expectedErrMessage: "invalid month \"jan\"",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.expr)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tc.expectedErrMessage) {
+				t.Errorf("expected error containing %q, got %q", tc.expectedErrMessage, err.Error())
+			}
+		})
+	}
+}
+
+func TestSchedule_Next(t *testing.T) {
+	// Monday 15 January 2024, 10:07:30
+	from := time.Date(2024, 1, 15, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected time.Time
+	}{
+		{
+			name:     "every minute",
+			expr:     "* * * * *",
+			expected: time.Date(2024, 1, 15, 10, 8, 0, 0, time.UTC),
+		},
+		{
+			name:     "every 15 minutes",
+			expr:     "*/15 * * * *",
+			expected: time.Date(2024, 1, 15, 10, 15, 0, 0, time.UTC),
+		},
+		{
+			name:     "hourly macro",
+			expr:     "@hourly",
+			expected: time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "list of hours",
+			expr:     "30 8,12,18 * * *",
+			expected: time.Date(2024, 1, 15, 12, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekdays range",
+			expr:     "0 9 * * 1-5",
+			expected: time.Date(2024, 1, 16, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "sunday written as 7",
+			expr:     "0 0 * * 7",
+			expected: time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "first of the month",
+			expr:     "0 0 1 * *",
+			expected: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "day of month or day of week",
+			expr:     "0 0 20 * 3",
+			expected: time.Date(2024, 1, 17, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "leap day",
+			expr:     "0 0 29 2 *",
+			expected: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			schedule, err := Parse(tc.expr)
+			if err != nil {
+				t.Fatalf("failed to parse %q: %v", tc.expr, err)
+			}
+
+			next := schedule.Next(from)
+			if !next.Equal(tc.expected) {
+				t.Errorf("expected next activation %s, got %s", tc.expected, next)
+			}
+		})
+	}
+}
+
+func TestSchedule_Next_Impossible(t *testing.T) {
+	schedule, err := Parse("0 0 31 2 *")
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		t.Errorf("expected no activation for February 31st, got %s", next)
+	}
+}
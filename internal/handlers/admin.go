@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/services"
+)
+
+// AdminHandler handles HTTP requests exposing the internal state of the service
+type AdminHandler struct {
+	breaker services.BreakerReporter
+	jobs    services.JobManager
+	alerts  services.AlertReporter
+
+	// concurrency may be nil when the analyses are not limited
+	concurrency services.ConcurrencyReporter
+
+	// keys may be nil when the API is open
+	keys KeyReporter
+
+	logger *slog.Logger
+}
+
+// NewAdminHandler creates a new admin request handler.
+// The breaker may be nil when the circuit breaker is disabled, the alerts when no alerting rule is defined,
+// the concurrency when the analyses are not limited, and the keys when the API is open.
+func NewAdminHandler(breaker services.BreakerReporter, jobs services.JobManager, alerts services.AlertReporter, concurrency services.ConcurrencyReporter, keys KeyReporter, logger *slog.Logger) *AdminHandler {
+	return &AdminHandler{
+		breaker:     breaker,
+		jobs:        jobs,
+		alerts:      alerts,
+		concurrency: concurrency,
+		keys:        keys,
+		logger:      logger,
+	}
+}
+
+// HandleBreaker processes GET requests to '/admin/breaker' endpoint.
+// Reports the state of the stream circuit breaker and its recent transitions.
+func (h *AdminHandler) HandleBreaker(w http.ResponseWriter, r *http.Request) {
+	if h.breaker == nil {
+		writeError(w, r, h.logger, models.Errorf(models.ErrorFeatureDisabled, "circuit breaker is disabled"))
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, h.breaker.BreakerStatus())
+}
+
+// HandleAlerts processes GET requests to '/admin/alerts' endpoint.
+// Reports the state of every alerting rule.
+func (h *AdminHandler) HandleAlerts(w http.ResponseWriter, r *http.Request) {
+	if h.alerts == nil {
+		writeError(w, r, h.logger, models.Errorf(models.ErrorFeatureDisabled, "alerting is disabled"))
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, map[string]interface{}{"rules": h.alerts.AlertRules()})
+}
+
+// HandleAnalyses processes GET requests to '/admin/analyses' endpoint.
+// Reports the utilization of the analysis concurrency limits.
+func (h *AdminHandler) HandleAnalyses(w http.ResponseWriter, r *http.Request) {
+	if h.concurrency == nil {
+		writeError(w, r, h.logger, models.Errorf(models.ErrorFeatureDisabled, "analysis limits are disabled"))
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, h.concurrency.ConcurrencyStatus())
+}
+
+// HandleKeys processes GET requests to '/admin/keys' endpoint.
+// Reports the usage of every API key, never the keys or their hashes.
+func (h *AdminHandler) HandleKeys(w http.ResponseWriter, r *http.Request) {
+	if h.keys == nil {
+		writeError(w, r, h.logger, models.Errorf(models.ErrorFeatureDisabled, "authentication is disabled"))
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, map[string]interface{}{"keys": h.keys.KeyStatuses()})
+}
+
+// HandleJobs processes GET requests to '/admin/jobs' endpoint.
+// Reports the state of every scheduled job.
+func (h *AdminHandler) HandleJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.logger, http.StatusOK, map[string]interface{}{"jobs": h.jobs.Jobs()})
+}
+
+// HandleJob processes GET requests to '/admin/jobs/{name}' endpoint.
+// Reports the state of a scheduled job and its last run.
+func (h *AdminHandler) HandleJob(w http.ResponseWriter, r *http.Request) {
+	status, err := h.jobs.Job(r.PathValue("name"))
+	if err != nil {
+		h.sendJobError(w, r, err)
+		return
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, status)
+}
+
+// HandlePauseJob processes POST requests to '/admin/jobs/{name}/pause' endpoint.
+// The scheduled runs of the job are skipped until it is resumed.
+func (h *AdminHandler) HandlePauseJob(w http.ResponseWriter, r *http.Request) {
+	h.jobAction(w, r, h.jobs.Pause, http.StatusOK)
+}
+
+// HandleResumeJob processes POST requests to '/admin/jobs/{name}/resume' endpoint
+func (h *AdminHandler) HandleResumeJob(w http.ResponseWriter, r *http.Request) {
+	h.jobAction(w, r, h.jobs.Resume, http.StatusOK)
+}
+
+// HandleTriggerJob processes POST requests to '/admin/jobs/{name}/trigger' endpoint.
+// The job starts in the background, the response does not wait for its results.
+func (h *AdminHandler) HandleTriggerJob(w http.ResponseWriter, r *http.Request) {
+	h.jobAction(w, r, h.jobs.Trigger, http.StatusAccepted)
+}
+
+// HandleAdminKeyRequired rejects the job actions when the API is open: they need an API key scoped to '/admin', and there is none
+func (h *AdminHandler) HandleAdminKeyRequired(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, h.logger, models.Errorf(models.ErrorForbidden, "job actions require an API key scoped to /admin, define auth.keys to enable them"))
+}
+
+// jobAction applies an action to the job named in the path and responds with its new state
+func (h *AdminHandler) jobAction(w http.ResponseWriter, r *http.Request, action func(name string) error, statusCode int) {
+	name := r.PathValue("name")
+
+	if err := action(name); err != nil {
+		h.sendJobError(w, r, err)
+		return
+	}
+
+	status, err := h.jobs.Job(name)
+	if err != nil {
+		h.sendJobError(w, r, err)
+		return
+	}
+
+	writeJSON(w, h.logger, statusCode, status)
+}
+
+// sendJobError sends the error of a job request with the matching error code
+func (h *AdminHandler) sendJobError(w http.ResponseWriter, r *http.Request, err error) {
+	code := models.ErrorInternal
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		code = models.ErrorNotFound
+	case errors.Is(err, services.ErrJobRunning):
+		code = models.ErrorConflict
+	}
+
+	writeError(w, r, h.logger, &models.Error{Code: code, Message: err.Error()})
+}
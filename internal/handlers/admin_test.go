@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/services"
+)
+
+// mockBreakerReporter is a mock implementation of the Breaker Reporter for testing
+type mockBreakerReporter struct {
+	status models.BreakerStatus
+}
+
+// Check interface implementation at compile-time
+var _ services.BreakerReporter = &mockBreakerReporter{}
+
+func (m *mockBreakerReporter) BreakerStatus() models.BreakerStatus {
+	return m.status
+}
+
+// mockAlertReporter is a mock implementation of the Alert Reporter for testing
+type mockAlertReporter struct {
+	rules []models.AlertRuleStatus
+}
+
+// Check interface implementation at compile-time
+var _ services.AlertReporter = &mockAlertReporter{}
+
+func (m *mockAlertReporter) AlertRules() []models.AlertRuleStatus {
+	return m.rules
+}
+
+// mockJobManager is a mock implementation of the Job Manager for testing
+type mockJobManager struct {
+	jobs      []models.JobStatus
+	actionErr error
+	actions   []string
+}
+
+// Check interface implementation at compile-time
+var _ services.JobManager = &mockJobManager{}
+
+func (m *mockJobManager) Jobs() []models.JobStatus {
+	return m.jobs
+}
+
+func (m *mockJobManager) Job(name string) (models.JobStatus, error) {
+	for _, job := range m.jobs {
+		if job.Name == name {
+			return job, nil
+		}
+	}
+	return models.JobStatus{}, fmt.Errorf("%w: %s", services.ErrJobNotFound, name)
+}
+
+func (m *mockJobManager) action(action, name string) error {
+	if m.actionErr != nil {
+		return m.actionErr
+	}
+	if _, err := m.Job(name); err != nil {
+		return err
+	}
+	m.actions = append(m.actions, action+" "+name)
+	return nil
+}
+
+func (m *mockJobManager) Pause(name string) error   { return m.action("pause", name) }
+func (m *mockJobManager) Resume(name string) error  { return m.action("resume", name) }
+func (m *mockJobManager) Trigger(name string) error { return m.action("trigger", name) }
+
+func TestAdminHandler_HandleBreaker(t *testing.T) {
+	breaker := &mockBreakerReporter{
+		status: models.BreakerStatus{
+			State:               models.BreakerOpen,
+			ConsecutiveFailures: 5,
+			FailureThreshold:    5,
+			OpenTimeout:         "30s",
+			RetryAfter:          12,
+			LastError:           "failed to connect to stream",
+		},
+	}
+
+	handler := NewAdminHandler(breaker, &mockJobManager{}, nil, nil, nil, testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/breaker", nil)
+	w := httptest.NewRecorder()
+	handler.HandleBreaker(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+
+	if body["state"] != "open" {
+		t.Errorf("expected state open, got %v", body["state"])
+	}
+	if body["retry_after_seconds"] != float64(12) {
+		t.Errorf("expected retry_after_seconds 12, got %v", body["retry_after_seconds"])
+	}
+}
+
+func TestAdminHandler_HandleBreaker_Disabled(t *testing.T) {
+	handler := NewAdminHandler(nil, &mockJobManager{}, nil, nil, nil, testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/breaker", nil)
+	w := httptest.NewRecorder()
+	handler.HandleBreaker(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestAdminHandler_HandleAnalyses(t *testing.T) {
+	limiter := services.NewConcurrencyLimiter(services.ConcurrencyLimits{MaxConcurrent: 2, MaxConcurrentPerClient: 1}, testLogger())
+	release, err := limiter.Acquire(t.Context(), "192.0.2.1")
+	if err != nil {
+		t.Fatalf("expected the analysis to be admitted, got %v", err)
+	}
+	defer release()
+
+	handler := NewAdminHandler(nil, &mockJobManager{}, nil, limiter, nil, testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/analyses", nil)
+	w := httptest.NewRecorder()
+	handler.HandleAnalyses(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var status models.ConcurrencyStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if status.Active != 1 || status.MaxConcurrent != 2 || status.Clients["192.0.2.1"] != 1 {
+		t.Errorf("expected one active analysis out of 2, got %+v", status)
+	}
+}
+
+func TestAdminHandler_HandleAlerts(t *testing.T) {
+	value := 612.5
+	alerts := &mockAlertReporter{
+		rules: []models.AlertRuleStatus{
+			{Name: "high-retweets", Condition: "avg_retweets > 500 over 5m0s", State: models.AlertFiring, Value: &value, Notifications: 1},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		alerts         services.AlertReporter
+		expectedStatus int
+	}{
+		{"enabled", alerts, http.StatusOK},
+		{"disabled", nil, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAdminHandler(nil, &mockJobManager{}, tt.alerts, nil, nil, testLogger())
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/alerts", nil)
+			w := httptest.NewRecorder()
+			handler.HandleAlerts(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Rules []models.AlertRuleStatus `json:"rules"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to parse response body: %v", err)
+			}
+			if len(body.Rules) != 1 || body.Rules[0].State != models.AlertFiring || *body.Rules[0].Value != value {
+				t.Errorf("unexpected rules: %+v", body.Rules)
+			}
+		})
+	}
+}
+
+func TestAdminHandler_HandleJobs(t *testing.T) {
+	jobs := &mockJobManager{
+		jobs: []models.JobStatus{
+			{Name: "hourly", Schedule: "0 * * * *", Duration: "1m0s", Dimensions: []string{"likes"}},
+			{Name: "tweets", Schedule: "every 15m0s", Duration: "30s", Dimensions: []string{"retweets"}, Paused: true},
+		},
+	}
+
+	handler := NewAdminHandler(nil, jobs, nil, nil, nil, testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/jobs", nil)
+	w := httptest.NewRecorder()
+	handler.HandleJobs(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var body struct {
+		Jobs []models.JobStatus `json:"jobs"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if len(body.Jobs) != 2 || body.Jobs[1].Name != "tweets" || !body.Jobs[1].Paused {
+		t.Errorf("unexpected jobs: %+v", body.Jobs)
+	}
+}
+
+func TestAdminHandler_JobActions(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		actionErr      error
+		expectedStatus int
+		expectedAction string
+	}{
+		{
+			name:           "get job",
+			method:         http.MethodGet,
+			path:           "/admin/jobs/hourly",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "get unknown job",
+			method:         http.MethodGet,
+			path:           "/admin/jobs/unknown",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "pause job",
+			method:         http.MethodPost,
+			path:           "/admin/jobs/hourly/pause",
+			expectedStatus: http.StatusOK,
+			expectedAction: "pause hourly",
+		},
+		{
+			name:           "resume job",
+			method:         http.MethodPost,
+			path:           "/admin/jobs/hourly/resume",
+			expectedStatus: http.StatusOK,
+			expectedAction: "resume hourly",
+		},
+		{
+			name:           "trigger job",
+			method:         http.MethodPost,
+			path:           "/admin/jobs/hourly/trigger",
+			expectedStatus: http.StatusAccepted,
+			expectedAction: "trigger hourly",
+		},
+		{
+			name:           "trigger running job",
+			method:         http.MethodPost,
+			path:           "/admin/jobs/hourly/trigger",
+			actionErr:      services.ErrJobRunning,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "pause unknown job",
+			method:         http.MethodPost,
+			path:           "/admin/jobs/unknown/pause",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			jobs := &mockJobManager{
+				jobs:      []models.JobStatus{{Name: "hourly", Schedule: "0 * * * *"}},
+				actionErr: tc.actionErr,
+			}
+			handler := NewAdminHandler(nil, jobs, nil, nil, nil, testLogger())
+
+			// Route through a mux so that the path values are set
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /admin/jobs/{name}", handler.HandleJob)
+			mux.HandleFunc("POST /admin/jobs/{name}/pause", handler.HandlePauseJob)
+			mux.HandleFunc("POST /admin/jobs/{name}/resume", handler.HandleResumeJob)
+			mux.HandleFunc("POST /admin/jobs/{name}/trigger", handler.HandleTriggerJob)
+
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("expected status %d, got %d", tc.expectedStatus, w.Code)
+			}
+
+			if tc.expectedAction != "" && (len(jobs.actions) != 1 || jobs.actions[0] != tc.expectedAction) {
+				t.Errorf("expected action %q, got %v", tc.expectedAction, jobs.actions)
+			}
+		})
+	}
+}
+
+func TestAdminHandler_HandleAdminKeyRequired(t *testing.T) {
+	jobs := &mockJobManager{}
+	handler := NewAdminHandler(nil, jobs, nil, nil, nil, testLogger())
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/jobs/hourly/trigger", nil)
+	w := httptest.NewRecorder()
+	handler.HandleAdminKeyRequired(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if message, _ := body["message"].(string); body["code"] != string(models.ErrorForbidden) || !strings.Contains(message, "auth.keys") {
+		t.Errorf("expected a forbidden error explaining how to enable the job actions, got %v", body)
+	}
+	if len(jobs.actions) != 0 {
+		t.Errorf("expected no job action, got %v", jobs.actions)
+	}
+}
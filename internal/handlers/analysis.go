@@ -1,26 +1,45 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
 	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/services"
 )
 
+// AnalysisPartialHeader flags the responses of the analyses cut short, whose status is still 200
+const AnalysisPartialHeader = "X-Analysis-Partial"
+
 // StreamAnalysisHandler handles HTTP requests for stream analysis
 type StreamAnalysisHandler struct {
 	streamAnalyzer services.AnalyzerService
-	logger         *slog.Logger
+	rangeAnalyzer  services.RangeAnalyzerService
+
+	// limiter admits the analyses within the concurrency limits (unlimited when nil)
+	limiter services.AnalysisLimiter
+
+	// minDuration and maxDuration bound the live analyses (unbounded when zero)
+	minDuration time.Duration
+	maxDuration time.Duration
+
+	logger *slog.Logger
 }
 
-// NewStreamAnalysisHandler creates a new analysis request handler
-func NewStreamAnalysisHandler(streamAnalyzer services.AnalyzerService, logger *slog.Logger) *StreamAnalysisHandler {
+// NewStreamAnalysisHandler creates a new analysis request handler.
+// The range analyzer may be nil when the post archive is disabled.
+// The limiter may be nil when the analyses are not limited, and the live analyses last between minDuration and maxDuration (unbounded when zero).
+func NewStreamAnalysisHandler(streamAnalyzer services.AnalyzerService, rangeAnalyzer services.RangeAnalyzerService, limiter services.AnalysisLimiter, minDuration, maxDuration time.Duration, logger *slog.Logger) *StreamAnalysisHandler {
 	return &StreamAnalysisHandler{
 		streamAnalyzer: streamAnalyzer,
+		rangeAnalyzer:  rangeAnalyzer,
+		limiter:        limiter,
+		minDuration:    minDuration,
+		maxDuration:    maxDuration,
 		logger:         logger,
 	}
 }
@@ -29,108 +48,398 @@ func NewStreamAnalysisHandler(streamAnalyzer services.AnalyzerService, logger *s
 func (h *StreamAnalysisHandler) HandleAnalysis(w http.ResponseWriter, r *http.Request) {
 	// Enforce GET method only
 	if r.Method != http.MethodGet {
-		h.sendError(w, http.StatusMethodNotAllowed, "only GET method is allowed")
+		writeError(w, r, h.logger, models.Errorf(models.ErrorMethodNotAllowed, "only GET method is allowed"))
+		return
+	}
+
+	// Negotiate the output format before the analysis, which blocks for the duration
+	format, err := negotiateFormat(r, FormatJSON, FormatCSV, FormatNDJSON, FormatPrometheus)
+	if err != nil {
+		writeError(w, r, h.logger, err)
+		return
+	}
+
+	// Analyze archived posts instead of waiting for the stream when a time range is requested
+	query := r.URL.Query()
+	if query.Has("from") || query.Has("to") {
+		h.handleRangeAnalysis(w, r, format)
 		return
 	}
 
 	// Parse and validate query parameters
-	duration, dimension, err := h.parseParams(r)
+	limits, dimension, err := h.parseParams(r)
 	if err != nil {
-		h.sendError(w, http.StatusBadRequest, err.Error())
+		writeError(w, r, h.logger, err)
+		return
+	}
+	grouping, err := parseGrouping(r)
+	if err != nil {
+		writeError(w, r, h.logger, err)
 		return
 	}
 
-	h.logger.Info("Analysis request started", "duration", duration, "dimension", dimension)
+	// Parse strict parameter (partial results are returned by default)
+	strict := false
+	if strictStr := query.Get("strict"); strictStr != "" {
+		if strict, err = strconv.ParseBool(strictStr); err != nil {
+			writeError(w, r, h.logger, models.Errorf(models.ErrorInvalidParameter, "invalid strict: %s (must be true or false)", strictStr))
+			return
+		}
+	}
 
-	// Perform analysis on posts (this blocks for the duration)
-	ctx := r.Context()
-	result, err := h.streamAnalyzer.AnalyzePosts(ctx, duration, dimension)
+	// Wait for a slot within the concurrency limits, the analysis starts once admitted
+	release, err := h.acquire(r)
 	if err != nil {
-		h.sendError(w, http.StatusInternalServerError, fmt.Errorf("failed to analyze stream: %w", err).Error())
+		writeError(w, r, h.logger, err)
 		return
 	}
+	defer release()
+
+	h.logger.InfoContext(r.Context(), "Analysis request started", "duration", limits.Duration, "max_posts", limits.MaxPosts, "until", limits.Until, "dimension", dimension, "api_key", apiKeyName(r.Context()))
+
+	// Perform analysis on posts (this blocks until a limit is reached).
+	// The analyzer classifies its errors (stream unavailable or interrupted, analysis cancelled), others are internal errors.
+	ctx := r.Context()
+	result, err := h.streamAnalyzer.AnalyzePosts(ctx, limits, dimension, grouping)
+	if err != nil {
+		if models.ErrorCodeOf(err) == models.ErrorInternal {
+			err = models.WrapError(models.ErrorInternal, err, "failed to analyze stream")
+		}
 
-	h.logger.Info("Analysis completed successfully", "total_posts", result.TotalPosts, "duration", duration, "dimension", dimension)
+		// Fail hard without a result, or when the client asked for complete results only
+		if result == nil || strict {
+			writeError(w, r, h.logger, err)
+			return
+		}
+
+		// Otherwise return what was analyzed before the error, flagged as incomplete.
+		// The warnings only give the code and the message of the error, the error itself is logged.
+		h.logger.WarnContext(r.Context(), "Analysis completed partially", "total_posts", result.TotalPosts, "ended_by", result.EndedBy, "dimension", dimension, "err", err)
+		result.Partial = true
+		if len(result.Warnings) == 0 {
+			var codedErr *models.Error
+			errors.As(err, &codedErr)
+			result.Warnings = []string{models.Warning(codedErr.Code, codedErr.Message)}
+		}
+	} else {
+		h.logger.InfoContext(r.Context(), "Analysis completed successfully", "total_posts", result.TotalPosts, "ended_by", result.EndedBy, "dimension", dimension)
+	}
 
 	// Send response
-	h.sendResponse(w, dimension, result)
+	h.sendResponse(w, format, dimension, grouping, result)
 }
 
-// parseParams extracts and validates query parameters
-func (h *StreamAnalysisHandler) parseParams(r *http.Request) (time.Duration, string, error) {
+// handleRangeAnalysis analyzes the archived posts of the requested time range
+func (h *StreamAnalysisHandler) handleRangeAnalysis(w http.ResponseWriter, r *http.Request, format string) {
+	if h.rangeAnalyzer == nil {
+		writeError(w, r, h.logger, models.Errorf(models.ErrorInvalidParameter, "from and to require the post archive, which is disabled"))
+		return
+	}
+
+	// Parse and validate query parameters
+	from, to, dimension, err := h.parseRangeParams(r)
+	if err != nil {
+		writeError(w, r, h.logger, err)
+		return
+	}
+	grouping, err := parseGrouping(r)
+	if err != nil {
+		writeError(w, r, h.logger, err)
+		return
+	}
+
+	release, err := h.acquire(r)
+	if err != nil {
+		writeError(w, r, h.logger, err)
+		return
+	}
+	defer release()
+
+	h.logger.InfoContext(r.Context(), "Range analysis request started", "from", from, "to", to, "dimension", dimension, "api_key", apiKeyName(r.Context()))
+
+	result, err := h.rangeAnalyzer.AnalyzeRange(r.Context(), from, to, dimension, grouping)
+	if err != nil {
+		writeError(w, r, h.logger, models.WrapError(models.ErrorInternal, err, "failed to analyze archive"))
+		return
+	}
+
+	h.logger.InfoContext(r.Context(), "Range analysis completed successfully", "total_posts", result.TotalPosts, "from", from, "to", to, "dimension", dimension)
+
+	h.sendResponse(w, format, dimension, grouping, result)
+}
+
+// acquire admits the analysis of the request within the concurrency limits of its client.
+// The returned function releases the slot once the analysis ends.
+func (h *StreamAnalysisHandler) acquire(r *http.Request) (func(), error) {
+	if h.limiter == nil {
+		return func() {}, nil
+	}
+	return h.limiter.Acquire(r.Context(), clientID(r))
+}
+
+// parseParams extracts and validates query parameters.
+// At least one of duration, max_posts and until limits the analysis, the first one reached ends it.
+// until is a wall-clock time, not a condition on the posts: the analysis ends when it is reached.
+func (h *StreamAnalysisHandler) parseParams(r *http.Request) (models.AnalysisLimits, string, error) {
 	query := r.URL.Query()
+	var limits models.AnalysisLimits
+	maxDuration := h.maxDurationFor(r)
+
+	if !query.Has("duration") && !query.Has("max_posts") && !query.Has("until") {
+		return limits, "", models.Errorf(models.ErrorInvalidDuration, "missing required parameter: duration (or max_posts, until)")
+	}
 
 	// Parse duration parameter
-	durationStr := query.Get("duration")
-	if durationStr == "" {
-		return 0, "", fmt.Errorf("missing required parameter: duration")
+	if durationStr := query.Get("duration"); query.Has("duration") {
+		duration, err := time.ParseDuration(durationStr)
+		if err != nil {
+			return limits, "", models.Errorf(models.ErrorInvalidDuration, "invalid duration format: %s (expected format: 5s, 10m, 1h)", durationStr)
+		}
+
+		// Validate duration is positive
+		if duration <= 0 {
+			return limits, "", models.Errorf(models.ErrorInvalidDuration, "duration must be positive")
+		}
+
+		if duration < h.minDuration {
+			return limits, "", models.Errorf(models.ErrorInvalidDuration, "duration must be at least %s", h.minDuration).WithDetail("min_duration", h.minDuration.String())
+		}
+
+		// The response is only written once the analysis ends, it must fit in the server write timeout
+		if maxDuration > 0 && duration > maxDuration {
+			return limits, "", models.Errorf(models.ErrorInvalidDuration, "duration must not exceed %s", maxDuration).WithDetail("max_duration", maxDuration.String())
+		}
+		limits.Duration = duration
+	}
+
+	// Parse max_posts parameter
+	if maxPostsStr := query.Get("max_posts"); query.Has("max_posts") {
+		maxPosts, err := strconv.Atoi(maxPostsStr)
+		if err != nil || maxPosts < 1 {
+			return limits, "", models.Errorf(models.ErrorInvalidParameter, "invalid max_posts: %s (must be a positive integer)", maxPostsStr)
+		}
+		limits.MaxPosts = maxPosts
+	}
+
+	// Parse until parameter
+	if query.Has("until") {
+		until, err := parseTimeParam("until", query.Get("until"))
+		if err != nil {
+			return limits, "", err
+		}
+		if !until.After(time.Now()) {
+			return limits, "", models.Errorf(models.ErrorInvalidParameter, "until must be in the future")
+		}
+		if maxDuration > 0 && time.Until(until) > maxDuration {
+			return limits, "", models.Errorf(models.ErrorInvalidParameter, "until must be within %s from now", maxDuration).WithDetail("max_duration", maxDuration.String())
+		}
+		limits.Until = until
+	}
+
+	// An analysis without duration ends at the latest after the maximum duration, which is not a requested duration
+	if limits.Duration == 0 {
+		limits.MaxDuration = maxDuration
 	}
 
-	duration, err := time.ParseDuration(durationStr)
+	// Parse dimension parameter
+	dimension := query.Get("dimension")
+	if dimension == "" {
+		return limits, "", models.Errorf(models.ErrorUnknownDimension, "missing required parameter: dimension")
+	}
+
+	// Validate dimension
+	if !models.ValidDimensions[dimension] {
+		return limits, "", models.Errorf(models.ErrorUnknownDimension, "invalid dimension: %s (must be one of: likes, comments, favorites, retweets)", dimension)
+	}
+
+	return limits, dimension, nil
+}
+
+// parseGrouping extracts and validates the grouping parameters of an analysis, both optional:
+// bucket splits the posts into a series of buckets by post timestamp, group_by=post_type groups them by post type.
+func parseGrouping(r *http.Request) (models.AnalysisGrouping, error) {
+	query := r.URL.Query()
+	var grouping models.AnalysisGrouping
+
+	if bucketStr := query.Get("bucket"); query.Has("bucket") {
+		bucket, err := time.ParseDuration(bucketStr)
+		if err != nil || bucket < time.Second || bucket%time.Second != 0 {
+			return grouping, models.Errorf(models.ErrorInvalidParameter, "invalid bucket: %s (must be a whole number of seconds, e.g. 30s, 5m, 1h)", bucketStr)
+		}
+		grouping.Bucket = bucket
+	}
+
+	if groupBy := query.Get("group_by"); query.Has("group_by") {
+		if groupBy != models.GroupByPostType {
+			return grouping, models.Errorf(models.ErrorInvalidParameter, "invalid group_by: %s (must be post_type)", groupBy)
+		}
+		grouping.ByPostType = true
+	}
+
+	return grouping, nil
+}
+
+// maxDurationFor returns the maximum duration of the analyses of the request, the lower of the server's and its API key's (unbounded when zero)
+func (h *StreamAnalysisHandler) maxDurationFor(r *http.Request) time.Duration {
+	maxDuration := h.maxDuration
+	if key := apiKeyFrom(r.Context()); key != nil && key.MaxDuration > 0 && (maxDuration == 0 || key.MaxDuration < maxDuration) {
+		maxDuration = key.MaxDuration
+	}
+	return maxDuration
+}
+
+// parseRangeParams extracts and validates the query parameters of a range analysis.
+// A missing to defaults to now, a missing from leaves the range unbounded.
+func (h *StreamAnalysisHandler) parseRangeParams(r *http.Request) (time.Time, time.Time, string, error) {
+	query := r.URL.Query()
+
+	for _, param := range []string{"duration", "max_posts", "until"} {
+		if query.Has(param) {
+			return time.Time{}, time.Time{}, "", models.Errorf(models.ErrorInvalidParameter, "%s cannot be combined with from and to", param)
+		}
+	}
+
+	from, err := parseTimeParam("from", query.Get("from"))
 	if err != nil {
-		return 0, "", fmt.Errorf("invalid duration format: %s (expected format: 5s, 10m, 1h)", durationStr)
+		return time.Time{}, time.Time{}, "", err
 	}
 
-	// Validate duration is positive
-	if duration <= 0 {
-		return 0, "", fmt.Errorf("duration must be positive")
+	to, err := parseTimeParam("to", query.Get("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, "", err
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	if !from.IsZero() && !from.Before(to) {
+		return time.Time{}, time.Time{}, "", models.Errorf(models.ErrorInvalidParameter, "from must be before to")
 	}
 
 	// Parse dimension parameter
 	dimension := query.Get("dimension")
 	if dimension == "" {
-		return 0, "", fmt.Errorf("missing required parameter: dimension")
+		return time.Time{}, time.Time{}, "", models.Errorf(models.ErrorUnknownDimension, "missing required parameter: dimension")
 	}
 
 	// Validate dimension
 	if !models.ValidDimensions[dimension] {
-		return 0, "", fmt.Errorf("invalid dimension: %s (must be one of: likes, comments, favorites, retweets)", dimension)
+		return time.Time{}, time.Time{}, "", models.Errorf(models.ErrorUnknownDimension, "invalid dimension: %s (must be one of: likes, comments, favorites, retweets)", dimension)
 	}
 
-	return duration, dimension, nil
+	return from, to, dimension, nil
 }
 
-// sendResponse sends a successful JSON response
-func (h *StreamAnalysisHandler) sendResponse(w http.ResponseWriter, dimension string, result *models.AnalysisResult) {
+// analysisColumns is the schema of the analysis results in CSV and NDJSON
+var analysisColumns = []string{"dimension", "total_posts", "minimum_timestamp", "maximum_timestamp", "average", "complete", "ended_by", "warnings"}
+
+// sendResponse sends a successful response in the negotiated format.
+// With a grouping, the rows are the groups instead of the totals, and the metrics add the groups to the totals.
+func (h *StreamAnalysisHandler) sendResponse(w http.ResponseWriter, format string, dimension string, grouping models.AnalysisGrouping, result *models.AnalysisResult) {
 	// Build response with dynamic field name for average
+	averageField := fmt.Sprintf("avg_%s", dimension)
 	resp := map[string]interface{}{
-		"total_posts":                    result.TotalPosts,
-		"minimum_timestamp":              result.MinimumTimestamp,
-		"maximum_timestamp":              result.MaximumTimestamp,
-		fmt.Sprintf("avg_%s", dimension): result.Average,
+		"total_posts":       result.TotalPosts,
+		"minimum_timestamp": result.MinimumTimestamp,
+		"maximum_timestamp": result.MaximumTimestamp,
+		averageField:        result.Average,
+		"complete":          !result.Partial,
 	}
 
-	respBytes, err := json.Marshal(resp)
-	if err != nil {
-		h.sendError(w, http.StatusInternalServerError, fmt.Errorf("failed to encode result response: %w", err).Error())
-		return
+	if result.EndedBy != "" {
+		resp["ended_by"] = result.EndedBy
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	if len(result.Warnings) > 0 {
+		resp["warnings"] = result.Warnings
+	}
 
-	if _, err := w.Write(respBytes); err != nil {
-		h.logger.Error("Failed to write result response", "err", err.Error())
+	if len(result.Anomalies) > 0 {
+		resp["anomalies"] = result.Anomalies
 	}
-}
 
-// sendError sends an error response with appropriate status code
-func (h *StreamAnalysisHandler) sendError(w http.ResponseWriter, statusCode int, message string) {
-	resp := map[string]string{
-		"error": message,
+	if result.Stream != nil {
+		resp["stream"] = result.Stream
 	}
 
-	respBytes, err := json.Marshal(resp)
-	if err != nil {
-		h.logger.Error("Failed to marshal error response", "err", err.Error())
-		http.Error(w, message, statusCode)
-		return
+	// The partial results are told apart without reading the body, whatever the format
+	if result.Partial {
+		w.Header().Set(AnalysisPartialHeader, "true")
+	}
+
+	// The rows and metrics have a fixed average field, labeled with the dimension
+	labels := [][2]string{{"dimension", dimension}}
+	analysisTable := &table{
+		columns: analysisColumns,
+		rows:    [][]any{{dimension, result.TotalPosts, result.MinimumTimestamp, result.MaximumTimestamp, result.Average, !result.Partial, result.EndedBy, result.Warnings}},
+	}
+	analysisMetrics := []metricFamily{
+		{"stream_analysis_posts", "Number of posts received during the analysis.", []metricSample{{labels, float64(result.TotalPosts)}}},
+		{"stream_analysis_average", "Average of the dimension over the posts carrying it.", []metricSample{{labels, float64(result.Average)}}},
+		{"stream_analysis_minimum_timestamp_seconds", "Oldest post timestamp of the analysis.", []metricSample{{labels, float64(result.MinimumTimestamp)}}},
+		{"stream_analysis_maximum_timestamp_seconds", "Newest post timestamp of the analysis.", []metricSample{{labels, float64(result.MaximumTimestamp)}}},
+		{"stream_analysis_complete", "Whether the analysis covered the whole requested window (1) or was cut short (0).", []metricSample{{labels, boolValue(!result.Partial)}}},
+		{"stream_analysis_anomalies", "Number of anomalies of the dimension detected during the analysis.", []metricSample{{labels, float64(len(result.Anomalies))}}},
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
+	if grouping.Bucket > 0 || grouping.ByPostType {
+		// The groups share the schema of the totals: the JSON fields, the columns and the labels have the same names
+		groupColumns := []string{"dimension"}
+		if grouping.Bucket > 0 {
+			groupColumns = append(groupColumns, "bucket_start", "bucket_end")
+		}
+		if grouping.ByPostType {
+			groupColumns = append(groupColumns, "post_type")
+		}
+		analysisTable = &table{columns: append(groupColumns, "total_posts", "average")}
+
+		groups := make([]map[string]any, 0, len(result.Groups))
+		postsSamples := make([]metricSample, 0, len(result.Groups))
+		averageSamples := make([]metricSample, 0, len(result.Groups))
+		for _, group := range result.Groups {
+			entry := map[string]any{"total_posts": group.TotalPosts, averageField: group.Average}
+			row := []any{dimension}
+			groupLabels := [][2]string{{"dimension", dimension}}
+			if grouping.Bucket > 0 {
+				entry["bucket_start"], entry["bucket_end"] = group.BucketStart, group.BucketEnd
+				row = append(row, group.BucketStart, group.BucketEnd)
+				groupLabels = append(groupLabels, [2]string{"bucket_start", strconv.FormatInt(group.BucketStart, 10)})
+			}
+			if grouping.ByPostType {
+				entry["post_type"] = group.PostType
+				row = append(row, group.PostType)
+				groupLabels = append(groupLabels, [2]string{"post_type", group.PostType})
+			}
+
+			groups = append(groups, entry)
+			analysisTable.rows = append(analysisTable.rows, append(row, group.TotalPosts, group.Average))
+			postsSamples = append(postsSamples, metricSample{groupLabels, float64(group.TotalPosts)})
+			averageSamples = append(averageSamples, metricSample{groupLabels, float64(group.Average)})
+		}
+
+		// A series has a bucket per entry, a breakdown a post type
+		if grouping.Bucket > 0 {
+			resp["series"] = groups
+		} else {
+			resp["breakdown"] = groups
+		}
+		analysisMetrics = append(analysisMetrics,
+			metricFamily{"stream_analysis_group_posts", "Number of posts of a group of the analysis, by bucket start and/or post type.", postsSamples},
+			metricFamily{"stream_analysis_group_average", "Average of the dimension over the posts of a group carrying it.", averageSamples},
+		)
+	}
+
+	writeFormatted(w, h.logger, format, http.StatusOK, formattedResponse{
+		json:    resp,
+		table:   analysisTable,
+		metrics: analysisMetrics,
+	})
+}
 
-	if _, err := w.Write(respBytes); err != nil {
-		h.logger.Error("Failed to write error response", "err", err.Error())
+// boolValue converts a boolean to a metric sample value
+func boolValue(b bool) float64 {
+	if b {
+		return 1
 	}
+	return 0
 }
@@ -18,15 +18,19 @@ import (
 
 // mockAnalyzerService is a mock implementation of the Analyzer Service for testing
 type mockAnalyzerService struct {
-	analyzePostsFn func(ctx context.Context, duration time.Duration, dimension string) (*models.AnalysisResult, error)
+	analyzePostsFn func(ctx context.Context, limits models.AnalysisLimits, dimension string) (*models.AnalysisResult, error)
+
+	// grouping is the grouping of the last analysis
+	grouping models.AnalysisGrouping
 }
 
 // Check interface implementation at compile-time
 var _ services.AnalyzerService = &mockAnalyzerService{}
 
-func (m *mockAnalyzerService) AnalyzePosts(ctx context.Context, duration time.Duration, dimension string) (*models.AnalysisResult, error) {
+func (m *mockAnalyzerService) AnalyzePosts(ctx context.Context, limits models.AnalysisLimits, dimension string, grouping models.AnalysisGrouping) (*models.AnalysisResult, error) {
+	m.grouping = grouping
 	if m.analyzePostsFn != nil {
-		return m.analyzePostsFn(ctx, duration, dimension)
+		return m.analyzePostsFn(ctx, limits, dimension)
 	}
 	return &models.AnalysisResult{}, nil
 }
@@ -42,6 +46,7 @@ func TestStreamAnalysisHandler_ParseParams(t *testing.T) {
 		queryParams        string
 		isError            bool
 		expectedDuration   time.Duration
+		expectedMaxPosts   int
 		expectedDimension  string
 		expectedErrMessage string
 	}{
@@ -73,12 +78,51 @@ func TestStreamAnalysisHandler_ParseParams(t *testing.T) {
 			expectedDuration:  1*time.Hour + 30*time.Minute + 45*time.Second,
 			expectedDimension: "retweets",
 		},
+		{
+			name:              "max posts instead of duration",
+			queryParams:       "max_posts=500&dimension=likes",
+			isError:           false,
+			expectedMaxPosts:  500,
+			expectedDimension: "likes",
+		},
+		{
+			name:              "max posts alongside duration",
+			queryParams:       "duration=30s&max_posts=500&dimension=likes",
+			isError:           false,
+			expectedDuration:  30 * time.Second,
+			expectedMaxPosts:  500,
+			expectedDimension: "likes",
+		},
+		{
+			name:              "until instead of duration",
+			queryParams:       "until=2999-01-01T00:00:00Z&dimension=likes",
+			isError:           false,
+			expectedDimension: "likes",
+		},
 		{
 			name:               "missing duration",
 			queryParams:        "dimension=likes",
 			isError:            true,
 			expectedErrMessage: "missing required parameter: duration",
 		},
+		{
+			name:               "invalid max posts",
+			queryParams:        "max_posts=0&dimension=likes",
+			isError:            true,
+			expectedErrMessage: "invalid max_posts",
+		},
+		{
+			name:               "invalid until",
+			queryParams:        "until=tomorrow&dimension=likes",
+			isError:            true,
+			expectedErrMessage: "invalid until",
+		},
+		{
+			name:               "until in the past",
+			queryParams:        "until=1705312800&dimension=likes",
+			isError:            true,
+			expectedErrMessage: "until must be in the future",
+		},
 		{
 			name:               "invalid duration",
 			queryParams:        "duration=invalid&dimension=likes",
@@ -113,13 +157,13 @@ func TestStreamAnalysisHandler_ParseParams(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			handler := NewStreamAnalysisHandler(&mockAnalyzerService{}, testLogger())
+			handler := NewStreamAnalysisHandler(&mockAnalyzerService{}, nil, nil, 0, 0, testLogger())
 
 			// Create request
 			req := httptest.NewRequest(http.MethodGet, "/analysis?"+tc.queryParams, nil)
 
 			// Extract query parameters from the request with parseParams
-			duration, dimension, err := handler.parseParams(req)
+			limits, dimension, err := handler.parseParams(req)
 
 			if tc.isError {
 				if err == nil {
@@ -134,8 +178,11 @@ func TestStreamAnalysisHandler_ParseParams(t *testing.T) {
 				if err != nil {
 					t.Errorf("expected no error, got %v", err)
 				}
-				if duration != tc.expectedDuration {
-					t.Errorf("expected duration %v, got %v", tc.expectedDuration, duration)
+				if limits.Duration != tc.expectedDuration {
+					t.Errorf("expected duration %v, got %v", tc.expectedDuration, limits.Duration)
+				}
+				if limits.MaxPosts != tc.expectedMaxPosts {
+					t.Errorf("expected max posts %d, got %d", tc.expectedMaxPosts, limits.MaxPosts)
 				}
 				if dimension != tc.expectedDimension {
 					t.Errorf("expected dimension %q, got %q", tc.expectedDimension, dimension)
@@ -150,48 +197,56 @@ func TestStreamAnalysisHandler_HandleAnalysis_ValidationErrors(t *testing.T) {
 		name               string
 		queryParams        string
 		expectedStatus     int
+		expectedCode       models.ErrorCode
 		expectedErrMessage string
 	}{
 		{
 			name:               "missing duration parameter",
 			queryParams:        "dimension=likes",
 			expectedStatus:     http.StatusBadRequest,
+			expectedCode:       models.ErrorInvalidDuration,
 			expectedErrMessage: "missing required parameter: duration",
 		},
 		{
 			name:               "invalid duration format",
 			queryParams:        "duration=invalid&dimension=likes",
 			expectedStatus:     http.StatusBadRequest,
+			expectedCode:       models.ErrorInvalidDuration,
 			expectedErrMessage: "invalid duration format",
 		},
 		{
 			name:               "negative duration",
 			queryParams:        "duration=-30s&dimension=likes",
 			expectedStatus:     http.StatusBadRequest,
+			expectedCode:       models.ErrorInvalidDuration,
 			expectedErrMessage: "duration must be positive",
 		},
 		{
 			name:               "zero duration",
 			queryParams:        "duration=0s&dimension=likes",
 			expectedStatus:     http.StatusBadRequest,
+			expectedCode:       models.ErrorInvalidDuration,
 			expectedErrMessage: "duration must be positive",
 		},
 		{
 			name:               "missing dimension parameter",
 			queryParams:        "duration=30s",
 			expectedStatus:     http.StatusBadRequest,
+			expectedCode:       models.ErrorUnknownDimension,
 			expectedErrMessage: "missing required parameter: dimension",
 		},
 		{
 			name:               "invalid dimension",
 			queryParams:        "duration=30s&dimension=invalid",
 			expectedStatus:     http.StatusBadRequest,
+			expectedCode:       models.ErrorUnknownDimension,
 			expectedErrMessage: "invalid dimension",
 		},
 		{
 			name:               "dimension with wrong case",
 			queryParams:        "duration=30s&dimension=Likes",
 			expectedStatus:     http.StatusBadRequest,
+			expectedCode:       models.ErrorUnknownDimension,
 			expectedErrMessage: "invalid dimension",
 		},
 	}
@@ -200,13 +255,13 @@ func TestStreamAnalysisHandler_HandleAnalysis_ValidationErrors(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			// Setup mock service (should not be called for validation errors)
 			mockStreamAnalyzer := &mockAnalyzerService{
-				analyzePostsFn: func(ctx context.Context, duration time.Duration, dimension string) (*models.AnalysisResult, error) {
+				analyzePostsFn: func(ctx context.Context, limits models.AnalysisLimits, dimension string) (*models.AnalysisResult, error) {
 					t.Error("AnalyzePosts should not be called for validation errors")
 					return nil, nil
 				},
 			}
 
-			handler := NewStreamAnalysisHandler(mockStreamAnalyzer, testLogger())
+			handler := NewStreamAnalysisHandler(mockStreamAnalyzer, nil, nil, 0, 0, testLogger())
 
 			// Create request
 			req := httptest.NewRequest(http.MethodGet, "/analysis?"+tc.queryParams, nil)
@@ -226,10 +281,13 @@ func TestStreamAnalysisHandler_HandleAnalysis_ValidationErrors(t *testing.T) {
 				t.Fatalf("failed to parse error response: %v", err)
 			}
 
-			// Assert error field is present
-			errMessage, ok := body["error"].(string)
+			// Assert the error code and message are present
+			if code := body["code"]; code != string(tc.expectedCode) {
+				t.Errorf("expected code %q, got %v", tc.expectedCode, code)
+			}
+			errMessage, ok := body["message"].(string)
 			if !ok {
-				t.Fatal("expected error field in response")
+				t.Fatal("expected message field in response")
 			}
 
 			// Check if error message contains expected text
@@ -252,13 +310,13 @@ func TestStreamAnalysisHandler_HandleAnalysis_MethodNotAllowed(t *testing.T) {
 		t.Run("method_"+method, func(t *testing.T) {
 			// Setup mock service
 			mockStreamAnalyzer := &mockAnalyzerService{
-				analyzePostsFn: func(ctx context.Context, duration time.Duration, dimension string) (*models.AnalysisResult, error) {
+				analyzePostsFn: func(ctx context.Context, limits models.AnalysisLimits, dimension string) (*models.AnalysisResult, error) {
 					t.Error("AnalyzePosts should not be called for wrong HTTP method")
 					return nil, nil
 				},
 			}
 
-			handler := NewStreamAnalysisHandler(mockStreamAnalyzer, testLogger())
+			handler := NewStreamAnalysisHandler(mockStreamAnalyzer, nil, nil, 0, 0, testLogger())
 
 			// Create request with wrong method
 			req := httptest.NewRequest(method, "/analysis?duration=30s&dimension=likes", nil)
@@ -278,13 +336,11 @@ func TestStreamAnalysisHandler_HandleAnalysis_MethodNotAllowed(t *testing.T) {
 				t.Fatalf("failed to parse error response: %v", err)
 			}
 
-			// Assert error field is present
-			errMessage, ok := body["error"].(string)
+			// Assert error message
+			errMessage, ok := body["message"].(string)
 			if !ok {
-				t.Fatal("expected error field in response")
+				t.Fatal("expected message field in response")
 			}
-
-			// Assert error message
 			if errMessage != "only GET method is allowed" {
 				t.Errorf("expected error 'only GET method is allowed', got %q", errMessage)
 			}
@@ -319,12 +375,12 @@ func TestStreamAnalysisHandler_HandleAnalysis_ServiceError(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			// Setup mock service that returns an error
 			mockStreamAnalyzer := &mockAnalyzerService{
-				analyzePostsFn: func(ctx context.Context, duration time.Duration, dimension string) (*models.AnalysisResult, error) {
+				analyzePostsFn: func(ctx context.Context, limits models.AnalysisLimits, dimension string) (*models.AnalysisResult, error) {
 					return nil, tc.serviceErr
 				},
 			}
 
-			handler := NewStreamAnalysisHandler(mockStreamAnalyzer, testLogger())
+			handler := NewStreamAnalysisHandler(mockStreamAnalyzer, nil, nil, 0, 0, testLogger())
 
 			// Create request
 			req := httptest.NewRequest(http.MethodGet, "/analysis?duration=30s&dimension=likes", nil)
@@ -344,15 +400,17 @@ func TestStreamAnalysisHandler_HandleAnalysis_ServiceError(t *testing.T) {
 				t.Fatalf("failed to parse error response: %v", err)
 			}
 
-			// Assert error field is present
-			errMessage, ok := body["error"].(string)
+			// Assert unclassified errors are internal errors
+			if code := body["code"]; code != string(models.ErrorInternal) {
+				t.Errorf("expected code %q, got %v", models.ErrorInternal, code)
+			}
+			errMessage, ok := body["message"].(string)
 			if !ok {
-				t.Fatal("expected error field in response")
+				t.Fatal("expected message field in response")
 			}
-
-			// Assert error message
-			if !(strings.Contains(errMessage, "failed to analyze stream")) {
-				t.Errorf("expected error 'failed to analyze stream', got %q", errMessage)
+			// The internal error text is only logged
+			if errMessage != "internal error" {
+				t.Errorf("expected a generic message, got %q", errMessage)
 			}
 		})
 	}
@@ -409,6 +467,18 @@ func TestStreamAnalysisHandler_HandleAnalysis_Success(t *testing.T) {
 			},
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:        "successful analysis with anomalies",
+			queryParams: "duration=1m&dimension=likes",
+			mockResult: &models.AnalysisResult{
+				TotalPosts:       50,
+				MinimumTimestamp: 1554324856,
+				MaximumTimestamp: 1633974046,
+				Average:          1824,
+				Anomalies:        []models.Anomaly{{PostType: "tweet", Dimension: "likes", Value: 9000, ZScore: 5.1, Direction: "spike"}},
+			},
+			expectedStatus: http.StatusOK,
+		},
 		{
 			name:        "successful analysis with zero posts",
 			queryParams: "duration=30s&dimension=likes",
@@ -426,12 +496,12 @@ func TestStreamAnalysisHandler_HandleAnalysis_Success(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			// Setup mock service
 			mockStreamAnalyzer := &mockAnalyzerService{
-				analyzePostsFn: func(ctx context.Context, duration time.Duration, dimension string) (*models.AnalysisResult, error) {
+				analyzePostsFn: func(ctx context.Context, limits models.AnalysisLimits, dimension string) (*models.AnalysisResult, error) {
 					return tc.mockResult, nil
 				},
 			}
 
-			handler := NewStreamAnalysisHandler(mockStreamAnalyzer, testLogger())
+			handler := NewStreamAnalysisHandler(mockStreamAnalyzer, nil, nil, 0, 0, testLogger())
 
 			// Create request
 			req := httptest.NewRequest(http.MethodGet, "/analysis?"+tc.queryParams, nil)
@@ -478,6 +548,402 @@ func TestStreamAnalysisHandler_HandleAnalysis_Success(t *testing.T) {
 			if body[avgKey] != float64(tc.mockResult.Average) {
 				t.Errorf("expected %s=%d, got %v", avgKey, tc.mockResult.Average, body[avgKey])
 			}
+
+			// Results returned without error cover the whole window
+			if body["complete"] != true {
+				t.Errorf("expected complete true, got %v", body["complete"])
+			}
+
+			// Anomalies are only reported when some were detected
+			anomalies, ok := body["anomalies"].([]interface{})
+			if ok != (len(tc.mockResult.Anomalies) > 0) || len(anomalies) != len(tc.mockResult.Anomalies) {
+				t.Errorf("expected %d anomalies, got %v", len(tc.mockResult.Anomalies), body["anomalies"])
+			}
+		})
+	}
+}
+
+// openCircuitStream is a stream failing fast as if its circuit breaker was open
+type openCircuitStream struct {
+	retryAfter time.Duration
+}
+
+func (s *openCircuitStream) ReadEvents(ctx context.Context) (<-chan services.StreamResult, error) {
+	return nil, &services.CircuitOpenError{RetryAfter: s.retryAfter}
+}
+
+func TestStreamAnalysisHandler_HandleAnalysis_CircuitOpen(t *testing.T) {
+	// Setup an analyzer failing fast because the circuit breaker is open
+	streamAnalyzer := services.NewStreamAnalyzer(&openCircuitStream{retryAfter: 12500 * time.Millisecond}, testLogger())
+
+	handler := NewStreamAnalysisHandler(streamAnalyzer, nil, nil, 0, 0, testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/analysis?duration=30s&dimension=likes", nil)
+	w := httptest.NewRecorder()
+	handler.HandleAnalysis(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	// Retry-After is rounded up to the next second
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "13" {
+		t.Errorf("expected Retry-After 13, got %q", retryAfter)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to parse error response: %v", err)
+	}
+
+	if code := body["code"]; code != string(models.ErrorUpstreamUnavailable) {
+		t.Errorf("expected code %q, got %v", models.ErrorUpstreamUnavailable, code)
+	}
+	errMessage, _ := body["message"].(string)
+	if !strings.Contains(errMessage, "circuit breaker is open") {
+		t.Errorf("expected error to mention the circuit breaker, got %q", errMessage)
+	}
+}
+
+func TestStreamAnalysisHandler_HandleAnalysis_PartialResult(t *testing.T) {
+	// Setup mock service returning a partial result with the stream error
+	mockStreamAnalyzer := &mockAnalyzerService{
+		analyzePostsFn: func(ctx context.Context, limits models.AnalysisLimits, dimension string) (*models.AnalysisResult, error) {
+			return &models.AnalysisResult{
+				TotalPosts: 3,
+				Average:    42,
+				Partial:    true,
+				Warnings:   []string{"STREAM_INTERRUPTED: stream interrupted", "analyzed for 1.2s of the requested 30s"},
+			}, models.WrapError(models.ErrorStreamInterrupted, errors.New("parse error"), "partial results (analyzed 3 posts)").
+				WithDetail("posts_analyzed", 3)
+		},
+	}
+
+	handler := NewStreamAnalysisHandler(mockStreamAnalyzer, nil, nil, 0, 0, testLogger())
+
+	tests := []struct {
+		name           string
+		queryParams    string
+		expectedStatus int
+	}{
+		{"partial result by default", "", http.StatusOK},
+		{"strict", "&strict=true", http.StatusGatewayTimeout},
+		{"not strict", "&strict=false", http.StatusOK},
+		{"invalid strict", "&strict=maybe", http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/analysis?duration=30s&dimension=likes"+tc.queryParams, nil)
+			w := httptest.NewRecorder()
+			handler.HandleAnalysis(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				if partial := w.Header().Get(AnalysisPartialHeader); partial != "" {
+					t.Errorf("expected no %s header on an error, got %q", AnalysisPartialHeader, partial)
+				}
+				return
+			}
+
+			if partial := w.Header().Get(AnalysisPartialHeader); partial != "true" {
+				t.Errorf("expected the %s header to be true, got %q", AnalysisPartialHeader, partial)
+			}
+
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to parse response: %v", err)
+			}
+			if body["complete"] != false {
+				t.Errorf("expected complete false, got %v", body["complete"])
+			}
+			if body["total_posts"] != float64(3) {
+				t.Errorf("expected the partial total_posts 3, got %v", body["total_posts"])
+			}
+			if warnings, _ := body["warnings"].([]interface{}); len(warnings) != 2 {
+				t.Errorf("expected the analyzer warnings, got %v", body["warnings"])
+			}
+		})
+	}
+}
+
+func TestStreamAnalysisHandler_HandleAnalysis_PartialResultWarning(t *testing.T) {
+	// Setup mock service returning a partial result without warnings
+	mockStreamAnalyzer := &mockAnalyzerService{
+		analyzePostsFn: func(ctx context.Context, limits models.AnalysisLimits, dimension string) (*models.AnalysisResult, error) {
+			return &models.AnalysisResult{TotalPosts: 3}, models.WrapError(models.ErrorStreamInterrupted, errors.New("parse error"), "partial results (analyzed 3 posts)")
+		},
+	}
+
+	handler := NewStreamAnalysisHandler(mockStreamAnalyzer, nil, nil, 0, 0, testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/analysis?duration=30s&dimension=likes", nil)
+	w := httptest.NewRecorder()
+	handler.HandleAnalysis(w, req)
+
+	// The warning gives the code and the message of the error, not the underlying error
+	var body models.AnalysisResult
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(body.Warnings) != 1 || body.Warnings[0] != "STREAM_INTERRUPTED: partial results (analyzed 3 posts)" {
+		t.Errorf("expected the coded warning, got %q", body.Warnings)
+	}
+}
+
+func TestStreamAnalysisHandler_HandleAnalysis_Limits(t *testing.T) {
+	// Setup mock service ending the analysis on the number of posts
+	var analyzedLimits models.AnalysisLimits
+	mockStreamAnalyzer := &mockAnalyzerService{
+		analyzePostsFn: func(ctx context.Context, limits models.AnalysisLimits, dimension string) (*models.AnalysisResult, error) {
+			analyzedLimits = limits
+			return &models.AnalysisResult{TotalPosts: 500, EndedBy: models.EndedByMaxPosts}, nil
+		},
+	}
+
+	handler := NewStreamAnalysisHandler(mockStreamAnalyzer, nil, nil, 0, 0, testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/analysis?duration=30s&max_posts=500&dimension=likes", nil)
+	w := httptest.NewRecorder()
+	handler.HandleAnalysis(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if analyzedLimits.Duration != 30*time.Second || analyzedLimits.MaxPosts != 500 {
+		t.Errorf("expected the analyzer to get both limits, got %+v", analyzedLimits)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if body["ended_by"] != models.EndedByMaxPosts || body["complete"] != true {
+		t.Errorf("expected a complete analysis ended by max_posts, got %v", body)
+	}
+	if partial := w.Header().Get(AnalysisPartialHeader); partial != "" {
+		t.Errorf("expected no %s header on a complete analysis, got %q", AnalysisPartialHeader, partial)
+	}
+}
+
+func TestStreamAnalysisHandler_ParseParams_DurationBounds(t *testing.T) {
+	handler := NewStreamAnalysisHandler(&mockAnalyzerService{}, nil, nil, time.Second, time.Minute, testLogger())
+
+	tests := []struct {
+		name                string
+		queryParams         string
+		expectedDuration    time.Duration
+		expectedMaxDuration time.Duration
+		expectedErrMessage  string
+	}{
+		{"within the maximum", "duration=30s&dimension=likes", 30 * time.Second, 0, ""},
+		{"under the minimum", "duration=500ms&dimension=likes", 0, 0, "duration must be at least 1s"},
+		{"over the maximum", "duration=2m&dimension=likes", 0, 0, "duration must not exceed 1m0s"},
+		{"until over the maximum", "until=" + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + "&dimension=likes", 0, 0, "until must be within 1m0s from now"},
+		{"max_posts bounded by the maximum", "max_posts=100&dimension=likes", 0, time.Minute, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/analysis?"+tc.queryParams, nil)
+			limits, _, err := handler.parseParams(req)
+
+			if tc.expectedErrMessage != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErrMessage) {
+					t.Errorf("expected error to contain %q, got %v", tc.expectedErrMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if limits.Duration != tc.expectedDuration || limits.MaxDuration != tc.expectedMaxDuration {
+				t.Errorf("expected duration %v and maximum duration %v, got %+v", tc.expectedDuration, tc.expectedMaxDuration, limits)
+			}
+		})
+	}
+}
+
+func TestStreamAnalysisHandler_HandleAnalysis_ConcurrencyLimit(t *testing.T) {
+	limiter := services.NewConcurrencyLimiter(services.ConcurrencyLimits{MaxConcurrent: 10, MaxConcurrentPerClient: 1}, testLogger())
+	handler := NewStreamAnalysisHandler(&mockAnalyzerService{}, nil, limiter, 0, 0, testLogger())
+
+	// The client already runs an analysis
+	release, err := limiter.Acquire(t.Context(), "192.0.2.1")
+	if err != nil {
+		t.Fatalf("expected the first analysis to be admitted, got %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/analysis?duration=5s&dimension=likes", nil)
+	req.RemoteAddr = "192.0.2.1:51234"
+	w := httptest.NewRecorder()
+	handler.HandleAnalysis(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+	if !strings.Contains(w.Body.String(), `"code":"TOO_MANY_REQUESTS"`) || !strings.Contains(w.Body.String(), `"reason":"client_limit"`) {
+		t.Errorf("expected a client limit error, got %s", w.Body.String())
+	}
+
+	// Other clients, and the same client once its analysis ended, are admitted
+	for _, remoteAddr := range []string{"192.0.2.2:51234", "192.0.2.1:51234"} {
+		release()
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.HandleAnalysis(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status %d for %s, got %d", http.StatusOK, remoteAddr, w.Code)
+		}
+	}
+}
+
+// mockRangeAnalyzerService is a mock implementation of the Range Analyzer Service for testing
+type mockRangeAnalyzerService struct {
+	analyzeRangeFn func(ctx context.Context, from, to time.Time, dimension string) (*models.AnalysisResult, error)
+}
+
+// Check interface implementation at compile-time
+var _ services.RangeAnalyzerService = &mockRangeAnalyzerService{}
+
+func (m *mockRangeAnalyzerService) AnalyzeRange(ctx context.Context, from, to time.Time, dimension string, grouping models.AnalysisGrouping) (*models.AnalysisResult, error) {
+	if m.analyzeRangeFn != nil {
+		return m.analyzeRangeFn(ctx, from, to, dimension)
+	}
+	return &models.AnalysisResult{}, nil
+}
+
+func TestStreamAnalysisHandler_ParseRangeParams(t *testing.T) {
+	tests := []struct {
+		name               string
+		queryParams        string
+		isError            bool
+		expectedFrom       time.Time
+		expectedTo         time.Time
+		expectedErrMessage string
+	}{
+		{
+			name:         "RFC 3339 range",
+			queryParams:  "from=2024-01-15T10:00:00Z&to=2024-01-15T11:00:00Z&dimension=likes",
+			expectedFrom: time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+			expectedTo:   time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC),
+		},
+		{
+			name:         "Unix timestamp range",
+			queryParams:  "from=1705312800&to=1705316400&dimension=likes",
+			expectedFrom: time.Unix(1705312800, 0),
+			expectedTo:   time.Unix(1705316400, 0),
+		},
+		{
+			name:               "combined with duration",
+			queryParams:        "from=1705312800&duration=30s&dimension=likes",
+			isError:            true,
+			expectedErrMessage: "duration cannot be combined with from and to",
+		},
+		{
+			name:               "combined with max_posts",
+			queryParams:        "to=1705316400&max_posts=500&dimension=likes",
+			isError:            true,
+			expectedErrMessage: "max_posts cannot be combined with from and to",
+		},
+		{
+			name:               "invalid from",
+			queryParams:        "from=yesterday&dimension=likes",
+			isError:            true,
+			expectedErrMessage: "invalid from: yesterday",
+		},
+		{
+			name:               "from after to",
+			queryParams:        "from=1705316400&to=1705312800&dimension=likes",
+			isError:            true,
+			expectedErrMessage: "from must be before to",
+		},
+		{
+			name:               "missing dimension",
+			queryParams:        "from=1705312800",
+			isError:            true,
+			expectedErrMessage: "missing required parameter: dimension",
+		},
+	}
+
+	handler := NewStreamAnalysisHandler(&mockAnalyzerService{}, &mockRangeAnalyzerService{}, nil, 0, 0, testLogger())
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/analysis?"+tc.queryParams, nil)
+
+			from, to, dimension, err := handler.parseRangeParams(req)
+
+			if tc.isError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				if !strings.Contains(err.Error(), tc.expectedErrMessage) {
+					t.Errorf("expected error containing %q, got %q", tc.expectedErrMessage, err.Error())
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !from.Equal(tc.expectedFrom) || !to.Equal(tc.expectedTo) {
+				t.Errorf("expected range [%s, %s), got [%s, %s)", tc.expectedFrom, tc.expectedTo, from, to)
+			}
+			if dimension != "likes" {
+				t.Errorf("expected dimension likes, got %q", dimension)
+			}
 		})
 	}
 }
+
+func TestStreamAnalysisHandler_HandleAnalysis_Range(t *testing.T) {
+	// The stream analyzer must not be used for a range analysis
+	mockStreamAnalyzer := &mockAnalyzerService{
+		analyzePostsFn: func(ctx context.Context, limits models.AnalysisLimits, dimension string) (*models.AnalysisResult, error) {
+			t.Error("expected the stream analyzer not to be called")
+			return nil, errors.New("unexpected call")
+		},
+	}
+	mockRangeAnalyzer := &mockRangeAnalyzerService{
+		analyzeRangeFn: func(ctx context.Context, from, to time.Time, dimension string) (*models.AnalysisResult, error) {
+			return &models.AnalysisResult{TotalPosts: 3, MinimumTimestamp: 1705312800, MaximumTimestamp: 1705316399, Average: 7}, nil
+		},
+	}
+
+	handler := NewStreamAnalysisHandler(mockStreamAnalyzer, mockRangeAnalyzer, nil, 0, 0, testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/analysis?from=1705312800&to=1705316400&dimension=comments", nil)
+	w := httptest.NewRecorder()
+	handler.HandleAnalysis(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if body["total_posts"] != float64(3) || body["avg_comments"] != float64(7) {
+		t.Errorf("unexpected response body: %v", body)
+	}
+}
+
+func TestStreamAnalysisHandler_HandleAnalysis_RangeArchiveDisabled(t *testing.T) {
+	handler := NewStreamAnalysisHandler(&mockAnalyzerService{}, nil, nil, 0, 0, testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/analysis?from=1705312800&dimension=likes", nil)
+	w := httptest.NewRecorder()
+	handler.HandleAnalysis(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
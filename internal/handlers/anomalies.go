@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/services"
+)
+
+const (
+	// defaultAnomalyLimit is the number of anomalies returned when no limit is requested
+	defaultAnomalyLimit = 100
+
+	// maxAnomalyLimit bounds the number of anomalies returned by a request
+	maxAnomalyLimit = 1000
+)
+
+// AnomalyHandler handles HTTP requests querying the detected anomalies
+type AnomalyHandler struct {
+	anomalies services.AnomalyReporter
+	logger    *slog.Logger
+}
+
+// NewAnomalyHandler creates a new anomaly request handler.
+// The anomalies may be nil when anomaly detection is disabled.
+func NewAnomalyHandler(anomalies services.AnomalyReporter, logger *slog.Logger) *AnomalyHandler {
+	return &AnomalyHandler{
+		anomalies: anomalies,
+		logger:    logger,
+	}
+}
+
+// HandleAnomalies processes GET requests to '/anomalies' endpoint.
+// Returns the detected anomalies matching the filters, newest first.
+func (h *AnomalyHandler) HandleAnomalies(w http.ResponseWriter, r *http.Request) {
+	if h.anomalies == nil {
+		writeError(w, r, h.logger, models.Errorf(models.ErrorFeatureDisabled, "anomaly detection is disabled"))
+		return
+	}
+
+	format, err := negotiateFormat(r, FormatJSON, FormatCSV, FormatNDJSON)
+	if err != nil {
+		writeError(w, r, h.logger, err)
+		return
+	}
+
+	query, err := h.parseParams(r)
+	if err != nil {
+		writeError(w, r, h.logger, err)
+		return
+	}
+
+	anomalies := h.anomalies.Anomalies(query)
+
+	// The rows are the anomalous buckets of the series
+	rows := make([][]any, 0, len(anomalies))
+	for _, anomaly := range anomalies {
+		rows = append(rows, []any{
+			anomaly.PostType, anomaly.Dimension, anomaly.BucketStart, anomaly.BucketEnd, anomaly.Value, anomaly.Posts,
+			anomaly.Baseline, anomaly.Deviation, anomaly.ZScore, anomaly.Direction, anomaly.Method,
+		})
+	}
+
+	writeFormatted(w, h.logger, format, http.StatusOK, formattedResponse{
+		json:  map[string]interface{}{"anomalies": anomalies},
+		table: &table{columns: anomalyColumns, rows: rows},
+	})
+}
+
+// anomalyColumns is the schema of the anomalies in CSV and NDJSON
+var anomalyColumns = []string{
+	"post_type", "dimension", "bucket_start", "bucket_end", "value", "posts",
+	"baseline", "deviation", "z_score", "direction", "method",
+}
+
+// parseParams extracts and validates the anomaly query parameters
+func (h *AnomalyHandler) parseParams(r *http.Request) (models.AnomalyQuery, error) {
+	params := r.URL.Query()
+	query := models.AnomalyQuery{Limit: defaultAnomalyLimit}
+	var err error
+
+	// Parse series parameters (all series when missing)
+	query.PostType = params.Get("post_type")
+	query.Dimension = params.Get("dimension")
+	if query.Dimension != "" && !models.ValidDimensions[query.Dimension] {
+		return query, models.Errorf(models.ErrorUnknownDimension, "invalid dimension: %s (must be one of: likes, comments, favorites, retweets)", query.Dimension)
+	}
+
+	// Parse time range parameters
+	if query.From, err = parseTimeParam("from", params.Get("from")); err != nil {
+		return query, err
+	}
+	if query.To, err = parseTimeParam("to", params.Get("to")); err != nil {
+		return query, err
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return query, models.Errorf(models.ErrorInvalidParameter, "from must be before to")
+	}
+
+	// Parse limit parameter
+	if limitStr := params.Get("limit"); limitStr != "" {
+		query.Limit, err = strconv.Atoi(limitStr)
+		if err != nil || query.Limit < 1 || query.Limit > maxAnomalyLimit {
+			return query, models.Errorf(models.ErrorInvalidParameter, "invalid limit: %s (must be between 1 and %d)", limitStr, maxAnomalyLimit)
+		}
+	}
+
+	return query, nil
+}
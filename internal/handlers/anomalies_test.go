@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/services"
+)
+
+// mockAnomalyReporter is a mock implementation of the Anomaly Reporter for testing
+type mockAnomalyReporter struct {
+	anomalies []models.Anomaly
+	query     models.AnomalyQuery
+}
+
+// Check interface implementation at compile-time
+var _ services.AnomalyReporter = &mockAnomalyReporter{}
+
+func (m *mockAnomalyReporter) Anomalies(query models.AnomalyQuery) []models.Anomaly {
+	m.query = query
+	return m.anomalies
+}
+
+func TestAnomalyHandler_HandleAnomalies(t *testing.T) {
+	tests := []struct {
+		name               string
+		queryParams        string
+		expectedStatus     int
+		expectedQuery      models.AnomalyQuery
+		expectedErrMessage string
+	}{
+		{
+			name:           "no parameters",
+			queryParams:    "",
+			expectedStatus: http.StatusOK,
+			expectedQuery:  models.AnomalyQuery{Limit: defaultAnomalyLimit},
+		},
+		{
+			name:           "all parameters",
+			queryParams:    "post_type=tweet&dimension=likes&from=2024-01-15T10:00:00Z&to=1705316400&limit=10",
+			expectedStatus: http.StatusOK,
+			expectedQuery: models.AnomalyQuery{
+				PostType:  "tweet",
+				Dimension: "likes",
+				From:      time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+				To:        time.Unix(1705316400, 0),
+				Limit:     10,
+			},
+		},
+		{
+			name:               "invalid dimension",
+			queryParams:        "dimension=shares",
+			expectedStatus:     http.StatusBadRequest,
+			expectedErrMessage: "invalid dimension: shares",
+		},
+		{
+			name:               "from after to",
+			queryParams:        "from=1705316400&to=1705312800",
+			expectedStatus:     http.StatusBadRequest,
+			expectedErrMessage: "from must be before to",
+		},
+		{
+			name:               "limit too large",
+			queryParams:        "limit=5000",
+			expectedStatus:     http.StatusBadRequest,
+			expectedErrMessage: "invalid limit: 5000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anomalies := &mockAnomalyReporter{
+				anomalies: []models.Anomaly{{PostType: "tweet", Dimension: "likes", Value: 900, ZScore: 4.2, Direction: "spike"}},
+			}
+			handler := NewAnomalyHandler(anomalies, testLogger())
+
+			req := httptest.NewRequest(http.MethodGet, "/anomalies?"+tt.queryParams, nil)
+			w := httptest.NewRecorder()
+			handler.HandleAnomalies(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				var body map[string]any
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatalf("failed to parse response body: %v", err)
+				}
+				if message, _ := body["message"].(string); !strings.Contains(message, tt.expectedErrMessage) {
+					t.Errorf("expected error containing %q, got %q", tt.expectedErrMessage, message)
+				}
+				return
+			}
+
+			if !anomalies.query.From.Equal(tt.expectedQuery.From) || !anomalies.query.To.Equal(tt.expectedQuery.To) ||
+				anomalies.query.PostType != tt.expectedQuery.PostType || anomalies.query.Dimension != tt.expectedQuery.Dimension ||
+				anomalies.query.Limit != tt.expectedQuery.Limit {
+				t.Errorf("expected query %+v, got %+v", tt.expectedQuery, anomalies.query)
+			}
+
+			var body struct {
+				Anomalies []models.Anomaly `json:"anomalies"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to parse response body: %v", err)
+			}
+			if len(body.Anomalies) != 1 || body.Anomalies[0].Direction != "spike" {
+				t.Errorf("unexpected anomalies: %+v", body.Anomalies)
+			}
+		})
+	}
+}
+
+func TestAnomalyHandler_HandleAnomalies_Disabled(t *testing.T) {
+	handler := NewAnomalyHandler(nil, testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/anomalies", nil)
+	w := httptest.NewRecorder()
+	handler.HandleAnomalies(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/metrics"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// keyConcurrencyRetryAfter is the delay suggested to the clients over the concurrent requests of their key
+const keyConcurrencyRetryAfter = 5 * time.Second
+
+// Invalid API keys allowed per client IP address: a burst, then a few per minute, so that guessing the keys is slow.
+// The rate limits of the routes only apply once authenticated, they do not cover the failed attempts.
+const (
+	failedAuthPerMinute  = 10
+	failedAuthBurst      = 10
+	maxFailedAuthClients = 10000
+)
+
+// adminPrefix is the path prefix of the admin endpoints, a key must list it (or one of its sub-paths) to call the admin actions
+const adminPrefix = "/admin"
+
+// KeyReporter is implemented by components exposing the usage of the API keys
+type KeyReporter interface {
+	KeyStatuses() []models.APIKeyStatus
+}
+
+// Authenticator requires an API key on the requests, and applies the permissions and quotas of the key.
+// The keys are identified by their hash, the keys themselves are never stored.
+type Authenticator struct {
+	header string
+	public []string
+
+	// keys are the states of the keys by hash, ordered keeps the order of the configuration for the reports
+	keys    map[string]*keyState
+	ordered []*keyState
+
+	// failures limits the invalid API keys by client IP address
+	failures *bucketSet
+
+	now    func() time.Time
+	logger *slog.Logger
+}
+
+// keyState tracks the quotas and the usage of an API key
+type keyState struct {
+	key models.APIKey
+
+	// bucket is nil when the request rate of the key is unlimited
+	bucket *tokenBucket
+
+	// usage is shared with the authenticator of the next configuration, see Inherit
+	usage *keyUsage
+}
+
+// keyUsage counts the requests of an API key
+type keyUsage struct {
+	inFlight  atomic.Int64
+	requests  atomic.Int64
+	forbidden atomic.Int64
+	throttled atomic.Int64
+	lastUsed  atomic.Int64
+}
+
+// apiKeyContextKey is the context key of the API key of a request
+type apiKeyContextKey struct{}
+
+// Check interface implementation at compile-time
+var (
+	_ KeyReporter       = &Authenticator{}
+	_ metrics.Collector = &Authenticator{}
+)
+
+// NewAuthenticator creates an authenticator reading the API keys from the header.
+// The requests to the public path prefixes are served without key.
+func NewAuthenticator(header string, keys []models.APIKey, public []string, logger *slog.Logger) *Authenticator {
+	a := &Authenticator{
+		header:   header,
+		public:   public,
+		keys:     make(map[string]*keyState, len(keys)),
+		failures: newBucketSet(maxFailedAuthClients, time.Now()),
+		now:      time.Now,
+		logger:   logger,
+	}
+
+	for _, key := range keys {
+		state := &keyState{key: key, usage: &keyUsage{}}
+		if key.RequestsPerMinute > 0 {
+			state.bucket = newTokenBucket(key.RequestsPerMinute, key.Burst, a.now())
+		}
+		a.keys[key.Hash] = state
+		a.ordered = append(a.ordered, state)
+	}
+
+	return a
+}
+
+// Inherit carries over the invalid keys of the clients, and the usage and the rate quota of the keys of the previous authenticator, identified by their hash,
+// so that a reload of the configuration neither resets the quotas nor forgets the requests in progress.
+// The rate quota is carried over when the rate and the burst of the key are unchanged.
+// It must be called before the authenticator serves requests.
+func (a *Authenticator) Inherit(previous *Authenticator) {
+	// A reload does not give another burst of attempts to the clients guessing the keys
+	a.failures = previous.failures
+
+	for hash, state := range a.keys {
+		prevState, ok := previous.keys[hash]
+		if !ok {
+			continue
+		}
+
+		// The requests in progress on the previous authenticator keep counting against the concurrency quota
+		state.usage = prevState.usage
+		if state.key.RequestsPerMinute == prevState.key.RequestsPerMinute && state.key.Burst == prevState.key.Burst {
+			state.bucket = prevState.bucket
+		}
+	}
+}
+
+// HashAPIKey returns the hash identifying an API key in the configuration
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Middleware rejects the requests without a valid API key (401), to an endpoint the key may not call (403),
+// or over the quotas of the key (429). The key of the accepted requests is available with apiKeyFrom.
+// A client sending too many invalid keys is rejected (429) before its keys are checked.
+// The admin actions change the state of the service: they are never public, and need a key scoped to the admin endpoints.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminAction := isAdminAction(r)
+		if !adminAction && matchesAnyPath(r.URL.Path, a.public) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		raw := r.Header.Get(a.header)
+		if raw == "" {
+			writeError(w, r, a.logger, models.Errorf(models.ErrorUnauthorized, "missing API key in the %s header", a.header))
+			return
+		}
+
+		client := clientAddr(r)
+		if bucket := a.failures.lookup(client); bucket != nil {
+			if ok, retryAfter := bucket.available(a.now()); !ok {
+				a.logger.WarnContext(r.Context(), "Too many invalid API keys from the client", "client", client, "path", r.URL.Path)
+				writeError(w, r, a.logger, models.Errorf(models.ErrorTooManyRequests, "too many invalid API keys, retry later").
+					WithDetail("reason", "auth_failures").
+					WithDetail("retry_after_seconds", ceilSeconds(retryAfter)))
+				return
+			}
+		}
+
+		state, ok := a.keys[HashAPIKey(raw)]
+		if !ok {
+			now := a.now()
+			if bucket, ok := a.failures.get(client, now, func() *tokenBucket {
+				return newTokenBucket(failedAuthPerMinute, failedAuthBurst, now)
+			}); ok {
+				bucket.take(now)
+			}
+
+			a.logger.WarnContext(r.Context(), "Invalid API key", "path", r.URL.Path, "client", client, "remote_addr", r.RemoteAddr)
+			writeError(w, r, a.logger, models.Errorf(models.ErrorUnauthorized, "invalid API key"))
+			return
+		}
+
+		name := state.key.Name
+		state.usage.requests.Add(1)
+		state.usage.lastUsed.Store(a.now().UnixNano())
+
+		if len(state.key.Endpoints) > 0 && !matchesAnyPath(r.URL.Path, state.key.Endpoints) {
+			state.usage.forbidden.Add(1)
+			a.logger.WarnContext(r.Context(), "API key not allowed on the endpoint", "api_key", name, "path", r.URL.Path)
+			writeError(w, r, a.logger, models.Errorf(models.ErrorForbidden, "API key %s is not allowed on %s", name, r.URL.Path))
+			return
+		}
+
+		if adminAction && !adminScoped(&state.key) {
+			state.usage.forbidden.Add(1)
+			a.logger.WarnContext(r.Context(), "API key not scoped to the admin actions", "api_key", name, "method", r.Method, "path", r.URL.Path)
+			writeError(w, r, a.logger, models.Errorf(models.ErrorForbidden, "API key %s must list %s in its endpoints to call %s %s", name, adminPrefix, r.Method, r.URL.Path))
+			return
+		}
+
+		if state.bucket != nil {
+			if result := state.bucket.take(a.now()); !result.allowed {
+				state.usage.throttled.Add(1)
+				a.logger.WarnContext(r.Context(), "API key over its request rate", "api_key", name, "path", r.URL.Path)
+				writeError(w, r, a.logger, models.Errorf(models.ErrorTooManyRequests, "API key %s is over its rate of %d requests per minute", name, state.key.RequestsPerMinute).
+					WithDetail("reason", "key_rate").
+					WithDetail("retry_after_seconds", ceilSeconds(result.retryAfter)))
+				return
+			}
+		}
+
+		inFlight := state.usage.inFlight.Add(1)
+		defer state.usage.inFlight.Add(-1)
+		if state.key.MaxConcurrent > 0 && inFlight > int64(state.key.MaxConcurrent) {
+			state.usage.throttled.Add(1)
+			a.logger.WarnContext(r.Context(), "API key over its concurrent requests", "api_key", name, "path", r.URL.Path)
+			writeError(w, r, a.logger, models.Errorf(models.ErrorTooManyRequests, "API key %s is over its %d concurrent requests", name, state.key.MaxConcurrent).
+				WithDetail("reason", "key_concurrency").
+				WithDetail("retry_after_seconds", int(keyConcurrencyRetryAfter.Seconds())))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, &state.key)))
+	})
+}
+
+// KeyStatuses returns the usage of every API key, in the order of the configuration
+func (a *Authenticator) KeyStatuses() []models.APIKeyStatus {
+	statuses := make([]models.APIKeyStatus, 0, len(a.ordered))
+	for _, state := range a.ordered {
+		status := models.APIKeyStatus{
+			Name:      state.key.Name,
+			Endpoints: state.key.Endpoints,
+			InFlight:  state.usage.inFlight.Load(),
+			Requests:  state.usage.requests.Load(),
+			Forbidden: state.usage.forbidden.Load(),
+			Throttled: state.usage.throttled.Load(),
+		}
+		if lastUsed := state.usage.lastUsed.Load(); lastUsed != 0 {
+			t := time.Unix(0, lastUsed)
+			status.LastUsed = &t
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Collect returns the usage of every API key, labelled by key name
+func (a *Authenticator) Collect() []metrics.Family {
+	requests := metrics.Family{Name: "stream_analyzer_api_key_requests_total", Help: "Requests authenticated by the API key.", Type: metrics.TypeCounter}
+	forbidden := metrics.Family{Name: "stream_analyzer_api_key_forbidden_total", Help: "Requests of the API key to an endpoint it may not call.", Type: metrics.TypeCounter}
+	throttled := metrics.Family{Name: "stream_analyzer_api_key_throttled_total", Help: "Requests of the API key rejected by its rate or concurrency quota.", Type: metrics.TypeCounter}
+	inFlight := metrics.Family{Name: "stream_analyzer_api_key_in_flight", Help: "Requests of the API key in progress.", Type: metrics.TypeGauge}
+
+	for _, status := range a.KeyStatuses() {
+		labels := [][2]string{{"key", status.Name}}
+		requests.Samples = append(requests.Samples, metrics.Sample{Labels: labels, Value: float64(status.Requests)})
+		forbidden.Samples = append(forbidden.Samples, metrics.Sample{Labels: labels, Value: float64(status.Forbidden)})
+		throttled.Samples = append(throttled.Samples, metrics.Sample{Labels: labels, Value: float64(status.Throttled)})
+		inFlight.Samples = append(inFlight.Samples, metrics.Sample{Labels: labels, Value: float64(status.InFlight)})
+	}
+
+	return []metrics.Family{requests, forbidden, throttled, inFlight}
+}
+
+// apiKeyFrom returns the API key of the request, or nil when the API is open
+func apiKeyFrom(ctx context.Context) *models.APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*models.APIKey)
+	return key
+}
+
+// apiKeyName returns the name of the API key of the request, or an empty string when the API is open
+func apiKeyName(ctx context.Context) string {
+	if key := apiKeyFrom(ctx); key != nil {
+		return key.Name
+	}
+	return ""
+}
+
+// matchesAnyPath reports whether the path is one of the prefixes or below it, e.g. "/admin/jobs" for "/admin"
+func matchesAnyPath(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if path == prefix || strings.HasPrefix(path, prefix+"/") || prefix == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isAdminAction reports whether the request changes the state of the service through the admin endpoints
+func isAdminAction(r *http.Request) bool {
+	return r.Method != http.MethodGet && r.Method != http.MethodHead && matchesAnyPath(r.URL.Path, []string{adminPrefix})
+}
+
+// adminScoped reports whether the key lists the admin endpoints, a key allowed on every endpoint does not
+func adminScoped(key *models.APIKey) bool {
+	for _, endpoint := range key.Endpoints {
+		if matchesAnyPath(endpoint, []string{adminPrefix}) {
+			return true
+		}
+	}
+	return false
+}
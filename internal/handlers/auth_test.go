@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// testAuthenticator creates an authenticator of a key limited to the analyses, and of an unrestricted admin key
+func testAuthenticator() *Authenticator {
+	keys := []models.APIKey{
+		{Name: "dashboard", Hash: HashAPIKey("dashboard-key"), Endpoints: []string{"/analysis"}, MaxDuration: time.Minute, RequestsPerMinute: 60, Burst: 2},
+		{Name: "ops", Hash: HashAPIKey("ops-key")},
+	}
+	return NewAuthenticator("X-API-Key", keys, []string{"/health"}, testLogger())
+}
+
+// keyEchoHandler answers with the name of the API key of the request
+var keyEchoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(apiKeyName(r.Context())))
+})
+
+func TestAuthenticator_Middleware(t *testing.T) {
+	handler := testAuthenticator().Middleware(keyEchoHandler)
+
+	tests := []struct {
+		name         string
+		path         string
+		key          string
+		expectedCode int
+		expectedBody string
+	}{
+		{"public endpoint", "/health/stream", "", http.StatusOK, ""},
+		{"missing key", "/analysis", "", http.StatusUnauthorized, `"code":"UNAUTHORIZED"`},
+		{"invalid key", "/analysis", "wrong-key", http.StatusUnauthorized, "invalid API key"},
+		{"allowed endpoint", "/analysis", "dashboard-key", http.StatusOK, "dashboard"},
+		{"allowed sub-path", "/analysis/compare", "dashboard-key", http.StatusOK, "dashboard"},
+		{"forbidden endpoint", "/admin/jobs", "dashboard-key", http.StatusForbidden, `"code":"FORBIDDEN"`},
+		{"prefix is not a path segment", "/analysisx", "dashboard-key", http.StatusForbidden, `"code":"FORBIDDEN"`},
+		{"unrestricted key", "/admin/jobs", "ops-key", http.StatusOK, "ops"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.key != "" {
+				req.Header.Set("X-API-Key", tc.key)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.expectedCode {
+				t.Errorf("expected status %d, got %d", tc.expectedCode, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tc.expectedBody) {
+				t.Errorf("expected body to contain %q, got %s", tc.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthenticator_AdminActions(t *testing.T) {
+	// The admin endpoints are public, the admin actions are not
+	keys := []models.APIKey{
+		{Name: "dashboard", Hash: HashAPIKey("dashboard-key"), Endpoints: []string{"/analysis"}},
+		{Name: "ops", Hash: HashAPIKey("ops-key")},
+		{Name: "admin", Hash: HashAPIKey("admin-key"), Endpoints: []string{"/admin/jobs"}},
+	}
+	handler := NewAuthenticator("X-API-Key", keys, []string{"/admin"}, testLogger()).Middleware(keyEchoHandler)
+
+	tests := []struct {
+		name         string
+		method       string
+		key          string
+		expectedCode int
+		expectedBody string
+	}{
+		{"public admin endpoint", http.MethodGet, "", http.StatusOK, ""},
+		{"action without key", http.MethodPost, "", http.StatusUnauthorized, `"code":"UNAUTHORIZED"`},
+		{"action of a key without the admin endpoints", http.MethodPost, "dashboard-key", http.StatusForbidden, `"code":"FORBIDDEN"`},
+		{"action of an unrestricted key", http.MethodPost, "ops-key", http.StatusForbidden, "must list /admin in its endpoints"},
+		{"action of an admin key", http.MethodPost, "admin-key", http.StatusOK, "admin"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/admin/jobs/hourly/pause", nil)
+			if tc.key != "" {
+				req.Header.Set("X-API-Key", tc.key)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.expectedCode {
+				t.Errorf("expected status %d, got %d", tc.expectedCode, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tc.expectedBody) {
+				t.Errorf("expected body to contain %q, got %s", tc.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthenticator_RateQuota(t *testing.T) {
+	auth := testAuthenticator()
+	clock := time.Unix(1700000000, 0)
+	auth.now = func() time.Time { return clock }
+	for _, state := range auth.keys {
+		if state.bucket != nil {
+			state.bucket.last = clock
+		}
+	}
+	handler := auth.Middleware(keyEchoHandler)
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/analysis", nil)
+		req.Header.Set("X-API-Key", "dashboard-key")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// The burst is allowed at once, then one request per second
+	for i := range 2 {
+		if w := serve(); w.Code != http.StatusOK {
+			t.Fatalf("expected request %d of the burst to be allowed, got %d", i+1, w.Code)
+		}
+	}
+
+	w := serve()
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected a 429 with Retry-After 1, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	clock = clock.Add(time.Second)
+	if w := serve(); w.Code != http.StatusOK {
+		t.Errorf("expected a request to be allowed after a second, got %d", w.Code)
+	}
+
+	// The usage is reported per key
+	statuses := auth.KeyStatuses()
+	if statuses[0].Name != "dashboard" || statuses[0].Requests != 4 || statuses[0].Throttled != 1 || statuses[0].LastUsed == nil {
+		t.Errorf("expected 4 requests with 1 throttled, got %+v", statuses[0])
+	}
+}
+
+func TestAuthenticator_FailedAttempts(t *testing.T) {
+	auth := testAuthenticator()
+	clock := time.Unix(1700000000, 0)
+	auth.now = func() time.Time { return clock }
+	handler := auth.Middleware(keyEchoHandler)
+
+	serve := func(key, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/analysis", nil)
+		req.Header.Set("X-API-Key", key)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := range failedAuthBurst {
+		if w := serve("wrong-key", "192.0.2.1:1234"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected attempt %d to be checked, got %d", i+1, w.Code)
+		}
+	}
+
+	// Once over the limit, the keys of the client are not checked anymore, valid ones included
+	w := serve("ops-key", "192.0.2.1:1234")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "6" || !strings.Contains(w.Body.String(), `"reason":"auth_failures"`) {
+		t.Errorf("expected a 429 with Retry-After 6, got %d %q %s", w.Code, w.Header().Get("Retry-After"), w.Body.String())
+	}
+
+	// Other clients are not affected
+	if w := serve("ops-key", "192.0.2.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("expected another client to be authenticated, got %d", w.Code)
+	}
+
+	clock = clock.Add(6 * time.Second)
+	if w := serve("ops-key", "192.0.2.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("expected the client to be authenticated once an attempt is earned, got %d", w.Code)
+	}
+}
+
+func TestAuthenticator_Inherit(t *testing.T) {
+	clock := time.Unix(1700000000, 0)
+	previous := testAuthenticator()
+	previous.now = func() time.Time { return clock }
+	for _, state := range previous.keys {
+		if state.bucket != nil {
+			state.bucket.last = clock
+		}
+	}
+	handler := previous.Middleware(keyEchoHandler)
+	for range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/analysis", nil)
+		req.Header.Set("X-API-Key", "dashboard-key")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// The quota of the key is still spent after the reload, and its usage is kept
+	auth := testAuthenticator()
+	auth.now = previous.now
+	auth.Inherit(previous)
+	req := httptest.NewRequest(http.MethodGet, "/analysis", nil)
+	req.Header.Set("X-API-Key", "dashboard-key")
+	w := httptest.NewRecorder()
+	auth.Middleware(keyEchoHandler).ServeHTTP(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the burst of the key to be spent, got %d", w.Code)
+	}
+	if status := auth.KeyStatuses()[0]; status.Requests != 3 || status.Throttled != 1 {
+		t.Errorf("expected the usage of the key to be carried over, got %+v", status)
+	}
+}
+
+func TestStreamAnalysisHandler_ParseParams_KeyMaxDuration(t *testing.T) {
+	handler := NewStreamAnalysisHandler(&mockAnalyzerService{}, nil, nil, 0, time.Hour, testLogger())
+	auth := testAuthenticator()
+
+	var limitsErr error
+	auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, limitsErr = handler.parseParams(r)
+	})).ServeHTTP(httptest.NewRecorder(), func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/analysis?duration=5m&dimension=likes", nil)
+		req.Header.Set("X-API-Key", "dashboard-key")
+		return req
+	}())
+
+	// The key bounds its analyses below the server maximum
+	if limitsErr == nil || !strings.Contains(limitsErr.Error(), "duration must not exceed 1m0s") {
+		t.Errorf("expected the maximum duration of the key, got %v", limitsErr)
+	}
+}
+
+func TestAdminHandler_HandleKeys(t *testing.T) {
+	handler := NewAdminHandler(nil, &mockJobManager{}, nil, nil, testAuthenticator(), testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/keys", nil)
+	w := httptest.NewRecorder()
+	handler.HandleKeys(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if strings.Contains(w.Body.String(), "sha256") {
+		t.Errorf("expected the key hashes to stay private, got %s", w.Body.String())
+	}
+
+	var body struct {
+		Keys []models.APIKeyStatus `json:"keys"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if len(body.Keys) != 2 || body.Keys[1].Name != "ops" {
+		t.Errorf("expected the two keys in order, got %+v", body.Keys)
+	}
+}
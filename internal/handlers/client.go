@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// ClientResolver identifies the IP address of the clients, behind the trusted reverse proxies
+type ClientResolver struct {
+	trusted []netip.Prefix
+}
+
+// clientIPContextKey is the context key of the IP address of the client of a request
+type clientIPContextKey struct{}
+
+// NewClientResolver creates a client resolver trusting the X-Forwarded-For header set by the proxies in the ranges
+func NewClientResolver(trusted []netip.Prefix) *ClientResolver {
+	return &ClientResolver{trusted: trusted}
+}
+
+// Middleware stores the IP address of the client in the request context, for the limits applying per client
+func (c *ClientResolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIPContextKey{}, c.clientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clientIP returns the IP address of the client of the request.
+// Behind trusted proxies, it is the last address of X-Forwarded-For that is not a trusted proxy: the addresses
+// before it could be forged by the client. Without trusted proxies, the header is ignored.
+func (c *ClientResolver) clientIP(r *http.Request) string {
+	peer := remoteHost(r)
+
+	addr, err := netip.ParseAddr(peer)
+	if err != nil || !c.isTrusted(addr) {
+		return peer
+	}
+
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+
+	client := peer
+	for _, hop := range slices.Backward(hops) {
+		hopAddr, err := netip.ParseAddr(strings.TrimSpace(hop))
+		if err != nil {
+			break
+		}
+		client = hopAddr.Unmap().String()
+		if !c.isTrusted(hopAddr) {
+			break
+		}
+	}
+	return client
+}
+
+// isTrusted reports whether the address is one of a trusted proxy
+func (c *ClientResolver) isTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range c.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteHost returns the IP address of the peer of the connection
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientID identifies the client of the request by its API key, or by its IP address when the API is open, for the limits applying per client
+func clientID(r *http.Request) string {
+	if name := apiKeyName(r.Context()); name != "" {
+		return "key:" + name
+	}
+
+	return clientAddr(r)
+}
+
+// clientAddr returns the IP address of the client of the request, as resolved by the ClientResolver when it ran
+func clientAddr(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey{}).(string); ok {
+		return ip
+	}
+	return remoteHost(r)
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/services"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/store"
+)
+
+// CompareHandler handles HTTP requests comparing two analyses
+type CompareHandler struct {
+	rangeAnalyzer services.RangeAnalyzerService
+	history       store.HistoryStore
+	logger        *slog.Logger
+}
+
+// NewCompareHandler creates a new comparison request handler.
+// The range analyzer may be nil when the post archive is disabled, and the history when the history store is disabled.
+func NewCompareHandler(rangeAnalyzer services.RangeAnalyzerService, history store.HistoryStore, logger *slog.Logger) *CompareHandler {
+	return &CompareHandler{
+		rangeAnalyzer: rangeAnalyzer,
+		history:       history,
+		logger:        logger,
+	}
+}
+
+// HandleCompare processes GET requests to '/analysis/compare' endpoint.
+// Compares two windows of archived posts, or two analyses of the history.
+func (h *CompareHandler) HandleCompare(w http.ResponseWriter, r *http.Request) {
+	format, err := negotiateFormat(r, FormatJSON, FormatCSV, FormatNDJSON, FormatPrometheus)
+	if err != nil {
+		writeError(w, r, h.logger, err)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Has("baseline") || query.Has("current") {
+		h.handleRecordComparison(w, r, format)
+		return
+	}
+
+	h.handleWindowComparison(w, r, format)
+}
+
+// handleWindowComparison analyzes two windows of archived posts of the same length.
+// The baseline window ends where the current window starts, or offset before the current window ends.
+func (h *CompareHandler) handleWindowComparison(w http.ResponseWriter, r *http.Request, format string) {
+	if h.rangeAnalyzer == nil {
+		writeError(w, r, h.logger, models.Errorf(models.ErrorInvalidParameter, "comparing windows requires the post archive, which is disabled"))
+		return
+	}
+
+	duration, offset, to, dimension, err := h.parseWindowParams(r)
+	if err != nil {
+		writeError(w, r, h.logger, err)
+		return
+	}
+
+	currentFrom := to.Add(-duration)
+	baselineTo := to.Add(-offset)
+	baselineFrom := baselineTo.Add(-duration)
+
+	h.logger.InfoContext(r.Context(), "Comparison request started", "duration", duration, "offset", offset, "to", to, "dimension", dimension)
+
+	baseline, err := h.rangeAnalyzer.AnalyzeRange(r.Context(), baselineFrom, baselineTo, dimension, models.AnalysisGrouping{})
+	if err != nil {
+		writeError(w, r, h.logger, models.WrapError(models.ErrorInternal, err, "failed to analyze baseline window"))
+		return
+	}
+
+	current, err := h.rangeAnalyzer.AnalyzeRange(r.Context(), currentFrom, to, dimension, models.AnalysisGrouping{})
+	if err != nil {
+		writeError(w, r, h.logger, models.WrapError(models.ErrorInternal, err, "failed to analyze current window"))
+		return
+	}
+
+	comparison := services.CompareWindows(dimension,
+		services.NewWindowSummary(baselineFrom, baselineTo, baseline),
+		services.NewWindowSummary(currentFrom, to, current),
+	)
+
+	h.sendResponse(w, format, comparison)
+}
+
+// handleRecordComparison compares two analyses of the history
+func (h *CompareHandler) handleRecordComparison(w http.ResponseWriter, r *http.Request, format string) {
+	if h.history == nil {
+		writeError(w, r, h.logger, models.Errorf(models.ErrorInvalidParameter, "comparing analyses requires the analysis history, which is disabled"))
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Has("duration") || query.Has("offset") || query.Has("to") {
+		writeError(w, r, h.logger, models.Errorf(models.ErrorInvalidParameter, "baseline and current cannot be combined with duration, offset and to"))
+		return
+	}
+
+	var records [2]models.AnalysisRecord
+	for i, param := range []string{"baseline", "current"} {
+		id := query.Get(param)
+		if id == "" {
+			writeError(w, r, h.logger, models.Errorf(models.ErrorInvalidParameter, "missing required parameter: %s", param))
+			return
+		}
+
+		record, err := h.history.Get(id)
+		if errors.Is(err, store.ErrRecordNotFound) {
+			writeError(w, r, h.logger, models.Errorf(models.ErrorNotFound, "analysis %s not found", id))
+			return
+		}
+		if err != nil {
+			writeError(w, r, h.logger, models.WrapError(models.ErrorInternal, err, "failed to query analysis history"))
+			return
+		}
+		records[i] = record
+	}
+
+	// Averages of different dimensions cannot be compared
+	dimension := records[0].Dimension
+	if records[1].Dimension != dimension {
+		writeError(w, r, h.logger, models.Errorf(models.ErrorUnknownDimension, "cannot compare an analysis of %s with an analysis of %s", dimension, records[1].Dimension))
+		return
+	}
+	if requested := query.Get("dimension"); requested != "" && requested != dimension {
+		writeError(w, r, h.logger, models.Errorf(models.ErrorUnknownDimension, "the analyses are of %s, not %s", dimension, requested))
+		return
+	}
+
+	comparison := services.CompareWindows(dimension, services.RecordWindowSummary(records[0]), services.RecordWindowSummary(records[1]))
+
+	h.sendResponse(w, format, comparison)
+}
+
+// compareColumns is the schema of the comparisons in CSV and NDJSON, with a row per metric
+var compareColumns = []string{"dimension", "metric", "baseline", "current", "absolute", "relative"}
+
+// sendResponse sends the comparison in the negotiated format
+func (h *CompareHandler) sendResponse(w http.ResponseWriter, format string, comparison models.Comparison) {
+	metrics := make([]string, 0, len(comparison.Deltas))
+	for metric := range comparison.Deltas {
+		metrics = append(metrics, metric)
+	}
+	slices.Sort(metrics)
+
+	rows := make([][]any, 0, len(metrics))
+	values := metricFamily{name: "stream_comparison_value", help: "Value of a metric over a compared window."}
+	absolute := metricFamily{name: "stream_comparison_absolute_change", help: "Change of a metric from the baseline window to the current window."}
+	relative := metricFamily{name: "stream_comparison_relative_change_percent", help: "Change of a metric in percent of the baseline window."}
+	for _, metric := range metrics {
+		delta := comparison.Deltas[metric]
+		rows = append(rows, []any{comparison.Dimension, metric, delta.Baseline, delta.Current, delta.Absolute, delta.Relative})
+
+		labels := [][2]string{{"dimension", comparison.Dimension}, {"metric", metric}}
+		values.samples = append(values.samples,
+			metricSample{append(slices.Clone(labels), [2]string{"window", "baseline"}), delta.Baseline},
+			metricSample{append(slices.Clone(labels), [2]string{"window", "current"}), delta.Current},
+		)
+		absolute.samples = append(absolute.samples, metricSample{labels, delta.Absolute})
+		if delta.Relative != nil {
+			relative.samples = append(relative.samples, metricSample{labels, *delta.Relative})
+		}
+	}
+
+	pValue := metricFamily{name: "stream_comparison_p_value", help: "P-value of the significance test of the difference between the averages of the windows."}
+	if comparison.Significance != nil {
+		pValue.samples = []metricSample{{[][2]string{{"dimension", comparison.Dimension}, {"test", comparison.Significance.Test}}, comparison.Significance.PValue}}
+	}
+
+	writeFormatted(w, h.logger, format, http.StatusOK, formattedResponse{
+		json:    comparison,
+		table:   &table{columns: compareColumns, rows: rows},
+		metrics: []metricFamily{values, absolute, relative, pValue},
+	})
+}
+
+// parseWindowParams extracts and validates the query parameters of a window comparison.
+// A missing to defaults to now, a missing offset to the duration (consecutive windows).
+func (h *CompareHandler) parseWindowParams(r *http.Request) (time.Duration, time.Duration, time.Time, string, error) {
+	query := r.URL.Query()
+
+	// Parse duration parameter
+	durationStr := query.Get("duration")
+	if durationStr == "" {
+		return 0, 0, time.Time{}, "", models.Errorf(models.ErrorInvalidDuration, "missing required parameter: duration")
+	}
+	duration, err := time.ParseDuration(durationStr)
+	if err != nil {
+		return 0, 0, time.Time{}, "", models.Errorf(models.ErrorInvalidDuration, "invalid duration format: %s (expected format: 5s, 10m, 1h)", durationStr)
+	}
+	if duration <= 0 {
+		return 0, 0, time.Time{}, "", models.Errorf(models.ErrorInvalidDuration, "duration must be positive")
+	}
+
+	// Parse offset parameter, the windows must not overlap for the significance test to hold
+	offset := duration
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		offset, err = time.ParseDuration(offsetStr)
+		if err != nil {
+			return 0, 0, time.Time{}, "", models.Errorf(models.ErrorInvalidParameter, "invalid offset format: %s (expected format: 5s, 10m, 24h)", offsetStr)
+		}
+		if offset < duration {
+			return 0, 0, time.Time{}, "", models.Errorf(models.ErrorInvalidParameter, "offset must be at least the duration, so that the windows do not overlap")
+		}
+	}
+
+	to, err := parseTimeParam("to", query.Get("to"))
+	if err != nil {
+		return 0, 0, time.Time{}, "", err
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	// Parse dimension parameter
+	dimension := query.Get("dimension")
+	if dimension == "" {
+		return 0, 0, time.Time{}, "", models.Errorf(models.ErrorUnknownDimension, "missing required parameter: dimension")
+	}
+
+	// Validate dimension
+	if !models.ValidDimensions[dimension] {
+		return 0, 0, time.Time{}, "", models.Errorf(models.ErrorUnknownDimension, "invalid dimension: %s (must be one of: likes, comments, favorites, retweets)", dimension)
+	}
+
+	return duration, offset, to, dimension, nil
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+func TestCompareHandler_ParseWindowParams(t *testing.T) {
+	tests := []struct {
+		name               string
+		queryParams        string
+		isError            bool
+		expectedOffset     time.Duration
+		expectedErrMessage string
+	}{
+		{
+			name:           "consecutive windows",
+			queryParams:    "duration=10m&dimension=likes",
+			expectedOffset: 10 * time.Minute,
+		},
+		{
+			name:           "period over period",
+			queryParams:    "duration=10m&offset=24h&dimension=likes&to=1705316400",
+			expectedOffset: 24 * time.Hour,
+		},
+		{
+			name:               "missing duration",
+			queryParams:        "dimension=likes",
+			isError:            true,
+			expectedErrMessage: "missing required parameter: duration",
+		},
+		{
+			name:               "overlapping windows",
+			queryParams:        "duration=10m&offset=5m&dimension=likes",
+			isError:            true,
+			expectedErrMessage: "offset must be at least the duration",
+		},
+		{
+			name:               "invalid dimension",
+			queryParams:        "duration=10m&dimension=shares",
+			isError:            true,
+			expectedErrMessage: "invalid dimension: shares",
+		},
+		{
+			name:               "invalid to",
+			queryParams:        "duration=10m&dimension=likes&to=yesterday",
+			isError:            true,
+			expectedErrMessage: "invalid to",
+		},
+	}
+
+	handler := NewCompareHandler(&mockRangeAnalyzerService{}, nil, testLogger())
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/analysis/compare?"+tc.queryParams, nil)
+
+			_, offset, _, _, err := handler.parseWindowParams(req)
+
+			if tc.isError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				if !strings.Contains(err.Error(), tc.expectedErrMessage) {
+					t.Errorf("expected error containing %q, got %q", tc.expectedErrMessage, err.Error())
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if offset != tc.expectedOffset {
+				t.Errorf("expected offset %s, got %s", tc.expectedOffset, offset)
+			}
+		})
+	}
+}
+
+func TestCompareHandler_HandleCompare_Windows(t *testing.T) {
+	to := time.Unix(1705316400, 0)
+
+	// The baseline window averages 20 likes, the current window 22 likes
+	var ranges [][2]time.Time
+	mockRangeAnalyzer := &mockRangeAnalyzerService{
+		analyzeRangeFn: func(ctx context.Context, from, to time.Time, dimension string) (*models.AnalysisResult, error) {
+			ranges = append(ranges, [2]time.Time{from, to})
+			if len(ranges) == 1 {
+				return &models.AnalysisResult{TotalPosts: 10, Average: 20, Mean: 20, Samples: 10, Variance: 4}, nil
+			}
+			return &models.AnalysisResult{TotalPosts: 10, Average: 22, Mean: 22, Samples: 10, Variance: 4}, nil
+		},
+	}
+
+	handler := NewCompareHandler(mockRangeAnalyzer, nil, testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/analysis/compare?duration=10m&dimension=likes&to=1705316400", nil)
+	w := httptest.NewRecorder()
+	handler.HandleCompare(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// The windows are consecutive
+	if len(ranges) != 2 || !ranges[0][0].Equal(to.Add(-20*time.Minute)) || !ranges[0][1].Equal(ranges[1][0]) || !ranges[1][1].Equal(to) {
+		t.Errorf("unexpected windows: %v", ranges)
+	}
+
+	var comparison models.Comparison
+	if err := json.NewDecoder(w.Body).Decode(&comparison); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if delta := comparison.Deltas["avg_likes"]; delta.Absolute != 2 || delta.Relative == nil || *delta.Relative != 10 {
+		t.Errorf("unexpected avg_likes delta: %+v", delta)
+	}
+	if comparison.Significance == nil || !comparison.Significance.Significant {
+		t.Errorf("expected a significant difference, got %+v", comparison.Significance)
+	}
+}
+
+func TestCompareHandler_HandleCompare_Records(t *testing.T) {
+	history := &mockHistoryStore{
+		records: []models.AnalysisRecord{
+			{ID: "a", Dimension: "likes", TotalPosts: 10, Average: 20, Mean: 20, Samples: 10, Variance: 4},
+			{ID: "b", Dimension: "likes", TotalPosts: 12, Average: 22, Mean: 22, Samples: 10, Variance: 4},
+			{ID: "c", Dimension: "comments", TotalPosts: 5, Average: 3},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		queryParams    string
+		expectedStatus int
+	}{
+		{"success", "baseline=a&current=b", http.StatusOK},
+		{"matching dimension", "baseline=a&current=b&dimension=likes", http.StatusOK},
+		{"other dimension requested", "baseline=a&current=b&dimension=comments", http.StatusBadRequest},
+		{"different dimensions", "baseline=a&current=c", http.StatusBadRequest},
+		{"missing current", "baseline=a", http.StatusBadRequest},
+		{"not found", "baseline=a&current=z", http.StatusNotFound},
+		{"combined with a window", "baseline=a&current=b&duration=10m", http.StatusBadRequest},
+	}
+
+	handler := NewCompareHandler(nil, history, testLogger())
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/analysis/compare?"+tc.queryParams, nil)
+			w := httptest.NewRecorder()
+			handler.HandleCompare(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var comparison models.Comparison
+			if err := json.NewDecoder(w.Body).Decode(&comparison); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if comparison.Baseline.RecordID != "a" || comparison.Current.RecordID != "b" || comparison.Deltas["total_posts"].Absolute != 2 {
+				t.Errorf("unexpected comparison: %+v", comparison)
+			}
+		})
+	}
+}
+
+func TestCompareHandler_HandleCompare_Disabled(t *testing.T) {
+	handler := NewCompareHandler(nil, nil, testLogger())
+
+	for _, queryParams := range []string{"duration=10m&dimension=likes", "baseline=a&current=b"} {
+		req := httptest.NewRequest(http.MethodGet, "/analysis/compare?"+queryParams, nil)
+		w := httptest.NewRecorder()
+		handler.HandleCompare(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", queryParams, http.StatusBadRequest, w.Code)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/metrics"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// Output formats of the responses, selected with the format parameter or the Accept header
+const (
+	FormatJSON       = "json"
+	FormatCSV        = "csv"
+	FormatNDJSON     = "ndjson"
+	FormatPrometheus = "prometheus"
+)
+
+// formatContentTypes maps each output format to the content type of its responses
+var formatContentTypes = map[string]string{
+	FormatJSON:       "application/json",
+	FormatCSV:        "text/csv; charset=utf-8",
+	FormatNDJSON:     "application/x-ndjson",
+	FormatPrometheus: metrics.ContentType,
+}
+
+// acceptedMediaTypes maps the media types of the Accept header to an output format
+var acceptedMediaTypes = map[string]string{
+	"application/json":     FormatJSON,
+	"text/csv":             FormatCSV,
+	"application/x-ndjson": FormatNDJSON,
+	"application/ndjson":   FormatNDJSON,
+	"text/plain":           FormatPrometheus,
+}
+
+// negotiateFormat picks the output format among the formats supported by the endpoint.
+// The format parameter takes precedence over the Accept header, JSON is the default.
+func negotiateFormat(r *http.Request, supported ...string) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if _, ok := formatContentTypes[format]; !ok {
+			return "", models.Errorf(models.ErrorInvalidParameter, "invalid format: %s (must be one of: json, csv, ndjson, prometheus)", format)
+		}
+		if !slices.Contains(supported, format) {
+			return "", models.Errorf(models.ErrorUnsupportedFormat, "unsupported format: %s is not available on this endpoint (must be one of: %s)", format, strings.Join(supported, ", "))
+		}
+		return format, nil
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return FormatJSON, nil
+	}
+
+	// Try the media ranges by decreasing quality, keeping the order of the header between equal qualities
+	type mediaRange struct {
+		mediaType string
+		quality   float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			quality = q
+		}
+		if quality > 0 {
+			ranges = append(ranges, mediaRange{mediaType, quality})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].quality > ranges[j].quality })
+
+	for _, mediaRange := range ranges {
+		if mediaRange.mediaType == "*/*" || mediaRange.mediaType == "application/*" {
+			return FormatJSON, nil
+		}
+		if format, ok := acceptedMediaTypes[mediaRange.mediaType]; ok && slices.Contains(supported, format) {
+			return format, nil
+		}
+	}
+
+	// Fall back to JSON rather than rejecting clients that only list unknown media types
+	return FormatJSON, nil
+}
+
+// table is a response rendered as rows, in CSV and NDJSON.
+// The columns are named after the JSON fields, so that all formats share the same schema.
+type table struct {
+	columns []string
+	rows    [][]any
+}
+
+// metricFamily is a response rendered as gauges in the Prometheus text format
+type metricFamily struct {
+	name    string
+	help    string
+	samples []metricSample
+}
+
+// metricSample is a value of a metric family, identified by its labels
+type metricSample struct {
+	labels [][2]string
+	value  float64
+}
+
+// formattedResponse is a response with a representation per output format.
+// A nil table or metrics means the endpoint does not support the corresponding formats.
+type formattedResponse struct {
+	json    any
+	table   *table
+	metrics []metricFamily
+}
+
+// writeFormatted renders the response in the negotiated format and writes it with the given status code
+func writeFormatted(w http.ResponseWriter, logger *slog.Logger, format string, statusCode int, resp formattedResponse) {
+	var buf bytes.Buffer
+	var err error
+
+	switch format {
+	case FormatCSV:
+		err = writeCSV(&buf, resp.table)
+	case FormatNDJSON:
+		err = writeNDJSON(&buf, resp.table)
+	case FormatPrometheus:
+		writePrometheus(&buf, resp.metrics)
+	default:
+		writeJSON(w, logger, statusCode, resp.json)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to encode response", "format", format, "err", err.Error())
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", formatContentTypes[format])
+	w.WriteHeader(statusCode)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		logger.Error("Failed to write response", "err", err.Error())
+	}
+}
+
+// writeCSV writes the table with a header line
+func writeCSV(buf *bytes.Buffer, t *table) error {
+	writer := csv.NewWriter(buf)
+	if err := writer.Write(t.columns); err != nil {
+		return err
+	}
+
+	record := make([]string, len(t.columns))
+	for _, row := range t.rows {
+		for i, value := range row {
+			record[i] = csvCell(value)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvCell formats a value of a table as a CSV cell
+func csvCell(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case *float64:
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []string:
+		return strings.Join(v, "; ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// writeNDJSON writes a JSON object per row, with the fields in the order of the columns
+func writeNDJSON(buf *bytes.Buffer, t *table) error {
+	for _, row := range t.rows {
+		buf.WriteByte('{')
+		for i, value := range row {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(t.columns[i])
+			buf.Write(key)
+			buf.WriteByte(':')
+
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			buf.Write(encoded)
+		}
+		buf.WriteString("}\n")
+	}
+	return nil
+}
+
+// writePrometheus writes the metric families as gauges in the Prometheus text exposition format
+func writePrometheus(buf *bytes.Buffer, metricFamilies []metricFamily) {
+	families := make([]metrics.Family, 0, len(metricFamilies))
+	for _, family := range metricFamilies {
+		samples := make([]metrics.Sample, 0, len(family.samples))
+		for _, sample := range family.samples {
+			samples = append(samples, metrics.Sample{Labels: sample.labels, Value: sample.value})
+		}
+		families = append(families, metrics.Family{Name: family.name, Help: family.help, Type: metrics.TypeGauge, Samples: samples})
+	}
+
+	// Writing to a buffer does not fail
+	metrics.WriteText(buf, families)
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name           string
+		queryParams    string
+		accept         string
+		supported      []string
+		expectedFormat string
+		expectedErr    bool
+	}{
+		{"default", "", "", []string{FormatJSON, FormatCSV}, FormatJSON, false},
+		{"format parameter", "format=csv", "", []string{FormatJSON, FormatCSV}, FormatCSV, false},
+		{"format parameter over accept", "format=csv", "application/x-ndjson", []string{FormatJSON, FormatCSV, FormatNDJSON}, FormatCSV, false},
+		{"accept", "", "text/csv", []string{FormatJSON, FormatCSV}, FormatCSV, false},
+		{"accept with parameters", "", "text/plain; version=0.0.4", []string{FormatJSON, FormatPrometheus}, FormatPrometheus, false},
+		{"accept by quality", "", "text/csv;q=0.5, application/x-ndjson", []string{FormatJSON, FormatCSV, FormatNDJSON}, FormatNDJSON, false},
+		{"accept skips unsupported", "", "text/plain, text/csv;q=0.5", []string{FormatJSON, FormatCSV}, FormatCSV, false},
+		{"accept wildcard", "", "text/html, */*;q=0.8", []string{FormatJSON, FormatCSV}, FormatJSON, false},
+		{"accept unknown falls back to json", "", "image/png", []string{FormatJSON, FormatCSV}, FormatJSON, false},
+		{"invalid format parameter", "format=xml", "", []string{FormatJSON}, "", true},
+		{"unsupported format parameter", "format=prometheus", "", []string{FormatJSON, FormatCSV}, "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/?"+tc.queryParams, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+
+			format, err := negotiateFormat(req, tc.supported...)
+			if tc.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error, got format %q", format)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if format != tc.expectedFormat {
+				t.Errorf("expected format %q, got %q", tc.expectedFormat, format)
+			}
+		})
+	}
+
+	// An unsupported format is not acceptable, an unknown one is a bad request
+	req := httptest.NewRequest(http.MethodGet, "/?format=prometheus", nil)
+	if _, err := negotiateFormat(req, FormatJSON); models.ErrorCodeOf(err) != models.ErrorUnsupportedFormat {
+		t.Errorf("expected an unsupported format error, got %v", err)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/?format=xml", nil)
+	if _, err := negotiateFormat(req, FormatJSON); models.ErrorCodeOf(err) != models.ErrorInvalidParameter {
+		t.Errorf("expected an invalid parameter error, got %v", err)
+	}
+}
+
+func TestStreamAnalysisHandler_HandleAnalysis_Formats(t *testing.T) {
+	mockStreamAnalyzer := &mockAnalyzerService{
+		analyzePostsFn: func(ctx context.Context, limits models.AnalysisLimits, dimension string) (*models.AnalysisResult, error) {
+			return &models.AnalysisResult{
+				TotalPosts:       42,
+				MinimumTimestamp: 1705315800,
+				MaximumTimestamp: 1705315830,
+				Average:          127,
+				EndedBy:          models.EndedByDuration,
+				Warnings:         []string{"first, warning", "second"},
+			}, nil
+		},
+	}
+
+	tests := []struct {
+		name                string
+		queryParams         string
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "csv",
+			queryParams:         "format=csv",
+			expectedContentType: "text/csv; charset=utf-8",
+			expectedBody: "dimension,total_posts,minimum_timestamp,maximum_timestamp,average,complete,ended_by,warnings\n" +
+				"likes,42,1705315800,1705315830,127,true,duration,\"first, warning; second\"\n",
+		},
+		{
+			name:                "ndjson",
+			queryParams:         "format=ndjson",
+			expectedContentType: "application/x-ndjson",
+			expectedBody: `{"dimension":"likes","total_posts":42,"minimum_timestamp":1705315800,"maximum_timestamp":1705315830,` +
+				`"average":127,"complete":true,"ended_by":"duration","warnings":["first, warning","second"]}` + "\n",
+		},
+		{
+			name:                "prometheus",
+			queryParams:         "format=prometheus",
+			expectedContentType: "text/plain; version=0.0.4; charset=utf-8",
+			expectedBody: "# HELP stream_analysis_posts Number of posts received during the analysis.\n" +
+				"# TYPE stream_analysis_posts gauge\n" +
+				"stream_analysis_posts{dimension=\"likes\"} 42\n" +
+				"# HELP stream_analysis_average Average of the dimension over the posts carrying it.\n" +
+				"# TYPE stream_analysis_average gauge\n" +
+				"stream_analysis_average{dimension=\"likes\"} 127\n",
+		},
+	}
+
+	handler := NewStreamAnalysisHandler(mockStreamAnalyzer, nil, nil, 0, 0, testLogger())
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/analysis?duration=1s&dimension=likes&"+tc.queryParams, nil)
+			w := httptest.NewRecorder()
+			handler.HandleAnalysis(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != tc.expectedContentType {
+				t.Errorf("expected Content-Type %q, got %q", tc.expectedContentType, contentType)
+			}
+			if body := w.Body.String(); !strings.HasPrefix(body, tc.expectedBody) {
+				t.Errorf("expected body starting with:\n%s\ngot:\n%s", tc.expectedBody, body)
+			}
+		})
+	}
+}
+
+func TestStreamAnalysisHandler_HandleAnalysis_Groups(t *testing.T) {
+	mockStreamAnalyzer := &mockAnalyzerService{
+		analyzePostsFn: func(ctx context.Context, limits models.AnalysisLimits, dimension string) (*models.AnalysisResult, error) {
+			return &models.AnalysisResult{
+				TotalPosts: 3,
+				Average:    20,
+				Groups: []models.AnalysisGroup{
+					{BucketStart: 1705315800, BucketEnd: 1705315860, PostType: "tweet", TotalPosts: 2, Average: 15},
+					{BucketStart: 1705315860, BucketEnd: 1705315920, PostType: "instagram_media", TotalPosts: 1, Average: 30},
+				},
+			}, nil
+		},
+	}
+
+	tests := []struct {
+		name             string
+		queryParams      string
+		expectedGrouping models.AnalysisGrouping
+		expectedBody     string
+	}{
+		{
+			name:             "csv series by post type",
+			queryParams:      "bucket=1m&group_by=post_type&format=csv",
+			expectedGrouping: models.AnalysisGrouping{Bucket: time.Minute, ByPostType: true},
+			expectedBody: "dimension,bucket_start,bucket_end,post_type,total_posts,average\n" +
+				"likes,1705315800,1705315860,tweet,2,15\n" +
+				"likes,1705315860,1705315920,instagram_media,1,30\n",
+		},
+		{
+			name:             "ndjson series",
+			queryParams:      "bucket=1m&format=ndjson",
+			expectedGrouping: models.AnalysisGrouping{Bucket: time.Minute},
+			expectedBody: `{"dimension":"likes","bucket_start":1705315800,"bucket_end":1705315860,"total_posts":2,"average":15}` + "\n" +
+				`{"dimension":"likes","bucket_start":1705315860,"bucket_end":1705315920,"total_posts":1,"average":30}` + "\n",
+		},
+		{
+			name:             "json breakdown",
+			queryParams:      "group_by=post_type",
+			expectedGrouping: models.AnalysisGrouping{ByPostType: true},
+			expectedBody:     `"breakdown":[{"avg_likes":15,"post_type":"tweet","total_posts":2},{"avg_likes":30,"post_type":"instagram_media","total_posts":1}]`,
+		},
+		{
+			name:             "prometheus breakdown",
+			queryParams:      "group_by=post_type&format=prometheus",
+			expectedGrouping: models.AnalysisGrouping{ByPostType: true},
+			expectedBody: "# HELP stream_analysis_group_posts Number of posts of a group of the analysis, by bucket start and/or post type.\n" +
+				"# TYPE stream_analysis_group_posts gauge\n" +
+				"stream_analysis_group_posts{dimension=\"likes\",post_type=\"tweet\"} 2\n" +
+				"stream_analysis_group_posts{dimension=\"likes\",post_type=\"instagram_media\"} 1\n",
+		},
+	}
+
+	handler := NewStreamAnalysisHandler(mockStreamAnalyzer, nil, nil, 0, 0, testLogger())
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/analysis?duration=1s&dimension=likes&"+tc.queryParams, nil)
+			w := httptest.NewRecorder()
+			handler.HandleAnalysis(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			if mockStreamAnalyzer.grouping != tc.expectedGrouping {
+				t.Errorf("expected grouping %+v, got %+v", tc.expectedGrouping, mockStreamAnalyzer.grouping)
+			}
+			if body := w.Body.String(); !strings.Contains(body, tc.expectedBody) {
+				t.Errorf("expected body containing:\n%s\ngot:\n%s", tc.expectedBody, body)
+			}
+		})
+	}
+
+	// Invalid groupings are rejected before the analysis
+	for _, queryParams := range []string{"bucket=500ms", "bucket=1.5s", "bucket=soon", "group_by=dimension"} {
+		req := httptest.NewRequest(http.MethodGet, "/analysis?duration=1s&dimension=likes&"+queryParams, nil)
+		w := httptest.NewRecorder()
+		handler.HandleAnalysis(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", queryParams, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestStreamAnalysisHandler_HandleAnalysis_FormatErrors(t *testing.T) {
+	analyzed := false
+	mockStreamAnalyzer := &mockAnalyzerService{
+		analyzePostsFn: func(ctx context.Context, limits models.AnalysisLimits, dimension string) (*models.AnalysisResult, error) {
+			analyzed = true
+			return &models.AnalysisResult{}, nil
+		},
+	}
+
+	handler := NewStreamAnalysisHandler(mockStreamAnalyzer, nil, nil, 0, 0, testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/analysis?duration=1s&dimension=likes&format=xml", nil)
+	w := httptest.NewRecorder()
+	handler.HandleAnalysis(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if analyzed {
+		t.Error("expected the format to be rejected before the analysis")
+	}
+}
+
+func TestAnomalyHandler_HandleAnomalies_Formats(t *testing.T) {
+	anomalies := &mockAnomalyReporter{
+		anomalies: []models.Anomaly{{
+			PostType:    "tweet",
+			Dimension:   "likes",
+			BucketStart: time.Date(2024, 1, 15, 10, 4, 0, 0, time.UTC),
+			BucketEnd:   time.Date(2024, 1, 15, 10, 5, 0, 0, time.UTC),
+			Value:       1840.5,
+			Posts:       42,
+			Baseline:    412.3,
+			Deviation:   96.1,
+			ZScore:      14.86,
+			Direction:   "spike",
+			Method:      "ewma",
+		}},
+	}
+
+	handler := NewAnomalyHandler(anomalies, testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/anomalies", nil)
+	req.Header.Set("Accept", "text/csv")
+	w := httptest.NewRecorder()
+	handler.HandleAnomalies(w, req)
+
+	expected := "post_type,dimension,bucket_start,bucket_end,value,posts,baseline,deviation,z_score,direction,method\n" +
+		"tweet,likes,2024-01-15T10:04:00Z,2024-01-15T10:05:00Z,1840.5,42,412.3,96.1,14.86,spike,ewma\n"
+	if w.Code != http.StatusOK || w.Body.String() != expected {
+		t.Errorf("unexpected response %d:\n%s", w.Code, w.Body.String())
+	}
+
+	// The anomalies are not available as metrics
+	req = httptest.NewRequest(http.MethodGet, "/anomalies?format=prometheus", nil)
+	w = httptest.NewRecorder()
+	handler.HandleAnomalies(w, req)
+
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("expected status %d, got %d", http.StatusNotAcceptable, w.Code)
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/services"
+)
+
+// Outcomes of the readiness checks, a failing check reports its reason instead
+const (
+	checkOK       = "ok"
+	checkDisabled = "disabled"
+)
+
+// Lifecycle tracks the version and the start of the service, and whether it is shutting down.
+// It outlives the reloads of the configuration.
+type Lifecycle struct {
+	version   string
+	startedAt time.Time
+	draining  atomic.Bool
+}
+
+// NewLifecycle creates the lifecycle of a service started now
+func NewLifecycle(version string) *Lifecycle {
+	return &Lifecycle{
+		version:   version,
+		startedAt: time.Now(),
+	}
+}
+
+// Drain marks the service as shutting down, so that it reports not ready while the requests in progress finish
+func (l *Lifecycle) Drain() {
+	l.draining.Store(true)
+}
+
+// Draining is true once the service is shutting down
+func (l *Lifecycle) Draining() bool {
+	return l.draining.Load()
+}
+
+// HealthHandler handles HTTP requests reporting the health of the service
+type HealthHandler struct {
+	stream services.HealthReporter
+	probe  services.ProbeReporter
+
+	// concurrency may be nil when the analyses are not limited
+	concurrency services.ConcurrencyReporter
+
+	lifecycle *Lifecycle
+	logger    *slog.Logger
+}
+
+// NewHealthHandler creates a new health request handler.
+// The concurrency may be nil when the analyses are not limited.
+func NewHealthHandler(stream services.HealthReporter, probe services.ProbeReporter, concurrency services.ConcurrencyReporter, lifecycle *Lifecycle, logger *slog.Logger) *HealthHandler {
+	return &HealthHandler{
+		stream:      stream,
+		probe:       probe,
+		concurrency: concurrency,
+		lifecycle:   lifecycle,
+		logger:      logger,
+	}
+}
+
+// HandleStreamHealth processes GET requests to '/health/stream' endpoint.
+// Reports whether the stream is connected, the age of the last event and the recent throughput.
+func (h *HealthHandler) HandleStreamHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.logger, http.StatusOK, h.stream.StreamHealth())
+}
+
+// HandleLiveness processes GET requests to '/healthz' endpoint.
+// Reports that the process is alive and serving requests, during the shutdown too.
+func (h *HealthHandler) HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.logger, http.StatusOK, map[string]string{"status": checkOK})
+}
+
+// HandleReadiness processes GET requests to '/readyz' endpoint.
+// Responds with 200 when the service accepts traffic, 503 otherwise, with the outcome of every check.
+func (h *HealthHandler) HandleReadiness(w http.ResponseWriter, r *http.Request) {
+	readiness := h.readiness(h.probe.ProbeStatus())
+
+	statusCode := http.StatusOK
+	if !readiness.Ready {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, h.logger, statusCode, readiness)
+}
+
+// HandleStatus processes GET requests to '/status' endpoint.
+// Reports the version, the uptime, the analyses in progress and the state of the upstream stream.
+func (h *HealthHandler) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	probe := h.probe.ProbeStatus()
+
+	status := models.ServiceStatus{
+		Version:       h.lifecycle.version,
+		StartedAt:     h.lifecycle.startedAt,
+		UptimeSeconds: time.Since(h.lifecycle.startedAt).Seconds(),
+		Ready:         h.readiness(probe).Ready,
+		ShuttingDown:  h.lifecycle.Draining(),
+		Upstream: models.UpstreamStatus{
+			Probe:  probe,
+			Health: h.stream.StreamHealth(),
+		},
+	}
+
+	if h.concurrency != nil {
+		concurrency := h.concurrency.ConcurrencyStatus()
+		status.ActiveAnalyses = concurrency.Active
+		status.QueuedAnalyses = concurrency.Queued
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, status)
+}
+
+// readiness runs the readiness checks against the outcome of the upstream probes
+func (h *HealthHandler) readiness(probe models.ProbeStatus) models.Readiness {
+	// The requests are served by a generation, which is only built from a valid configuration
+	checks := map[string]string{
+		"config":   checkOK,
+		"shutdown": checkOK,
+		"upstream": checkOK,
+	}
+
+	if h.lifecycle.Draining() {
+		checks["shutdown"] = "shutting down"
+	}
+
+	switch {
+	case !probe.Enabled:
+		checks["upstream"] = checkDisabled
+	case probe.LastProbeAt == nil:
+		checks["upstream"] = "not probed yet"
+	case probe.Stale:
+		checks["upstream"] = "last probe is stale"
+	case !probe.Reachable:
+		checks["upstream"] = "unreachable: " + probe.LastError
+	}
+
+	ready := true
+	for _, outcome := range checks {
+		if outcome != checkOK && outcome != checkDisabled {
+			ready = false
+		}
+	}
+
+	return models.Readiness{Ready: ready, Checks: checks}
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/services"
+)
+
+// mockHealthReporter is a mock implementation of the Health Reporter for testing
+type mockHealthReporter struct {
+	health models.StreamHealth
+}
+
+// Check interface implementation at compile-time
+var _ services.HealthReporter = &mockHealthReporter{}
+
+func (m *mockHealthReporter) StreamHealth() models.StreamHealth {
+	return m.health
+}
+
+// mockProbeReporter is a mock implementation of the Probe Reporter for testing
+type mockProbeReporter struct {
+	status models.ProbeStatus
+}
+
+// Check interface implementation at compile-time
+var _ services.ProbeReporter = &mockProbeReporter{}
+
+func (m *mockProbeReporter) ProbeStatus() models.ProbeStatus {
+	return m.status
+}
+
+func TestHealthHandler_HandleStreamHealth(t *testing.T) {
+	reporter := &mockHealthReporter{
+		health: models.StreamHealth{
+			Connected:         true,
+			ActiveConnections: 2,
+			LastEventAt:       1633974046,
+			LastEventAge:      1.5,
+			EventsPerSecond:   42,
+			Stalls:            1,
+		},
+	}
+
+	handler := NewHealthHandler(reporter, &mockProbeReporter{}, nil, NewLifecycle("test"), testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/health/stream", nil)
+	w := httptest.NewRecorder()
+	handler.HandleStreamHealth(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected Content-Type application/json, got %s", w.Header().Get("Content-Type"))
+	}
+
+	var body models.StreamHealth
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+
+	if body != reporter.health {
+		t.Errorf("expected %+v, got %+v", reporter.health, body)
+	}
+}
+
+func TestHealthHandler_HandleLiveness(t *testing.T) {
+	lifecycle := NewLifecycle("test")
+	lifecycle.Drain()
+	handler := NewHealthHandler(&mockHealthReporter{}, &mockProbeReporter{}, nil, lifecycle, testLogger())
+
+	// The process is alive while it drains
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	w := httptest.NewRecorder()
+	handler.HandleLiveness(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestHealthHandler_HandleReadiness(t *testing.T) {
+	probedAt := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name           string
+		probe          models.ProbeStatus
+		draining       bool
+		expectedStatus int
+		expectedChecks map[string]string
+	}{
+		{
+			name:           "upstream reachable",
+			probe:          models.ProbeStatus{Enabled: true, Reachable: true, LastProbeAt: &probedAt},
+			expectedStatus: http.StatusOK,
+			expectedChecks: map[string]string{"config": "ok", "shutdown": "ok", "upstream": "ok"},
+		},
+		{
+			name:           "probe disabled",
+			probe:          models.ProbeStatus{},
+			expectedStatus: http.StatusOK,
+			expectedChecks: map[string]string{"config": "ok", "shutdown": "ok", "upstream": "disabled"},
+		},
+		{
+			name:           "not probed yet",
+			probe:          models.ProbeStatus{Enabled: true},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedChecks: map[string]string{"config": "ok", "shutdown": "ok", "upstream": "not probed yet"},
+		},
+		{
+			name:           "upstream unreachable",
+			probe:          models.ProbeStatus{Enabled: true, LastProbeAt: &probedAt, LastError: "connection refused"},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedChecks: map[string]string{"config": "ok", "shutdown": "ok", "upstream": "unreachable: connection refused"},
+		},
+		{
+			name:           "stale probe",
+			probe:          models.ProbeStatus{Enabled: true, Reachable: true, LastProbeAt: &probedAt, Stale: true},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedChecks: map[string]string{"config": "ok", "shutdown": "ok", "upstream": "last probe is stale"},
+		},
+		{
+			name:           "shutting down",
+			probe:          models.ProbeStatus{Enabled: true, Reachable: true, LastProbeAt: &probedAt},
+			draining:       true,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedChecks: map[string]string{"config": "ok", "shutdown": "shutting down", "upstream": "ok"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lifecycle := NewLifecycle("test")
+			if tt.draining {
+				lifecycle.Drain()
+			}
+			handler := NewHealthHandler(&mockHealthReporter{}, &mockProbeReporter{status: tt.probe}, nil, lifecycle, testLogger())
+
+			req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			w := httptest.NewRecorder()
+			handler.HandleReadiness(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var body models.Readiness
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to parse response body: %v", err)
+			}
+
+			if body.Ready != (tt.expectedStatus == http.StatusOK) {
+				t.Errorf("expected ready to match the status code, got %v", body.Ready)
+			}
+			for check, expected := range tt.expectedChecks {
+				if body.Checks[check] != expected {
+					t.Errorf("expected check %s to be %q, got %q", check, expected, body.Checks[check])
+				}
+			}
+		})
+	}
+}
+
+func TestHealthHandler_HandleStatus(t *testing.T) {
+	limiter := services.NewConcurrencyLimiter(services.ConcurrencyLimits{MaxConcurrent: 1, QueueSize: 1, QueueTimeout: time.Minute}, testLogger())
+	release, err := limiter.Acquire(context.Background(), "client")
+	if err != nil {
+		t.Fatalf("expected the analysis to be admitted, got %v", err)
+	}
+	defer release()
+
+	probedAt := time.Unix(1700000000, 0)
+	probe := &mockProbeReporter{status: models.ProbeStatus{Enabled: true, LastProbeAt: &probedAt, LastError: "connection refused", LastErrorAt: &probedAt}}
+	reporter := &mockHealthReporter{health: models.StreamHealth{Connected: true, ActiveConnections: 1}}
+
+	lifecycle := NewLifecycle("v1.2.3")
+	lifecycle.Drain()
+	handler := NewHealthHandler(reporter, probe, limiter, lifecycle, testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	w := httptest.NewRecorder()
+	handler.HandleStatus(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var body models.ServiceStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+
+	if body.Version != "v1.2.3" || body.UptimeSeconds < 0 || body.StartedAt.IsZero() {
+		t.Errorf("unexpected version or uptime: %+v", body)
+	}
+	if body.Ready || !body.ShuttingDown {
+		t.Errorf("expected a service shutting down not to be ready, got %+v", body)
+	}
+	if body.ActiveAnalyses != 1 || body.QueuedAnalyses != 0 {
+		t.Errorf("expected 1 active analysis, got %d active and %d queued", body.ActiveAnalyses, body.QueuedAnalyses)
+	}
+	if body.Upstream.Probe.LastError != "connection refused" || body.Upstream.Health != reporter.health {
+		t.Errorf("unexpected upstream status: %+v", body.Upstream)
+	}
+}
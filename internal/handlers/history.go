@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/store"
+)
+
+// HistoryHandler handles HTTP requests querying the analysis history
+type HistoryHandler struct {
+	history store.HistoryStore
+	logger  *slog.Logger
+}
+
+// NewHistoryHandler creates a new history request handler.
+// The history may be nil when the history store is disabled.
+func NewHistoryHandler(history store.HistoryStore, logger *slog.Logger) *HistoryHandler {
+	return &HistoryHandler{
+		history: history,
+		logger:  logger,
+	}
+}
+
+// HandleHistory processes GET requests to '/analyses/history' endpoint.
+// Returns the completed analyses matching the filters, newest first.
+func (h *HistoryHandler) HandleHistory(w http.ResponseWriter, r *http.Request) {
+	if h.history == nil {
+		writeError(w, r, h.logger, models.Errorf(models.ErrorFeatureDisabled, "analysis history is disabled"))
+		return
+	}
+
+	format, err := negotiateFormat(r, FormatJSON, FormatCSV, FormatNDJSON)
+	if err != nil {
+		writeError(w, r, h.logger, err)
+		return
+	}
+
+	query, err := h.parseParams(r)
+	if err != nil {
+		writeError(w, r, h.logger, err)
+		return
+	}
+
+	page, err := h.history.Query(query)
+	if err != nil {
+		writeError(w, r, h.logger, models.WrapError(models.ErrorInternal, err, "failed to query analysis history"))
+		return
+	}
+
+	// The rows are the records of the page
+	rows := make([][]any, 0, len(page.Records))
+	for _, record := range page.Records {
+		// The limits not requested are empty, as they are omitted in JSON
+		var maxPosts, until any
+		if record.MaxPosts > 0 {
+			maxPosts = record.MaxPosts
+		}
+		if record.Until != nil {
+			until = *record.Until
+		}
+		rows = append(rows, []any{
+			record.ID, record.Source, record.Dimension, record.Duration, maxPosts, until, record.EndedBy, record.Partial,
+			record.StartedAt, record.CompletedAt, record.Elapsed, record.TotalPosts, record.MinimumTimestamp, record.MaximumTimestamp, record.Average, record.Warnings,
+			record.Samples, record.Mean, record.Variance,
+		})
+	}
+
+	writeFormatted(w, h.logger, format, http.StatusOK, formattedResponse{
+		json:  page,
+		table: &table{columns: historyColumns, rows: rows},
+	})
+}
+
+// historyColumns is the schema of the analysis history in CSV and NDJSON
+var historyColumns = []string{
+	"id", "source", "dimension", "duration", "max_posts", "until", "ended_by", "partial",
+	"started_at", "completed_at", "elapsed_seconds", "total_posts", "minimum_timestamp", "maximum_timestamp", "average", "warnings",
+	"samples", "mean", "variance",
+}
+
+// parseParams extracts and validates the history query parameters
+func (h *HistoryHandler) parseParams(r *http.Request) (models.HistoryQuery, error) {
+	params := r.URL.Query()
+	var query models.HistoryQuery
+	var err error
+
+	// Parse source parameter (all sources when missing)
+	query.Source = params.Get("source")
+
+	// Parse dimension parameter (all dimensions when missing)
+	query.Dimension = params.Get("dimension")
+	if query.Dimension != "" && !models.ValidDimensions[query.Dimension] {
+		return query, models.Errorf(models.ErrorUnknownDimension, "invalid dimension: %s (must be one of: likes, comments, favorites, retweets)", query.Dimension)
+	}
+
+	// Parse time range parameters
+	if query.From, err = parseTimeParam("from", params.Get("from")); err != nil {
+		return query, err
+	}
+	if query.To, err = parseTimeParam("to", params.Get("to")); err != nil {
+		return query, err
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return query, models.Errorf(models.ErrorInvalidParameter, "from must be before to")
+	}
+
+	// Parse pagination parameters
+	if limitStr := params.Get("limit"); limitStr != "" {
+		query.Limit, err = strconv.Atoi(limitStr)
+		if err != nil || query.Limit < 1 || query.Limit > store.MaxHistoryLimit {
+			return query, models.Errorf(models.ErrorInvalidParameter, "invalid limit: %s (must be between 1 and %d)", limitStr, store.MaxHistoryLimit)
+		}
+	}
+	if offsetStr := params.Get("offset"); offsetStr != "" {
+		query.Offset, err = strconv.Atoi(offsetStr)
+		if err != nil || query.Offset < 0 {
+			return query, models.Errorf(models.ErrorInvalidParameter, "invalid offset: %s (must be a non-negative integer)", offsetStr)
+		}
+	}
+
+	return query, nil
+}
+
+// parseTimeParam parses the value of the named parameter, an RFC 3339 time or a Unix timestamp in seconds.
+// Returns the zero time when the value is empty, and an INVALID_PARAMETER error naming the parameter when it is malformed.
+func parseTimeParam(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, models.Errorf(models.ErrorInvalidParameter, "invalid %s: %s (expected RFC 3339 time or Unix timestamp)", name, value)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/store"
+)
+
+// mockHistoryStore is a mock implementation of the History Store for testing
+type mockHistoryStore struct {
+	queryFn func(query models.HistoryQuery) (*models.HistoryPage, error)
+	records []models.AnalysisRecord
+}
+
+// Check interface implementation at compile-time
+var _ store.HistoryStore = &mockHistoryStore{}
+
+func (m *mockHistoryStore) Append(record models.AnalysisRecord) error {
+	return nil
+}
+
+func (m *mockHistoryStore) Query(query models.HistoryQuery) (*models.HistoryPage, error) {
+	if m.queryFn != nil {
+		return m.queryFn(query)
+	}
+	return &models.HistoryPage{Records: []models.AnalysisRecord{}}, nil
+}
+
+func (m *mockHistoryStore) Get(id string) (models.AnalysisRecord, error) {
+	for _, record := range m.records {
+		if record.ID == id {
+			return record, nil
+		}
+	}
+	return models.AnalysisRecord{}, store.ErrRecordNotFound
+}
+
+func TestHistoryHandler_ParseParams(t *testing.T) {
+	tests := []struct {
+		name               string
+		queryParams        string
+		isError            bool
+		expectedQuery      models.HistoryQuery
+		expectedErrMessage string
+	}{
+		{
+			name:          "no parameters",
+			queryParams:   "",
+			expectedQuery: models.HistoryQuery{},
+		},
+		{
+			name:        "all parameters",
+			queryParams: "source=job:hourly&dimension=likes&from=2024-01-15T10:00:00Z&to=1705316400&limit=10&offset=20",
+			expectedQuery: models.HistoryQuery{
+				Source:    "job:hourly",
+				Dimension: "likes",
+				From:      time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+				To:        time.Unix(1705316400, 0),
+				Limit:     10,
+				Offset:    20,
+			},
+		},
+		{
+			name:               "invalid dimension",
+			queryParams:        "dimension=shares",
+			isError:            true,
+			expectedErrMessage: "invalid dimension: shares",
+		},
+		{
+			name:               "invalid from",
+			queryParams:        "from=yesterday",
+			isError:            true,
+			expectedErrMessage: "invalid from: yesterday",
+		},
+		{
+			name:               "from after to",
+			queryParams:        "from=1705316400&to=1705312800",
+			isError:            true,
+			expectedErrMessage: "from must be before to",
+		},
+		{
+			name:               "limit too large",
+			queryParams:        "limit=5000",
+			isError:            true,
+			expectedErrMessage: "invalid limit: 5000",
+		},
+		{
+			name:               "negative offset",
+			queryParams:        "offset=-1",
+			isError:            true,
+			expectedErrMessage: "invalid offset: -1",
+		},
+	}
+
+	handler := NewHistoryHandler(&mockHistoryStore{}, testLogger())
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/analyses/history?"+tc.queryParams, nil)
+
+			query, err := handler.parseParams(req)
+
+			if tc.isError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				if !strings.Contains(err.Error(), tc.expectedErrMessage) {
+					t.Errorf("expected error containing %q, got %q", tc.expectedErrMessage, err.Error())
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if query.Source != tc.expectedQuery.Source || query.Dimension != tc.expectedQuery.Dimension || query.Limit != tc.expectedQuery.Limit || query.Offset != tc.expectedQuery.Offset {
+				t.Errorf("expected query %+v, got %+v", tc.expectedQuery, query)
+			}
+			if !query.From.Equal(tc.expectedQuery.From) || !query.To.Equal(tc.expectedQuery.To) {
+				t.Errorf("expected time range [%s, %s), got [%s, %s)", tc.expectedQuery.From, tc.expectedQuery.To, query.From, query.To)
+			}
+		})
+	}
+}
+
+func TestHistoryHandler_HandleHistory(t *testing.T) {
+	tests := []struct {
+		name           string
+		history        store.HistoryStore
+		queryParams    string
+		expectedStatus int
+	}{
+		{
+			name: "success",
+			history: &mockHistoryStore{
+				queryFn: func(query models.HistoryQuery) (*models.HistoryPage, error) {
+					return &models.HistoryPage{
+						Records: []models.AnalysisRecord{{ID: "a", Dimension: query.Dimension}},
+						Total:   1,
+						Limit:   store.DefaultHistoryLimit,
+					}, nil
+				},
+			},
+			queryParams:    "dimension=likes",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid parameters",
+			history:        &mockHistoryStore{},
+			queryParams:    "limit=0",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "store error",
+			history: &mockHistoryStore{
+				queryFn: func(query models.HistoryQuery) (*models.HistoryPage, error) {
+					return nil, errors.New("disk error")
+				},
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "history disabled",
+			history:        nil,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewHistoryHandler(tc.history, testLogger())
+
+			req := httptest.NewRequest(http.MethodGet, "/analyses/history?"+tc.queryParams, nil)
+			w := httptest.NewRecorder()
+			handler.HandleHistory(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("expected status %d, got %d", tc.expectedStatus, w.Code)
+			}
+
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var page models.HistoryPage
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatalf("failed to parse response body: %v", err)
+			}
+			if len(page.Records) != 1 || page.Records[0].Dimension != "likes" {
+				t.Errorf("unexpected page: %+v", page)
+			}
+		})
+	}
+}
+
+func TestHistoryHandler_HandleHistory_CSV(t *testing.T) {
+	until := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	history := &mockHistoryStore{
+		queryFn: func(query models.HistoryQuery) (*models.HistoryPage, error) {
+			return &models.HistoryPage{
+				Records: []models.AnalysisRecord{
+					{ID: "a", Source: "api", Dimension: "likes", Duration: "30s", EndedBy: models.EndedByDuration},
+					{ID: "b", Source: "api", Dimension: "likes", MaxPosts: 500, Until: &until, EndedBy: models.EndedByStreamError, Partial: true},
+				},
+				Total: 2,
+			}, nil
+		},
+	}
+	handler := NewHistoryHandler(history, testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/analyses/history?format=csv", nil)
+	w := httptest.NewRecorder()
+	handler.HandleHistory(w, req)
+
+	// The limits not requested are empty cells
+	lines := strings.Split(w.Body.String(), "\n")
+	if len(lines) < 3 || !strings.HasPrefix(lines[0], "id,source,dimension,duration,max_posts,until,ended_by,partial,") {
+		t.Fatalf("unexpected CSV header: %q", w.Body.String())
+	}
+	if !strings.HasPrefix(lines[1], "a,api,likes,30s,,,duration,false,") {
+		t.Errorf("unexpected row of a duration analysis: %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "b,api,likes,,500,2024-01-15T10:30:00Z,stream_error,true,") {
+		t.Errorf("unexpected row of a partial analysis: %q", lines[2])
+	}
+}
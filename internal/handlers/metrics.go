@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/metrics"
+)
+
+// unmatchedRoute labels the requests matching no route, so that unknown paths do not create series
+const unmatchedRoute = "unmatched"
+
+// RequestMetrics counts the requests and measures their latency by route and status code.
+// It outlives the reloads of the configuration, so that the counters are not reset.
+type RequestMetrics struct {
+	requests  *metrics.Counter
+	durations *metrics.Histogram
+}
+
+// Check interface implementation at compile-time
+var _ metrics.Collector = &RequestMetrics{}
+
+// NewRequestMetrics creates new request metrics
+func NewRequestMetrics() *RequestMetrics {
+	return &RequestMetrics{
+		requests:  metrics.NewCounter("stream_analyzer_http_requests_total", "HTTP requests served, by route and status code.", "route", "status"),
+		durations: metrics.NewHistogram("stream_analyzer_http_request_duration_seconds", "Latency of the HTTP requests, by route and status code.", metrics.DefaultBuckets, "route", "status"),
+	}
+}
+
+// Middleware measures the requests, the rejected ones included.
+// The route label is the pattern of the router matching the request, e.g. "/analysis" for "GET /analysis".
+func (m *RequestMetrics) Middleware(routes *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startedAt := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		route := unmatchedRoute
+		if _, pattern := routes.Handler(r); pattern != "" {
+			// Strip the method of the pattern, every route serves a single one
+			_, path, found := strings.Cut(pattern, " ")
+			if !found {
+				path = pattern
+			}
+			route = path
+		}
+
+		status := strconv.Itoa(recorder.status)
+		m.requests.Inc(route, status)
+		m.durations.Observe(time.Since(startedAt).Seconds(), route, status)
+	})
+}
+
+// Collect returns the request counters and latencies
+func (m *RequestMetrics) Collect() []metrics.Family {
+	return append(m.requests.Collect(), m.durations.Collect()...)
+}
+
+// statusRecorder records the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	r.status = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// MetricsHandler handles HTTP requests exposing the metrics of the service
+type MetricsHandler struct {
+	registry *metrics.Registry
+	logger   *slog.Logger
+}
+
+// NewMetricsHandler creates a new metrics request handler
+func NewMetricsHandler(registry *metrics.Registry, logger *slog.Logger) *MetricsHandler {
+	return &MetricsHandler{
+		registry: registry,
+		logger:   logger,
+	}
+}
+
+// HandleMetrics processes GET requests to '/metrics' endpoint.
+// Writes the metrics of every registered component in the Prometheus text format.
+func (h *MetricsHandler) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	h.registry.WriteText(&buf)
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		h.logger.ErrorContext(r.Context(), "Failed to write response", "err", err.Error())
+	}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/metrics"
+)
+
+func TestMetricsHandler_HandleMetrics(t *testing.T) {
+	requestMetrics := NewRequestMetrics()
+	auth := testAuthenticator()
+	limiter, _ := testRateLimiter(RateLimitRoute{Path: "/analysis", RequestsPerMinute: 60, Burst: 1})
+
+	registry := metrics.NewRegistry()
+	registry.Register("http", requestMetrics)
+	registry.Register("auth", auth)
+	registry.Register("rate_limit", limiter)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /analysis", okHandler)
+	mux.HandleFunc("GET /metrics", NewMetricsHandler(registry, testLogger()).HandleMetrics)
+	handler := requestMetrics.Middleware(mux, auth.Middleware(limiter.Middleware(mux)))
+
+	serve := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	serve("/analysis", "dashboard-key")
+	serve("/analysis", "dashboard-key")
+	serve("/analysis", "")
+	serve("/unknown/path", "ops-key")
+
+	w := serve("/metrics", "ops-key")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != metrics.ContentType {
+		t.Fatalf("expected a 200 in the Prometheus text format, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	// The requests rejected by the middlewares are counted, the unknown paths under a single route
+	for _, expected := range []string{
+		`stream_analyzer_http_requests_total{route="/analysis",status="200"} 1`,
+		`stream_analyzer_http_requests_total{route="/analysis",status="401"} 1`,
+		`stream_analyzer_http_requests_total{route="/analysis",status="429"} 1`,
+		`stream_analyzer_http_requests_total{route="unmatched",status="404"} 1`,
+		`stream_analyzer_http_request_duration_seconds_count{route="/analysis",status="200"} 1`,
+		`stream_analyzer_api_key_requests_total{key="dashboard"} 2`,
+		`stream_analyzer_api_key_in_flight{key="ops"} 1`,
+		`stream_analyzer_rate_limit_rejections_total{route="/analysis"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("expected the metrics to contain %q, got:\n%s", expected, w.Body.String())
+		}
+	}
+}
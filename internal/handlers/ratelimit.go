@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"cmp"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/metrics"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+const (
+	// rateLimitSweepInterval is how often the buckets of the clients gone quiet are dropped
+	rateLimitSweepInterval = time.Minute
+
+	// rateLimitFullSweepInterval is how often the buckets are swept at most while the set is full
+	rateLimitFullSweepInterval = time.Second
+
+	// maxRateLimitBuckets caps the buckets in memory, a flood of client addresses is rejected instead of growing it
+	maxRateLimitBuckets = 100000
+)
+
+// RateLimitRoute is the request rate allowed per client on a path prefix
+type RateLimitRoute struct {
+	// Path is the prefix of the limited paths, e.g. "/analysis" (which includes "/analysis/compare")
+	Path string
+
+	// RequestsPerMinute and Burst bound the request rate of every client (Burst defaults to RequestsPerMinute)
+	RequestsPerMinute int
+	Burst             int
+}
+
+// RateLimiter limits the request rate of every client per route, with a token bucket per client and route.
+// The clients are identified by their API key, or by their IP address when the API is open.
+type RateLimiter struct {
+	// routes are ordered by decreasing path length, so that the longest matching prefix applies
+	routes []RateLimitRoute
+
+	buckets *bucketSet
+
+	// rejected counts the requests over the rate by route path
+	mu       sync.Mutex
+	rejected map[string]int64
+
+	now    func() time.Time
+	logger *slog.Logger
+}
+
+// Check interface implementation at compile-time
+var _ metrics.Collector = &RateLimiter{}
+
+// NewRateLimiter creates a new rate limiter of the routes
+func NewRateLimiter(routes []RateLimitRoute, logger *slog.Logger) *RateLimiter {
+	routes = slices.Clone(routes)
+	slices.SortStableFunc(routes, func(a, b RateLimitRoute) int {
+		return cmp.Compare(len(b.Path), len(a.Path))
+	})
+
+	return &RateLimiter{
+		routes:   routes,
+		buckets:  newBucketSet(maxRateLimitBuckets, time.Now()),
+		rejected: make(map[string]int64),
+		now:      time.Now,
+		logger:   logger,
+	}
+}
+
+// Inherit carries over the buckets and the rejection counters of the previous rate limiter, so that a reload of the configuration does not reset the rates.
+// The buckets of a route are carried over when its rate and burst are unchanged.
+// It must be called before the rate limiter serves requests.
+func (l *RateLimiter) Inherit(previous *RateLimiter) {
+	previous.mu.Lock()
+	defer previous.mu.Unlock()
+	previous.buckets.mu.Lock()
+	defer previous.buckets.mu.Unlock()
+
+	unchanged := make(map[string]bool, len(l.routes))
+	for _, route := range l.routes {
+		for _, prevRoute := range previous.routes {
+			if route == prevRoute {
+				unchanged[route.Path] = true
+			}
+		}
+		if count, ok := previous.rejected[route.Path]; ok {
+			l.rejected[route.Path] = count
+		}
+	}
+
+	for key, bucket := range previous.buckets.buckets {
+		path, _, _ := strings.Cut(key, " ")
+		if unchanged[path] {
+			l.buckets.buckets[key] = bucket
+		}
+	}
+}
+
+// Middleware rejects the requests over the rate of their route with a 429 and a Retry-After header.
+// Every limited response carries the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers
+// (IETF draft "RateLimit header fields for HTTP").
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, ok := l.route(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client := clientID(r)
+		now := l.now()
+		bucket, ok := l.buckets.get(route.Path+" "+client, now, func() *tokenBucket {
+			return newTokenBucket(route.RequestsPerMinute, route.Burst, now)
+		})
+		if !ok {
+			l.reject(route)
+			l.logger.WarnContext(r.Context(), "Too many rate limited clients, rejecting a new one", "client", client, "route", route.Path, "max_buckets", maxRateLimitBuckets)
+			writeError(w, r, l.logger, models.Errorf(models.ErrorTooManyRequests, "too many clients on %s, retry later", route.Path).
+				WithDetail("reason", "rate_limit").
+				WithDetail("retry_after_seconds", ceilSeconds(rateLimitSweepInterval)))
+			return
+		}
+		result := bucket.take(now)
+
+		header := w.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(result.limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.reset)))
+		header.Set("RateLimit-Policy", strconv.Itoa(result.limit)+";w="+strconv.Itoa(ceilSeconds(result.window)))
+
+		if !result.allowed {
+			l.reject(route)
+
+			l.logger.WarnContext(r.Context(), "Request over the rate limit", "client", client, "route", route.Path, "path", r.URL.Path)
+			writeError(w, r, l.logger, models.Errorf(models.ErrorTooManyRequests, "rate limit of %d requests per minute exceeded on %s", route.RequestsPerMinute, route.Path).
+				WithDetail("reason", "rate_limit").
+				WithDetail("retry_after_seconds", ceilSeconds(result.retryAfter)))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// route returns the route of the longest prefix matching the path
+func (l *RateLimiter) route(path string) (RateLimitRoute, bool) {
+	for _, route := range l.routes {
+		if matchesAnyPath(path, []string{route.Path}) {
+			return route, true
+		}
+	}
+	return RateLimitRoute{}, false
+}
+
+// reject counts a request rejected on the route
+func (l *RateLimiter) reject(route RateLimitRoute) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rejected[route.Path]++
+}
+
+// BucketCount returns the number of buckets in memory
+func (l *RateLimiter) BucketCount() int {
+	return l.buckets.len()
+}
+
+// Collect returns the requests rejected per route and the buckets in memory
+func (l *RateLimiter) Collect() []metrics.Family {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rejected := metrics.Family{Name: "stream_analyzer_rate_limit_rejections_total", Help: "Requests rejected for exceeding the rate limit of their route.", Type: metrics.TypeCounter}
+	for _, route := range l.routes {
+		rejected.Samples = append(rejected.Samples, metrics.Sample{Labels: [][2]string{{"route", route.Path}}, Value: float64(l.rejected[route.Path])})
+	}
+	buckets := metrics.Family{Name: "stream_analyzer_rate_limit_buckets", Help: "Token buckets of the active clients in memory.", Type: metrics.TypeGauge, Samples: []metrics.Sample{{Value: float64(l.buckets.len())}}}
+
+	return []metrics.Family{rejected, buckets}
+}
+
+// ceilSeconds rounds a duration up to whole seconds, as the rate limit headers expect
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// bucketSet holds the token buckets of the clients by key, up to a maximum number.
+// The buckets full again are dropped periodically: recreating them is lossless, so memory stays bounded by the active clients.
+type bucketSet struct {
+	max int
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// newBucketSet creates an empty set of at most max buckets
+func newBucketSet(max int, now time.Time) *bucketSet {
+	return &bucketSet{
+		max:       max,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: now,
+	}
+}
+
+// get returns the bucket of the key, created with newBucket on its first use.
+// Returns false when the set is full of buckets still in use, the client must then be rejected.
+func (s *bucketSet) get(key string, now time.Time, newBucket func() *tokenBucket) (*tokenBucket, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweepLocked(now, rateLimitSweepInterval)
+	if bucket, ok := s.buckets[key]; ok {
+		return bucket, true
+	}
+
+	// A full set is swept sooner, at most every rateLimitFullSweepInterval so that a flood does not sweep at every request
+	if len(s.buckets) >= s.max {
+		s.sweepLocked(now, rateLimitFullSweepInterval)
+		if len(s.buckets) >= s.max {
+			return nil, false
+		}
+	}
+
+	bucket := newBucket()
+	s.buckets[key] = bucket
+	return bucket, true
+}
+
+// lookup returns the bucket of the key, nil when it has none
+func (s *bucketSet) lookup(key string) *tokenBucket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.buckets[key]
+}
+
+// len returns the number of buckets in the set
+func (s *bucketSet) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.buckets)
+}
+
+// sweepLocked drops the buckets full again when the last sweep is older than the interval, s.mu must be held
+func (s *bucketSet) sweepLocked(now time.Time, interval time.Duration) {
+	if now.Sub(s.lastSweep) < interval {
+		return
+	}
+
+	for key, bucket := range s.buckets {
+		if bucket.full(now) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// tokenBucket allows bursts of requests up to its capacity, refilled at a constant rate
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// takeResult is the outcome of a request on a token bucket
+type takeResult struct {
+	allowed bool
+
+	// limit is the capacity of the bucket, remaining the tokens left
+	limit     int
+	remaining int
+
+	// retryAfter is the wait before the next token when the request is not allowed,
+	// reset the wait before the bucket is full again, and window the time to refill an empty bucket
+	retryAfter time.Duration
+	reset      time.Duration
+	window     time.Duration
+}
+
+// newTokenBucket creates a full bucket allowing perMinute requests per minute, and up to burst at once (perMinute when zero)
+func newTokenBucket(perMinute, burst int, now time.Time) *tokenBucket {
+	if burst == 0 {
+		burst = perMinute
+	}
+	return &tokenBucket{
+		rate:   float64(perMinute) / 60,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// take consumes a token if one is available
+func (b *tokenBucket) take(now time.Time) takeResult {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+
+	result := takeResult{
+		limit:  int(b.burst),
+		window: b.wait(b.burst),
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.allowed = true
+	} else {
+		result.retryAfter = b.wait(1 - b.tokens)
+	}
+	result.remaining = int(b.tokens)
+	result.reset = b.wait(b.burst - b.tokens)
+	return result
+}
+
+// available reports whether a token is available without consuming it, or else the wait before the next one
+func (b *tokenBucket) available(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	if b.tokens >= 1 {
+		return true, 0
+	}
+	return false, b.wait(1 - b.tokens)
+}
+
+// full reports whether the bucket is full again, it then behaves as a new one
+func (b *tokenBucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// refill adds the tokens earned since the last update, up to the burst, b.mu must be held
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// wait returns the time to earn the tokens
+func (b *tokenBucket) wait(tokens float64) time.Duration {
+	return time.Duration(tokens / b.rate * float64(time.Second))
+}
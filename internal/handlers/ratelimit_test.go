@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRateLimiter creates a rate limiter with a manually advanced clock
+func testRateLimiter(routes ...RateLimitRoute) (*RateLimiter, *time.Time) {
+	limiter := NewRateLimiter(routes, testLogger())
+	clock := time.Unix(1700000000, 0)
+	limiter.now = func() time.Time { return clock }
+	limiter.buckets.lastSweep = clock
+	return limiter, &clock
+}
+
+// okHandler answers every request with a 200
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	limiter, clock := testRateLimiter(RateLimitRoute{Path: "/analysis", RequestsPerMinute: 6, Burst: 2})
+	handler := limiter.Middleware(okHandler)
+
+	serve := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// The burst is allowed, with the remaining requests in the headers
+	for _, expectedRemaining := range []string{"1", "0"} {
+		w := serve("/analysis", "192.0.2.1:1234")
+		if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != expectedRemaining {
+			t.Errorf("expected a 200 with %s remaining, got %d %v", expectedRemaining, w.Code, w.Header())
+		}
+	}
+
+	// Then one request every 10 seconds
+	w := serve("/analysis/compare", "192.0.2.1:1234")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "10" || w.Header().Get("RateLimit-Reset") != "20" {
+		t.Errorf("expected a 429 with Retry-After 10 and RateLimit-Reset 20, got %d %v", w.Code, w.Header())
+	}
+	if !strings.Contains(w.Body.String(), `"reason":"rate_limit"`) {
+		t.Errorf("expected a rate limit error, got %s", w.Body.String())
+	}
+
+	// Other clients and other routes are not limited
+	if w := serve("/analysis", "192.0.2.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("expected another client to be allowed, got %d", w.Code)
+	}
+	if w := serve("/anomalies", "192.0.2.1:1234"); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("expected an unlimited route without headers, got %d %v", w.Code, w.Header())
+	}
+
+	*clock = clock.Add(10 * time.Second)
+	if w := serve("/analysis", "192.0.2.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("expected a request to be allowed after 10 seconds, got %d", w.Code)
+	}
+}
+
+func TestRateLimiter_LongestRoute(t *testing.T) {
+	limiter, _ := testRateLimiter(
+		RateLimitRoute{Path: "/", RequestsPerMinute: 100},
+		RateLimitRoute{Path: "/analysis", RequestsPerMinute: 10},
+	)
+
+	tests := []struct {
+		path         string
+		expectedPath string
+	}{
+		{"/analysis", "/analysis"},
+		{"/analysis/compare", "/analysis"},
+		{"/analyses/history", "/"},
+	}
+
+	for _, tc := range tests {
+		route, ok := limiter.route(tc.path)
+		if !ok || route.Path != tc.expectedPath {
+			t.Errorf("expected route %s for %s, got %v", tc.expectedPath, tc.path, route)
+		}
+	}
+}
+
+func TestRateLimiter_DropsFullBuckets(t *testing.T) {
+	limiter, clock := testRateLimiter(RateLimitRoute{Path: "/", RequestsPerMinute: 60})
+	handler := limiter.Middleware(okHandler)
+
+	for i := range 100 {
+		req := httptest.NewRequest(http.MethodGet, "/analysis", nil)
+		req.RemoteAddr = "192.0.2." + strings.Repeat("1", i%3+1) + ":1234"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if count := limiter.BucketCount(); count != 3 {
+		t.Fatalf("expected a bucket per client, got %d", count)
+	}
+
+	// Once refilled, the buckets of the quiet clients are dropped with the next sweep
+	*clock = clock.Add(2 * time.Minute)
+	req := httptest.NewRequest(http.MethodGet, "/analysis", nil)
+	req.RemoteAddr = "198.51.100.1:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if count := limiter.BucketCount(); count != 1 {
+		t.Errorf("expected only the bucket of the new client, got %d", count)
+	}
+}
+
+func TestRateLimiter_BucketCap(t *testing.T) {
+	limiter, clock := testRateLimiter(RateLimitRoute{Path: "/", RequestsPerMinute: 60})
+	limiter.buckets.max = 2
+	handler := limiter.Middleware(okHandler)
+
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/analysis", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	serve("192.0.2.1:1234")
+	serve("192.0.2.2:1234")
+
+	// The set is full of buckets in use: a new client is rejected, the known ones are still served
+	if w := serve("192.0.2.3:1234"); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected a new client to be rejected with a 429, got %d %v", w.Code, w.Header())
+	}
+	if w := serve("192.0.2.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("expected a known client to be served, got %d", w.Code)
+	}
+	if count := limiter.BucketCount(); count != 2 {
+		t.Errorf("expected the buckets to be capped at 2, got %d", count)
+	}
+
+	// Once the buckets refill, the full set is swept for the new client
+	*clock = clock.Add(2 * time.Second)
+	if w := serve("192.0.2.3:1234"); w.Code != http.StatusOK {
+		t.Errorf("expected the new client to be served after the sweep, got %d", w.Code)
+	}
+}
+
+func TestRateLimiter_Inherit(t *testing.T) {
+	previous, _ := testRateLimiter(RateLimitRoute{Path: "/analysis", RequestsPerMinute: 6, Burst: 1}, RateLimitRoute{Path: "/anomalies", RequestsPerMinute: 6, Burst: 1})
+	handler := previous.Middleware(okHandler)
+	for _, path := range []string{"/analysis", "/anomalies"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// The bucket of the unchanged route is carried over, the one of the changed route starts over
+	limiter, _ := testRateLimiter(RateLimitRoute{Path: "/analysis", RequestsPerMinute: 6, Burst: 1}, RateLimitRoute{Path: "/anomalies", RequestsPerMinute: 12, Burst: 1})
+	limiter.Inherit(previous)
+	handler = limiter.Middleware(okHandler)
+
+	for path, expectedCode := range map[string]int{"/analysis": http.StatusTooManyRequests, "/anomalies": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != expectedCode {
+			t.Errorf("expected status %d on %s, got %d", expectedCode, path, w.Code)
+		}
+	}
+}
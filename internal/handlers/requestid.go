@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/logging"
+)
+
+const (
+	// RequestIDHeader carries the identifier of a request, set by the client or generated by the server
+	RequestIDHeader = "X-Request-ID"
+
+	// maxRequestIDLength bounds the identifiers accepted from the clients
+	maxRequestIDLength = 128
+)
+
+// RequestIDMiddleware identifies every request with the X-Request-ID header of the client, or a generated identifier.
+// The identifier is echoed in the response header and stored in the context, so that the logs of the request carry it.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestID(w, r)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// requestID returns the identifier of the request: the one of the middleware, else the one of the client or a generated one.
+// The identifier is echoed in the response header so that the client can report it.
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	if id := logging.RequestID(r.Context()); id != "" {
+		return id
+	}
+
+	id := r.Header.Get(RequestIDHeader)
+	if !validRequestID(id) {
+		id = logging.NewID()
+	}
+
+	w.Header().Set(RequestIDHeader, id)
+	return id
+}
+
+// validRequestID reports whether the identifier of a client can be used as is: not empty, bounded,
+// and made of printable ASCII characters without spaces, so that it cannot forge log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := range len(id) {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
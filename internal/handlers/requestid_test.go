@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/logging"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{"client identifier", "client-id-42", "client-id-42"},
+		{"missing identifier", "", ""},
+		{"identifier too long", strings.Repeat("a", 129), ""},
+		{"identifier with a line break", "id\nlevel=ERROR", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var contextID string
+			handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contextID = logging.RequestID(r.Context())
+				writeError(w, r, testLogger(), models.Errorf(models.ErrorNotFound, "not found"))
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/analysis", nil)
+			if tc.header != "" {
+				req.Header.Set(RequestIDHeader, tc.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			if tc.expected != "" && id != tc.expected {
+				t.Errorf("expected request id %q, got %q", tc.expected, id)
+			}
+			if tc.expected == "" && len(id) != 16 {
+				t.Errorf("expected a generated request id, got %q", id)
+			}
+
+			// The handlers and the error responses share the identifier of the middleware
+			if contextID != id || !strings.Contains(w.Body.String(), `"request_id":"`+id+`"`) {
+				t.Errorf("expected request id %q in the context and the body, got %q and %s", id, contextID, w.Body.String())
+			}
+		})
+	}
+}
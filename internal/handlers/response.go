@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/logging"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// writeJSON encodes the value as JSON and writes it with the given status code
+func writeJSON(w http.ResponseWriter, logger *slog.Logger, statusCode int, v any) {
+	respBytes, err := json.Marshal(v)
+	if err != nil {
+		logger.Error("Failed to encode response", "err", err.Error())
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if _, err := w.Write(respBytes); err != nil {
+		logger.Error("Failed to write response", "err", err.Error())
+	}
+}
+
+const (
+	// StatusClientClosedRequest is the non-standard status code of the requests abandoned by the client
+	StatusClientClosedRequest = 499
+
+	// problemContentType is the content type of the error responses
+	problemContentType = "application/problem+json"
+
+	// problemTypePrefix prefixes the error code in the problem type URI
+	problemTypePrefix = "urn:stream-analyzer:problem:"
+)
+
+// errorStatuses maps each error code to the status code of its responses
+var errorStatuses = map[models.ErrorCode]int{
+	models.ErrorInvalidDuration:     http.StatusBadRequest,
+	models.ErrorUnknownDimension:    http.StatusBadRequest,
+	models.ErrorInvalidParameter:    http.StatusBadRequest,
+	models.ErrorUnsupportedFormat:   http.StatusNotAcceptable,
+	models.ErrorMethodNotAllowed:    http.StatusMethodNotAllowed,
+	models.ErrorNotFound:            http.StatusNotFound,
+	models.ErrorConflict:            http.StatusConflict,
+	models.ErrorFeatureDisabled:     http.StatusNotFound,
+	models.ErrorUnauthorized:        http.StatusUnauthorized,
+	models.ErrorForbidden:           http.StatusForbidden,
+	models.ErrorTooManyRequests:     http.StatusTooManyRequests,
+	models.ErrorUpstreamUnavailable: http.StatusServiceUnavailable,
+	models.ErrorStreamInterrupted:   http.StatusGatewayTimeout,
+	models.ErrorShuttingDown:        http.StatusServiceUnavailable,
+	models.ErrorClientClosedRequest: StatusClientClosedRequest,
+	models.ErrorInternal:            http.StatusInternalServerError,
+}
+
+// problem is an error response body following RFC 7807 (problem details for HTTP APIs)
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`
+	Instance string `json:"instance"`
+
+	// Extension members: Message repeats Detail for the clients unaware of RFC 7807
+	Code      models.ErrorCode `json:"code"`
+	Message   string           `json:"message"`
+	Details   map[string]any   `json:"details,omitempty"`
+	RequestID string           `json:"request_id"`
+}
+
+// writeError writes the error as problem details, with the status code of its error code.
+// Errors without a code are internal errors.
+// The detail is the message of the coded error, never the errors it wraps: they are logged for the 5xx responses.
+func writeError(w http.ResponseWriter, r *http.Request, logger *slog.Logger, err error) {
+	var codedErr *models.Error
+	if !errors.As(err, &codedErr) {
+		codedErr = models.WrapError(models.ErrorInternal, err, "internal error")
+	}
+
+	statusCode, ok := errorStatuses[codedErr.Code]
+	if !ok {
+		statusCode = http.StatusInternalServerError
+	}
+
+	// The full error chain is only logged, the client gets the message of the coded error
+	requestID := requestID(w, r)
+	if statusCode >= http.StatusInternalServerError {
+		logger.ErrorContext(logging.WithRequestID(r.Context(), requestID), "Request failed", "code", codedErr.Code, "err", err)
+	}
+
+	// The internal errors describe the server, not the request
+	message := codedErr.Message
+	if codedErr.Code == models.ErrorInternal {
+		message = "internal error"
+	}
+
+	// Tell the client when to retry, e.g. while the circuit breaker is open
+	if retryAfter, ok := codedErr.Details["retry_after_seconds"].(int); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+
+	body := problem{
+		Type:      problemTypePrefix + strings.ToLower(strings.ReplaceAll(string(codedErr.Code), "_", "-")),
+		Title:     problemTitle(codedErr.Code),
+		Status:    statusCode,
+		Detail:    message,
+		Instance:  r.URL.Path,
+		Code:      codedErr.Code,
+		Message:   message,
+		Details:   codedErr.Details,
+		RequestID: requestID,
+	}
+
+	respBytes, marshalErr := json.Marshal(body)
+	if marshalErr != nil {
+		logger.Error("Failed to encode response", "err", marshalErr.Error())
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(statusCode)
+
+	if _, err := w.Write(respBytes); err != nil {
+		logger.Error("Failed to write response", "err", err.Error())
+	}
+}
+
+// problemTitle returns the human-readable summary of an error code, e.g. "Invalid duration" for INVALID_DURATION
+func problemTitle(code models.ErrorCode) string {
+	title := strings.ToLower(strings.ReplaceAll(string(code), "_", " "))
+	if title == "" {
+		return title
+	}
+	return strings.ToUpper(title[:1]) + title[1:]
+}
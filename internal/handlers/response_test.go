@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   models.ErrorCode
+
+		// expectedMessage is the message of the coded error, never the errors it wraps
+		expectedMessage string
+	}{
+		{"invalid duration", models.Errorf(models.ErrorInvalidDuration, "duration must be positive"), http.StatusBadRequest, models.ErrorInvalidDuration, "duration must be positive"},
+		{"upstream unavailable", models.Errorf(models.ErrorUpstreamUnavailable, "stream unavailable"), http.StatusServiceUnavailable, models.ErrorUpstreamUnavailable, "stream unavailable"},
+		{"stream interrupted", models.WrapError(models.ErrorStreamInterrupted, errors.New("stream error: EOF"), "partial results (analyzed 3 posts)"), http.StatusGatewayTimeout, models.ErrorStreamInterrupted, "partial results (analyzed 3 posts)"},
+		{"shutting down", models.Errorf(models.ErrorShuttingDown, "analysis interrupted"), http.StatusServiceUnavailable, models.ErrorShuttingDown, "analysis interrupted"},
+		{"client closed request", models.WrapError(models.ErrorClientClosedRequest, context.Canceled, "analysis interrupted"), StatusClientClosedRequest, models.ErrorClientClosedRequest, "analysis interrupted"},
+		{"wrapped coded error", fmt.Errorf("job failed: %w", models.Errorf(models.ErrorNotFound, "job not found")), http.StatusNotFound, models.ErrorNotFound, "job not found"},
+		{"internal error", models.WrapError(models.ErrorInternal, errors.New("open /var/lib/history.jsonl: disk full"), "failed to query analysis history"), http.StatusInternalServerError, models.ErrorInternal, "internal error"},
+		{"error without code", errors.New("disk full"), http.StatusInternalServerError, models.ErrorInternal, "internal error"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/analysis?duration=30s", nil)
+			w := httptest.NewRecorder()
+			writeError(w, req, testLogger(), tc.err)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("expected status %d, got %d", tc.expectedStatus, w.Code)
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != "application/problem+json" {
+				t.Errorf("expected problem+json, got %q", contentType)
+			}
+
+			var body problem
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to parse error response: %v", err)
+			}
+			if body.Code != tc.expectedCode || body.Status != tc.expectedStatus {
+				t.Errorf("expected code %s and status %d, got %+v", tc.expectedCode, tc.expectedStatus, body)
+			}
+			if body.Message != tc.expectedMessage || body.Detail != body.Message || body.Instance != "/analysis" || body.Type == "" || body.Title == "" {
+				t.Errorf("unexpected problem details: %+v", body)
+			}
+			if body.RequestID == "" || body.RequestID != w.Header().Get(RequestIDHeader) {
+				t.Errorf("expected the request id in the body and the headers, got %q and %q", body.RequestID, w.Header().Get(RequestIDHeader))
+			}
+		})
+	}
+}
+
+func TestWriteError_DetailsAndRequestID(t *testing.T) {
+	err := models.Errorf(models.ErrorUpstreamUnavailable, "stream unavailable").WithDetail("retry_after_seconds", 13)
+
+	req := httptest.NewRequest(http.MethodGet, "/analysis", nil)
+	req.Header.Set(RequestIDHeader, "client-id-42")
+	w := httptest.NewRecorder()
+	writeError(w, req, testLogger(), err)
+
+	var body problem
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to parse error response: %v", err)
+	}
+
+	// The request id of the client is kept
+	if body.RequestID != "client-id-42" {
+		t.Errorf("expected request id client-id-42, got %q", body.RequestID)
+	}
+	if body.Details["retry_after_seconds"] != float64(13) || w.Header().Get("Retry-After") != "13" {
+		t.Errorf("expected a retry delay of 13 seconds, got %v and %q", body.Details, w.Header().Get("Retry-After"))
+	}
+	if body.Type != "urn:stream-analyzer:problem:upstream-unavailable" || body.Title != "Upstream unavailable" {
+		t.Errorf("unexpected problem type: %s (%s)", body.Type, body.Title)
+	}
+}
@@ -0,0 +1,43 @@
+// Package logging correlates the log records with the request or the job run they are emitted for.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// requestIDKey and jobIDKey are the context keys of the identifiers
+type (
+	requestIDKey struct{}
+	jobIDKey     struct{}
+)
+
+// NewID generates a random identifier of 16 hexadecimal digits
+func NewID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID returns a copy of the context carrying the identifier of a request
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the identifier of the request of the context, or an empty string
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithJobID returns a copy of the context carrying the identifier of a job run
+func WithJobID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, jobIDKey{}, id)
+}
+
+// JobID returns the identifier of the job run of the context, or an empty string
+func JobID(ctx context.Context) string {
+	id, _ := ctx.Value(jobIDKey{}).(string)
+	return id
+}
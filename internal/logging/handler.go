@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// ContextHandler wraps a slog handler, adding the request_id and the job_id of the context to every record.
+// The records must be emitted with the context variants of the logger methods, e.g. InfoContext.
+type ContextHandler struct {
+	handler slog.Handler
+}
+
+// Check interface implementation at compile-time
+var _ slog.Handler = &ContextHandler{}
+
+// NewContextHandler creates a new handler adding the identifiers of the context to the records of the wrapped handler
+func NewContextHandler(handler slog.Handler) *ContextHandler {
+	return &ContextHandler{handler: handler}
+}
+
+func (h *ContextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *ContextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if id := JobID(ctx); id != "" {
+		record.AddAttrs(slog.String("job_id", id))
+	}
+	return h.handler.Handle(ctx, record)
+}
+
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ContextHandler{handler: h.handler.WithAttrs(attrs)}
+}
+
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{handler: h.handler.WithGroup(name)}
+}
@@ -0,0 +1,29 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestContextHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewContextHandler(slog.NewTextHandler(&buf, nil))).With("component", "test")
+
+	ctx := WithJobID(WithRequestID(context.Background(), "req-1"), "job-1")
+	logger.InfoContext(ctx, "with identifiers")
+	logger.Info("without identifiers")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %q", buf.String())
+	}
+	if !strings.Contains(lines[0], "component=test") || !strings.Contains(lines[0], "request_id=req-1") || !strings.Contains(lines[0], "job_id=job-1") {
+		t.Errorf("expected the identifiers of the context, got %q", lines[0])
+	}
+	if strings.Contains(lines[1], "request_id") || strings.Contains(lines[1], "job_id") {
+		t.Errorf("expected no identifiers without context, got %q", lines[1])
+	}
+}
@@ -0,0 +1,275 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of the histograms of request latencies, in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Collector produces metric families when the metrics are scraped
+type Collector interface {
+	Collect() []Family
+}
+
+// CollectorFunc adapts a function to the Collector interface, e.g. to read the status of a component at scrape time
+type CollectorFunc func() []Family
+
+func (f CollectorFunc) Collect() []Family {
+	return f()
+}
+
+// Check interface implementation at compile-time
+var (
+	_ Collector = CollectorFunc(nil)
+	_ Collector = &Counter{}
+	_ Collector = &Gauge{}
+	_ Collector = &Histogram{}
+)
+
+// series are the values of a metric by label values.
+// The label values must match the label names in number, which is a programming error otherwise.
+type series[T any] struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*labeled[T]
+}
+
+// labeled is a value of a metric and its label values
+type labeled[T any] struct {
+	labelValues []string
+	value       T
+}
+
+func newSeries[T any](name, help string, labels []string) series[T] {
+	return series[T]{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]*labeled[T]),
+	}
+}
+
+// get returns the value of the label values, created by init on first use, or nil when init is nil. s.mu must be held.
+func (s *series[T]) get(labelValues []string, init func() T) *labeled[T] {
+	if len(labelValues) != len(s.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", s.name, len(s.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	value, ok := s.values[key]
+	if !ok && init != nil {
+		value = &labeled[T]{labelValues: slices.Clone(labelValues), value: init()}
+		s.values[key] = value
+	}
+	return value
+}
+
+// sorted returns the values ordered by label values, so that the output is stable, s.mu must be held
+func (s *series[T]) sorted() []*labeled[T] {
+	values := make([]*labeled[T], 0, len(s.values))
+	for _, value := range s.values {
+		values = append(values, value)
+	}
+	slices.SortFunc(values, func(a, b *labeled[T]) int {
+		return slices.Compare(a.labelValues, b.labelValues)
+	})
+	return values
+}
+
+// pairs returns the labels of the label values, followed by the extra labels
+func (s *series[T]) pairs(labelValues []string, extra ...[2]string) [][2]string {
+	pairs := make([][2]string, 0, len(labelValues)+len(extra))
+	for i, value := range labelValues {
+		pairs = append(pairs, [2]string{s.labels[i], value})
+	}
+	return append(pairs, extra...)
+}
+
+// Counter is a value that only goes up, e.g. the number of requests
+type Counter struct {
+	series[float64]
+}
+
+// NewCounter creates a new counter with the given label names
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{series: newSeries[float64](name, help, labels)}
+	if len(labels) == 0 {
+		// A counter without labels is exposed before its first increment
+		c.get(nil, zero)
+	}
+	return c
+}
+
+// Inc adds one to the counter of the label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a non-negative value to the counter of the label values
+func (c *Counter) Add(value float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.get(labelValues, zero).value += value
+}
+
+// Value returns the counter of the label values
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if value := c.get(labelValues, nil); value != nil {
+		return value.value
+	}
+	return 0
+}
+
+func (c *Counter) Collect() []Family {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	family := Family{Name: c.name, Help: c.help, Type: TypeCounter}
+	for _, value := range c.sorted() {
+		family.Samples = append(family.Samples, Sample{Labels: c.pairs(value.labelValues), Value: value.value})
+	}
+	return []Family{family}
+}
+
+// Gauge is a value that goes up and down, e.g. the number of requests in progress
+type Gauge struct {
+	series[float64]
+}
+
+// NewGauge creates a new gauge with the given label names
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{series: newSeries[float64](name, help, labels)}
+	if len(labels) == 0 {
+		g.get(nil, zero)
+	}
+	return g
+}
+
+// Set sets the gauge of the label values
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.get(labelValues, zero).value = value
+}
+
+// Add adds a value, possibly negative, to the gauge of the label values
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.get(labelValues, zero).value += value
+}
+
+func (g *Gauge) Collect() []Family {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	family := Family{Name: g.name, Help: g.help, Type: TypeGauge}
+	for _, value := range g.sorted() {
+		family.Samples = append(family.Samples, Sample{Labels: g.pairs(value.labelValues), Value: value.value})
+	}
+	return []Family{family}
+}
+
+// Histogram counts observations in buckets, e.g. the latency of the requests
+type Histogram struct {
+	series[*histogramValue]
+
+	// buckets are the upper bounds of the buckets, in increasing order
+	buckets []float64
+}
+
+// histogramValue is the state of a histogram for some label values
+type histogramValue struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram creates a new histogram with the given bucket upper bounds and label names.
+// The +Inf bucket is implicit.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+
+	h := &Histogram{
+		series:  newSeries[*histogramValue](name, help, labels),
+		buckets: buckets,
+	}
+	if len(labels) == 0 {
+		h.get(nil, h.newValue)
+	}
+	return h
+}
+
+// Observe records a value in the histogram of the label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	state := h.get(labelValues, h.newValue).value
+	if i, _ := slices.BinarySearch(h.buckets, value); i < len(h.buckets) {
+		state.counts[i]++
+	}
+	state.count++
+	state.sum += value
+}
+
+// Count returns the number of observations of the label values
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if value := h.get(labelValues, nil); value != nil {
+		return value.value.count
+	}
+	return 0
+}
+
+func (h *Histogram) newValue() *histogramValue {
+	return &histogramValue{counts: make([]uint64, len(h.buckets))}
+}
+
+func (h *Histogram) Collect() []Family {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	family := Family{Name: h.name, Help: h.help, Type: TypeHistogram}
+	for _, value := range h.sorted() {
+		// The buckets are cumulative
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += value.value.counts[i]
+			family.Samples = append(family.Samples, Sample{
+				Suffix: "_bucket",
+				Labels: h.pairs(value.labelValues, [2]string{"le", strconv.FormatFloat(bound, 'g', -1, 64)}),
+				Value:  float64(cumulative),
+			})
+		}
+		family.Samples = append(family.Samples,
+			Sample{Suffix: "_bucket", Labels: h.pairs(value.labelValues, [2]string{"le", formatValue(math.Inf(1))}), Value: float64(value.value.count)},
+			Sample{Suffix: "_sum", Labels: h.pairs(value.labelValues), Value: value.value.sum},
+			Sample{Suffix: "_count", Labels: h.pairs(value.labelValues), Value: float64(value.value.count)},
+		)
+	}
+	return []Family{family}
+}
+
+// zero initializes the values of the counters and the gauges
+func zero() float64 {
+	return 0
+}
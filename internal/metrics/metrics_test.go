@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	requests := NewCounter("requests_total", "Requests served.", "route", "status")
+	requests.Inc("/analysis", "200")
+	requests.Add(2, "/analysis", "200")
+	requests.Inc("/analysis", "429")
+
+	inFlight := NewGauge("in_flight", "Requests in progress.")
+
+	latency := NewHistogram("latency_seconds", "Latency of the requests.", []float64{1, 0.1}, "route")
+	latency.Observe(0.05, "/analysis")
+	latency.Observe(0.1, "/analysis")
+	latency.Observe(3, "/analysis")
+
+	registry := NewRegistry()
+	registry.Register("requests", requests)
+	registry.Register("latency", latency)
+	registry.Register("in_flight", inFlight)
+	registry.Register("custom", CollectorFunc(func() []Family {
+		return []Family{{Name: "escaped", Help: "Label\nvalues.", Type: TypeGauge, Samples: []Sample{
+			{Labels: [][2]string{{"key", `a"b\c`}}, Value: math.NaN()},
+		}}}
+	}))
+
+	var buf bytes.Buffer
+	if err := registry.WriteText(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := `# HELP escaped Label\nvalues.
+# TYPE escaped gauge
+escaped{key="a\"b\\c"} NaN
+# HELP in_flight Requests in progress.
+# TYPE in_flight gauge
+in_flight 0
+# HELP latency_seconds Latency of the requests.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/analysis",le="0.1"} 2
+latency_seconds_bucket{route="/analysis",le="1"} 2
+latency_seconds_bucket{route="/analysis",le="+Inf"} 3
+latency_seconds_sum{route="/analysis"} 3.15
+latency_seconds_count{route="/analysis"} 3
+# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="/analysis",status="200"} 3
+requests_total{route="/analysis",status="429"} 1
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestRegistry_Replace(t *testing.T) {
+	registry := NewRegistry()
+
+	first := NewCounter("reloads_total", "Counter of a component.")
+	first.Inc()
+	registry.Register("component", first)
+
+	// The component rebuilt by a reload replaces the previous one
+	registry.Register("component", NewCounter("reloads_total", "Counter of a component."))
+	families := registry.Gather()
+	if len(families) != 1 || families[0].Samples[0].Value != 0 {
+		t.Errorf("expected the collector to be replaced, got %+v", families)
+	}
+
+	registry.Unregister("component")
+	if families := registry.Gather(); len(families) != 0 {
+		t.Errorf("expected no metrics, got %+v", families)
+	}
+}
+
+func TestCounter_LabelMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for missing label values")
+		}
+	}()
+
+	counter := NewCounter("requests_total", "Requests served.", "route")
+	if counter.Value("/analysis") != 0 {
+		t.Error("expected a counter never incremented to be zero")
+	}
+	counter.Inc()
+}
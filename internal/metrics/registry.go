@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"cmp"
+	"io"
+	"slices"
+	"sync"
+)
+
+// Registry gathers the metrics of the components registered by name.
+// The components rebuilt when the configuration is reloaded replace their previous instance under the same name.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]Collector
+}
+
+// NewRegistry creates a new empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]Collector),
+	}
+}
+
+// Register adds the collector under the name, replacing the collector registered under the same name if any
+func (r *Registry) Register(name string, collector Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collectors[name] = collector
+}
+
+// Unregister removes the collector registered under the name, e.g. a component disabled by a reload
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.collectors, name)
+}
+
+// Gather collects the metric families of every collector, ordered by name
+func (r *Registry) Gather() []Family {
+	r.mu.Lock()
+	collectors := make([]Collector, 0, len(r.collectors))
+	for _, collector := range r.collectors {
+		collectors = append(collectors, collector)
+	}
+	r.mu.Unlock()
+
+	// The collectors are called without the lock, they may take their own
+	var families []Family
+	for _, collector := range collectors {
+		families = append(families, collector.Collect()...)
+	}
+	slices.SortStableFunc(families, func(a, b Family) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return families
+}
+
+// WriteText writes the metrics of every collector in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	return WriteText(w, r.Gather())
+}
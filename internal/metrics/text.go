@@ -0,0 +1,95 @@
+// Package metrics exposes the internals of the service in the Prometheus text format, without client library.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the content type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Type is the type of a metric family
+type Type string
+
+const (
+	TypeCounter   Type = "counter"
+	TypeGauge     Type = "gauge"
+	TypeHistogram Type = "histogram"
+)
+
+// Family is a named metric and its samples
+type Family struct {
+	Name    string
+	Help    string
+	Type    Type
+	Samples []Sample
+}
+
+// Sample is a value of a metric family, identified by its labels.
+// Suffix tells apart the series of a histogram: "_bucket", "_sum" or "_count".
+type Sample struct {
+	Suffix string
+	Labels [][2]string
+	Value  float64
+}
+
+// WriteText writes the metric families in the Prometheus text exposition format.
+// The families without sample are left out.
+func WriteText(w io.Writer, families []Family) error {
+	var buf bytes.Buffer
+
+	for _, family := range families {
+		if len(family.Samples) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&buf, "# HELP %s %s\n", family.Name, helpReplacer.Replace(family.Help))
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", family.Name, family.Type)
+
+		for _, sample := range family.Samples {
+			buf.WriteString(family.Name)
+			buf.WriteString(sample.Suffix)
+			if len(sample.Labels) > 0 {
+				buf.WriteByte('{')
+				for i, label := range sample.Labels {
+					if i > 0 {
+						buf.WriteByte(',')
+					}
+					fmt.Fprintf(&buf, "%s=\"%s\"", label[0], labelReplacer.Replace(label[1]))
+				}
+				buf.WriteByte('}')
+			}
+			buf.WriteByte(' ')
+			buf.WriteString(formatValue(sample.Value))
+			buf.WriteByte('\n')
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// labelReplacer escapes the label values, helpReplacer the help texts
+var (
+	labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// formatValue formats a sample value
+func formatValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// AlertCondition is the kind of condition of an alerting rule
+type AlertCondition string
+
+const (
+	// AlertThreshold compares the metric over the window to the value of the rule
+	AlertThreshold AlertCondition = "threshold"
+
+	// AlertRateOfChange compares the change of the metric from the previous window, in percent, to the value of the rule
+	AlertRateOfChange AlertCondition = "rate_of_change"
+
+	// AlertAbsence fires when the window has no data for the metric
+	AlertAbsence AlertCondition = "absence"
+)
+
+const (
+	// MetricTotalPosts is the number of posts received during the window
+	MetricTotalPosts = "total_posts"
+
+	// MetricAveragePrefix prefixes the dimension in the metrics averaging a dimension, e.g. "avg_retweets"
+	MetricAveragePrefix = "avg_"
+)
+
+// AlertOperators lists the comparison operators of the threshold and rate of change conditions
+var AlertOperators = map[string]bool{
+	">":  true,
+	">=": true,
+	"<":  true,
+	"<=": true,
+}
+
+// ValidAlertMetric reports whether a metric can be used in an alerting rule
+func ValidAlertMetric(metric string) bool {
+	if metric == MetricTotalPosts {
+		return true
+	}
+	dimension, ok := strings.CutPrefix(metric, MetricAveragePrefix)
+	return ok && ValidDimensions[dimension]
+}
+
+// AlertState is the state of an alerting rule
+type AlertState string
+
+const (
+	// AlertOK means the condition of the rule is not met
+	AlertOK AlertState = "ok"
+
+	// AlertFiring means the condition of the rule is met
+	AlertFiring AlertState = "firing"
+)
+
+// AlertEvent is the notification sent when an alerting rule starts or stops firing
+type AlertEvent struct {
+	Rule string `json:"rule"`
+
+	// State is "firing" when the condition is met, "ok" when it is resolved
+	State AlertState `json:"state"`
+
+	// Condition describes the rule, e.g. "avg_retweets > 500 over 5m0s"
+	Condition string `json:"condition"`
+	Metric    string `json:"metric"`
+	Window    string `json:"window"`
+
+	// Value is the evaluated value (the metric, or its change in percent for a rate of change rule).
+	// It is omitted when the window has no data.
+	Value *float64 `json:"value,omitempty"`
+
+	At time.Time `json:"at"`
+}
+
+// AlertRuleStatus describes an alerting rule and its current state
+type AlertRuleStatus struct {
+	Name      string     `json:"name"`
+	Condition string     `json:"condition"`
+	State     AlertState `json:"state"`
+
+	// Value is the last evaluated value, omitted when the window had no data
+	Value           *float64   `json:"value,omitempty"`
+	LastEvaluatedAt *time.Time `json:"last_evaluated_at,omitempty"`
+	FiringSince     *time.Time `json:"firing_since,omitempty"`
+	LastNotifiedAt  *time.Time `json:"last_notified_at,omitempty"`
+
+	// Notifications counts the events sent, Suppressed the firing events skipped during the cooldown
+	Notifications int `json:"notifications"`
+	Suppressed    int `json:"suppressed"`
+}
@@ -1,9 +1,87 @@
 package models
 
+import "time"
+
+// AnalysisLimits are the conditions ending a live analysis, the first one reached ends it.
+// Zero values are not set, at least one of them is.
+type AnalysisLimits struct {
+	// Duration is how long the stream is analyzed for, as requested
+	Duration time.Duration
+
+	// MaxDuration caps the analyses without a requested Duration, e.g. those only limited by MaxPosts (no cap when zero)
+	MaxDuration time.Duration
+
+	// MaxPosts ends the analysis once this number of posts is received
+	MaxPosts int
+
+	// Until ends the analysis at this time
+	Until time.Time
+}
+
+// AnalysisGrouping splits the statistics of an analysis into groups, on top of the totals. The zero value adds no group.
+type AnalysisGrouping struct {
+	// Bucket groups the posts into a series of buckets of this span by post timestamp, a whole number of seconds (no series when zero)
+	Bucket time.Duration
+
+	// ByPostType groups the posts by post type
+	ByPostType bool
+}
+
+// GroupByPostType is the value of the group_by parameter grouping the posts by post type
+const GroupByPostType = "post_type"
+
+// AnalysisGroup holds the statistics of a group of posts: a bucket of the series and/or a post type
+type AnalysisGroup struct {
+	// BucketStart and BucketEnd bound the post timestamps of the bucket, in [BucketStart, BucketEnd) (zero without series)
+	BucketStart int64
+	BucketEnd   int64
+
+	// PostType is empty unless the posts are grouped by post type
+	PostType string
+
+	TotalPosts int
+	Average    int
+}
+
+// Conditions ending a live analysis
+const (
+	EndedByDuration         = "duration"
+	EndedByMaxDuration      = "max_duration"
+	EndedByMaxPosts         = "max_posts"
+	EndedByUntil            = "until"
+	EndedByStreamError      = "stream_error"
+	EndedByStreamClosed     = "stream_closed"
+	EndedByClientDisconnect = "client_disconnect"
+	EndedByShutdown         = "shutdown"
+)
+
 // AnalysisResult represents the output of a stream analysis
 type AnalysisResult struct {
 	TotalPosts       int   `json:"total_posts"`
 	MinimumTimestamp int64 `json:"minimum_timestamp"`
 	MaximumTimestamp int64 `json:"maximum_timestamp"`
 	Average          int   `json:"-"`
+
+	// Samples is the number of posts carrying the dimension, Mean and Variance describe their values
+	Samples  int64   `json:"-"`
+	Mean     float64 `json:"-"`
+	Variance float64 `json:"-"`
+
+	// Warnings flag results that are valid but may be misleading
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Partial is true when the analysis was cut short, the statistics then only cover the posts received before
+	Partial bool `json:"-"`
+
+	// EndedBy is the condition that ended a live analysis, e.g. EndedByMaxPosts (empty for archived posts)
+	EndedBy string `json:"-"`
+
+	// Groups are the statistics of the groups of the requested grouping, by bucket then post type
+	Groups []AnalysisGroup `json:"-"`
+
+	// Anomalies are the anomalies of the analyzed dimension detected during the analysis
+	Anomalies []Anomaly `json:"anomalies,omitempty"`
+
+	// Stream describes the health of the stream during the analysis
+	Stream *StreamHealth `json:"stream,omitempty"`
 }
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+const (
+	// AnomalyMethodEWMA scores the buckets against an exponentially weighted moving mean and variance
+	AnomalyMethodEWMA = "ewma"
+
+	// AnomalyMethodMAD scores the buckets against the median and median absolute deviation of the recent buckets
+	AnomalyMethodMAD = "mad"
+)
+
+// Anomaly is a time bucket whose average of a dimension deviates from the baseline of its series
+type Anomaly struct {
+	// A series is the average of a dimension over the posts of a type
+	PostType  string `json:"post_type"`
+	Dimension string `json:"dimension"`
+
+	// BucketStart and BucketEnd bound the arrival time of the posts of the bucket
+	BucketStart time.Time `json:"bucket_start"`
+	BucketEnd   time.Time `json:"bucket_end"`
+
+	// Value is the average of the dimension over the posts of the bucket
+	Value float64 `json:"value"`
+	Posts int     `json:"posts"`
+
+	// Baseline and Deviation are the expected value and spread of the series before the bucket
+	Baseline  float64 `json:"baseline"`
+	Deviation float64 `json:"deviation"`
+	ZScore    float64 `json:"z_score"`
+
+	// Direction is "spike" above the baseline or "drop" below it
+	Direction string `json:"direction"`
+
+	// Method is the baseline method: "ewma" or "mad"
+	Method string `json:"method"`
+}
+
+// AnomalyQuery filters the detected anomalies
+type AnomalyQuery struct {
+	// PostType and Dimension keep only the anomalies of a series (all series when empty)
+	PostType  string
+	Dimension string
+
+	// From and To keep only the anomalies whose bucket overlaps [From, To) (unbounded when zero)
+	From time.Time
+	To   time.Time
+
+	// Limit keeps only the most recent anomalies (all when zero)
+	Limit int
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// APIKey is a credential of the API clients, with its permissions and quotas
+type APIKey struct {
+	// Name identifies the key in the logs, it is never the key itself
+	Name string
+
+	// Hash is the SHA-256 of the key, "sha256:" followed by 64 hexadecimal digits
+	Hash string
+
+	// Endpoints are the path prefixes the key may call (all when empty)
+	Endpoints []string
+
+	// MaxDuration bounds the analyses of the key (no additional bound when zero)
+	MaxDuration time.Duration
+
+	// RequestsPerMinute and Burst bound the request rate of the key (unlimited when zero)
+	RequestsPerMinute int
+	Burst             int
+
+	// MaxConcurrent bounds the requests of the key in progress (unlimited when zero)
+	MaxConcurrent int
+}
+
+// APIKeyStatus describes the usage of an API key since the start
+type APIKeyStatus struct {
+	Name      string     `json:"name"`
+	Endpoints []string   `json:"endpoints"`
+	InFlight  int64      `json:"in_flight"`
+	Requests  int64      `json:"requests"`
+	Forbidden int64      `json:"forbidden"`
+	Throttled int64      `json:"throttled"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// BreakerState is the state of a circuit breaker
+type BreakerState string
+
+const (
+	// BreakerClosed lets every request through
+	BreakerClosed BreakerState = "closed"
+
+	// BreakerOpen fails every request fast until the open timeout elapses
+	BreakerOpen BreakerState = "open"
+
+	// BreakerHalfOpen lets a single probe request through to decide whether to close or re-open
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerTransition records a state change of a circuit breaker
+type BreakerTransition struct {
+	From   BreakerState `json:"from"`
+	To     BreakerState `json:"to"`
+	At     time.Time    `json:"at"`
+	Reason string       `json:"reason"`
+}
+
+// BreakerStatus describes the current state of a circuit breaker
+type BreakerStatus struct {
+	State               BreakerState        `json:"state"`
+	ConsecutiveFailures int                 `json:"consecutive_failures"`
+	FailureThreshold    int                 `json:"failure_threshold"`
+	OpenTimeout         string              `json:"open_timeout"`
+	OpenedAt            *time.Time          `json:"opened_at,omitempty"`
+	RetryAfter          float64             `json:"retry_after_seconds,omitempty"`
+	LastError           string              `json:"last_error,omitempty"`
+	Transitions         []BreakerTransition `json:"transitions"`
+}
@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// WindowSummary is one of the two compared analyses
+type WindowSummary struct {
+	// From and To bound the analyzed posts
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+
+	// RecordID is the history record of the analysis, when compared from the history
+	RecordID string `json:"record_id,omitempty"`
+
+	TotalPosts int `json:"total_posts"`
+
+	// Average is the unrounded average of the dimension over the Samples posts carrying it
+	Average  float64 `json:"average"`
+	Samples  int64   `json:"samples"`
+	Variance float64 `json:"variance"`
+	StdDev   float64 `json:"std_dev"`
+
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// MetricDelta is the change of a metric from the baseline window to the current window
+type MetricDelta struct {
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+
+	// Absolute is current - baseline
+	Absolute float64 `json:"absolute"`
+
+	// Relative is the absolute change in percent of the baseline (omitted when the baseline is 0)
+	Relative *float64 `json:"relative,omitempty"`
+}
+
+// Significance tells whether the averages of the two windows differ beyond chance
+type Significance struct {
+	// Test is the statistical test: "welch_t"
+	Test string `json:"test"`
+
+	T                float64 `json:"t"`
+	DegreesOfFreedom float64 `json:"degrees_of_freedom"`
+	PValue           float64 `json:"p_value"`
+
+	// Significant is true when the p-value is below Alpha
+	Alpha       float64 `json:"alpha"`
+	Significant bool    `json:"significant"`
+}
+
+// Comparison is the comparison of an analysis (the current window) against another one (the baseline window)
+type Comparison struct {
+	Dimension string        `json:"dimension"`
+	Baseline  WindowSummary `json:"baseline"`
+	Current   WindowSummary `json:"current"`
+
+	// Deltas are keyed by metric: "total_posts", "posts_per_second" and "avg_<dimension>"
+	Deltas map[string]MetricDelta `json:"deltas"`
+
+	// Significance is omitted when a window has too few values to be tested
+	Significance *Significance `json:"significance,omitempty"`
+
+	Warnings []string `json:"warnings,omitempty"`
+}
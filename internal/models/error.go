@@ -0,0 +1,99 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorCode is a stable identifier of a class of errors, for the API clients to branch on.
+// Unlike the messages, codes never change once released.
+type ErrorCode string
+
+const (
+	// Invalid requests
+	ErrorInvalidDuration   ErrorCode = "INVALID_DURATION"
+	ErrorUnknownDimension  ErrorCode = "UNKNOWN_DIMENSION"
+	ErrorInvalidParameter  ErrorCode = "INVALID_PARAMETER"
+	ErrorUnsupportedFormat ErrorCode = "UNSUPPORTED_FORMAT"
+	ErrorMethodNotAllowed  ErrorCode = "METHOD_NOT_ALLOWED"
+	ErrorNotFound          ErrorCode = "NOT_FOUND"
+	ErrorConflict          ErrorCode = "CONFLICT"
+	ErrorFeatureDisabled   ErrorCode = "FEATURE_DISABLED"
+
+	// Requests without valid credentials, or not allowed with them
+	ErrorUnauthorized ErrorCode = "UNAUTHORIZED"
+	ErrorForbidden    ErrorCode = "FORBIDDEN"
+
+	// Requests over the limits of the server
+	ErrorTooManyRequests ErrorCode = "TOO_MANY_REQUESTS"
+
+	// Failures of the stream
+	ErrorUpstreamUnavailable ErrorCode = "UPSTREAM_UNAVAILABLE"
+	ErrorStreamInterrupted   ErrorCode = "STREAM_INTERRUPTED"
+
+	// Requests cut short by the server or the client
+	ErrorShuttingDown        ErrorCode = "SHUTTING_DOWN"
+	ErrorClientClosedRequest ErrorCode = "CLIENT_CLOSED_REQUEST"
+
+	// ErrorInternal is the code of the errors that are not classified
+	ErrorInternal ErrorCode = "INTERNAL"
+)
+
+// Error is an error with a stable code, raised by the services and the handlers and reported to the API clients
+type Error struct {
+	Code ErrorCode
+
+	// Message describes the error for humans
+	Message string
+
+	// Details are machine-readable facts about the error, e.g. the number of posts analyzed before it
+	Details map[string]any
+
+	// Err is the underlying error, if any
+	Err error
+}
+
+// Errorf creates an error with a code and a formatted message
+func Errorf(code ErrorCode, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// WrapError creates an error with a code and a message, wrapping the underlying error
+func WrapError(code ErrorCode, err error, message string) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+// WithDetail adds a machine-readable detail to the error and returns it
+func (e *Error) WithDetail(key string, value any) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]any)
+	}
+	e.Details[key] = value
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCodeOf returns the code of the first *Error in the chain of err, or ErrorInternal
+func ErrorCodeOf(err error) ErrorCode {
+	var codedErr *Error
+	if errors.As(err, &codedErr) {
+		return codedErr.Code
+	}
+	return ErrorInternal
+}
+
+// Warning formats a warning of the analysis results with a stable code, e.g. "STREAM_INTERRUPTED: stream interrupted".
+// Unlike Error, it never includes the underlying error.
+func Warning(code ErrorCode, message string) string {
+	return string(code) + ": " + message
+}
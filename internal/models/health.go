@@ -0,0 +1,35 @@
+package models
+
+// StreamHealth describes the state of the upstream stream connection.
+// It is reported both for the stream client as a whole and for a single analysis,
+// in which case the connection counters are left empty.
+type StreamHealth struct {
+	// Connected is true while at least one connection to the stream is open
+	Connected bool `json:"connected"`
+
+	// ActiveConnections is the number of open connections to the stream
+	ActiveConnections int64 `json:"active_connections,omitempty"`
+
+	// LastEventAt is the Unix timestamp of the last received event (0 if none yet)
+	LastEventAt int64 `json:"last_event_at"`
+
+	// LastEventAge is the number of seconds elapsed since the last received event (-1 if none yet)
+	LastEventAge float64 `json:"last_event_age_seconds"`
+
+	// EventsPerSecond is the recent event throughput
+	EventsPerSecond float64 `json:"events_per_second"`
+
+	// Stalls counts the connections detected as stalled (open but silent)
+	Stalls int64 `json:"stalls,omitempty"`
+
+	// Reconnects counts the connections re-established after a stall or a disconnection
+	Reconnects int64 `json:"reconnects,omitempty"`
+
+	// ParseErrors counts the events that could not be parsed into a post
+	ParseErrors int64 `json:"parse_errors,omitempty"`
+
+	// ChannelDepth is the number of posts waiting to be consumed after the last event, ChannelHighWater the highest seen.
+	// A depth close to the capacity of the channel (100) means the consumers fall behind the stream.
+	ChannelDepth     int64 `json:"channel_depth,omitempty"`
+	ChannelHighWater int64 `json:"channel_high_water,omitempty"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// AnalysisRecord is an analysis saved in the history store, complete or cut short
+type AnalysisRecord struct {
+	ID string `json:"id"`
+
+	// Source is what triggered the analysis ("api" for HTTP requests, "job:<name>" for scheduled jobs)
+	Source string `json:"source"`
+
+	// Parameters of the analysis, the limits not requested are omitted
+	Dimension string     `json:"dimension"`
+	Duration  string     `json:"duration,omitempty"`
+	MaxPosts  int        `json:"max_posts,omitempty"`
+	Until     *time.Time `json:"until,omitempty"`
+
+	// EndedBy is the condition that ended the analysis, e.g. EndedByMaxPosts
+	EndedBy string `json:"ended_by,omitempty"`
+
+	// Partial is true when the analysis was cut short, its warnings tell why
+	Partial bool `json:"partial,omitempty"`
+
+	// StartedAt and CompletedAt bound the analysis, Elapsed is the time it actually took
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+	Elapsed     float64   `json:"elapsed_seconds"`
+
+	// Result of the analysis
+	TotalPosts       int      `json:"total_posts"`
+	MinimumTimestamp int64    `json:"minimum_timestamp"`
+	MaximumTimestamp int64    `json:"maximum_timestamp"`
+	Average          int      `json:"average"`
+	Warnings         []string `json:"warnings,omitempty"`
+
+	// Samples, Mean and Variance describe the dimension values, to compare the analysis with another one
+	Samples  int64   `json:"samples,omitempty"`
+	Mean     float64 `json:"mean,omitempty"`
+	Variance float64 `json:"variance,omitempty"`
+}
+
+// HistoryQuery filters and paginates the analysis history
+type HistoryQuery struct {
+	// Source keeps only the analyses triggered by a source (all sources when empty)
+	Source string
+
+	// Dimension keeps only the analyses of a dimension (all dimensions when empty)
+	Dimension string
+
+	// From and To keep only the analyses completed in [From, To) (unbounded when zero)
+	From time.Time
+	To   time.Time
+
+	// Offset and Limit select a page of the matching records, newest first
+	Offset int
+	Limit  int
+}
+
+// HistoryPage is a page of analysis records, newest first
+type HistoryPage struct {
+	Records []AnalysisRecord `json:"records"`
+
+	// Total is the number of records matching the query, across all pages
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+
+	// NextOffset is the offset of the next page (omitted on the last page)
+	NextOffset *int `json:"next_offset,omitempty"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// JobStatus describes a scheduled analysis job and its recent activity
+type JobStatus struct {
+	Name       string   `json:"name"`
+	Schedule   string   `json:"schedule"`
+	Duration   string   `json:"duration"`
+	Dimensions []string `json:"dimensions"`
+	PostTypes  []string `json:"post_types,omitempty"`
+	Sink       string   `json:"sink,omitempty"`
+
+	Paused  bool       `json:"paused"`
+	Running bool       `json:"running"`
+	NextRun *time.Time `json:"next_run,omitempty"`
+
+	Runs     int     `json:"runs"`
+	Failures int     `json:"failures"`
+	LastRun  *JobRun `json:"last_run,omitempty"`
+}
+
+// JobRun is the outcome of a single run of a scheduled job
+type JobRun struct {
+	// ID identifies the run in the logs (job_id)
+	ID string `json:"id"`
+
+	// Trigger is what started the run: "schedule" or "manual"
+	Trigger     string    `json:"trigger"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+	Error       string    `json:"error,omitempty"`
+
+	// Records are the results of the run, one per dimension
+	Records []AnalysisRecord `json:"records,omitempty"`
+}
@@ -0,0 +1,20 @@
+package models
+
+// ConcurrencyStatus describes the current utilization of the analysis concurrency limits
+type ConcurrencyStatus struct {
+	// Active is the number of analyses running, Queued the number of those waiting for a slot
+	Active int `json:"active"`
+	Queued int `json:"queued"`
+
+	// Limits in place, zero when unlimited
+	MaxConcurrent          int    `json:"max_concurrent"`
+	MaxConcurrentPerClient int    `json:"max_concurrent_per_client"`
+	QueueSize              int    `json:"queue_size"`
+	QueueTimeout           string `json:"queue_timeout"`
+
+	// Rejected counts the analyses refused since the start, by reason
+	Rejected map[string]int `json:"rejected"`
+
+	// Clients are the analyses running or queued per client
+	Clients map[string]int `json:"clients"`
+}
@@ -75,6 +75,18 @@ func (p *PostPayload) UnmarshalJSON(event []byte) error {
 	return nil
 }
 
+// MarshalJSON implements custom JSON marshalling for PostPayload.
+// Produces the same structure as the stream (the post type is the root key), so that the output can be unmarshalled back.
+func (p PostPayload) MarshalJSON() ([]byte, error) {
+	postDetails := make(map[string]interface{}, len(p.Data.Details)+1)
+	for key, val := range p.Data.Details {
+		postDetails[key] = val
+	}
+	postDetails["timestamp"] = p.Data.Timestamp
+
+	return json.Marshal(map[string]interface{}{p.Type: postDetails})
+}
+
 // GetDimensionValue extracts the value of a specified dimension from the post
 func (p *PostPayload) GetDimensionValue(dimension string) (uint64, bool) {
 	val, ok := p.Data.Details[dimension]
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// ProbeStatus describes the periodic reachability checks of the upstream stream
+type ProbeStatus struct {
+	// Enabled is false when the probe interval is zero, the readiness then does not depend on the upstream.
+	// Reachable is the outcome of the last probe.
+	Enabled   bool `json:"enabled"`
+	Reachable bool `json:"reachable"`
+
+	Interval string `json:"interval,omitempty"`
+
+	LastProbeAt   *time.Time `json:"last_probe_at,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+
+	// Stale is true when the last probe is older than twice the interval, i.e. the probes stopped
+	Stale bool `json:"stale,omitempty"`
+
+	// LastError is kept after the upstream recovers, LastErrorAt tells when it occurred
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// Readiness tells whether the service accepts traffic, and the outcome of every check deciding it
+type Readiness struct {
+	Ready bool `json:"ready"`
+
+	// Checks are "ok" when passing, the reason of the failure otherwise, by check name: "config", "shutdown" and "upstream"
+	Checks map[string]string `json:"checks"`
+}
+
+// ServiceStatus describes the running service, see '/status'
+type ServiceStatus struct {
+	Version       string    `json:"version"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds float64   `json:"uptime_seconds"`
+
+	Ready        bool `json:"ready"`
+	ShuttingDown bool `json:"shutting_down"`
+
+	// ActiveAnalyses is the number of analyses running, QueuedAnalyses the number of those waiting for a slot
+	ActiveAnalyses int `json:"active_analyses"`
+	QueuedAnalyses int `json:"queued_analyses"`
+
+	Upstream UpstreamStatus `json:"upstream"`
+}
+
+// UpstreamStatus describes the upstream stream: the outcome of the probes and the health of the connections
+type UpstreamStatus struct {
+	Probe  ProbeStatus  `json:"probe"`
+	Health StreamHealth `json:"health"`
+}
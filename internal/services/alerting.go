@@ -0,0 +1,411 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+const (
+	// alertMaxRetryDelay bounds the delay between two connection attempts of the alert engine
+	alertMaxRetryDelay = 30 * time.Second
+)
+
+// AlertRule is the definition of an alerting rule
+type AlertRule struct {
+	Name string
+
+	// Metric is "total_posts" or "avg_<dimension>"
+	Metric    string
+	Condition models.AlertCondition
+
+	// Operator and Value define the threshold of the threshold and rate of change conditions
+	Operator string
+	Value    float64
+
+	// Window is the span of the recent posts the metric is computed on
+	Window time.Duration
+
+	// Cooldown is the minimum delay between two firing notifications of the rule
+	Cooldown time.Duration
+
+	// Hysteresis is how far back past the threshold the value must go for a firing rule to resolve,
+	// so that a value oscillating around the threshold does not flap
+	Hysteresis float64
+
+	// Notifiers receive the events of the rule
+	Notifiers []Notifier
+}
+
+// String describes the condition of the rule
+func (r *AlertRule) String() string {
+	switch r.Condition {
+	case models.AlertRateOfChange:
+		return fmt.Sprintf("change of %s %s %g%% over %s", r.Metric, r.Operator, r.Value, r.Window)
+	case models.AlertAbsence:
+		return fmt.Sprintf("no %s data over %s", r.Metric, r.Window)
+	default:
+		return fmt.Sprintf("%s %s %g over %s", r.Metric, r.Operator, r.Value, r.Window)
+	}
+}
+
+// AlertReporter is implemented by components reporting the state of alerting rules
+type AlertReporter interface {
+	AlertRules() []models.AlertRuleStatus
+}
+
+// alertRuleState is an alerting rule and its state
+type alertRuleState struct {
+	AlertRule
+
+	state           models.AlertState
+	value           *float64
+	lastEvaluatedAt time.Time
+	firingSince     time.Time
+	lastNotifiedAt  time.Time
+
+	// notifiedFiring tells whether the current firing was notified, the resolution is notified only then
+	notifiedFiring bool
+	notifications  int
+	suppressed     int
+}
+
+// AlertEngine continuously reads the stream and evaluates alerting rules against sliding windows of the recent posts.
+// A rule is evaluated once the engine has run long enough to fill its window(s).
+type AlertEngine struct {
+	stream   StreamService
+	interval time.Duration
+	logger   *slog.Logger
+	now      func() time.Time
+
+	mu        sync.Mutex
+	window    *slidingWindow
+	startedAt time.Time
+	rules     []*alertRuleState
+
+	// deliveries tracks the notifications being sent
+	deliveries sync.WaitGroup
+}
+
+// Check interface implementation at compile-time
+var _ AlertReporter = &AlertEngine{}
+
+// NewAlertEngine creates a new alert engine evaluating the rules at the given interval
+func NewAlertEngine(stream StreamService, rules []AlertRule, interval time.Duration, logger *slog.Logger) *AlertEngine {
+	e := &AlertEngine{
+		stream:   stream,
+		interval: interval,
+		logger:   logger,
+		now:      time.Now,
+	}
+
+	// The rate of change rules compare two consecutive windows
+	var span time.Duration
+	for _, rule := range rules {
+		ruleSpan := rule.Window
+		if rule.Condition == models.AlertRateOfChange {
+			ruleSpan *= 2
+		}
+		span = max(span, ruleSpan)
+
+		e.rules = append(e.rules, &alertRuleState{
+			AlertRule: rule,
+			state:     models.AlertOK,
+		})
+	}
+	e.window = newSlidingWindow(span)
+
+	return e
+}
+
+// Inherit carries over the state of the rules of the previous engine, identified by their name, and its window of the recent posts,
+// so that a reload of the configuration neither resets the firing rules and their cooldown nor restarts the warm-up.
+// It must be called before the engine runs.
+func (e *AlertEngine) Inherit(previous *AlertEngine) {
+	previous.mu.Lock()
+	defer previous.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, rule := range e.rules {
+		for _, prevRule := range previous.rules {
+			if prevRule.Name != rule.Name {
+				continue
+			}
+
+			rule.state, rule.value = prevRule.state, prevRule.value
+			rule.lastEvaluatedAt, rule.firingSince, rule.lastNotifiedAt = prevRule.lastEvaluatedAt, prevRule.firingSince, prevRule.lastNotifiedAt
+			rule.notifiedFiring, rule.notifications, rule.suppressed = prevRule.notifiedFiring, prevRule.notifications, prevRule.suppressed
+			break
+		}
+	}
+
+	if previous.startedAt.IsZero() {
+		return
+	}
+
+	// The previous window only holds its own span, a larger window is filled from then on
+	e.window.copyFrom(previous.window)
+	e.startedAt = previous.startedAt
+	if oldest := e.now().Add(-previous.window.span()); oldest.After(e.startedAt) {
+		e.startedAt = oldest
+	}
+}
+
+// Run reads the stream and evaluates the rules until the context is cancelled.
+// The rules keep being evaluated while the stream is down, so that the absence of data is detected.
+func (e *AlertEngine) Run(ctx context.Context) {
+	e.mu.Lock()
+	if e.startedAt.IsZero() {
+		e.startedAt = e.now()
+	}
+	e.mu.Unlock()
+
+	go followStream(ctx, e.logger, "alerts", alertMaxRetryDelay, e.consumeStream)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// The notifications in progress are cancelled with the context
+			e.deliveries.Wait()
+			return
+		case <-ticker.C:
+			e.evaluate(ctx)
+		}
+	}
+}
+
+// consumeStream reads a single stream connection and adds its posts to the window.
+// Returns the number of posts read and the error that ended the stream.
+func (e *AlertEngine) consumeStream(ctx context.Context) (int, error) {
+	resultCh, err := e.stream.ReadEvents(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	consumed := 0
+	for result := range resultCh {
+		if result.Err != nil {
+			return consumed, result.Err
+		}
+		if result.Post != nil {
+			e.observe(result.Post)
+			consumed++
+		}
+	}
+
+	return consumed, fmt.Errorf("stream closed")
+}
+
+// observe adds a post received now to the window
+func (e *AlertEngine) observe(post *models.PostPayload) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.window.add(e.now(), post)
+}
+
+// evaluate evaluates every rule and sends the resulting events in the background
+func (e *AlertEngine) evaluate(ctx context.Context) {
+	e.mu.Lock()
+	now := e.now()
+
+	type notification struct {
+		rule  *alertRuleState
+		event models.AlertEvent
+	}
+	var notifications []notification
+
+	for _, rule := range e.rules {
+		if event := e.evaluateRule(rule, now); event != nil {
+			notifications = append(notifications, notification{rule: rule, event: *event})
+		}
+	}
+	e.mu.Unlock()
+
+	for _, n := range notifications {
+		attrs := []any{"rule", n.rule.Name, "state", n.event.State, "condition", n.event.Condition}
+		if n.event.Value != nil {
+			attrs = append(attrs, "value", *n.event.Value)
+		}
+		e.logger.Info("Alert state changed", attrs...)
+
+		for _, notifier := range n.rule.Notifiers {
+			e.deliveries.Add(1)
+			go func() {
+				defer e.deliveries.Done()
+				if err := notifier.Notify(ctx, n.event); err != nil {
+					e.logger.Error("Failed to send alert notification", "rule", n.rule.Name, "notifier", notifier.String(), "err", err)
+				}
+			}()
+		}
+	}
+}
+
+// evaluateRule updates the state of a rule and returns the event to notify, if any.
+// Must be called with the lock held.
+func (e *AlertEngine) evaluateRule(rule *alertRuleState, now time.Time) *models.AlertEvent {
+	// Wait for the window(s) to be filled, a partial window would look like missing data
+	warmUp := rule.Window
+	if rule.Condition == models.AlertRateOfChange {
+		warmUp *= 2
+	}
+	if now.Sub(e.startedAt) < warmUp {
+		return nil
+	}
+
+	value, met, cleared, ok := e.check(rule, now)
+	rule.lastEvaluatedAt = now
+	rule.value = nil
+	if !ok {
+		// Not enough data to decide, the rule keeps its state
+		return nil
+	}
+	if rule.Condition != models.AlertAbsence {
+		rule.value = &value
+	}
+
+	switch {
+	case rule.state == models.AlertOK && met:
+		rule.state = models.AlertFiring
+		rule.firingSince = now
+
+		if !rule.lastNotifiedAt.IsZero() && now.Sub(rule.lastNotifiedAt) < rule.Cooldown {
+			rule.notifiedFiring = false
+			rule.suppressed++
+			e.logger.Info("Alert firing during cooldown, notification suppressed", "rule", rule.Name, "value", value)
+			return nil
+		}
+
+		rule.notifiedFiring = true
+		rule.lastNotifiedAt = now
+		rule.notifications++
+		return rule.event(models.AlertFiring, now)
+
+	case rule.state == models.AlertFiring && cleared:
+		rule.state = models.AlertOK
+		rule.firingSince = time.Time{}
+
+		if !rule.notifiedFiring {
+			return nil
+		}
+		rule.notifiedFiring = false
+		rule.notifications++
+		return rule.event(models.AlertOK, now)
+	}
+
+	return nil
+}
+
+// check evaluates the condition of a rule over the window ending now.
+// Returns the evaluated value, whether the condition is met, whether a firing rule is resolved,
+// and false when the window does not have enough data to decide.
+func (e *AlertEngine) check(rule *alertRuleState, now time.Time) (value float64, met, cleared, ok bool) {
+	current, hasData := e.window.stats(now, rule.Window).metric(rule.Metric)
+
+	switch rule.Condition {
+	case models.AlertAbsence:
+		return current, !hasData, hasData, true
+
+	case models.AlertRateOfChange:
+		previous, hadData := e.window.stats(now.Add(-rule.Window), rule.Window).metric(rule.Metric)
+		// The change is undefined without a previous value, and an average needs data in both windows
+		if !hadData || previous == 0 || (!hasData && rule.Metric != models.MetricTotalPosts) {
+			return 0, false, false, false
+		}
+		value = (current - previous) / previous * 100
+
+	default:
+		// Without posts, the average is undefined but the total is zero
+		if !hasData && rule.Metric != models.MetricTotalPosts {
+			return 0, false, false, false
+		}
+		value = current
+	}
+
+	met = compare(value, rule.Operator, rule.Value)
+
+	// With hysteresis, the threshold to go back past is moved away from the firing side
+	resolveThreshold := rule.Value
+	switch rule.Operator {
+	case ">", ">=":
+		resolveThreshold -= rule.Hysteresis
+	case "<", "<=":
+		resolveThreshold += rule.Hysteresis
+	}
+	cleared = !compare(value, rule.Operator, resolveThreshold)
+
+	return value, met, cleared, true
+}
+
+// compare applies a comparison operator
+func compare(value float64, operator string, threshold float64) bool {
+	switch operator {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	default:
+		return false
+	}
+}
+
+// event builds the notification of a state change of the rule
+func (r *alertRuleState) event(state models.AlertState, at time.Time) *models.AlertEvent {
+	return &models.AlertEvent{
+		Rule:      r.Name,
+		State:     state,
+		Condition: r.String(),
+		Metric:    r.Metric,
+		Window:    r.Window.String(),
+		Value:     r.value,
+		At:        at.UTC(),
+	}
+}
+
+// AlertRules returns the status of every rule, in configuration order
+func (e *AlertEngine) AlertRules() []models.AlertRuleStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	statuses := make([]models.AlertRuleStatus, 0, len(e.rules))
+	for _, rule := range e.rules {
+		status := models.AlertRuleStatus{
+			Name:          rule.Name,
+			Condition:     rule.String(),
+			State:         rule.state,
+			Value:         rule.value,
+			Notifications: rule.notifications,
+			Suppressed:    rule.suppressed,
+		}
+
+		if !rule.lastEvaluatedAt.IsZero() {
+			lastEvaluatedAt := rule.lastEvaluatedAt.UTC()
+			status.LastEvaluatedAt = &lastEvaluatedAt
+		}
+		if !rule.firingSince.IsZero() {
+			firingSince := rule.firingSince.UTC()
+			status.FiringSince = &firingSince
+		}
+		if !rule.lastNotifiedAt.IsZero() {
+			lastNotifiedAt := rule.lastNotifiedAt.UTC()
+			status.LastNotifiedAt = &lastNotifiedAt
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/testutil"
+)
+
+// mockNotifier records the notified payloads
+type mockNotifier struct {
+	mu       sync.Mutex
+	payloads []any
+}
+
+// Check interface implementation at compile-time
+var _ Notifier = &mockNotifier{}
+
+func (m *mockNotifier) Notify(ctx context.Context, payload any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.payloads = append(m.payloads, payload)
+	return nil
+}
+
+func (m *mockNotifier) String() string {
+	return "mock"
+}
+
+func (m *mockNotifier) states() []models.AlertState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var states []models.AlertState
+	for _, payload := range m.payloads {
+		states = append(states, payload.(models.AlertEvent).State)
+	}
+	return states
+}
+
+// testAlertEngine creates an alert engine on a manually advanced clock, with a single rule notifying the returned notifier
+func testAlertEngine(rule AlertRule) (*AlertEngine, *testClock, *mockNotifier) {
+	clock := &testClock{now: time.Unix(1700000000, 0)}
+	notifier := &mockNotifier{}
+	rule.Notifiers = []Notifier{notifier}
+
+	engine := NewAlertEngine(&mockStreamService{}, []AlertRule{rule}, time.Second, testLogger())
+	engine.now = clock.Now
+	engine.startedAt = clock.Now()
+
+	return engine, clock, notifier
+}
+
+// retweetPost returns a tweet with the given number of retweets
+func retweetPost(retweets int) *models.PostPayload {
+	return &models.PostPayload{
+		Type: "tweet",
+		Data: models.Post{Timestamp: 1700000000, Details: map[string]interface{}{"retweets": retweets}},
+	}
+}
+
+// step adds posts at the current second, evaluates the rules and advances the clock by a second
+func step(engine *AlertEngine, clock *testClock, posts ...*models.PostPayload) {
+	for _, post := range posts {
+		engine.observe(post)
+	}
+	engine.evaluate(context.Background())
+	engine.deliveries.Wait()
+	clock.Advance(time.Second)
+}
+
+func TestAlertEngine_Threshold(t *testing.T) {
+	engine, clock, notifier := testAlertEngine(AlertRule{
+		Name:       "high-retweets",
+		Metric:     "avg_retweets",
+		Condition:  models.AlertThreshold,
+		Operator:   ">",
+		Value:      500,
+		Window:     3 * time.Second,
+		Hysteresis: 100,
+	})
+
+	// No evaluation before the window is filled
+	step(engine, clock, retweetPost(600))
+	step(engine, clock, retweetPost(600))
+	if rules := engine.AlertRules(); rules[0].LastEvaluatedAt != nil {
+		t.Fatalf("expected no evaluation during warm-up, got %+v", rules[0])
+	}
+
+	step(engine, clock, retweetPost(600))
+	step(engine, clock, retweetPost(600))
+	if states := notifier.states(); len(states) != 1 || states[0] != models.AlertFiring {
+		t.Fatalf("expected a firing event, got %v", states)
+	}
+
+	rules := engine.AlertRules()
+	if rules[0].State != models.AlertFiring || rules[0].Value == nil || *rules[0].Value != 600 {
+		t.Errorf("unexpected rule status: %+v", rules[0])
+	}
+
+	// Below the threshold but within the hysteresis: still firing
+	for range 3 {
+		step(engine, clock, retweetPost(450))
+	}
+	if states := notifier.states(); len(states) != 1 {
+		t.Fatalf("expected no resolution within the hysteresis, got %v", states)
+	}
+
+	// Below the threshold minus the hysteresis: resolved
+	for range 3 {
+		step(engine, clock, retweetPost(300))
+	}
+	if states := notifier.states(); len(states) != 2 || states[1] != models.AlertOK {
+		t.Fatalf("expected a resolution event, got %v", states)
+	}
+}
+
+func TestAlertEngine_Cooldown(t *testing.T) {
+	engine, clock, notifier := testAlertEngine(AlertRule{
+		Name:      "no-posts",
+		Metric:    models.MetricTotalPosts,
+		Condition: models.AlertThreshold,
+		Operator:  "<=",
+		Value:     0,
+		Window:    time.Second,
+		Cooldown:  time.Minute,
+	})
+
+	step(engine, clock, retweetPost(1)) // warm-up
+	step(engine, clock)                 // fires
+	step(engine, clock, retweetPost(1)) // resolves
+	step(engine, clock)                 // fires again during the cooldown
+
+	if states := notifier.states(); len(states) != 2 {
+		t.Fatalf("expected the second firing to be suppressed, got %v", states)
+	}
+
+	rules := engine.AlertRules()
+	if rules[0].State != models.AlertFiring || rules[0].Suppressed != 1 {
+		t.Errorf("unexpected rule status: %+v", rules[0])
+	}
+
+	// The resolution of a suppressed firing is not notified either
+	step(engine, clock, retweetPost(1))
+	if states := notifier.states(); len(states) != 2 {
+		t.Fatalf("expected no resolution event, got %v", states)
+	}
+
+	// After the cooldown, firing is notified again
+	clock.Advance(time.Minute)
+	step(engine, clock)
+	if states := notifier.states(); len(states) != 3 || states[2] != models.AlertFiring {
+		t.Fatalf("expected a firing event after the cooldown, got %v", states)
+	}
+}
+
+func TestAlertEngine_Inherit(t *testing.T) {
+	rule := AlertRule{
+		Name:      "no-posts",
+		Metric:    models.MetricTotalPosts,
+		Condition: models.AlertThreshold,
+		Operator:  "<=",
+		Value:     0,
+		Window:    time.Second,
+		Cooldown:  time.Minute,
+	}
+	previous, clock, notifier := testAlertEngine(rule)
+
+	step(previous, clock, retweetPost(1)) // warm-up
+	step(previous, clock)                 // fires
+	if states := notifier.states(); len(states) != 1 || states[0] != models.AlertFiring {
+		t.Fatalf("expected a firing event, got %v", states)
+	}
+
+	rule.Notifiers = []Notifier{notifier}
+	engine := NewAlertEngine(&mockStreamService{}, []AlertRule{rule}, time.Second, testLogger())
+	engine.now = clock.Now
+	engine.Inherit(previous)
+
+	// Still firing and evaluated right away: no new notification
+	step(engine, clock)
+	rules := engine.AlertRules()
+	if rules[0].State != models.AlertFiring || rules[0].LastEvaluatedAt == nil || rules[0].Notifications != 1 {
+		t.Fatalf("expected the firing state to be kept, got %+v", rules[0])
+	}
+	if states := notifier.states(); len(states) != 1 {
+		t.Fatalf("expected no new notification, got %v", states)
+	}
+
+	// The cooldown is kept as well
+	step(engine, clock, retweetPost(1)) // resolves
+	step(engine, clock)                 // fires again during the cooldown
+	if states := notifier.states(); len(states) != 2 || states[1] != models.AlertOK {
+		t.Fatalf("expected only the resolution to be notified, got %v", states)
+	}
+	if rules := engine.AlertRules(); rules[0].Suppressed != 1 {
+		t.Errorf("expected the second firing to be suppressed, got %+v", rules[0])
+	}
+}
+
+func TestAlertEngine_RateOfChange(t *testing.T) {
+	engine, clock, notifier := testAlertEngine(AlertRule{
+		Name:      "posts-drop",
+		Metric:    models.MetricTotalPosts,
+		Condition: models.AlertRateOfChange,
+		Operator:  "<=",
+		Value:     -50,
+		Window:    2 * time.Second,
+	})
+
+	step(engine, clock)
+
+	// Previous window: 4 posts per second
+	for range 2 {
+		step(engine, clock, retweetPost(1), retweetPost(1), retweetPost(1), retweetPost(1))
+	}
+	if states := notifier.states(); len(states) != 0 {
+		t.Fatalf("expected no event during warm-up, got %v", states)
+	}
+
+	// Current window: 1 post per second, a 75% drop
+	step(engine, clock, retweetPost(1))
+	step(engine, clock, retweetPost(1))
+
+	if states := notifier.states(); len(states) != 1 || states[0] != models.AlertFiring {
+		t.Fatalf("expected a firing event, got %v", states)
+	}
+
+	rules := engine.AlertRules()
+	if rules[0].Value == nil || *rules[0].Value != -75 {
+		t.Errorf("expected a -75%% change, got %+v", rules[0])
+	}
+}
+
+func TestAlertEngine_Absence(t *testing.T) {
+	engine, clock, notifier := testAlertEngine(AlertRule{
+		Name:      "no-retweets",
+		Metric:    "avg_retweets",
+		Condition: models.AlertAbsence,
+		Window:    2 * time.Second,
+	})
+
+	// Posts without the dimension do not count as data
+	article := &models.PostPayload{Type: "article", Data: models.Post{Timestamp: 1700000000, Details: map[string]interface{}{}}}
+	for range 3 {
+		step(engine, clock, article)
+	}
+
+	if states := notifier.states(); len(states) != 1 || states[0] != models.AlertFiring {
+		t.Fatalf("expected a firing event, got %v", states)
+	}
+
+	step(engine, clock, retweetPost(10))
+	if states := notifier.states(); len(states) != 2 || states[1] != models.AlertOK {
+		t.Fatalf("expected a resolution event, got %v", states)
+	}
+}
+
+func TestAlertEngine_Webhook(t *testing.T) {
+	receiver := testutil.NewWebhookReceiver("s3cret", 1)
+	defer receiver.Close()
+
+	webhook := NewWebhook("ops", receiver.URL, "s3cret", 3, receiver.Client(), testLogger())
+	webhook.retryDelay = 0
+
+	// The stream delivers a post every 50ms
+	stream := &mockStreamService{
+		readEventsFn: func(ctx context.Context) (<-chan StreamResult, error) {
+			ch := make(chan StreamResult)
+			go func() {
+				defer close(ch)
+				ticker := time.NewTicker(50 * time.Millisecond)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-ticker.C:
+						select {
+						case ch <- StreamResult{Post: retweetPost(900)}:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}
+			}()
+			return ch, nil
+		},
+	}
+
+	rule := AlertRule{
+		Name:      "high-retweets",
+		Metric:    "avg_retweets",
+		Condition: models.AlertThreshold,
+		Operator:  ">",
+		Value:     500,
+		Window:    time.Second,
+		Notifiers: []Notifier{webhook},
+	}
+	engine := NewAlertEngine(stream, []AlertRule{rule}, 200*time.Millisecond, testLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go engine.Run(ctx)
+
+	select {
+	case delivery := <-receiver.Received:
+		if !delivery.Verified {
+			t.Error("expected a valid signature")
+		}
+
+		var event models.AlertEvent
+		if err := json.Unmarshal(delivery.Body, &event); err != nil {
+			t.Fatalf("failed to parse event: %v", err)
+		}
+		if event.Rule != "high-retweets" || event.State != models.AlertFiring || event.Value == nil || *event.Value != 900 {
+			t.Errorf("unexpected event: %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the webhook notification")
+	}
+}
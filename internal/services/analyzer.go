@@ -1,18 +1,27 @@
 package services
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math"
+	"slices"
 	"time"
 
 	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
 )
 
+// ErrShuttingDown is the cause of the cancellation of the requests in progress when the server shuts down
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// maxAnalysisGroups bounds the number of groups of an analysis, the posts of the groups beyond only count in the totals
+const maxAnalysisGroups = 10000
+
 // AnalyzerService defines the analyzer service interface
 type AnalyzerService interface {
-	AnalyzePosts(ctx context.Context, duration time.Duration, dimension string) (*models.AnalysisResult, error)
+	AnalyzePosts(ctx context.Context, limits models.AnalysisLimits, dimension string, grouping models.AnalysisGrouping) (*models.AnalysisResult, error)
 }
 
 // StreamAnalyzer performs statistical analysis on social media posts
@@ -40,18 +49,45 @@ type aggregator struct {
 	dimensionSum     uint64
 	validCount       int64
 	dimension        string
+
+	// mean and m2 track the spread of the dimension values (Welford's algorithm)
+	mean float64
+	m2   float64
+
+	// groups are the statistics of the requested grouping (none when it is the zero value)
+	grouping        models.AnalysisGrouping
+	groups          map[groupKey]*groupStats
+	groupsTruncated bool
+}
+
+// groupKey identifies a group of posts: the start of its bucket and its post type, each zero when not grouped by
+type groupKey struct {
+	bucketStart int64
+	postType    string
+}
+
+// groupStats are the statistics of a group of posts
+type groupStats struct {
+	totalPosts   int
+	dimensionSum uint64
+	validCount   int64
 }
 
-// newAggregator creates a new aggregator
-func newAggregator(dimension string) *aggregator {
-	return &aggregator{
+// newAggregator creates a new aggregator, grouping the posts as requested
+func newAggregator(dimension string, grouping models.AnalysisGrouping) *aggregator {
+	agg := &aggregator{
 		totalPosts:       0,
 		minimumTimestamp: 0,
 		maximumTimestamp: 0,
 		dimensionSum:     0,
 		validCount:       0,
 		dimension:        dimension,
+		grouping:         grouping,
 	}
+	if grouping.Bucket > 0 || grouping.ByPostType {
+		agg.groups = make(map[groupKey]*groupStats)
+	}
+	return agg
 }
 
 // processPost updates the aggregator with a new post (incremental computation)
@@ -77,9 +113,49 @@ func (agg *aggregator) processPost(post *models.PostPayload) {
 	}
 
 	// Update dimension statistics
-	if dimValue, ok := post.GetDimensionValue(agg.dimension); ok {
+	dimValue, hasValue := post.GetDimensionValue(agg.dimension)
+	if hasValue {
 		agg.dimensionSum += dimValue
 		agg.validCount++
+
+		delta := float64(dimValue) - agg.mean
+		agg.mean += delta / float64(agg.validCount)
+		agg.m2 += delta * (float64(dimValue) - agg.mean)
+	}
+
+	if agg.groups != nil {
+		agg.processGroup(post, dimValue, hasValue)
+	}
+}
+
+// processGroup updates the statistics of the group of a post
+func (agg *aggregator) processGroup(post *models.PostPayload, dimValue uint64, hasValue bool) {
+	var key groupKey
+	if bucket := int64(agg.grouping.Bucket / time.Second); bucket > 0 {
+		// Floor division, so that the buckets of the timestamps before 1970 are aligned as well
+		key.bucketStart = post.Data.Timestamp / bucket * bucket
+		if post.Data.Timestamp%bucket < 0 {
+			key.bucketStart -= bucket
+		}
+	}
+	if agg.grouping.ByPostType {
+		key.postType = post.Type
+	}
+
+	stats, ok := agg.groups[key]
+	if !ok {
+		if len(agg.groups) >= maxAnalysisGroups {
+			agg.groupsTruncated = true
+			return
+		}
+		stats = &groupStats{}
+		agg.groups[key] = stats
+	}
+
+	stats.totalPosts++
+	if hasValue {
+		stats.dimensionSum += dimValue
+		stats.validCount++
 	}
 }
 
@@ -95,60 +171,242 @@ func (agg *aggregator) getResult() *models.AnalysisResult {
 	// Calculate average with proper rounding
 	if agg.validCount > 0 {
 		result.Average = int(math.Round(float64(agg.dimensionSum) / float64(agg.validCount)))
+		result.Samples = agg.validCount
+		result.Mean = agg.mean
+	}
+	if agg.validCount > 1 {
+		result.Variance = agg.m2 / float64(agg.validCount-1)
+	}
+
+	if agg.groups != nil {
+		result.Groups = agg.getGroups()
+	}
+
+	// An average of 0 can mean no data, make it explicit
+	switch {
+	case agg.totalPosts == 0:
+		result.Warnings = append(result.Warnings, "no posts received during the analysis")
+	case agg.validCount == 0:
+		result.Warnings = append(result.Warnings, fmt.Sprintf("no post carried the %s dimension", agg.dimension))
+	}
+
+	if agg.groupsTruncated {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("more than %d groups, the posts of the other groups only count in the totals", maxAnalysisGroups))
 	}
 
 	return result
 }
 
+// getGroups returns the statistics of the groups, by bucket then post type
+func (agg *aggregator) getGroups() []models.AnalysisGroup {
+	groups := make([]models.AnalysisGroup, 0, len(agg.groups))
+	for key, stats := range agg.groups {
+		group := models.AnalysisGroup{
+			PostType:   key.postType,
+			TotalPosts: stats.totalPosts,
+		}
+		if agg.grouping.Bucket > 0 {
+			group.BucketStart = key.bucketStart
+			group.BucketEnd = key.bucketStart + int64(agg.grouping.Bucket/time.Second)
+		}
+		if stats.validCount > 0 {
+			group.Average = int(math.Round(float64(stats.dimensionSum) / float64(stats.validCount)))
+		}
+		groups = append(groups, group)
+	}
+
+	slices.SortFunc(groups, func(a, b models.AnalysisGroup) int {
+		return cmp.Or(cmp.Compare(a.BucketStart, b.BucketStart), cmp.Compare(a.PostType, b.PostType))
+	})
+	return groups
+}
+
 // AnalyzePosts orchestrates the complete analysis workflow.
-// Establishes a stream connection with a time-bounded context.
+// Establishes a stream connection with a context cancelled by the first limit reached.
 // Posts are analyzed as they arrive using incremental computation (no memory storage required).
-func (a *StreamAnalyzer) AnalyzePosts(ctx context.Context, duration time.Duration, dimension string) (*models.AnalysisResult, error) {
-	// Create context with timeout for the analysis duration
-	analyzeCtx, cancel := context.WithTimeout(ctx, duration)
-	defer cancel()
+// Errors are *models.Error, classifying the failures of the stream and the cancellations of the analysis.
+func (a *StreamAnalyzer) AnalyzePosts(ctx context.Context, limits models.AnalysisLimits, dimension string, grouping models.AnalysisGrouping) (*models.AnalysisResult, error) {
+	startedAt := time.Now()
+
+	// Create a context cancelled when the analysis duration elapses, the until time is reached or enough posts are received.
+	// Its cause tells which limit ended the analysis.
+	analyzeCtx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+	if limits.Duration > 0 {
+		var cancel context.CancelFunc
+		analyzeCtx, cancel = context.WithTimeoutCause(analyzeCtx, limits.Duration, errDurationElapsed)
+		defer cancel()
+	} else if limits.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		analyzeCtx, cancel = context.WithTimeoutCause(analyzeCtx, limits.MaxDuration, errMaxDurationElapsed)
+		defer cancel()
+	}
+	if !limits.Until.IsZero() {
+		var cancel context.CancelFunc
+		analyzeCtx, cancel = context.WithDeadlineCause(analyzeCtx, limits.Until, errUntilReached)
+		defer cancel()
+	}
 
 	// Get stream results
 	resultCh, err := a.streamClient.ReadEvents(analyzeCtx)
 	if err != nil {
-		return nil, err
+		if ctx.Err() != nil {
+			return nil, canceledError(ctx, 0)
+		}
+		return nil, unavailableError(err)
 	}
 
 	// Incrementally compute aggregate metrics from posts (no storage) until either:
-	// - The context timeout expires (after 'duration')
+	// - A limit is reached (duration, until time or number of posts)
 	// - The stream encounters an error (parse, scanner, network)
 	// - The channel closes normally (unexpected, but handled)
-	result, err := a.computeAnalysis(resultCh, dimension)
+	result, err := a.computeAnalysis(analyzeCtx, resultCh, dimension, grouping, limits.MaxPosts, stop)
 
-	// Return result with post collection error if one occurred
+	// Return the partial result with the post collection error if one occurred
 	if err != nil {
-		return result, fmt.Errorf("partial results (analyzed %d posts): %w", result.TotalPosts, err)
+		result.EndedBy = models.EndedByStreamError
+		markPartial(result, models.Warning(models.ErrorStreamInterrupted, "stream interrupted"), startedAt, limits)
+		return result, models.WrapError(models.ErrorStreamInterrupted, err, fmt.Sprintf("partial results (analyzed %d posts)", result.TotalPosts)).
+			WithDetail("posts_analyzed", result.TotalPosts)
+	}
+
+	// The analysis was cut short by the server or the client
+	if ctx.Err() != nil {
+		canceledErr := canceledError(ctx, result.TotalPosts)
+		result.EndedBy = models.EndedByClientDisconnect
+		if canceledErr.Code == models.ErrorShuttingDown {
+			result.EndedBy = models.EndedByShutdown
+		}
+		markPartial(result, models.Warning(canceledErr.Code, canceledErr.Message), startedAt, limits)
+		return result, canceledErr
+	}
+
+	switch context.Cause(analyzeCtx) {
+	case errMaxPostsReached:
+		result.EndedBy = models.EndedByMaxPosts
+	case errUntilReached:
+		result.EndedBy = models.EndedByUntil
+	case errDurationElapsed:
+		result.EndedBy = models.EndedByDuration
+	case errMaxDurationElapsed:
+		result.EndedBy = models.EndedByMaxDuration
+	default:
+		// The stream closed without error before any limit was reached
+		result.EndedBy = models.EndedByStreamClosed
 	}
 
 	return result, nil
 }
 
+// Causes of the cancellation of the stream by the limits of an analysis
+var (
+	errDurationElapsed    = errors.New("analysis duration elapsed")
+	errMaxDurationElapsed = errors.New("analysis maximum duration elapsed")
+	errUntilReached       = errors.New("analysis until time reached")
+	errMaxPostsReached    = errors.New("analysis maximum number of posts reached")
+)
+
+// markPartial flags a result cut short, explaining why and how long the stream was analyzed for
+func markPartial(result *models.AnalysisResult, reason string, startedAt time.Time, limits models.AnalysisLimits) {
+	result.Partial = true
+
+	elapsed := fmt.Sprintf("analyzed for %s", time.Since(startedAt).Round(time.Millisecond))
+	switch {
+	case limits.Duration > 0:
+		elapsed += fmt.Sprintf(" of the requested %s", limits.Duration)
+	case limits.MaxDuration > 0:
+		elapsed += fmt.Sprintf(" of at most %s", limits.MaxDuration)
+	}
+	result.Warnings = append(result.Warnings, reason, elapsed)
+}
+
+// unavailableError classifies a failure to connect to the stream.
+// While the circuit breaker is open, the details tell when to retry.
+func unavailableError(err error) *models.Error {
+	unavailableErr := models.WrapError(models.ErrorUpstreamUnavailable, err, "stream unavailable")
+
+	var openErr *CircuitOpenError
+	if errors.As(err, &openErr) {
+		unavailableErr.Message = "stream unavailable, circuit breaker is open"
+		unavailableErr.WithDetail("retry_after_seconds", int(math.Ceil(openErr.RetryAfter.Seconds())))
+	}
+
+	return unavailableErr
+}
+
+// canceledError classifies the cancellation of an analysis: the server shutting down or the client going away
+func canceledError(ctx context.Context, posts int) *models.Error {
+	message := fmt.Sprintf("analysis interrupted (analyzed %d posts)", posts)
+
+	if cause := context.Cause(ctx); errors.Is(cause, ErrShuttingDown) {
+		return models.WrapError(models.ErrorShuttingDown, cause, message).WithDetail("posts_analyzed", posts)
+	}
+	return models.WrapError(models.ErrorClientClosedRequest, ctx.Err(), message).WithDetail("posts_analyzed", posts)
+}
+
 // computeAnalysis computes analysis incrementally as posts arrive from the channel.
-// Blocks until the channel closes.
+// Blocks until the channel closes, stopping the stream once maxPosts posts are received (no limit when zero).
 // Memory usage: O(1) (only stores running totals, not the posts themselves)
-func (a *StreamAnalyzer) computeAnalysis(resultCh <-chan StreamResult, dimension string) (*models.AnalysisResult, error) {
+func (a *StreamAnalyzer) computeAnalysis(ctx context.Context, resultCh <-chan StreamResult, dimension string, grouping models.AnalysisGrouping, maxPosts int, stop context.CancelCauseFunc) (*models.AnalysisResult, error) {
 	// Create an aggregator (only stores statistics, not posts)
-	aggregator := newAggregator(dimension)
+	aggregator := newAggregator(dimension, grouping)
+
+	startedAt := time.Now()
+	var lastEventAt time.Time
+	limitReached := false
 
 	// Process each post as it arrives
 	for result := range resultCh {
+		// Drain what the stream sends after the maximum number of posts, until it sees the cancellation
+		if limitReached {
+			continue
+		}
+
 		// Handle stream error
 		if result.Err != nil {
-			a.logger.Error("Stream error during analysis", "err", result.Err, "posts_processed", aggregator.totalPosts)
-			return aggregator.getResult(), result.Err
+			a.logger.ErrorContext(ctx, "Stream error during analysis", "err", result.Err, "posts_processed", aggregator.totalPosts)
+			res := aggregator.getResult()
+			res.Stream = analysisHealth(startedAt, lastEventAt, aggregator.totalPosts, false)
+			return res, result.Err
 		}
 
 		// Process valid post incrementally
 		if result.Post != nil {
 			aggregator.processPost(result.Post)
+			lastEventAt = time.Now()
+
+			// Stop the stream as soon as enough posts are received
+			if maxPosts > 0 && aggregator.totalPosts >= maxPosts {
+				limitReached = true
+				stop(errMaxPostsReached)
+			}
 		}
 	}
 
-	// Return final computed result
-	return aggregator.getResult(), nil
+	// Return final computed result.
+	// The stream stayed connected if it was closed because the analysis window ended.
+	res := aggregator.getResult()
+	res.Stream = analysisHealth(startedAt, lastEventAt, aggregator.totalPosts, ctx.Err() != nil)
+	return res, nil
+}
+
+// analysisHealth describes the health of the stream as observed during a single analysis
+func analysisHealth(startedAt, lastEventAt time.Time, events int, connected bool) *models.StreamHealth {
+	now := time.Now()
+
+	health := &models.StreamHealth{
+		Connected:    connected,
+		LastEventAge: -1,
+	}
+
+	if elapsed := now.Sub(startedAt).Seconds(); elapsed > 0 {
+		health.EventsPerSecond = float64(events) / elapsed
+	}
+
+	if !lastEventAt.IsZero() {
+		health.LastEventAt = lastEventAt.Unix()
+		health.LastEventAge = now.Sub(lastEventAt).Seconds()
+	}
+
+	return health
 }
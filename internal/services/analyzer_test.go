@@ -6,7 +6,9 @@ import (
 	"io"
 	"log/slog"
 	"math"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -110,7 +112,7 @@ func TestStreamAnalyzer_AnalyzePosts_StreamConnectionError(t *testing.T) {
 
 	analyzer := NewStreamAnalyzer(mockStreamClient, testLogger())
 
-	result, err := analyzer.AnalyzePosts(context.Background(), 1*time.Second, "likes")
+	result, err := analyzer.AnalyzePosts(context.Background(), models.AnalysisLimits{Duration: 1 * time.Second}, "likes", models.AnalysisGrouping{})
 
 	// Should return the connection error
 	if err == nil {
@@ -121,6 +123,10 @@ func TestStreamAnalyzer_AnalyzePosts_StreamConnectionError(t *testing.T) {
 		t.Errorf("expected error to wrap %v, got %v", expectedErr, err)
 	}
 
+	if code := models.ErrorCodeOf(err); code != models.ErrorUpstreamUnavailable {
+		t.Errorf("expected code %s, got %s", models.ErrorUpstreamUnavailable, code)
+	}
+
 	if result != nil {
 		t.Errorf("expected nil result on error, got %v", result)
 	}
@@ -161,7 +167,7 @@ func TestStreamAnalyzer_AnalyzePosts_StreamError(t *testing.T) {
 
 	analyzer := NewStreamAnalyzer(mockStream, testLogger())
 
-	result, err := analyzer.AnalyzePosts(context.Background(), 1*time.Second, "likes")
+	result, err := analyzer.AnalyzePosts(context.Background(), models.AnalysisLimits{Duration: 1 * time.Second}, "likes", models.AnalysisGrouping{})
 
 	// Should return both partial results and error
 	if err == nil {
@@ -178,6 +184,10 @@ func TestStreamAnalyzer_AnalyzePosts_StreamError(t *testing.T) {
 		t.Errorf("expected error message to mention 'partial results', got: %v", err.Error())
 	}
 
+	if code := models.ErrorCodeOf(err); code != models.ErrorStreamInterrupted {
+		t.Errorf("expected code %s, got %s", models.ErrorStreamInterrupted, code)
+	}
+
 	// Result should not be nil
 	if result == nil {
 		t.Fatal("expected non-nil result with partial data, got nil")
@@ -196,6 +206,14 @@ func TestStreamAnalyzer_AnalyzePosts_StreamError(t *testing.T) {
 	if result.Average != expectedResult.Average {
 		t.Errorf("expected Average=%d, got %d", expectedResult.Average, result.Average)
 	}
+
+	// The result is flagged as partial, explaining why and for how long the stream was analyzed, without the stream error itself
+	if !result.Partial {
+		t.Error("expected the result to be flagged as partial")
+	}
+	if len(result.Warnings) != 2 || result.Warnings[0] != "STREAM_INTERRUPTED: stream interrupted" || !strings.Contains(result.Warnings[1], "of the requested 1s") {
+		t.Errorf("expected the coded stream interruption and the analyzed duration as warnings, got %q", result.Warnings)
+	}
 }
 
 func TestStreamAnalyzer_AnalyzePosts_EmptyStream(t *testing.T) {
@@ -212,7 +230,7 @@ func TestStreamAnalyzer_AnalyzePosts_EmptyStream(t *testing.T) {
 
 	analyzer := NewStreamAnalyzer(mockStreamClient, testLogger())
 
-	result, err := analyzer.AnalyzePosts(context.Background(), 1*time.Second, "likes")
+	result, err := analyzer.AnalyzePosts(context.Background(), models.AnalysisLimits{Duration: 1 * time.Second}, "likes", models.AnalysisGrouping{})
 
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
@@ -231,6 +249,11 @@ func TestStreamAnalyzer_AnalyzePosts_EmptyStream(t *testing.T) {
 	if result.Average != expectedResult.Average {
 		t.Errorf("expected Average=%d, got %d", expectedResult.Average, result.Average)
 	}
+
+	// The empty result should be flagged
+	if len(result.Warnings) != 1 || result.Warnings[0] != "no posts received during the analysis" {
+		t.Errorf("expected a no posts warning, got %v", result.Warnings)
+	}
 }
 
 func TestStreamAnalyzer_AnalyzePosts_AllPostsMissingDimension(t *testing.T) {
@@ -265,7 +288,7 @@ func TestStreamAnalyzer_AnalyzePosts_AllPostsMissingDimension(t *testing.T) {
 	analyzer := NewStreamAnalyzer(mockStreamClient, testLogger())
 
 	// Analyze posts with the 'likes' dimension
-	result, err := analyzer.AnalyzePosts(context.Background(), 1*time.Second, "likes")
+	result, err := analyzer.AnalyzePosts(context.Background(), models.AnalysisLimits{Duration: 1 * time.Second}, "likes", models.AnalysisGrouping{})
 
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
@@ -286,6 +309,11 @@ func TestStreamAnalyzer_AnalyzePosts_AllPostsMissingDimension(t *testing.T) {
 	if result.MaximumTimestamp != expectedResult.MaximumTimestamp {
 		t.Errorf("expected MaximumTimestamp=%d, got %d", expectedResult.MaximumTimestamp, result.MaximumTimestamp)
 	}
+
+	// The average of 0 should be flagged
+	if len(result.Warnings) != 1 || result.Warnings[0] != "no post carried the likes dimension" {
+		t.Errorf("expected a missing dimension warning, got %v", result.Warnings)
+	}
 }
 
 func TestStreamAnalyzer_AnalyzePosts_Success(t *testing.T) {
@@ -478,7 +506,7 @@ func TestStreamAnalyzer_AnalyzePosts_Success(t *testing.T) {
 			analyzer := NewStreamAnalyzer(mockStream, testLogger())
 
 			// Execute analysis
-			result, err := analyzer.AnalyzePosts(context.Background(), tc.duration, tc.dimension)
+			result, err := analyzer.AnalyzePosts(context.Background(), models.AnalysisLimits{Duration: tc.duration}, tc.dimension, models.AnalysisGrouping{})
 
 			// Assertions
 			if err != nil {
@@ -499,3 +527,258 @@ func TestStreamAnalyzer_AnalyzePosts_Success(t *testing.T) {
 		})
 	}
 }
+
+func TestStreamAnalyzer_AnalyzePosts_CircuitOpen(t *testing.T) {
+	mockStream := &mockStreamService{
+		readEventsFn: func(ctx context.Context) (<-chan StreamResult, error) {
+			return nil, &CircuitOpenError{RetryAfter: 12500 * time.Millisecond}
+		},
+	}
+
+	_, err := NewStreamAnalyzer(mockStream, testLogger()).AnalyzePosts(context.Background(), models.AnalysisLimits{Duration: time.Second}, "likes", models.AnalysisGrouping{})
+
+	var codedErr *models.Error
+	if !errors.As(err, &codedErr) || codedErr.Code != models.ErrorUpstreamUnavailable {
+		t.Fatalf("expected an upstream unavailable error, got %v", err)
+	}
+
+	// The retry delay is rounded up to the next second
+	if retryAfter := codedErr.Details["retry_after_seconds"]; retryAfter != 13 {
+		t.Errorf("expected a retry delay of 13 seconds, got %v", retryAfter)
+	}
+}
+
+func TestStreamAnalyzer_AnalyzePosts_Cancelled(t *testing.T) {
+	tests := []struct {
+		name            string
+		limits          models.AnalysisLimits
+		cause           error
+		expectedCode    models.ErrorCode
+		expectedEnd     string
+		expectedElapsed string
+	}{
+		{"server shutting down", models.AnalysisLimits{Duration: time.Minute}, ErrShuttingDown, models.ErrorShuttingDown, models.EndedByShutdown, "of the requested 1m0s"},
+		{"client gone", models.AnalysisLimits{Duration: time.Minute}, nil, models.ErrorClientClosedRequest, models.EndedByClientDisconnect, "of the requested 1m0s"},
+		{"client gone without duration", models.AnalysisLimits{MaxPosts: 500, MaxDuration: time.Minute}, nil, models.ErrorClientClosedRequest, models.EndedByClientDisconnect, "of at most 1m0s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The stream delivers a post, then the request is cancelled before the end of the analysis
+			ctx, cancel := context.WithCancelCause(context.Background())
+			mockStream := &mockStreamService{
+				readEventsFn: func(ctx context.Context) (<-chan StreamResult, error) {
+					ch := make(chan StreamResult, 1)
+					ch <- StreamResult{Post: likesPost(10)}
+					go func() {
+						<-ctx.Done()
+						close(ch)
+					}()
+					return ch, nil
+				},
+			}
+			time.AfterFunc(50*time.Millisecond, func() { cancel(tt.cause) })
+
+			result, err := NewStreamAnalyzer(mockStream, testLogger()).AnalyzePosts(ctx, tt.limits, "likes", models.AnalysisGrouping{})
+			if code := models.ErrorCodeOf(err); code != tt.expectedCode {
+				t.Fatalf("expected code %s, got %s (%v)", tt.expectedCode, code, err)
+			}
+			if result == nil || result.TotalPosts != 1 || !result.Partial {
+				t.Fatalf("expected the partial result, got %+v", result)
+			}
+			if len(result.Warnings) != 2 || !strings.Contains(result.Warnings[1], tt.expectedElapsed) {
+				t.Errorf("expected the interruption and the analyzed duration as warnings, got %q", result.Warnings)
+			}
+			if result.EndedBy != tt.expectedEnd {
+				t.Errorf("expected the analysis to be ended by %s, got %q", tt.expectedEnd, result.EndedBy)
+			}
+		})
+	}
+}
+
+// endlessStream is a stream sending posts until its context is cancelled
+type endlessStream struct {
+	posts atomic.Int64
+}
+
+func (s *endlessStream) ReadEvents(ctx context.Context) (<-chan StreamResult, error) {
+	ch := make(chan StreamResult)
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case ch <- StreamResult{Post: likesPost(10)}:
+				s.posts.Add(1)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func TestStreamAnalyzer_AnalyzePosts_Limits(t *testing.T) {
+	tests := []struct {
+		name          string
+		limits        models.AnalysisLimits
+		expectedEnd   string
+		expectedPosts int
+	}{
+		{"max posts", models.AnalysisLimits{MaxPosts: 500}, models.EndedByMaxPosts, 500},
+		{"max posts before duration", models.AnalysisLimits{Duration: time.Minute, MaxPosts: 3}, models.EndedByMaxPosts, 3},
+		{"duration", models.AnalysisLimits{Duration: 50 * time.Millisecond}, models.EndedByDuration, -1},
+		{"maximum duration", models.AnalysisLimits{MaxPosts: math.MaxInt, MaxDuration: 50 * time.Millisecond}, models.EndedByMaxDuration, -1},
+		{"duration before maximum duration", models.AnalysisLimits{Duration: 50 * time.Millisecond, MaxDuration: time.Minute}, models.EndedByDuration, -1},
+		{"until", models.AnalysisLimits{Until: time.Now().Add(50 * time.Millisecond)}, models.EndedByUntil, -1},
+		{"until before duration", models.AnalysisLimits{Duration: time.Minute, Until: time.Now().Add(50 * time.Millisecond)}, models.EndedByUntil, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := &endlessStream{}
+			started := time.Now()
+
+			result, err := NewStreamAnalyzer(stream, testLogger()).AnalyzePosts(context.Background(), tt.limits, "likes", models.AnalysisGrouping{})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if elapsed := time.Since(started); elapsed > 5*time.Second {
+				t.Fatalf("expected the first limit to end the analysis, took %s", elapsed)
+			}
+
+			if result.EndedBy != tt.expectedEnd {
+				t.Errorf("expected the analysis to be ended by %s, got %q", tt.expectedEnd, result.EndedBy)
+			}
+			if tt.expectedPosts >= 0 && result.TotalPosts != tt.expectedPosts {
+				t.Errorf("expected exactly %d posts, got %d", tt.expectedPosts, result.TotalPosts)
+			}
+			if result.Partial {
+				t.Error("expected a limit reached not to flag the result as partial")
+			}
+
+			// The stream is cancelled as soon as the limit is reached
+			sent := stream.posts.Load()
+			time.Sleep(20 * time.Millisecond)
+			if stream.posts.Load() != sent {
+				t.Error("expected the stream to be cancelled")
+			}
+		})
+	}
+}
+
+func TestAggregator_Variance(t *testing.T) {
+	agg := newAggregator("likes", models.AnalysisGrouping{})
+	for _, likes := range []int{50, 150, 100} {
+		agg.processPost(likesPost(likes))
+	}
+	agg.processPost(&models.PostPayload{Type: "article", Data: models.Post{Details: map[string]interface{}{}}})
+
+	result := agg.getResult()
+	if result.Samples != 3 || result.Mean != 100 {
+		t.Errorf("expected 3 samples with a mean of 100, got %d and %v", result.Samples, result.Mean)
+	}
+	if math.Abs(result.Variance-2500) > 1e-9 {
+		t.Errorf("expected a variance of 2500, got %v", result.Variance)
+	}
+}
+
+func TestAggregator_Groups(t *testing.T) {
+	posts := []models.PostPayload{
+		{Type: "tweet", Data: models.Post{Timestamp: 125, Details: map[string]interface{}{"likes": 10}}},
+		{Type: "tweet", Data: models.Post{Timestamp: 179, Details: map[string]interface{}{"likes": 21}}},
+		{Type: "instagram_media", Data: models.Post{Timestamp: 130, Details: map[string]interface{}{"likes": 100}}},
+		{Type: "tweet", Data: models.Post{Timestamp: 60, Details: map[string]interface{}{"likes": 5}}},
+		{Type: "article", Data: models.Post{Timestamp: 200, Details: map[string]interface{}{}}},
+	}
+
+	agg := newAggregator("likes", models.AnalysisGrouping{Bucket: time.Minute, ByPostType: true})
+	for _, post := range posts {
+		agg.processPost(&post)
+	}
+
+	// The groups are sorted by bucket then post type, a group without the dimension has no average
+	expected := []models.AnalysisGroup{
+		{BucketStart: 60, BucketEnd: 120, PostType: "tweet", TotalPosts: 1, Average: 5},
+		{BucketStart: 120, BucketEnd: 180, PostType: "instagram_media", TotalPosts: 1, Average: 100},
+		{BucketStart: 120, BucketEnd: 180, PostType: "tweet", TotalPosts: 2, Average: 16},
+		{BucketStart: 180, BucketEnd: 240, PostType: "article", TotalPosts: 1, Average: 0},
+	}
+	result := agg.getResult()
+	if !slices.Equal(result.Groups, expected) {
+		t.Errorf("expected groups %+v, got %+v", expected, result.Groups)
+	}
+	if result.TotalPosts != 5 {
+		t.Errorf("expected the totals over all the groups, got %d posts", result.TotalPosts)
+	}
+
+	// Without grouping, there is no group
+	agg = newAggregator("likes", models.AnalysisGrouping{})
+	agg.processPost(&posts[0])
+	if groups := agg.getResult().Groups; groups != nil {
+		t.Errorf("expected no groups, got %+v", groups)
+	}
+}
+
+func TestStreamAnalyzer_AnalyzePosts_StreamHealth(t *testing.T) {
+	posts := []models.PostPayload{
+		{Type: "tweet", Data: models.Post{Timestamp: 1554324856, Details: map[string]interface{}{"likes": 10}}},
+		{Type: "tweet", Data: models.Post{Timestamp: 1633974046, Details: map[string]interface{}{"likes": 20}}},
+	}
+
+	tests := []struct {
+		name              string
+		streamErr         error
+		expectedConnected bool
+	}{
+		{
+			name:              "stream open until the end of the analysis",
+			streamErr:         nil,
+			expectedConnected: true,
+		},
+		{
+			name:              "stream interrupted by an error",
+			streamErr:         ErrStreamStalled,
+			expectedConnected: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Setup mock service that sends posts then waits for the analysis window to end
+			mockStream := &mockStreamService{
+				readEventsFn: func(ctx context.Context) (<-chan StreamResult, error) {
+					ch := make(chan StreamResult, len(posts)+1)
+					go func() {
+						defer close(ch)
+						for _, post := range posts {
+							ch <- StreamResult{Post: &post}
+						}
+						if tc.streamErr != nil {
+							ch <- StreamResult{Err: tc.streamErr}
+							return
+						}
+						<-ctx.Done()
+					}()
+					return ch, nil
+				},
+			}
+
+			analyzer := NewStreamAnalyzer(mockStream, testLogger())
+
+			result, _ := analyzer.AnalyzePosts(context.Background(), models.AnalysisLimits{Duration: 100 * time.Millisecond}, "likes", models.AnalysisGrouping{})
+
+			if result == nil || result.Stream == nil {
+				t.Fatal("expected stream health in the result")
+			}
+			if result.Stream.Connected != tc.expectedConnected {
+				t.Errorf("expected connected=%v, got %v", tc.expectedConnected, result.Stream.Connected)
+			}
+			if result.Stream.EventsPerSecond <= 0 {
+				t.Errorf("expected positive events per second, got %v", result.Stream.EventsPerSecond)
+			}
+			if result.Stream.LastEventAge < 0 {
+				t.Errorf("expected last event age to be set, got %v", result.Stream.LastEventAge)
+			}
+		})
+	}
+}
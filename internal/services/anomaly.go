@@ -0,0 +1,497 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+const (
+	// maxStoredAnomalies bounds the number of anomalies kept in memory, the oldest ones are dropped first
+	maxStoredAnomalies = 1000
+
+	// anomalyTickInterval is how often the detector checks whether the current bucket is over
+	anomalyTickInterval = time.Second
+
+	// anomalyMaxRetryDelay bounds the delay between two connection attempts of the detector
+	anomalyMaxRetryDelay = 30 * time.Second
+
+	// madScale makes the median absolute deviation a consistent estimator of the standard deviation of normal data
+	madScale = 1.4826
+)
+
+// AnomalyOptions configures an anomaly detector
+type AnomalyOptions struct {
+	// Method is models.AnomalyMethodEWMA or models.AnomalyMethodMAD
+	Method string
+
+	// Bucket is the span of the time buckets the series are made of
+	Bucket time.Duration
+
+	// ZScoreLimit flags the buckets whose absolute z-score is greater
+	ZScoreLimit float64
+
+	// Alpha is the smoothing factor of the EWMA baseline, in (0, 1]: the higher, the faster the baseline follows the series
+	Alpha float64
+
+	// Window is the number of recent buckets of the MAD baseline
+	Window int
+
+	// MinBuckets is the number of buckets a series needs before its buckets are scored
+	MinBuckets int
+
+	// MinPosts is the number of posts carrying the dimension a bucket needs to be part of a series
+	MinPosts int
+
+	// Notifiers receive every anomaly
+	Notifiers []Notifier
+}
+
+// AnomalyReporter is implemented by components reporting detected anomalies
+type AnomalyReporter interface {
+	Anomalies(query models.AnomalyQuery) []models.Anomaly
+}
+
+// baseline is the expected behavior of a series
+type baseline interface {
+	// score returns the expected value and its spread, and false while the baseline has too few samples
+	score() (expected, deviation float64, ok bool)
+	update(value float64)
+}
+
+// ewmaBaseline is an exponentially weighted moving mean and variance
+type ewmaBaseline struct {
+	alpha      float64
+	minSamples int
+
+	samples  int
+	mean     float64
+	variance float64
+}
+
+func (b *ewmaBaseline) score() (float64, float64, bool) {
+	if b.samples < b.minSamples {
+		return 0, 0, false
+	}
+	return b.mean, math.Sqrt(b.variance), true
+}
+
+func (b *ewmaBaseline) update(value float64) {
+	b.samples++
+	if b.samples == 1 {
+		b.mean = value
+		return
+	}
+
+	diff := value - b.mean
+	increment := b.alpha * diff
+	b.mean += increment
+	b.variance = (1 - b.alpha) * (b.variance + diff*increment)
+}
+
+// madBaseline is the median and median absolute deviation of the recent values
+type madBaseline struct {
+	window     int
+	minSamples int
+
+	values []float64
+}
+
+func (b *madBaseline) score() (float64, float64, bool) {
+	if len(b.values) < b.minSamples {
+		return 0, 0, false
+	}
+
+	median := medianOf(b.values)
+	deviations := make([]float64, len(b.values))
+	for i, value := range b.values {
+		deviations[i] = math.Abs(value - median)
+	}
+
+	return median, madScale * medianOf(deviations), true
+}
+
+func (b *madBaseline) update(value float64) {
+	b.values = append(b.values, value)
+	if len(b.values) > b.window {
+		b.values = b.values[1:]
+	}
+}
+
+// medianOf returns the median of the values, without modifying them
+func medianOf(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// seriesKey identifies a series: a dimension of a post type
+type seriesKey struct {
+	postType  string
+	dimension string
+}
+
+// bucketStats are the statistics of a series during the current bucket
+type bucketStats struct {
+	sum   uint64
+	count int
+}
+
+// AnomalyDetector continuously reads the stream and keeps a rolling baseline of the average of every dimension per post type.
+// The posts are grouped in time buckets by arrival time: when a bucket is over, its average is scored against the baseline
+// of its series before updating it, and flagged when its z-score goes past the limit.
+type AnomalyDetector struct {
+	stream StreamService
+	opts   AnomalyOptions
+	logger *slog.Logger
+	now    func() time.Time
+
+	mu          sync.Mutex
+	bucketStart time.Time
+	bucket      map[seriesKey]*bucketStats
+	baselines   map[seriesKey]baseline
+	anomalies   []models.Anomaly
+
+	// pending are the anomalies not notified yet
+	pending []models.Anomaly
+
+	// deliveries tracks the notifications being sent
+	deliveries sync.WaitGroup
+}
+
+// Check interface implementation at compile-time
+var _ AnomalyReporter = &AnomalyDetector{}
+
+// NewAnomalyDetector creates a new anomaly detector
+func NewAnomalyDetector(stream StreamService, opts AnomalyOptions, logger *slog.Logger) *AnomalyDetector {
+	return &AnomalyDetector{
+		stream:    stream,
+		opts:      opts,
+		logger:    logger,
+		now:       time.Now,
+		bucket:    make(map[seriesKey]*bucketStats),
+		baselines: make(map[seriesKey]baseline),
+	}
+}
+
+// Inherit carries over the baselines, the current bucket and the stored anomalies of the previous detector when the method
+// and the bucket span are unchanged, so that a reload of the configuration does not restart the learning of the series.
+// The baselines follow the new smoothing factor, window and minimum of buckets from then on.
+// It must be called before the detector runs.
+func (d *AnomalyDetector) Inherit(previous *AnomalyDetector) {
+	if d.opts.Method != previous.opts.Method || d.opts.Bucket != previous.opts.Bucket {
+		return
+	}
+
+	previous.mu.Lock()
+	defer previous.mu.Unlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, prevBaseline := range previous.baselines {
+		b := d.newBaseline()
+		switch b := b.(type) {
+		case *ewmaBaseline:
+			prev := prevBaseline.(*ewmaBaseline)
+			b.samples, b.mean, b.variance = prev.samples, prev.mean, prev.variance
+		case *madBaseline:
+			prev := prevBaseline.(*madBaseline)
+			b.values = slices.Clone(prev.values[max(len(prev.values)-b.window, 0):])
+		}
+		d.baselines[key] = b
+	}
+
+	d.bucketStart = previous.bucketStart
+	for key, stats := range previous.bucket {
+		d.bucket[key] = &bucketStats{sum: stats.sum, count: stats.count}
+	}
+
+	d.anomalies = slices.Clone(previous.anomalies)
+}
+
+// Run reads the stream and scores the buckets until the context is cancelled
+func (d *AnomalyDetector) Run(ctx context.Context) {
+	go followStream(ctx, d.logger, "anomalies", anomalyMaxRetryDelay, d.consumeStream)
+
+	// Buckets also end while the stream is silent
+	ticker := time.NewTicker(anomalyTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// The notifications in progress are cancelled with the context
+			d.deliveries.Wait()
+			return
+		case <-ticker.C:
+			// Buckets ended by a post are notified here as well
+			d.notify(ctx, d.roll())
+		}
+	}
+}
+
+// consumeStream reads a single stream connection and adds its posts to the current bucket.
+// Returns the number of posts read and the error that ended the stream.
+func (d *AnomalyDetector) consumeStream(ctx context.Context) (int, error) {
+	resultCh, err := d.stream.ReadEvents(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	consumed := 0
+	for result := range resultCh {
+		if result.Err != nil {
+			return consumed, result.Err
+		}
+		if result.Post != nil {
+			d.observe(result.Post)
+			consumed++
+		}
+	}
+
+	return consumed, fmt.Errorf("stream closed")
+}
+
+// observe adds a post received now to the current bucket, ending the previous bucket if the post starts a new one
+func (d *AnomalyDetector) observe(post *models.PostPayload) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.rollLocked()
+
+	for dimension := range models.ValidDimensions {
+		value, ok := post.GetDimensionValue(dimension)
+		if !ok {
+			continue
+		}
+
+		key := seriesKey{postType: post.Type, dimension: dimension}
+		stats, ok := d.bucket[key]
+		if !ok {
+			stats = &bucketStats{}
+			d.bucket[key] = stats
+		}
+		stats.sum += value
+		stats.count++
+	}
+}
+
+// roll ends the current bucket if it is over, and returns the anomalies not notified yet
+func (d *AnomalyDetector) roll() []models.Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.rollLocked()
+
+	pending := d.pending
+	d.pending = nil
+	return pending
+}
+
+// rollLocked ends the current bucket if it is over, scores its series and starts the bucket of now.
+// Must be called with the lock held.
+func (d *AnomalyDetector) rollLocked() {
+	now := d.now()
+	if d.bucketStart.IsZero() {
+		d.bucketStart = now.Truncate(d.opts.Bucket)
+		return
+	}
+
+	bucketEnd := d.bucketStart.Add(d.opts.Bucket)
+	if now.Before(bucketEnd) {
+		return
+	}
+
+	// Score the series in a stable order
+	keys := make([]seriesKey, 0, len(d.bucket))
+	for key := range d.bucket {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b seriesKey) int {
+		return cmp.Or(cmp.Compare(a.postType, b.postType), cmp.Compare(a.dimension, b.dimension))
+	})
+
+	var anomalies []models.Anomaly
+	for _, key := range keys {
+		stats := d.bucket[key]
+		if stats.count < d.opts.MinPosts {
+			// Too few posts for the average to be meaningful
+			continue
+		}
+		value := float64(stats.sum) / float64(stats.count)
+
+		b, ok := d.baselines[key]
+		if !ok {
+			b = d.newBaseline()
+			d.baselines[key] = b
+		}
+
+		// A series without spread cannot be scored
+		expected, deviation, ok := b.score()
+		if ok && deviation > 0 {
+			zScore := (value - expected) / deviation
+			if math.Abs(zScore) > d.opts.ZScoreLimit {
+				anomaly := models.Anomaly{
+					PostType:    key.postType,
+					Dimension:   key.dimension,
+					BucketStart: d.bucketStart.UTC(),
+					BucketEnd:   bucketEnd.UTC(),
+					Value:       value,
+					Posts:       stats.count,
+					Baseline:    expected,
+					Deviation:   deviation,
+					ZScore:      zScore,
+					Direction:   "spike",
+					Method:      d.opts.Method,
+				}
+				if zScore < 0 {
+					anomaly.Direction = "drop"
+				}
+				anomalies = append(anomalies, anomaly)
+			}
+		}
+
+		b.update(value)
+	}
+
+	d.anomalies = append(d.anomalies, anomalies...)
+	if len(d.anomalies) > maxStoredAnomalies {
+		d.anomalies = slices.Clone(d.anomalies[len(d.anomalies)-maxStoredAnomalies:])
+	}
+	d.pending = append(d.pending, anomalies...)
+
+	clear(d.bucket)
+	d.bucketStart = now.Truncate(d.opts.Bucket)
+}
+
+// newBaseline creates the baseline of a new series
+func (d *AnomalyDetector) newBaseline() baseline {
+	// At least two values are needed for a spread
+	minSamples := max(d.opts.MinBuckets, 2)
+
+	if d.opts.Method == models.AnomalyMethodMAD {
+		return &madBaseline{window: d.opts.Window, minSamples: minSamples}
+	}
+	return &ewmaBaseline{alpha: d.opts.Alpha, minSamples: minSamples}
+}
+
+// notify logs the anomalies and sends them in the background
+func (d *AnomalyDetector) notify(ctx context.Context, anomalies []models.Anomaly) {
+	for _, anomaly := range anomalies {
+		d.logger.Info("Anomaly detected", "post_type", anomaly.PostType, "dimension", anomaly.Dimension,
+			"value", anomaly.Value, "baseline", anomaly.Baseline, "z_score", anomaly.ZScore, "bucket_start", anomaly.BucketStart)
+
+		for _, notifier := range d.opts.Notifiers {
+			d.deliveries.Add(1)
+			go func() {
+				defer d.deliveries.Done()
+				if err := notifier.Notify(ctx, anomaly); err != nil {
+					d.logger.Error("Failed to send anomaly notification", "notifier", notifier.String(), "err", err)
+				}
+			}()
+		}
+	}
+}
+
+// Anomalies returns the detected anomalies matching the query, newest first
+func (d *AnomalyDetector) Anomalies(query models.AnomalyQuery) []models.Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	matches := []models.Anomaly{}
+	for i := len(d.anomalies) - 1; i >= 0; i-- {
+		anomaly := d.anomalies[i]
+
+		if query.PostType != "" && anomaly.PostType != query.PostType {
+			continue
+		}
+		if query.Dimension != "" && anomaly.Dimension != query.Dimension {
+			continue
+		}
+		if !query.From.IsZero() && !anomaly.BucketEnd.After(query.From) {
+			continue
+		}
+		if !query.To.IsZero() && !anomaly.BucketStart.Before(query.To) {
+			continue
+		}
+
+		matches = append(matches, anomaly)
+		if query.Limit > 0 && len(matches) == query.Limit {
+			break
+		}
+	}
+
+	return matches
+}
+
+// AnomalyAnalyzer wraps an analyzer and adds the anomalies of the analyzed dimension detected during the analysis to its results
+type AnomalyAnalyzer struct {
+	analyzer  AnalyzerService
+	anomalies AnomalyReporter
+}
+
+// Check interface implementation at compile-time
+var _ AnalyzerService = &AnomalyAnalyzer{}
+
+// NewAnomalyAnalyzer creates a new analyzer reporting the anomalies of the analyses
+func NewAnomalyAnalyzer(analyzer AnalyzerService, anomalies AnomalyReporter) *AnomalyAnalyzer {
+	return &AnomalyAnalyzer{
+		analyzer:  analyzer,
+		anomalies: anomalies,
+	}
+}
+
+// AnalyzePosts runs the analysis and adds the anomalies whose bucket overlaps it
+func (a *AnomalyAnalyzer) AnalyzePosts(ctx context.Context, limits models.AnalysisLimits, dimension string, grouping models.AnalysisGrouping) (*models.AnalysisResult, error) {
+	startedAt := time.Now()
+
+	result, err := a.analyzer.AnalyzePosts(ctx, limits, dimension, grouping)
+	if err != nil {
+		return result, err
+	}
+
+	result.Anomalies = a.anomalies.Anomalies(models.AnomalyQuery{Dimension: dimension, From: startedAt, To: time.Now()})
+	return result, nil
+}
+
+// AnomalyRangeAnalyzer wraps a range analyzer and adds the anomalies of the analyzed dimension in the range to its results
+type AnomalyRangeAnalyzer struct {
+	analyzer  RangeAnalyzerService
+	anomalies AnomalyReporter
+}
+
+// Check interface implementation at compile-time
+var _ RangeAnalyzerService = &AnomalyRangeAnalyzer{}
+
+// NewAnomalyRangeAnalyzer creates a new range analyzer reporting the anomalies of the analyzed ranges
+func NewAnomalyRangeAnalyzer(analyzer RangeAnalyzerService, anomalies AnomalyReporter) *AnomalyRangeAnalyzer {
+	return &AnomalyRangeAnalyzer{
+		analyzer:  analyzer,
+		anomalies: anomalies,
+	}
+}
+
+// AnalyzeRange runs the analysis and adds the anomalies whose bucket overlaps the range.
+// Only the anomalies still in memory are reported, older ranges have none.
+func (a *AnomalyRangeAnalyzer) AnalyzeRange(ctx context.Context, from, to time.Time, dimension string, grouping models.AnalysisGrouping) (*models.AnalysisResult, error) {
+	result, err := a.analyzer.AnalyzeRange(ctx, from, to, dimension, grouping)
+	if err != nil {
+		return result, err
+	}
+
+	result.Anomalies = a.anomalies.Anomalies(models.AnomalyQuery{Dimension: dimension, From: from, To: to})
+	return result, nil
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// mockAnomalyReporter is a mock implementation of the Anomaly Reporter for testing
+type mockAnomalyReporter struct {
+	anomalies []models.Anomaly
+	query     models.AnomalyQuery
+}
+
+// Check interface implementation at compile-time
+var _ AnomalyReporter = &mockAnomalyReporter{}
+
+func (m *mockAnomalyReporter) Anomalies(query models.AnomalyQuery) []models.Anomaly {
+	m.query = query
+	return m.anomalies
+}
+
+// testAnomalyDetector creates an anomaly detector with 1-minute buckets on a manually advanced clock
+func testAnomalyDetector(method string) (*AnomalyDetector, *testClock) {
+	clock := &testClock{now: time.Unix(1700000000, 0).Truncate(time.Minute)}
+
+	detector := NewAnomalyDetector(&mockStreamService{}, AnomalyOptions{
+		Method:      method,
+		Bucket:      time.Minute,
+		ZScoreLimit: 3,
+		Alpha:       0.3,
+		Window:      10,
+		MinBuckets:  5,
+		MinPosts:    1,
+	}, testLogger())
+	detector.now = clock.Now
+
+	return detector, clock
+}
+
+// likesPost returns a tweet with the given number of likes
+func likesPost(likes int) *models.PostPayload {
+	return &models.PostPayload{
+		Type: "tweet",
+		Data: models.Post{Timestamp: 1700000000, Details: map[string]interface{}{"likes": likes}},
+	}
+}
+
+// feedBuckets adds one post per bucket with the given number of likes, and returns the anomalies of the ended buckets
+func feedBuckets(detector *AnomalyDetector, clock *testClock, likes ...int) []models.Anomaly {
+	var anomalies []models.Anomaly
+	for _, value := range likes {
+		detector.observe(likesPost(value))
+		clock.Advance(time.Minute)
+		anomalies = append(anomalies, detector.roll()...)
+	}
+	return anomalies
+}
+
+func TestAnomalyDetector(t *testing.T) {
+	steady := []int{100, 104, 98, 102, 97, 101, 103, 99}
+
+	tests := []struct {
+		name              string
+		method            string
+		last              int
+		expectedDirection string
+	}{
+		{"ewma spike", models.AnomalyMethodEWMA, 300, "spike"},
+		{"ewma drop", models.AnomalyMethodEWMA, 10, "drop"},
+		{"ewma normal value", models.AnomalyMethodEWMA, 102, ""},
+		{"mad spike", models.AnomalyMethodMAD, 300, "spike"},
+		{"mad drop", models.AnomalyMethodMAD, 10, "drop"},
+		{"mad normal value", models.AnomalyMethodMAD, 101, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detector, clock := testAnomalyDetector(tt.method)
+
+			if anomalies := feedBuckets(detector, clock, steady...); len(anomalies) != 0 {
+				t.Fatalf("expected no anomaly on the steady series, got %+v", anomalies)
+			}
+
+			anomalies := feedBuckets(detector, clock, tt.last)
+			if tt.expectedDirection == "" {
+				if len(anomalies) != 0 {
+					t.Errorf("expected no anomaly, got %+v", anomalies)
+				}
+				return
+			}
+
+			if len(anomalies) != 1 {
+				t.Fatalf("expected 1 anomaly, got %+v", anomalies)
+			}
+			anomaly := anomalies[0]
+			if anomaly.PostType != "tweet" || anomaly.Dimension != "likes" || anomaly.Value != float64(tt.last) {
+				t.Errorf("unexpected anomaly series: %+v", anomaly)
+			}
+			if anomaly.Direction != tt.expectedDirection || anomaly.Method != tt.method {
+				t.Errorf("expected a %s by %s, got %+v", tt.expectedDirection, tt.method, anomaly)
+			}
+			if anomaly.BucketEnd.Sub(anomaly.BucketStart) != time.Minute {
+				t.Errorf("expected a 1 minute bucket, got %s to %s", anomaly.BucketStart, anomaly.BucketEnd)
+			}
+		})
+	}
+}
+
+func TestAnomalyDetector_WarmUp(t *testing.T) {
+	detector, clock := testAnomalyDetector(models.AnomalyMethodEWMA)
+
+	// The series has fewer buckets than required before the spike
+	if anomalies := feedBuckets(detector, clock, 100, 104, 98, 5000); len(anomalies) != 0 {
+		t.Errorf("expected no anomaly during warm-up, got %+v", anomalies)
+	}
+}
+
+func TestAnomalyDetector_Inherit(t *testing.T) {
+	tests := []struct {
+		name            string
+		method          string
+		expectAnomalies bool
+	}{
+		{"same method", models.AnomalyMethodMAD, true},
+		{"method changed", models.AnomalyMethodEWMA, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous, clock := testAnomalyDetector(models.AnomalyMethodMAD)
+			if anomalies := feedBuckets(previous, clock, 100, 104, 98, 102, 97, 101, 500); len(anomalies) != 1 {
+				t.Fatalf("expected 1 anomaly, got %+v", anomalies)
+			}
+
+			detector, _ := testAnomalyDetector(tt.method)
+			detector.now = clock.Now
+			detector.Inherit(previous)
+
+			// The baselines are kept: the spike is scored right away
+			anomalies := feedBuckets(detector, clock, 600)
+			if tt.expectAnomalies != (len(anomalies) == 1) {
+				t.Errorf("expected anomalies %v, got %+v", tt.expectAnomalies, anomalies)
+			}
+
+			stored := detector.Anomalies(models.AnomalyQuery{})
+			if tt.expectAnomalies != (len(stored) == 2) {
+				t.Errorf("expected the stored anomalies to be kept %v, got %+v", tt.expectAnomalies, stored)
+			}
+		})
+	}
+}
+
+func TestAnomalyDetector_Anomalies(t *testing.T) {
+	detector, clock := testAnomalyDetector(models.AnomalyMethodMAD)
+
+	feedBuckets(detector, clock, 100, 104, 98, 102, 97, 101, 500)
+	spikeEnd := clock.Now()
+	feedBuckets(detector, clock, 100, 104, 3000)
+
+	tests := []struct {
+		name     string
+		query    models.AnomalyQuery
+		expected []float64
+	}{
+		{"all, newest first", models.AnomalyQuery{}, []float64{3000, 500}},
+		{"limit", models.AnomalyQuery{Limit: 1}, []float64{3000}},
+		{"dimension", models.AnomalyQuery{Dimension: "comments"}, []float64{}},
+		{"post type", models.AnomalyQuery{PostType: "tweet"}, []float64{3000, 500}},
+		{"before", models.AnomalyQuery{To: spikeEnd}, []float64{500}},
+		{"after", models.AnomalyQuery{From: spikeEnd}, []float64{3000}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anomalies := detector.Anomalies(tt.query)
+			if len(anomalies) != len(tt.expected) {
+				t.Fatalf("expected %d anomalies, got %+v", len(tt.expected), anomalies)
+			}
+			for i, value := range tt.expected {
+				if anomalies[i].Value != value {
+					t.Errorf("expected anomaly %d value %v, got %v", i, value, anomalies[i].Value)
+				}
+			}
+		})
+	}
+}
+
+func TestAnomalyDetector_Notify(t *testing.T) {
+	detector, clock := testAnomalyDetector(models.AnomalyMethodEWMA)
+	notifier := &mockNotifier{}
+	detector.opts.Notifiers = []Notifier{notifier}
+
+	// Anomalies are notified once
+	detector.notify(context.Background(), feedBuckets(detector, clock, 100, 104, 98, 102, 97, 101, 900))
+	detector.notify(context.Background(), detector.roll())
+	detector.deliveries.Wait()
+
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	if len(notifier.payloads) != 1 {
+		t.Fatalf("expected 1 notification, got %d", len(notifier.payloads))
+	}
+	if anomaly, ok := notifier.payloads[0].(models.Anomaly); !ok || anomaly.Value != 900 {
+		t.Errorf("unexpected notification: %+v", notifier.payloads[0])
+	}
+}
+
+func TestAnomalyAnalyzer_AnalyzePosts(t *testing.T) {
+	anomalies := &mockAnomalyReporter{
+		anomalies: []models.Anomaly{{PostType: "tweet", Dimension: "likes", Value: 900}},
+	}
+	analyzer := &mockAnalyzer{result: &models.AnalysisResult{TotalPosts: 1}}
+
+	before := time.Now()
+	result, err := NewAnomalyAnalyzer(analyzer, anomalies).AnalyzePosts(context.Background(), models.AnalysisLimits{Duration: time.Second}, "likes", models.AnalysisGrouping{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(result.Anomalies) != 1 || result.Anomalies[0].Value != 900 {
+		t.Errorf("unexpected anomalies: %+v", result.Anomalies)
+	}
+
+	// The anomalies are queried for the analyzed dimension over the analysis
+	query := anomalies.query
+	if query.Dimension != "likes" || query.From.Before(before) || query.To.Before(query.From) {
+		t.Errorf("unexpected anomaly query: %+v", query)
+	}
+}
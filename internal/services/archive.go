@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/store"
+)
+
+// RangeAnalyzerService defines the interface of the analyses over archived posts
+type RangeAnalyzerService interface {
+	AnalyzeRange(ctx context.Context, from, to time.Time, dimension string, grouping models.AnalysisGrouping) (*models.AnalysisResult, error)
+}
+
+// ArchiveAnalyzer performs statistical analysis on archived posts
+type ArchiveAnalyzer struct {
+	archive store.PostArchive
+	logger  *slog.Logger
+}
+
+// Check interface implementation at compile-time
+var _ RangeAnalyzerService = &ArchiveAnalyzer{}
+
+// NewArchiveAnalyzer creates a new archive analyzer
+func NewArchiveAnalyzer(archive store.PostArchive, logger *slog.Logger) *ArchiveAnalyzer {
+	return &ArchiveAnalyzer{
+		archive: archive,
+		logger:  logger,
+	}
+}
+
+// AnalyzeRange computes the same statistics as a stream analysis over the archived posts whose timestamp is in [from, to).
+// Does not wait for the stream, the result only depends on what was archived.
+func (a *ArchiveAnalyzer) AnalyzeRange(ctx context.Context, from, to time.Time, dimension string, grouping models.AnalysisGrouping) (*models.AnalysisResult, error) {
+	aggregator := newAggregator(dimension, grouping)
+
+	err := a.archive.Scan(ctx, from, to, func(post *models.PostPayload) error {
+		aggregator.processPost(post)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan post archive: %w", err)
+	}
+
+	return aggregator.getResult(), nil
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/store"
+)
+
+const (
+	// archiveFlushInterval is how often the buffered posts are written to the archive
+	archiveFlushInterval = time.Second
+
+	// archiveFlushSize is the number of buffered posts triggering a write before the flush interval
+	archiveFlushSize = 1000
+
+	// archiveMaxRetryDelay bounds the delay between two connection attempts of the archiver
+	archiveMaxRetryDelay = 30 * time.Second
+)
+
+// PostArchiver continuously reads the stream and archives every parsed post
+type PostArchiver struct {
+	stream  StreamService
+	archive store.PostArchive
+	logger  *slog.Logger
+}
+
+// NewPostArchiver creates a new post archiver
+func NewPostArchiver(stream StreamService, archive store.PostArchive, logger *slog.Logger) *PostArchiver {
+	return &PostArchiver{
+		stream:  stream,
+		archive: archive,
+		logger:  logger,
+	}
+}
+
+// Run archives the stream until the context is cancelled.
+// The stream is reconnected with an exponential backoff whenever it fails.
+func (a *PostArchiver) Run(ctx context.Context) {
+	followStream(ctx, a.logger, "archiver", archiveMaxRetryDelay, a.archiveStream)
+}
+
+// archiveStream reads a single stream connection and archives its posts.
+// Returns the number of archived posts and the error that ended the stream.
+func (a *PostArchiver) archiveStream(ctx context.Context) (int, error) {
+	resultCh, err := a.stream.ReadEvents(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	ticker := time.NewTicker(archiveFlushInterval)
+	defer ticker.Stop()
+
+	var buffer []models.PostPayload
+	archived := 0
+
+	flush := func() {
+		if len(buffer) == 0 {
+			return
+		}
+		if err := a.archive.Append(buffer); err != nil {
+			a.logger.Error("Failed to archive posts", "err", err, "posts", len(buffer))
+		} else {
+			archived += len(buffer)
+		}
+		buffer = buffer[:0]
+	}
+	defer flush()
+
+	for {
+		select {
+		case result, ok := <-resultCh:
+			if !ok {
+				return archived, errors.New("stream closed")
+			}
+			if result.Err != nil {
+				return archived, result.Err
+			}
+			if result.Post != nil {
+				buffer = append(buffer, *result.Post)
+			}
+			if len(buffer) >= archiveFlushSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/store"
+)
+
+// mockPostArchive is a mock implementation of the Post Archive for testing
+type mockPostArchive struct {
+	mu       sync.Mutex
+	posts    []models.PostPayload
+	appended chan struct{}
+}
+
+// Check interface implementation at compile-time
+var _ store.PostArchive = &mockPostArchive{}
+
+func (m *mockPostArchive) Append(posts []models.PostPayload) error {
+	m.mu.Lock()
+	m.posts = append(m.posts, posts...)
+	m.mu.Unlock()
+
+	if m.appended != nil {
+		m.appended <- struct{}{}
+	}
+	return nil
+}
+
+func (m *mockPostArchive) Scan(ctx context.Context, from, to time.Time, fn func(post *models.PostPayload) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.posts {
+		post := &m.posts[i]
+		if post.Data.Timestamp < from.Unix() || post.Data.Timestamp >= to.Unix() {
+			continue
+		}
+		if err := fn(post); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestPostArchiver_Run(t *testing.T) {
+	posts := []models.PostPayload{
+		{Type: "tweet", Data: models.Post{Timestamp: 1705312800}},
+		{Type: "tweet", Data: models.Post{Timestamp: 1705312801}},
+	}
+
+	// The first connection fails, the second one delivers posts then breaks
+	calls := 0
+	mockStreamClient := &mockStreamService{
+		readEventsFn: func(ctx context.Context) (<-chan StreamResult, error) {
+			calls++
+			if calls == 1 {
+				return nil, errors.New("connection refused")
+			}
+			return testStreamResultCh(posts, errors.New("stream interrupted")), nil
+		},
+	}
+
+	archive := &mockPostArchive{appended: make(chan struct{}, 10)}
+	archiver := NewPostArchiver(mockStreamClient, archive, testLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		archiver.Run(ctx)
+		close(done)
+	}()
+
+	// Posts buffered before the stream error are flushed to the archive
+	select {
+	case <-archive.appended:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the posts to be archived")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("archiver did not stop after context cancellation")
+	}
+
+	archive.mu.Lock()
+	defer archive.mu.Unlock()
+	if len(archive.posts) < len(posts) {
+		t.Errorf("expected at least %d archived posts, got %d", len(posts), len(archive.posts))
+	}
+}
+
+func TestArchiveAnalyzer_AnalyzeRange(t *testing.T) {
+	archive := &mockPostArchive{
+		posts: []models.PostPayload{
+			{Type: "tweet", Data: models.Post{Timestamp: 100, Details: map[string]interface{}{"likes": float64(10)}}},
+			{Type: "tweet", Data: models.Post{Timestamp: 200, Details: map[string]interface{}{"likes": float64(20)}}},
+			{Type: "tweet", Data: models.Post{Timestamp: 300, Details: map[string]interface{}{"likes": float64(90)}}},
+		},
+	}
+
+	analyzer := NewArchiveAnalyzer(archive, testLogger())
+
+	result, err := analyzer.AnalyzeRange(context.Background(), time.Unix(100, 0), time.Unix(300, 0), "likes", models.AnalysisGrouping{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Only the posts in [100, 300) are analyzed
+	if result.TotalPosts != 2 {
+		t.Errorf("expected TotalPosts=2, got %d", result.TotalPosts)
+	}
+	if result.MinimumTimestamp != 100 || result.MaximumTimestamp != 200 {
+		t.Errorf("expected timestamps [100, 200], got [%d, %d]", result.MinimumTimestamp, result.MaximumTimestamp)
+	}
+	if result.Average != 15 {
+		t.Errorf("expected Average=15, got %d", result.Average)
+	}
+}
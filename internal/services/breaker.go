@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// maxBreakerTransitions is the number of recent transitions kept for inspection
+const maxBreakerTransitions = 20
+
+// ErrCircuitOpen is matched (with errors.Is) by the errors returned while the circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError is returned instead of connecting to the stream while the circuit breaker is open
+type CircuitOpenError struct {
+	// RetryAfter is the time left before the breaker lets a probe through
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrCircuitOpen, e.RetryAfter.Round(time.Second))
+}
+
+// Is makes errors.Is(err, ErrCircuitOpen) match
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// BreakerReporter is implemented by components exposing the state of a circuit breaker
+type BreakerReporter interface {
+	BreakerStatus() models.BreakerStatus
+}
+
+// CircuitBreaker wraps a stream service and fails fast while the stream is unreachable.
+// It opens after a number of consecutive connection failures, then lets a single probe
+// through once the open timeout has elapsed (half-open) to decide whether to close again.
+type CircuitBreaker struct {
+	stream           StreamService
+	logger           *slog.Logger
+	failureThreshold int
+	openTimeout      time.Duration
+	now              func() time.Time
+
+	mu          sync.Mutex
+	state       models.BreakerState
+	failures    int
+	openedAt    time.Time
+	probing     bool
+	lastError   string
+	transitions []models.BreakerTransition
+}
+
+// Check interface implementation at compile-time
+var (
+	_ StreamService   = &CircuitBreaker{}
+	_ BreakerReporter = &CircuitBreaker{}
+)
+
+// NewCircuitBreaker creates a new circuit breaker around a stream service
+func NewCircuitBreaker(stream StreamService, failureThreshold int, openTimeout time.Duration, logger *slog.Logger) *CircuitBreaker {
+	return &CircuitBreaker{
+		stream:           stream,
+		logger:           logger,
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		now:              time.Now,
+		state:            models.BreakerClosed,
+	}
+}
+
+// ReadEvents connects to the stream through the breaker.
+// Returns a *CircuitOpenError without connecting while the breaker is open.
+func (b *CircuitBreaker) ReadEvents(ctx context.Context) (<-chan StreamResult, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+
+	resultCh, err := b.stream.ReadEvents(ctx)
+
+	// A cancelled request says nothing about the health of the stream
+	if err != nil && ctx.Err() != nil {
+		b.release()
+		return nil, err
+	}
+
+	b.record(err)
+
+	return resultCh, err
+}
+
+// BreakerStatus returns the current state of the breaker
+func (b *CircuitBreaker) BreakerStatus() models.BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.expireOpen(now)
+
+	status := models.BreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		FailureThreshold:    b.failureThreshold,
+		OpenTimeout:         b.openTimeout.String(),
+		LastError:           b.lastError,
+		Transitions:         append([]models.BreakerTransition{}, b.transitions...),
+	}
+
+	if b.state != models.BreakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+
+	if b.state == models.BreakerOpen {
+		status.RetryAfter = b.retryAfter(now).Seconds()
+	}
+
+	return status
+}
+
+// allow decides whether a connection attempt may go through
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.expireOpen(now)
+
+	switch b.state {
+	case models.BreakerOpen:
+		return &CircuitOpenError{RetryAfter: b.retryAfter(now)}
+
+	case models.BreakerHalfOpen:
+		// Only one probe at a time, the others fail fast until its outcome is known
+		if b.probing {
+			return &CircuitOpenError{RetryAfter: time.Second}
+		}
+		b.probing = true
+	}
+
+	return nil
+}
+
+// record updates the breaker with the outcome of a connection attempt
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	if err == nil {
+		b.failures = 0
+		if b.state != models.BreakerClosed {
+			b.transition(models.BreakerClosed, "probe succeeded")
+		}
+		return
+	}
+
+	b.failures++
+	b.lastError = err.Error()
+
+	switch {
+	case b.state == models.BreakerHalfOpen:
+		b.openedAt = b.now()
+		b.transition(models.BreakerOpen, "probe failed: "+err.Error())
+
+	case b.state == models.BreakerClosed && b.failures >= b.failureThreshold:
+		b.openedAt = b.now()
+		b.transition(models.BreakerOpen, fmt.Sprintf("%d consecutive failures: %s", b.failures, err.Error()))
+	}
+}
+
+// release gives back a probe slot without recording any outcome
+func (b *CircuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// expireOpen moves an open breaker to half-open once the open timeout has elapsed.
+// Must be called with the lock held.
+func (b *CircuitBreaker) expireOpen(now time.Time) {
+	if b.state == models.BreakerOpen && now.Sub(b.openedAt) >= b.openTimeout {
+		b.transition(models.BreakerHalfOpen, "open timeout elapsed")
+	}
+}
+
+// retryAfter returns the time left before the open timeout elapses.
+// Must be called with the lock held.
+func (b *CircuitBreaker) retryAfter(now time.Time) time.Duration {
+	return max(b.openTimeout-now.Sub(b.openedAt), 0)
+}
+
+// transition changes the state, logs it and keeps it in the recent transitions.
+// Must be called with the lock held.
+func (b *CircuitBreaker) transition(to models.BreakerState, reason string) {
+	from := b.state
+	b.state = to
+
+	b.transitions = append(b.transitions, models.BreakerTransition{
+		From:   from,
+		To:     to,
+		At:     b.now(),
+		Reason: reason,
+	})
+	if len(b.transitions) > maxBreakerTransitions {
+		b.transitions = b.transitions[len(b.transitions)-maxBreakerTransitions:]
+	}
+
+	if to == models.BreakerOpen {
+		b.logger.Warn("Circuit breaker state changed", "from", from, "to", to, "reason", reason, "open_timeout", b.openTimeout)
+		return
+	}
+
+	b.logger.Info("Circuit breaker state changed", "from", from, "to", to, "reason", reason)
+}
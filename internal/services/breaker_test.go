@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// testClock is a manually advanced clock for testing
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// testBreaker creates a circuit breaker around a stream whose connection outcome is controlled by the test
+func testBreaker(threshold int, openTimeout time.Duration) (*CircuitBreaker, *testClock, *int, *error) {
+	clock := &testClock{now: time.Unix(1700000000, 0)}
+	calls := 0
+	var connErr error
+
+	stream := &mockStreamService{
+		readEventsFn: func(ctx context.Context) (<-chan StreamResult, error) {
+			calls++
+			if connErr != nil {
+				return nil, connErr
+			}
+			return testStreamResultCh(nil, nil), nil
+		},
+	}
+
+	breaker := NewCircuitBreaker(stream, threshold, openTimeout, testLogger())
+	breaker.now = clock.Now
+
+	return breaker, clock, &calls, &connErr
+}
+
+func TestCircuitBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	breaker, clock, calls, connErr := testBreaker(3, 30*time.Second)
+	*connErr = errors.New("connection refused")
+
+	ctx := context.Background()
+
+	// The first failures go through to the stream
+	for range 3 {
+		if _, err := breaker.ReadEvents(ctx); !errors.Is(err, *connErr) {
+			t.Fatalf("expected connection error, got %v", err)
+		}
+	}
+
+	if state := breaker.BreakerStatus().State; state != models.BreakerOpen {
+		t.Fatalf("expected breaker to be open after 3 failures, got %s", state)
+	}
+
+	// While open, calls fail fast without reaching the stream
+	clock.Advance(10 * time.Second)
+
+	_, err := breaker.ReadEvents(ctx)
+
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) {
+		t.Fatalf("expected *CircuitOpenError, got %v", err)
+	}
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Error("expected error to match ErrCircuitOpen")
+	}
+	if openErr.RetryAfter != 20*time.Second {
+		t.Errorf("expected retry after 20s, got %s", openErr.RetryAfter)
+	}
+	if *calls != 3 {
+		t.Errorf("expected 3 calls to reach the stream, got %d", *calls)
+	}
+}
+
+func TestCircuitBreaker_SuccessResetsFailures(t *testing.T) {
+	breaker, _, _, connErr := testBreaker(2, 30*time.Second)
+	ctx := context.Background()
+
+	*connErr = errors.New("connection refused")
+	breaker.ReadEvents(ctx)
+
+	*connErr = nil
+	breaker.ReadEvents(ctx)
+
+	*connErr = errors.New("connection refused")
+	breaker.ReadEvents(ctx)
+
+	// Failures are not consecutive, the breaker stays closed
+	status := breaker.BreakerStatus()
+	if status.State != models.BreakerClosed {
+		t.Errorf("expected breaker to stay closed, got %s", status.State)
+	}
+	if status.ConsecutiveFailures != 1 {
+		t.Errorf("expected 1 consecutive failure, got %d", status.ConsecutiveFailures)
+	}
+}
+
+func TestCircuitBreaker_HalfOpenProbe(t *testing.T) {
+	tests := []struct {
+		name          string
+		probeErr      error
+		expectedState models.BreakerState
+	}{
+		{
+			name:          "successful probe closes the breaker",
+			probeErr:      nil,
+			expectedState: models.BreakerClosed,
+		},
+		{
+			name:          "failed probe re-opens the breaker",
+			probeErr:      errors.New("still down"),
+			expectedState: models.BreakerOpen,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			breaker, clock, calls, connErr := testBreaker(1, 30*time.Second)
+			ctx := context.Background()
+
+			*connErr = errors.New("connection refused")
+			breaker.ReadEvents(ctx)
+
+			// Once the open timeout elapses, the breaker lets a probe through
+			clock.Advance(30 * time.Second)
+			if state := breaker.BreakerStatus().State; state != models.BreakerHalfOpen {
+				t.Fatalf("expected half-open breaker after the open timeout, got %s", state)
+			}
+
+			*connErr = tc.probeErr
+			breaker.ReadEvents(ctx)
+
+			if *calls != 2 {
+				t.Errorf("expected the probe to reach the stream, got %d calls", *calls)
+			}
+
+			status := breaker.BreakerStatus()
+			if status.State != tc.expectedState {
+				t.Errorf("expected %s breaker, got %s", tc.expectedState, status.State)
+			}
+
+			// closed -> open -> half-open -> closed/open
+			if len(status.Transitions) != 3 {
+				t.Errorf("expected 3 transitions, got %+v", status.Transitions)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker_SingleProbe(t *testing.T) {
+	clock := &testClock{now: time.Unix(1700000000, 0)}
+	probeStarted := make(chan struct{})
+	releaseProbe := make(chan struct{})
+	calls := 0
+
+	stream := &mockStreamService{
+		readEventsFn: func(ctx context.Context) (<-chan StreamResult, error) {
+			calls++
+			if calls == 1 {
+				return nil, errors.New("connection refused")
+			}
+			// The probe blocks until the test releases it
+			close(probeStarted)
+			<-releaseProbe
+			return testStreamResultCh(nil, nil), nil
+		},
+	}
+
+	breaker := NewCircuitBreaker(stream, 1, time.Second, testLogger())
+	breaker.now = clock.Now
+
+	breaker.ReadEvents(context.Background())
+	clock.Advance(time.Second)
+
+	probeDone := make(chan error)
+	go func() {
+		_, err := breaker.ReadEvents(context.Background())
+		probeDone <- err
+	}()
+	<-probeStarted
+
+	// Concurrent calls fail fast while the probe is in flight
+	if _, err := breaker.ReadEvents(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected fail fast during the probe, got %v", err)
+	}
+
+	close(releaseProbe)
+	if err := <-probeDone; err != nil {
+		t.Errorf("expected probe to succeed, got %v", err)
+	}
+
+	if state := breaker.BreakerStatus().State; state != models.BreakerClosed {
+		t.Errorf("expected breaker to close after the probe, got %s", state)
+	}
+}
+
+func TestCircuitBreaker_IgnoresCancelledRequests(t *testing.T) {
+	breaker, _, _, connErr := testBreaker(1, 30*time.Second)
+	*connErr = context.Canceled
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	breaker.ReadEvents(ctx)
+
+	if state := breaker.BreakerStatus().State; state != models.BreakerClosed {
+		t.Errorf("expected cancelled requests not to open the breaker, got %s", state)
+	}
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"math"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/stats"
+)
+
+const (
+	// SignificanceTest is the test comparing the averages of two windows
+	SignificanceTest = "welch_t"
+
+	// SignificanceLevel is the p-value below which two windows are considered different
+	SignificanceLevel = 0.05
+)
+
+// NewWindowSummary summarizes the analysis of the posts between from and to
+func NewWindowSummary(from, to time.Time, result *models.AnalysisResult) models.WindowSummary {
+	return models.WindowSummary{
+		From:       from.UTC(),
+		To:         to.UTC(),
+		TotalPosts: result.TotalPosts,
+		Average:    result.Mean,
+		Samples:    result.Samples,
+		Variance:   result.Variance,
+		StdDev:     math.Sqrt(result.Variance),
+		Warnings:   result.Warnings,
+	}
+}
+
+// RecordWindowSummary summarizes an analysis of the history.
+// Records saved before the variance was tracked only have the rounded average.
+func RecordWindowSummary(record models.AnalysisRecord) models.WindowSummary {
+	average := record.Mean
+	if record.Samples == 0 {
+		average = float64(record.Average)
+	}
+
+	return models.WindowSummary{
+		From:       record.StartedAt,
+		To:         record.CompletedAt,
+		RecordID:   record.ID,
+		TotalPosts: record.TotalPosts,
+		Average:    average,
+		Samples:    record.Samples,
+		Variance:   record.Variance,
+		StdDev:     math.Sqrt(record.Variance),
+		Warnings:   record.Warnings,
+	}
+}
+
+// CompareWindows computes the change of each metric from the baseline window to the current window,
+// and tests whether their averages differ significantly
+func CompareWindows(dimension string, baseline, current models.WindowSummary) models.Comparison {
+	comparison := models.Comparison{
+		Dimension: dimension,
+		Baseline:  baseline,
+		Current:   current,
+		Deltas: map[string]models.MetricDelta{
+			"total_posts":                          newMetricDelta(float64(baseline.TotalPosts), float64(current.TotalPosts)),
+			"posts_per_second":                     newMetricDelta(postsPerSecond(baseline), postsPerSecond(current)),
+			models.MetricAveragePrefix + dimension: newMetricDelta(baseline.Average, current.Average),
+		},
+	}
+
+	test, err := stats.WelchTTest(
+		stats.Summary{N: baseline.Samples, Mean: baseline.Average, Variance: baseline.Variance},
+		stats.Summary{N: current.Samples, Mean: current.Average, Variance: current.Variance},
+	)
+	if err != nil {
+		comparison.Warnings = append(comparison.Warnings, "significance not tested: "+err.Error())
+		return comparison
+	}
+
+	comparison.Significance = &models.Significance{
+		Test:             SignificanceTest,
+		T:                test.T,
+		DegreesOfFreedom: test.DegreesOfFreedom,
+		PValue:           test.PValue,
+		Alpha:            SignificanceLevel,
+		Significant:      test.PValue < SignificanceLevel,
+	}
+
+	return comparison
+}
+
+// newMetricDelta computes the change of a metric, the relative change is omitted when the baseline is 0
+func newMetricDelta(baseline, current float64) models.MetricDelta {
+	delta := models.MetricDelta{
+		Baseline: baseline,
+		Current:  current,
+		Absolute: current - baseline,
+	}
+
+	if baseline != 0 {
+		relative := delta.Absolute / math.Abs(baseline) * 100
+		delta.Relative = &relative
+	}
+
+	return delta
+}
+
+// postsPerSecond normalizes the number of posts of a window, so that windows of different lengths can be compared
+func postsPerSecond(window models.WindowSummary) float64 {
+	seconds := window.To.Sub(window.From).Seconds()
+	if seconds <= 0 {
+		return 0
+	}
+	return float64(window.TotalPosts) / seconds
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+func TestCompareWindows(t *testing.T) {
+	start := time.Unix(1700000000, 0).UTC()
+	baseline := models.WindowSummary{From: start, To: start.Add(10 * time.Second), TotalPosts: 20, Average: 20, Samples: 10, Variance: 4}
+	current := models.WindowSummary{From: start.Add(10 * time.Second), To: start.Add(20 * time.Second), TotalPosts: 30, Average: 22, Samples: 10, Variance: 4}
+
+	comparison := CompareWindows("likes", baseline, current)
+
+	tests := []struct {
+		metric           string
+		expectedAbsolute float64
+		expectedRelative float64
+	}{
+		{"total_posts", 10, 50},
+		{"posts_per_second", 1, 50},
+		{"avg_likes", 2, 10},
+	}
+
+	for _, tt := range tests {
+		delta, ok := comparison.Deltas[tt.metric]
+		if !ok {
+			t.Errorf("missing %s delta", tt.metric)
+			continue
+		}
+		if math.Abs(delta.Absolute-tt.expectedAbsolute) > 1e-9 || delta.Relative == nil || math.Abs(*delta.Relative-tt.expectedRelative) > 1e-9 {
+			t.Errorf("unexpected %s delta: %+v", tt.metric, delta)
+		}
+	}
+
+	significance := comparison.Significance
+	if significance == nil {
+		t.Fatal("expected a significance test")
+	}
+	if significance.Test != SignificanceTest || !significance.Significant || significance.PValue > SignificanceLevel {
+		t.Errorf("expected a significant difference, got %+v", significance)
+	}
+}
+
+func TestCompareWindows_NotSignificant(t *testing.T) {
+	baseline := models.WindowSummary{Average: 100, Samples: 50, Variance: 400}
+	current := models.WindowSummary{Average: 101, Samples: 50, Variance: 400}
+
+	comparison := CompareWindows("likes", baseline, current)
+	if comparison.Significance == nil || comparison.Significance.Significant {
+		t.Errorf("expected no significant difference, got %+v", comparison.Significance)
+	}
+}
+
+func TestCompareWindows_InsufficientData(t *testing.T) {
+	baseline := models.WindowSummary{TotalPosts: 0}
+	current := models.WindowSummary{TotalPosts: 5, Average: 10, Samples: 5, Variance: 1}
+
+	comparison := CompareWindows("likes", baseline, current)
+	if comparison.Significance != nil || len(comparison.Warnings) != 1 {
+		t.Errorf("expected a warning instead of a significance test, got %+v", comparison)
+	}
+
+	// No relative change from a baseline of 0
+	if delta := comparison.Deltas["total_posts"]; delta.Relative != nil || delta.Absolute != 5 {
+		t.Errorf("unexpected total_posts delta: %+v", delta)
+	}
+}
+
+func TestRecordWindowSummary(t *testing.T) {
+	// Records saved before the variance was tracked fall back to the rounded average
+	summary := RecordWindowSummary(models.AnalysisRecord{ID: "abc", TotalPosts: 3, Average: 42})
+	if summary.RecordID != "abc" || summary.Average != 42 || summary.Samples != 0 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	summary = RecordWindowSummary(models.AnalysisRecord{ID: "def", Average: 42, Mean: 41.6, Samples: 5, Variance: 9})
+	if summary.Average != 41.6 || summary.StdDev != 3 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// followStream calls read until the context is cancelled, for the background components consuming the stream continuously.
+// read handles a single stream connection and returns the number of posts it consumed and the error that ended it.
+// The stream is reconnected with an exponential backoff bounded by maxDelay whenever it fails.
+func followStream(ctx context.Context, logger *slog.Logger, name string, maxDelay time.Duration, read func(ctx context.Context) (int, error)) {
+	retryDelay := defaultReconnectDelay
+
+	for {
+		consumed, err := read(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Back off only when the stream keeps failing without delivering posts
+		if consumed > 0 {
+			retryDelay = defaultReconnectDelay
+		}
+
+		delay := retryDelay
+		var openErr *CircuitOpenError
+		if errors.As(err, &openErr) {
+			delay = max(openErr.RetryAfter, defaultReconnectDelay)
+		}
+
+		logger.Warn("Stream interrupted, retrying", "component", name, "err", err, "retry_in", delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		retryDelay = min(retryDelay*2, maxDelay)
+	}
+}
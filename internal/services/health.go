@@ -0,0 +1,163 @@
+package services
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/metrics"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// HealthReporter is implemented by stream services that track the health of their upstream connections
+type HealthReporter interface {
+	StreamHealth() models.StreamHealth
+}
+
+// healthRateWindow is the sliding window over which the event throughput is computed
+const healthRateWindow = 10 * time.Second
+
+// healthTracker records the activity of a stream client across all its connections.
+// It is safe for concurrent use.
+type healthTracker struct {
+	activeConnections atomic.Int64
+	lastEvent         atomic.Int64 // Unix nanoseconds, 0 if no event yet
+	stalls            atomic.Int64
+	reconnects        atomic.Int64
+	parseErrors       atomic.Int64
+	rate              *rateCounter
+
+	// channelDepth is the number of results waiting in the channel of the consumer after the last event, channelHighWater the highest seen
+	channelDepth     atomic.Int64
+	channelHighWater atomic.Int64
+}
+
+// newHealthTracker creates a new health tracker
+func newHealthTracker() *healthTracker {
+	return &healthTracker{
+		rate: newRateCounter(healthRateWindow),
+	}
+}
+
+// connected records a newly opened connection and returns the function recording its closing
+func (h *healthTracker) connected() func() {
+	h.activeConnections.Add(1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { h.activeConnections.Add(-1) })
+	}
+}
+
+// event records a received event
+func (h *healthTracker) event(now time.Time) {
+	h.lastEvent.Store(now.UnixNano())
+	h.rate.add(now)
+}
+
+// queued records the number of results waiting in the channel of the consumer after an event was sent
+func (h *healthTracker) queued(depth int) {
+	h.channelDepth.Store(int64(depth))
+	for {
+		highWater := h.channelHighWater.Load()
+		if int64(depth) <= highWater || h.channelHighWater.CompareAndSwap(highWater, int64(depth)) {
+			return
+		}
+	}
+}
+
+// snapshot returns the current health of the stream
+func (h *healthTracker) snapshot(now time.Time) models.StreamHealth {
+	health := models.StreamHealth{
+		ActiveConnections: h.activeConnections.Load(),
+		LastEventAge:      -1,
+		EventsPerSecond:   h.rate.perSecond(now),
+		Stalls:            h.stalls.Load(),
+		Reconnects:        h.reconnects.Load(),
+		ParseErrors:       h.parseErrors.Load(),
+		ChannelDepth:      h.channelDepth.Load(),
+		ChannelHighWater:  h.channelHighWater.Load(),
+	}
+
+	health.Connected = health.ActiveConnections > 0
+
+	if last := h.lastEvent.Load(); last != 0 {
+		lastEvent := time.Unix(0, last)
+		health.LastEventAt = lastEvent.Unix()
+		health.LastEventAge = now.Sub(lastEvent).Seconds()
+	}
+
+	return health
+}
+
+// healthFamilies returns the metrics of the health of a stream client
+func healthFamilies(health models.StreamHealth) []metrics.Family {
+	gauge := func(name, help string, value float64) metrics.Family {
+		return metrics.Family{Name: name, Help: help, Type: metrics.TypeGauge, Samples: []metrics.Sample{{Value: value}}}
+	}
+	counter := func(name, help string, value int64) metrics.Family {
+		return metrics.Family{Name: name, Help: help, Type: metrics.TypeCounter, Samples: []metrics.Sample{{Value: float64(value)}}}
+	}
+
+	return []metrics.Family{
+		gauge("stream_analyzer_upstream_connections", "Open connections to the upstream stream.", float64(health.ActiveConnections)),
+		gauge("stream_analyzer_upstream_events_per_second", "Events received per second over the last 10 seconds.", health.EventsPerSecond),
+		gauge("stream_analyzer_upstream_channel_depth", "Posts waiting to be consumed after the last event.", float64(health.ChannelDepth)),
+		gauge("stream_analyzer_upstream_channel_high_water", "Highest number of posts waiting to be consumed.", float64(health.ChannelHighWater)),
+		counter("stream_analyzer_upstream_parse_errors_total", "Events that could not be parsed into a post.", health.ParseErrors),
+		counter("stream_analyzer_upstream_reconnects_total", "Connections re-established after a stall or a disconnection.", health.Reconnects),
+		counter("stream_analyzer_upstream_stalls_total", "Connections detected as stalled.", health.Stalls),
+	}
+}
+
+// rateCounter counts events in one-second buckets over a sliding window
+type rateCounter struct {
+	mu      sync.Mutex
+	buckets []int64
+	seconds []int64 // Unix second each bucket belongs to
+}
+
+// newRateCounter creates a new rate counter for the given window (rounded to whole seconds)
+func newRateCounter(window time.Duration) *rateCounter {
+	size := max(int(window/time.Second), 1)
+
+	return &rateCounter{
+		buckets: make([]int64, size),
+		seconds: make([]int64, size),
+	}
+}
+
+// add records one event at the given time
+func (r *rateCounter) add(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sec := now.Unix()
+	i := int(sec % int64(len(r.buckets)))
+
+	// Recycle buckets belonging to a previous window
+	if r.seconds[i] != sec {
+		r.seconds[i] = sec
+		r.buckets[i] = 0
+	}
+
+	r.buckets[i]++
+}
+
+// perSecond returns the average number of events per second over the window
+func (r *rateCounter) perSecond(now time.Time) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sec := now.Unix()
+	size := int64(len(r.buckets))
+
+	var total int64
+	for i := range r.buckets {
+		if sec-r.seconds[i] < size {
+			total += r.buckets[i]
+		}
+	}
+
+	return float64(total) / float64(size)
+}
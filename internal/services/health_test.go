@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthTracker_Snapshot(t *testing.T) {
+	tracker := newHealthTracker()
+	now := time.Unix(1700000000, 0)
+
+	// No connection and no event yet
+	health := tracker.snapshot(now)
+	if health.Connected {
+		t.Error("expected not connected without connections")
+	}
+	if health.LastEventAge != -1 {
+		t.Errorf("expected last event age -1 without events, got %v", health.LastEventAge)
+	}
+
+	disconnected := tracker.connected()
+	for i := range 20 {
+		tracker.event(now.Add(time.Duration(i) * 100 * time.Millisecond))
+		tracker.queued(i % 7)
+	}
+
+	health = tracker.snapshot(now.Add(5 * time.Second))
+	if !health.Connected || health.ActiveConnections != 1 {
+		t.Errorf("expected 1 active connection, got %+v", health)
+	}
+	if health.LastEventAt != now.Add(1900*time.Millisecond).Unix() {
+		t.Errorf("expected last event at %d, got %d", now.Add(1900*time.Millisecond).Unix(), health.LastEventAt)
+	}
+	if health.EventsPerSecond != 2 {
+		t.Errorf("expected 2 events per second over a 10s window, got %v", health.EventsPerSecond)
+	}
+	if health.ChannelDepth != 5 || health.ChannelHighWater != 6 {
+		t.Errorf("expected a channel depth of 5 and a high-water mark of 6, got %d and %d", health.ChannelDepth, health.ChannelHighWater)
+	}
+
+	// Closing twice must only be counted once
+	disconnected()
+	disconnected()
+
+	health = tracker.snapshot(now.Add(30 * time.Second))
+	if health.Connected || health.ActiveConnections != 0 {
+		t.Errorf("expected no active connection, got %+v", health)
+	}
+	if health.EventsPerSecond != 0 {
+		t.Errorf("expected events outside the window to be ignored, got %v", health.EventsPerSecond)
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/metrics"
+)
+
+// hubBufferSize is the number of results a reader may fall behind the stream before the hub drops it
+const hubBufferSize = 1000
+
+// ErrReaderTooSlow is sent to a reader dropped by the hub because it fell behind the stream
+var ErrReaderTooSlow = errors.New("reader fell behind the stream")
+
+// StreamHub shares a single upstream stream connection between all its readers.
+// The upstream connection is opened by the first reader and closed when the last one leaves.
+// Every reader receives every post read while it is subscribed, in its own buffer: a reader falling behind by more than
+// the buffer is dropped with an ErrReaderTooSlow error, so that it never slows down the others.
+type StreamHub struct {
+	upstream StreamService
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	session *hubSession
+}
+
+// hubSession is a single upstream connection and the readers subscribed to it
+type hubSession struct {
+	cancel      context.CancelFunc
+	subscribers map[*hubSubscriber]struct{}
+
+	// connected is closed once the connection attempt ends, connectErr is its error
+	connected  chan struct{}
+	connectErr error
+}
+
+// hubSubscriber is a reader of the hub
+type hubSubscriber struct {
+	ctx context.Context
+	ch  chan StreamResult
+
+	// mu serializes the sends with the closing of the channel
+	mu     sync.Mutex
+	closed bool
+}
+
+// send delivers a result without blocking, returns false when the buffer of the reader is full
+func (s *hubSubscriber) send(result StreamResult) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return true
+	}
+
+	select {
+	case s.ch <- result:
+		return true
+	default:
+		return false
+	}
+}
+
+// close closes the channel of the reader, after sending the error if any.
+// The error replaces the most recent result when the buffer is full, the reader is told why it stops either way.
+func (s *hubSubscriber) close(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+
+	if err != nil {
+		select {
+		case s.ch <- StreamResult{Err: err}:
+		default:
+			// The hub is the only sender, receiving one result leaves room for the error
+			select {
+			case <-s.ch:
+			default:
+			}
+			s.ch <- StreamResult{Err: err}
+		}
+	}
+
+	close(s.ch)
+}
+
+// Check interface implementation at compile-time
+var (
+	_ StreamService     = &StreamHub{}
+	_ metrics.Collector = &StreamHub{}
+)
+
+// NewStreamHub creates a new stream hub on top of an upstream stream service
+func NewStreamHub(upstream StreamService, logger *slog.Logger) *StreamHub {
+	return &StreamHub{
+		upstream: upstream,
+		logger:   logger,
+	}
+}
+
+// ReadEvents subscribes to the shared stream until the context is done.
+// Connects to the upstream stream if no connection is open, and returns its connection error if any.
+// The wait for the connection is bounded by the context, the connection is abandoned once every waiting reader is gone.
+// An upstream stream error is sent to every subscriber before their channels are closed.
+func (h *StreamHub) ReadEvents(ctx context.Context) (<-chan StreamResult, error) {
+	sub := &hubSubscriber{
+		ctx: ctx,
+		ch:  make(chan StreamResult, hubBufferSize),
+	}
+
+	h.mu.Lock()
+	session := h.session
+	if session == nil {
+		// The upstream connection outlives the reader opening it, it is closed with the last subscriber.
+		// It serves every reader, so its logs carry no request or job: each reader logs its own subscription.
+		sessionCtx, cancel := context.WithCancel(context.Background())
+
+		session = &hubSession{
+			cancel:      cancel,
+			subscribers: make(map[*hubSubscriber]struct{}),
+			connected:   make(chan struct{}),
+		}
+		h.session = session
+
+		// Connect without holding the lock, so that the other readers and the metrics are not blocked by a silent upstream
+		go h.connect(sessionCtx, session)
+	}
+	session.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+
+	select {
+	case <-session.connected:
+		if session.connectErr != nil {
+			return nil, session.connectErr
+		}
+	case <-ctx.Done():
+		h.unsubscribe(session, sub, nil)
+		return nil, fmt.Errorf("failed to connect to stream: %w", context.Cause(ctx))
+	}
+
+	h.logger.DebugContext(ctx, "Subscribed to the shared stream")
+
+	// Unsubscribe as soon as the reader is done, even if the stream is silent
+	go func() {
+		<-ctx.Done()
+		h.unsubscribe(session, sub, nil)
+	}()
+
+	return sub.ch, nil
+}
+
+// Subscribers returns the number of readers of the current upstream connection, those waiting for it included
+func (h *StreamHub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.session == nil {
+		return 0
+	}
+	return len(h.session.subscribers)
+}
+
+// Collect returns the number of readers of the shared connection
+func (h *StreamHub) Collect() []metrics.Family {
+	return []metrics.Family{{
+		Name:    "stream_analyzer_upstream_subscribers",
+		Help:    "Readers of the shared upstream connection: analyses, archiver, jobs, alerts and anomaly detection.",
+		Type:    metrics.TypeGauge,
+		Samples: []metrics.Sample{{Value: float64(h.Subscribers())}},
+	}}
+}
+
+// connect opens the upstream connection of the session, then broadcasts its results until it ends.
+// On failure, the readers waiting for the connection return the error.
+func (h *StreamHub) connect(ctx context.Context, session *hubSession) {
+	upstreamCh, err := h.upstream.ReadEvents(ctx)
+
+	h.mu.Lock()
+	session.connectErr = err
+	close(session.connected)
+
+	if err != nil {
+		for sub := range session.subscribers {
+			delete(session.subscribers, sub)
+			sub.close(nil)
+		}
+		h.endSessionLocked(session)
+		h.mu.Unlock()
+		return
+	}
+	h.mu.Unlock()
+
+	h.logger.DebugContext(ctx, "Shared stream connection opened")
+	h.broadcast(session, upstreamCh)
+}
+
+// unsubscribe closes the channel of a subscriber, after sending the error if any, and the upstream connection if it was the last one
+func (h *StreamHub) unsubscribe(session *hubSession, sub *hubSubscriber, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := session.subscribers[sub]; !ok {
+		// Already closed by the end of the upstream stream
+		return
+	}
+
+	delete(session.subscribers, sub)
+	sub.close(err)
+	h.logger.DebugContext(sub.ctx, "Unsubscribed from the shared stream")
+
+	if len(session.subscribers) == 0 {
+		h.endSessionLocked(session)
+		h.logger.Debug("Shared stream connection closed, no subscribers left")
+	}
+}
+
+// endSessionLocked closes the upstream connection of the session, the next reader opens a new one. h.mu must be held.
+func (h *StreamHub) endSessionLocked(session *hubSession) {
+	session.cancel()
+	if h.session == session {
+		h.session = nil
+	}
+}
+
+// broadcast forwards the upstream results to every subscriber of the session until the upstream stream ends.
+// The lock is only held to list the subscribers, the results are sent without blocking.
+func (h *StreamHub) broadcast(session *hubSession, upstreamCh <-chan StreamResult) {
+	var streamErr error
+	var subscribers []*hubSubscriber
+
+	for result := range upstreamCh {
+		// The upstream stream closes its channel right after an error, which is sent along with the closing of the subscribers
+		if result.Err != nil {
+			streamErr = result.Err
+			break
+		}
+
+		h.mu.Lock()
+		subscribers = subscribers[:0]
+		for sub := range session.subscribers {
+			subscribers = append(subscribers, sub)
+		}
+		h.mu.Unlock()
+
+		for _, sub := range subscribers {
+			if !sub.send(result) {
+				h.logger.WarnContext(sub.ctx, "Stream reader fell behind, dropping it", "buffer", hubBufferSize)
+				h.unsubscribe(session, sub, ErrReaderTooSlow)
+			}
+		}
+	}
+
+	// The upstream stream ended: close the remaining subscribers, the next reader opens a new connection
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range session.subscribers {
+		delete(session.subscribers, sub)
+		sub.close(streamErr)
+	}
+	h.endSessionLocked(session)
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/logging"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// testUpstream is a controllable upstream stream for the hub tests
+type testUpstream struct {
+	mu          sync.Mutex
+	connections int
+	ch          chan StreamResult
+	ctx         context.Context
+	connectErr  error
+
+	// silent makes the connections hang until their context is done, like an upstream never answering
+	silent bool
+}
+
+func (u *testUpstream) ReadEvents(ctx context.Context) (<-chan StreamResult, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.silent {
+		u.ctx = ctx
+		u.mu.Unlock()
+		<-ctx.Done()
+		u.mu.Lock()
+		return nil, ctx.Err()
+	}
+
+	if u.connectErr != nil {
+		return nil, u.connectErr
+	}
+
+	u.connections++
+	u.ch = make(chan StreamResult)
+	u.ctx = ctx
+	return u.ch, nil
+}
+
+// send delivers a result to the current connection
+func (u *testUpstream) send(t *testing.T, result StreamResult) {
+	t.Helper()
+
+	u.mu.Lock()
+	ch := u.ch
+	u.mu.Unlock()
+
+	select {
+	case ch <- result:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout sending to the hub")
+	}
+}
+
+// receive reads a result from a subscriber channel
+func receive(t *testing.T, ch <-chan StreamResult) (StreamResult, bool) {
+	t.Helper()
+
+	select {
+	case result, ok := <-ch:
+		return result, ok
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout reading from the hub")
+		return StreamResult{}, false
+	}
+}
+
+func TestStreamHub_SharesConnection(t *testing.T) {
+	upstream := &testUpstream{}
+	hub := NewStreamHub(upstream, testLogger())
+
+	ctx1, cancel1 := context.WithCancel(logging.WithRequestID(context.Background(), "req-1"))
+	defer cancel1()
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+
+	ch1, err := hub.ReadEvents(ctx1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	ch2, err := hub.ReadEvents(ctx2)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if upstream.connections != 1 {
+		t.Errorf("expected a single upstream connection, got %d", upstream.connections)
+	}
+	if hub.Subscribers() != 2 {
+		t.Errorf("expected 2 subscribers, got %d", hub.Subscribers())
+	}
+
+	// The connection serves both readers, its logs carry none of their request ids
+	if id := logging.RequestID(upstream.ctx); id != "" {
+		t.Errorf("expected the upstream connection to carry no request id, got %q", id)
+	}
+
+	// Every subscriber receives every post
+	post := &models.PostPayload{Type: "tweet", Data: models.Post{Timestamp: 1}}
+	upstream.send(t, StreamResult{Post: post})
+
+	for _, ch := range []<-chan StreamResult{ch1, ch2} {
+		result, ok := receive(t, ch)
+		if !ok || result.Post != post {
+			t.Errorf("expected the post to be broadcast, got %+v (open: %v)", result, ok)
+		}
+	}
+
+	// A subscriber leaving gets its channel closed, the connection stays open for the other one
+	cancel1()
+	if _, ok := receive(t, ch1); ok {
+		t.Error("expected the channel of the cancelled subscriber to be closed")
+	}
+	if upstream.ctx.Err() != nil {
+		t.Error("expected the upstream connection to stay open")
+	}
+
+	// The last subscriber leaving closes the upstream connection
+	cancel2()
+	receive(t, ch2)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for upstream.ctx.Err() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if upstream.ctx.Err() == nil {
+		t.Error("expected the upstream connection to be closed")
+	}
+	if hub.Subscribers() != 0 {
+		t.Errorf("expected no subscribers, got %d", hub.Subscribers())
+	}
+}
+
+func TestStreamHub_UpstreamError(t *testing.T) {
+	upstream := &testUpstream{}
+	hub := NewStreamHub(upstream, testLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch1, _ := hub.ReadEvents(ctx)
+	ch2, _ := hub.ReadEvents(ctx)
+
+	// The upstream error is sent to every subscriber before their channels are closed
+	streamErr := errors.New("stream interrupted")
+	upstream.send(t, StreamResult{Err: streamErr})
+
+	for _, ch := range []<-chan StreamResult{ch1, ch2} {
+		result, ok := receive(t, ch)
+		if !ok || !errors.Is(result.Err, streamErr) {
+			t.Errorf("expected the stream error, got %+v (open: %v)", result, ok)
+		}
+		if _, ok := receive(t, ch); ok {
+			t.Error("expected the channel to be closed after the error")
+		}
+	}
+
+	// The next reader opens a new connection
+	if _, err := hub.ReadEvents(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if upstream.connections != 2 {
+		t.Errorf("expected a new upstream connection, got %d connections", upstream.connections)
+	}
+}
+
+func TestStreamHub_ConnectionError(t *testing.T) {
+	connectErr := &CircuitOpenError{RetryAfter: time.Second}
+	upstream := &testUpstream{connectErr: connectErr}
+	hub := NewStreamHub(upstream, testLogger())
+
+	// The connection error is returned as is, so that callers can inspect it
+	_, err := hub.ReadEvents(context.Background())
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected the connection error, got %v", err)
+	}
+	if hub.Subscribers() != 0 {
+		t.Errorf("expected no subscribers, got %d", hub.Subscribers())
+	}
+}
+
+func TestStreamHub_ConnectBoundedByReader(t *testing.T) {
+	upstream := &testUpstream{silent: true}
+	hub := NewStreamHub(upstream, testLogger())
+
+	ctx1, cancel1 := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel1()
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+
+	errCh := make(chan error, 2)
+	go func() {
+		_, err := hub.ReadEvents(ctx1)
+		errCh <- err
+	}()
+	go func() {
+		_, err := hub.ReadEvents(ctx2)
+		errCh <- err
+	}()
+
+	// The readers waiting for the connection do not hold the hub
+	deadline := time.Now().Add(5 * time.Second)
+	for hub.Subscribers() != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if hub.Subscribers() != 2 {
+		t.Fatalf("expected 2 readers waiting for the connection, got %d", hub.Subscribers())
+	}
+
+	// Each reader gives up with its own context, the connection is abandoned with the last one
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the deadline of the reader, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the reader to give up at its deadline")
+	}
+
+	cancel2()
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the cancellation of the reader, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the reader to give up once cancelled")
+	}
+
+	upstream.mu.Lock()
+	connCtx := upstream.ctx
+	upstream.mu.Unlock()
+	if connCtx.Err() == nil {
+		t.Error("expected the connection attempt to be cancelled")
+	}
+	if hub.Subscribers() != 0 {
+		t.Errorf("expected no subscribers, got %d", hub.Subscribers())
+	}
+}
+
+func TestStreamHub_DropsSlowReader(t *testing.T) {
+	upstream := &testUpstream{}
+	hub := NewStreamHub(upstream, testLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	slow, _ := hub.ReadEvents(ctx)
+	fast, _ := hub.ReadEvents(ctx)
+
+	// The fast reader keeps up while the slow one never reads
+	post := &models.PostPayload{Type: "tweet", Data: models.Post{Timestamp: 1}}
+	for range hubBufferSize + 1 {
+		upstream.send(t, StreamResult{Post: post})
+		if result, ok := receive(t, fast); !ok || result.Post != post {
+			t.Fatalf("expected the post to reach the fast reader, got %+v (open: %v)", result, ok)
+		}
+	}
+
+	// The slow reader is told it fell behind, after the posts it buffered
+	var last StreamResult
+	count := 0
+	for result := range slow {
+		last = result
+		count++
+	}
+	if !errors.Is(last.Err, ErrReaderTooSlow) || count != hubBufferSize {
+		t.Errorf("expected %d results ending with ErrReaderTooSlow, got %d ending with %+v", hubBufferSize, count, last)
+	}
+	if hub.Subscribers() != 1 {
+		t.Errorf("expected the fast reader to stay subscribed, got %d subscribers", hub.Subscribers())
+	}
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/metrics"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// AnalysisDurationBuckets are the upper bounds of the histogram of the analysis durations, in seconds
+var AnalysisDurationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600}
+
+// endedByError labels the analyses that failed without result
+const endedByError = "error"
+
+// InstrumentedAnalyzer wraps an analyzer and measures the duration of every analysis, by dimension and ending condition
+type InstrumentedAnalyzer struct {
+	analyzer  AnalyzerService
+	durations *metrics.Histogram
+}
+
+// Check interface implementation at compile-time
+var _ AnalyzerService = &InstrumentedAnalyzer{}
+
+// NewAnalysisDurations creates the histogram of the analysis durations measured by the instrumented analyzers
+func NewAnalysisDurations() *metrics.Histogram {
+	return metrics.NewHistogram("stream_analyzer_analysis_duration_seconds", "Duration of the live analyses, by dimension and ending condition.", AnalysisDurationBuckets, "dimension", "ended_by")
+}
+
+// NewInstrumentedAnalyzer creates a new analyzer recording the analysis durations in the histogram.
+// The histogram outlives the analyzer, so that the measures survive the reloads of the configuration.
+func NewInstrumentedAnalyzer(analyzer AnalyzerService, durations *metrics.Histogram) *InstrumentedAnalyzer {
+	return &InstrumentedAnalyzer{
+		analyzer:  analyzer,
+		durations: durations,
+	}
+}
+
+// AnalyzePosts runs the analysis and records its duration
+func (a *InstrumentedAnalyzer) AnalyzePosts(ctx context.Context, limits models.AnalysisLimits, dimension string, grouping models.AnalysisGrouping) (*models.AnalysisResult, error) {
+	startedAt := time.Now()
+
+	result, err := a.analyzer.AnalyzePosts(ctx, limits, dimension, grouping)
+
+	endedBy := endedByError
+	if result != nil && result.EndedBy != "" {
+		endedBy = result.EndedBy
+	}
+	a.durations.Observe(time.Since(startedAt).Seconds(), dimension, endedBy)
+
+	return result, err
+}
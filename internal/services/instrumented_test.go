@@ -0,0 +1,31 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+func TestInstrumentedAnalyzer_AnalyzePosts(t *testing.T) {
+	durations := NewAnalysisDurations()
+
+	completed := NewInstrumentedAnalyzer(&mockAnalyzer{result: &models.AnalysisResult{TotalPosts: 3, EndedBy: models.EndedByMaxPosts}}, durations)
+	if _, err := completed.AnalyzePosts(context.Background(), models.AnalysisLimits{MaxPosts: 3}, "likes", models.AnalysisGrouping{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	failed := NewInstrumentedAnalyzer(&mockAnalyzer{err: errors.New("failed to connect to stream")}, durations)
+	if _, err := failed.AnalyzePosts(context.Background(), models.AnalysisLimits{MaxPosts: 3}, "likes", models.AnalysisGrouping{}); err == nil {
+		t.Fatal("expected the error of the analyzer")
+	}
+
+	// Every analysis is measured, the failures without result included
+	if count := durations.Count("likes", models.EndedByMaxPosts); count != 1 {
+		t.Errorf("expected 1 analysis ended by max_posts, got %d", count)
+	}
+	if count := durations.Count("likes", endedByError); count != 1 {
+		t.Errorf("expected 1 failed analysis, got %d", count)
+	}
+}
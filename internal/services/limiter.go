@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/metrics"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// limiterRetryAfter is the delay suggested to the clients whose analysis was rejected by the concurrency limits
+const limiterRetryAfter = 5 * time.Second
+
+// Reasons of the analyses rejected by the concurrency limits
+const (
+	RejectedClientLimit  = "client_limit"
+	RejectedQueueFull    = "queue_full"
+	RejectedQueueTimeout = "queue_timeout"
+)
+
+// ConcurrencyLimits bounds the analyses running at the same time, zero values are unlimited
+type ConcurrencyLimits struct {
+	// MaxConcurrent bounds the analyses running overall
+	MaxConcurrent int
+
+	// MaxConcurrentPerClient bounds the analyses running or queued per client
+	MaxConcurrentPerClient int
+
+	// QueueSize bounds the analyses waiting for a slot once MaxConcurrent is reached (rejected right away when zero)
+	QueueSize int
+
+	// QueueTimeout bounds the wait of a queued analysis
+	QueueTimeout time.Duration
+}
+
+// AnalysisLimiter admits the analyses within limits, see ConcurrencyLimiter
+type AnalysisLimiter interface {
+	Acquire(ctx context.Context, client string) (func(), error)
+}
+
+// ConcurrencyReporter is implemented by components exposing the utilization of the concurrency limits
+type ConcurrencyReporter interface {
+	ConcurrencyStatus() models.ConcurrencyStatus
+}
+
+// ConcurrencyLimiter admits the analyses within the concurrency limits, queuing those over the overall limit in arrival order.
+// It outlives the reloads of the configuration, so that the analyses in progress keep counting against the new limits.
+type ConcurrencyLimiter struct {
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	limits   ConcurrencyLimits
+	active   int
+	clients  map[string]int
+	waiters  []*limiterWaiter
+	rejected map[string]int
+}
+
+// limiterWaiter is an analysis queued for a slot, its channel is closed once the slot is granted
+type limiterWaiter struct {
+	granted chan struct{}
+}
+
+// Check interface implementation at compile-time
+var (
+	_ AnalysisLimiter     = &ConcurrencyLimiter{}
+	_ ConcurrencyReporter = &ConcurrencyLimiter{}
+	_ metrics.Collector   = &ConcurrencyLimiter{}
+)
+
+// NewConcurrencyLimiter creates a new concurrency limiter
+func NewConcurrencyLimiter(limits ConcurrencyLimits, logger *slog.Logger) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		logger:   logger,
+		limits:   limits,
+		clients:  make(map[string]int),
+		rejected: make(map[string]int),
+	}
+}
+
+// SetLimits replaces the limits, the analyses in progress are not interrupted and the queued ones are admitted if the new limits allow it
+func (l *ConcurrencyLimiter) SetLimits(limits ConcurrencyLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limits = limits
+	l.grantLocked()
+}
+
+// Acquire admits an analysis of the client, waiting in the queue when the overall limit is reached.
+// The returned function releases the slot, it must be called once the analysis ends.
+// Returns a TOO_MANY_REQUESTS error when the limits reject the analysis, or a SHUTTING_DOWN or CLIENT_CLOSED_REQUEST error when the context is done while queued.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, client string) (func(), error) {
+	l.mu.Lock()
+
+	limits := l.limits
+	if limits.MaxConcurrentPerClient > 0 && l.clients[client] >= limits.MaxConcurrentPerClient {
+		l.rejected[RejectedClientLimit]++
+		l.mu.Unlock()
+		return nil, l.rejectError(ctx, RejectedClientLimit, "too many concurrent analyses for this client (limit: %d)", limits.MaxConcurrentPerClient)
+	}
+
+	release := sync.OnceFunc(func() { l.release(client) })
+
+	// Take a free slot, unless analyses are already queued for it
+	if len(l.waiters) == 0 && (limits.MaxConcurrent == 0 || l.active < limits.MaxConcurrent) {
+		l.active++
+		l.clients[client]++
+		l.mu.Unlock()
+		return release, nil
+	}
+
+	if len(l.waiters) >= limits.QueueSize {
+		l.rejected[RejectedQueueFull]++
+		l.mu.Unlock()
+		return nil, l.rejectError(ctx, RejectedQueueFull, "too many concurrent analyses (limit: %d, queue: %d)", limits.MaxConcurrent, limits.QueueSize)
+	}
+
+	waiter := &limiterWaiter{granted: make(chan struct{})}
+	l.waiters = append(l.waiters, waiter)
+	l.clients[client]++
+	l.mu.Unlock()
+
+	timer := time.NewTimer(limits.QueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-waiter.granted:
+		return release, nil
+	case <-timer.C:
+		if l.dequeue(waiter, client, RejectedQueueTimeout) {
+			return release, nil
+		}
+		return nil, l.rejectError(ctx, RejectedQueueTimeout, "no analysis slot freed within %s", limits.QueueTimeout)
+	case <-ctx.Done():
+		// The slot may have been granted meanwhile, hand it over to the next analysis
+		if l.dequeue(waiter, client, "") {
+			release()
+		}
+		if cause := context.Cause(ctx); errors.Is(cause, ErrShuttingDown) {
+			return nil, models.WrapError(models.ErrorShuttingDown, cause, "analysis cancelled while queued")
+		}
+		return nil, models.WrapError(models.ErrorClientClosedRequest, ctx.Err(), "analysis cancelled while queued")
+	}
+}
+
+// dequeue removes a waiter that gave up, counting the rejection reason when not empty.
+// Returns true when the slot was granted meanwhile, the waiter then holds it.
+func (l *ConcurrencyLimiter) dequeue(waiter *limiterWaiter, client string, reason string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-waiter.granted:
+		return true
+	default:
+	}
+
+	l.waiters = slices.DeleteFunc(l.waiters, func(w *limiterWaiter) bool { return w == waiter })
+	l.decrementClientLocked(client)
+	if reason != "" {
+		l.rejected[reason]++
+	}
+	return false
+}
+
+// release frees the slot of an analysis of the client, and hands it to the first queued analysis
+func (l *ConcurrencyLimiter) release(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+	l.decrementClientLocked(client)
+	l.grantLocked()
+}
+
+// grantLocked admits the queued analyses in arrival order while slots are free, l.mu must be held
+func (l *ConcurrencyLimiter) grantLocked() {
+	for len(l.waiters) > 0 && (l.limits.MaxConcurrent == 0 || l.active < l.limits.MaxConcurrent) {
+		waiter := l.waiters[0]
+		l.waiters = l.waiters[1:]
+		l.active++
+		close(waiter.granted)
+	}
+}
+
+// decrementClientLocked forgets the clients without analysis, l.mu must be held
+func (l *ConcurrencyLimiter) decrementClientLocked(client string) {
+	l.clients[client]--
+	if l.clients[client] <= 0 {
+		delete(l.clients, client)
+	}
+}
+
+// rejectError creates the error of an analysis rejected by the limits, telling the client when to retry
+func (l *ConcurrencyLimiter) rejectError(ctx context.Context, reason string, format string, args ...any) error {
+	l.logger.WarnContext(ctx, "Analysis rejected by the concurrency limits", "reason", reason)
+
+	return models.Errorf(models.ErrorTooManyRequests, format, args...).
+		WithDetail("reason", reason).
+		WithDetail("retry_after_seconds", int(limiterRetryAfter.Seconds()))
+}
+
+// ConcurrencyStatus returns the current utilization of the limits
+func (l *ConcurrencyLimiter) ConcurrencyStatus() models.ConcurrencyStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return models.ConcurrencyStatus{
+		Active:                 l.active,
+		Queued:                 len(l.waiters),
+		MaxConcurrent:          l.limits.MaxConcurrent,
+		MaxConcurrentPerClient: l.limits.MaxConcurrentPerClient,
+		QueueSize:              l.limits.QueueSize,
+		QueueTimeout:           l.limits.QueueTimeout.String(),
+		Rejected:               maps.Clone(l.rejected),
+		Clients:                maps.Clone(l.clients),
+	}
+}
+
+// Collect returns the metrics of the analyses running, queued and rejected
+func (l *ConcurrencyLimiter) Collect() []metrics.Family {
+	status := l.ConcurrencyStatus()
+
+	gauge := func(name, help string, value float64) metrics.Family {
+		return metrics.Family{Name: name, Help: help, Type: metrics.TypeGauge, Samples: []metrics.Sample{{Value: value}}}
+	}
+	families := []metrics.Family{
+		gauge("stream_analyzer_analyses_active", "Analyses running.", float64(status.Active)),
+		gauge("stream_analyzer_analyses_queued", "Analyses waiting for a slot.", float64(status.Queued)),
+	}
+
+	// The utilization is only defined with an overall limit
+	if status.MaxConcurrent > 0 {
+		families = append(families,
+			gauge("stream_analyzer_analyses_max_concurrent", "Analyses allowed to run at the same time.", float64(status.MaxConcurrent)),
+			gauge("stream_analyzer_analyses_limiter_utilization", "Ratio of the analyses running to the analyses allowed to run.", float64(status.Active)/float64(status.MaxConcurrent)),
+		)
+	}
+
+	rejected := metrics.Family{Name: "stream_analyzer_analyses_rejected_total", Help: "Analyses rejected by the concurrency limits, by reason.", Type: metrics.TypeCounter}
+	for _, reason := range []string{RejectedClientLimit, RejectedQueueFull, RejectedQueueTimeout} {
+		rejected.Samples = append(rejected.Samples, metrics.Sample{Labels: [][2]string{{"reason", reason}}, Value: float64(status.Rejected[reason])})
+	}
+
+	return append(families, rejected)
+}
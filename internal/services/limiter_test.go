@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/metrics"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// waitForQueued waits until the number of analyses is queued in the limiter
+func waitForQueued(t *testing.T, limiter *ConcurrencyLimiter, queued int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for limiter.ConcurrencyStatus().Queued != queued {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %d queued analyses", queued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrencyLimiter_PerClientLimit(t *testing.T) {
+	limiter := NewConcurrencyLimiter(ConcurrencyLimits{MaxConcurrentPerClient: 1}, testLogger())
+
+	release, err := limiter.Acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatalf("expected the first analysis to be admitted, got %v", err)
+	}
+
+	// A second analysis of the same client is rejected, not another client's
+	if _, err := limiter.Acquire(context.Background(), "a"); models.ErrorCodeOf(err) != models.ErrorTooManyRequests {
+		t.Errorf("expected a TOO_MANY_REQUESTS error, got %v", err)
+	}
+	releaseB, err := limiter.Acquire(context.Background(), "b")
+	if err != nil {
+		t.Fatalf("expected another client to be admitted, got %v", err)
+	}
+	releaseB()
+
+	// Releasing twice frees a single slot
+	release()
+	release()
+	if status := limiter.ConcurrencyStatus(); status.Active != 0 || len(status.Clients) != 0 || status.Rejected[RejectedClientLimit] != 1 {
+		t.Errorf("expected no active analysis and one rejection, got %+v", status)
+	}
+
+	// The rejections are exposed for every reason, without utilization when the overall concurrency is unlimited
+	var buf bytes.Buffer
+	metrics.WriteText(&buf, limiter.Collect())
+	for _, expected := range []string{
+		"stream_analyzer_analyses_active 0\n",
+		`stream_analyzer_analyses_rejected_total{reason="client_limit"} 1`,
+		`stream_analyzer_analyses_rejected_total{reason="queue_full"} 0`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected the metrics to contain %q, got:\n%s", expected, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "utilization") {
+		t.Errorf("expected no utilization without overall limit, got:\n%s", buf.String())
+	}
+}
+
+func TestConcurrencyLimiter_Queue(t *testing.T) {
+	limiter := NewConcurrencyLimiter(ConcurrencyLimits{MaxConcurrent: 1, QueueSize: 1, QueueTimeout: time.Second}, testLogger())
+
+	release, err := limiter.Acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatalf("expected the first analysis to be admitted, got %v", err)
+	}
+
+	// The second analysis waits for the slot of the first one
+	admitted := make(chan error, 1)
+	go func() {
+		releaseQueued, err := limiter.Acquire(context.Background(), "b")
+		if err == nil {
+			defer releaseQueued()
+		}
+		admitted <- err
+	}()
+
+	waitForQueued(t, limiter, 1)
+
+	// The queue is full, the third analysis is rejected right away
+	if _, err := limiter.Acquire(context.Background(), "c"); models.ErrorCodeOf(err) != models.ErrorTooManyRequests {
+		t.Errorf("expected a TOO_MANY_REQUESTS error with a full queue, got %v", err)
+	}
+
+	release()
+	if err := <-admitted; err != nil {
+		t.Errorf("expected the queued analysis to be admitted, got %v", err)
+	}
+}
+
+func TestConcurrencyLimiter_QueueTimeout(t *testing.T) {
+	limiter := NewConcurrencyLimiter(ConcurrencyLimits{MaxConcurrent: 1, QueueSize: 1, QueueTimeout: 20 * time.Millisecond}, testLogger())
+
+	release, err := limiter.Acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatalf("expected the first analysis to be admitted, got %v", err)
+	}
+	defer release()
+
+	if _, err := limiter.Acquire(context.Background(), "b"); models.ErrorCodeOf(err) != models.ErrorTooManyRequests {
+		t.Errorf("expected a TOO_MANY_REQUESTS error after the queue timeout, got %v", err)
+	}
+
+	// A queued analysis abandoned by its client leaves the queue
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := limiter.Acquire(ctx, "c"); models.ErrorCodeOf(err) != models.ErrorClientClosedRequest {
+		t.Errorf("expected a CLIENT_CLOSED_REQUEST error, got %v", err)
+	}
+
+	status := limiter.ConcurrencyStatus()
+	if status.Queued != 0 || status.Active != 1 || status.Rejected[RejectedQueueTimeout] != 1 {
+		t.Errorf("expected an empty queue and one timeout, got %+v", status)
+	}
+}
+
+func TestConcurrencyLimiter_SetLimits(t *testing.T) {
+	limiter := NewConcurrencyLimiter(ConcurrencyLimits{MaxConcurrent: 1, QueueSize: 1, QueueTimeout: time.Second}, testLogger())
+
+	release, err := limiter.Acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatalf("expected the first analysis to be admitted, got %v", err)
+	}
+	defer release()
+
+	admitted := make(chan error, 1)
+	go func() {
+		releaseQueued, err := limiter.Acquire(context.Background(), "b")
+		if err == nil {
+			defer releaseQueued()
+		}
+		admitted <- err
+	}()
+
+	waitForQueued(t, limiter, 1)
+
+	// Raising the limit admits the queued analysis without waiting for a release
+	limiter.SetLimits(ConcurrencyLimits{MaxConcurrent: 2})
+	if err := <-admitted; err != nil {
+		t.Errorf("expected the queued analysis to be admitted, got %v", err)
+	}
+}
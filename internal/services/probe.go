@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/metrics"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// ProbeReporter is implemented by components checking the reachability of the upstream stream
+type ProbeReporter interface {
+	ProbeStatus() models.ProbeStatus
+}
+
+// UpstreamProbe checks periodically that the upstream stream accepts connections.
+// A probe subscribes to the stream and leaves right away: through the hub, it reuses the shared connection when one is open.
+// It outlives the reloads of the configuration, so that the last outcome is kept while the new stream is probed.
+type UpstreamProbe struct {
+	logger *slog.Logger
+	now    func() time.Time
+
+	// changed wakes up the probe loop when the stream or the settings are replaced
+	changed chan struct{}
+
+	mu            sync.Mutex
+	stream        StreamService
+	interval      time.Duration
+	timeout       time.Duration
+	probed        bool
+	reachable     bool
+	lastProbeAt   time.Time
+	lastSuccessAt time.Time
+	lastError     string
+	lastErrorAt   time.Time
+}
+
+// Check interface implementation at compile-time
+var (
+	_ ProbeReporter     = &UpstreamProbe{}
+	_ metrics.Collector = &UpstreamProbe{}
+)
+
+// NewUpstreamProbe creates a new upstream probe, idle until configured
+func NewUpstreamProbe(logger *slog.Logger) *UpstreamProbe {
+	return &UpstreamProbe{
+		logger:  logger,
+		now:     time.Now,
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// Configure replaces the probed stream and the probe settings, the new stream is probed right away.
+// A zero interval disables the probe.
+func (p *UpstreamProbe) Configure(stream StreamService, interval, timeout time.Duration) {
+	p.mu.Lock()
+	p.stream = stream
+	p.interval = interval
+	p.timeout = timeout
+	p.mu.Unlock()
+
+	select {
+	case p.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Run probes the stream at every interval until the context is done
+func (p *UpstreamProbe) Run(ctx context.Context) {
+	for {
+		p.mu.Lock()
+		stream, interval, timeout := p.stream, p.interval, p.timeout
+		p.mu.Unlock()
+
+		// Wait for the configuration while the probe is disabled
+		var timer *time.Timer
+		var tick <-chan time.Time
+		if stream != nil && interval > 0 {
+			p.probe(ctx, stream, timeout)
+			timer = time.NewTimer(interval)
+			tick = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-p.changed:
+		case <-tick:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// probe connects to the stream within the timeout and records the outcome.
+// The probes run one at a time: the hub gives up the connection at the deadline of the probe, and the subscription ends with it.
+func (p *UpstreamProbe) probe(ctx context.Context, stream StreamService, timeout time.Duration) {
+	probeCtx, cancel := context.WithTimeoutCause(ctx, timeout, fmt.Errorf("no connection within %s", timeout))
+	defer cancel()
+
+	_, err := stream.ReadEvents(probeCtx)
+
+	// A probe interrupted by the shutdown says nothing about the stream
+	if ctx.Err() != nil {
+		return
+	}
+
+	p.record(err)
+}
+
+// record updates the outcome of the probes, logging only the changes of reachability
+func (p *UpstreamProbe) record(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	wasProbed, wasReachable := p.probed, p.reachable
+
+	p.probed = true
+	p.lastProbeAt = now
+	p.reachable = err == nil
+
+	if err != nil {
+		p.lastError = err.Error()
+		p.lastErrorAt = now
+
+		if !wasProbed || wasReachable {
+			p.logger.Warn("Upstream stream unreachable", "err", err.Error())
+		}
+		return
+	}
+
+	p.lastSuccessAt = now
+	if !wasProbed || !wasReachable {
+		p.logger.Info("Upstream stream reachable")
+	}
+}
+
+// ProbeStatus returns the outcome of the probes
+func (p *UpstreamProbe) ProbeStatus() models.ProbeStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := models.ProbeStatus{
+		Enabled:   p.stream != nil && p.interval > 0,
+		Reachable: p.reachable,
+		LastError: p.lastError,
+	}
+
+	if status.Enabled {
+		status.Interval = p.interval.String()
+		status.Stale = p.probed && p.now().Sub(p.lastProbeAt) > 2*p.interval+p.timeout
+	}
+
+	timestamp := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+	status.LastProbeAt = timestamp(p.lastProbeAt)
+	status.LastSuccessAt = timestamp(p.lastSuccessAt)
+	status.LastErrorAt = timestamp(p.lastErrorAt)
+
+	return status
+}
+
+// Collect returns the reachability of the upstream stream, once probed
+func (p *UpstreamProbe) Collect() []metrics.Family {
+	status := p.ProbeStatus()
+	if !status.Enabled || status.LastProbeAt == nil {
+		return nil
+	}
+
+	reachable := 0.0
+	if status.Reachable {
+		reachable = 1
+	}
+
+	return []metrics.Family{{
+		Name:    "stream_analyzer_upstream_reachable",
+		Help:    "Whether the last probe of the upstream stream connected (1) or not (0).",
+		Type:    metrics.TypeGauge,
+		Samples: []metrics.Sample{{Value: reachable}},
+	}}
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUpstreamProbe_RecordsOutcome(t *testing.T) {
+	var mu sync.Mutex
+	var connErr error
+
+	stream := &mockStreamService{
+		readEventsFn: func(ctx context.Context) (<-chan StreamResult, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if connErr != nil {
+				return nil, connErr
+			}
+			return testStreamResultCh(nil, nil), nil
+		},
+	}
+
+	clock := &testClock{now: time.Unix(1700000000, 0)}
+	probe := NewUpstreamProbe(testLogger())
+	probe.now = clock.Now
+
+	if status := probe.ProbeStatus(); status.Enabled || status.LastProbeAt != nil {
+		t.Fatalf("expected an idle probe before configuration, got %+v", status)
+	}
+
+	probe.Configure(stream, time.Minute, time.Second)
+	ctx := context.Background()
+
+	probe.probe(ctx, stream, time.Second)
+	status := probe.ProbeStatus()
+	if !status.Enabled || !status.Reachable || status.LastSuccessAt == nil || status.LastError != "" {
+		t.Fatalf("expected a reachable upstream, got %+v", status)
+	}
+
+	// The last error is kept once the upstream recovers
+	clock.Advance(time.Minute)
+	mu.Lock()
+	connErr = errors.New("connection refused")
+	mu.Unlock()
+	probe.probe(ctx, stream, time.Second)
+	status = probe.ProbeStatus()
+	if status.Reachable || status.LastError != "connection refused" || !status.LastErrorAt.Equal(clock.now) {
+		t.Fatalf("expected an unreachable upstream, got %+v", status)
+	}
+
+	clock.Advance(time.Minute)
+	mu.Lock()
+	connErr = nil
+	mu.Unlock()
+	probe.probe(ctx, stream, time.Second)
+	status = probe.ProbeStatus()
+	if !status.Reachable || !status.LastSuccessAt.Equal(clock.now) || status.LastError != "connection refused" {
+		t.Fatalf("expected the upstream to recover with its last error, got %+v", status)
+	}
+}
+
+func TestUpstreamProbe_Timeout(t *testing.T) {
+	// A silent upstream, the hub gives up the connection at the deadline of the probe
+	upstream := &testUpstream{silent: true}
+	hub := NewStreamHub(upstream, testLogger())
+
+	probe := NewUpstreamProbe(testLogger())
+	probe.Configure(hub, time.Minute, 10*time.Millisecond)
+	probe.probe(context.Background(), hub, 10*time.Millisecond)
+
+	status := probe.ProbeStatus()
+	if status.Reachable || !strings.Contains(status.LastError, "no connection within 10ms") {
+		t.Errorf("expected the probe to time out, got %+v", status)
+	}
+
+	// Nothing is left behind by the probe
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		upstream.mu.Lock()
+		connCtx := upstream.ctx
+		upstream.mu.Unlock()
+		if connCtx != nil && connCtx.Err() != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if upstream.ctx == nil || upstream.ctx.Err() == nil || hub.Subscribers() != 0 {
+		t.Errorf("expected the connection attempt to be abandoned, got %d subscribers", hub.Subscribers())
+	}
+}
+
+func TestUpstreamProbe_Run(t *testing.T) {
+	probed := make(chan struct{}, 10)
+	stream := &mockStreamService{
+		readEventsFn: func(ctx context.Context) (<-chan StreamResult, error) {
+			probed <- struct{}{}
+			return testStreamResultCh(nil, nil), nil
+		},
+	}
+
+	probe := NewUpstreamProbe(testLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		probe.Run(ctx)
+		close(done)
+	}()
+
+	// The stream is probed as soon as it is configured, then at every interval
+	probe.Configure(stream, 20*time.Millisecond, time.Second)
+	for range 2 {
+		select {
+		case <-probed:
+		case <-time.After(time.Second):
+			t.Fatal("expected the stream to be probed")
+		}
+	}
+
+	// A zero interval disables the probe
+	probe.Configure(stream, 0, time.Second)
+	time.Sleep(10 * time.Millisecond)
+	for len(probed) > 0 {
+		<-probed
+	}
+	select {
+	case <-probed:
+		t.Fatal("expected no probe once disabled")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if probe.ProbeStatus().Enabled {
+		t.Error("expected the probe to be disabled")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the probe to stop with its context")
+	}
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/store"
+)
+
+// SourceAPI is the source of the analyses requested through the HTTP API
+const SourceAPI = "api"
+
+// RecordingAnalyzer wraps an analyzer and saves every completed analysis in the history store
+type RecordingAnalyzer struct {
+	analyzer AnalyzerService
+	history  store.HistoryStore
+	source   string
+	logger   *slog.Logger
+}
+
+// Check interface implementation at compile-time
+var _ AnalyzerService = &RecordingAnalyzer{}
+
+// NewRecordingAnalyzer creates a new analyzer recording the analyses of the given source
+func NewRecordingAnalyzer(analyzer AnalyzerService, history store.HistoryStore, source string, logger *slog.Logger) *RecordingAnalyzer {
+	return &RecordingAnalyzer{
+		analyzer: analyzer,
+		history:  history,
+		source:   source,
+		logger:   logger,
+	}
+}
+
+// AnalyzePosts runs the analysis and records it when it returns a result, partial results included.
+// Failing to record is logged but does not fail the analysis.
+func (a *RecordingAnalyzer) AnalyzePosts(ctx context.Context, limits models.AnalysisLimits, dimension string, grouping models.AnalysisGrouping) (*models.AnalysisResult, error) {
+	startedAt := time.Now()
+
+	result, err := a.analyzer.AnalyzePosts(ctx, limits, dimension, grouping)
+	if result == nil {
+		return result, err
+	}
+
+	record := NewAnalysisRecord(a.source, limits, dimension, startedAt, time.Now(), result)
+	if err := a.history.Append(record); err != nil {
+		a.logger.ErrorContext(ctx, "Failed to record analysis", "err", err, "dimension", dimension)
+	}
+
+	return result, err
+}
+
+// NewAnalysisRecord builds the history record of an analysis run with the given limits
+func NewAnalysisRecord(source string, limits models.AnalysisLimits, dimension string, startedAt, completedAt time.Time, result *models.AnalysisResult) models.AnalysisRecord {
+	record := models.AnalysisRecord{
+		ID:               newRecordID(),
+		Source:           source,
+		Dimension:        dimension,
+		MaxPosts:         limits.MaxPosts,
+		EndedBy:          result.EndedBy,
+		Partial:          result.Partial,
+		StartedAt:        startedAt.UTC(),
+		CompletedAt:      completedAt.UTC(),
+		Elapsed:          completedAt.Sub(startedAt).Seconds(),
+		TotalPosts:       result.TotalPosts,
+		MinimumTimestamp: result.MinimumTimestamp,
+		MaximumTimestamp: result.MaximumTimestamp,
+		Average:          result.Average,
+		Warnings:         result.Warnings,
+		Samples:          result.Samples,
+		Mean:             result.Mean,
+		Variance:         result.Variance,
+	}
+	if limits.Duration > 0 {
+		record.Duration = limits.Duration.String()
+	}
+	if !limits.Until.IsZero() {
+		until := limits.Until.UTC()
+		record.Until = &until
+	}
+
+	return record
+}
+
+// newRecordID returns a random identifier for a history record
+func newRecordID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
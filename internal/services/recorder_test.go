@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/store"
+)
+
+// mockHistoryStore is a mock implementation of the History Store for testing
+type mockHistoryStore struct {
+	records   []models.AnalysisRecord
+	appendErr error
+}
+
+// Check interface implementation at compile-time
+var _ store.HistoryStore = &mockHistoryStore{}
+
+func (m *mockHistoryStore) Append(record models.AnalysisRecord) error {
+	if m.appendErr != nil {
+		return m.appendErr
+	}
+	m.records = append(m.records, record)
+	return nil
+}
+
+func (m *mockHistoryStore) Query(query models.HistoryQuery) (*models.HistoryPage, error) {
+	return &models.HistoryPage{Records: m.records, Total: len(m.records)}, nil
+}
+
+func (m *mockHistoryStore) Get(id string) (models.AnalysisRecord, error) {
+	for _, record := range m.records {
+		if record.ID == id {
+			return record, nil
+		}
+	}
+	return models.AnalysisRecord{}, store.ErrRecordNotFound
+}
+
+// mockAnalyzer is a mock implementation of the Analyzer Service for testing
+type mockAnalyzer struct {
+	result *models.AnalysisResult
+	err    error
+}
+
+func (m *mockAnalyzer) AnalyzePosts(ctx context.Context, limits models.AnalysisLimits, dimension string, grouping models.AnalysisGrouping) (*models.AnalysisResult, error) {
+	return m.result, m.err
+}
+
+func TestRecordingAnalyzer_AnalyzePosts(t *testing.T) {
+	result := &models.AnalysisResult{
+		TotalPosts:       3,
+		MinimumTimestamp: 1554324856,
+		MaximumTimestamp: 1633974046,
+		Average:          120,
+		Warnings:         []string{"some warning"},
+	}
+
+	history := &mockHistoryStore{}
+	analyzer := NewRecordingAnalyzer(&mockAnalyzer{result: result}, history, SourceAPI, testLogger())
+
+	got, err := analyzer.AnalyzePosts(context.Background(), models.AnalysisLimits{Duration: 5 * time.Second}, "likes", models.AnalysisGrouping{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got != result {
+		t.Error("expected the result of the wrapped analyzer")
+	}
+
+	if len(history.records) != 1 {
+		t.Fatalf("expected 1 recorded analysis, got %d", len(history.records))
+	}
+
+	record := history.records[0]
+	if record.ID == "" {
+		t.Error("expected record ID to be set")
+	}
+	if record.Source != SourceAPI || record.Dimension != "likes" || record.Duration != "5s" {
+		t.Errorf("unexpected record parameters: %+v", record)
+	}
+	if record.TotalPosts != 3 || record.Average != 120 || len(record.Warnings) != 1 {
+		t.Errorf("unexpected record result: %+v", record)
+	}
+	if record.CompletedAt.Before(record.StartedAt) {
+		t.Errorf("expected completed_at after started_at, got %s and %s", record.CompletedAt, record.StartedAt)
+	}
+}
+
+func TestRecordingAnalyzer_AnalyzePosts_Partial(t *testing.T) {
+	result := &models.AnalysisResult{
+		TotalPosts: 2,
+		Partial:    true,
+		EndedBy:    models.EndedByStreamError,
+		Warnings:   []string{"STREAM_INTERRUPTED: stream interrupted", "analyzed for 1s of at most 1h0m0s"},
+	}
+	streamErr := models.WrapError(models.ErrorStreamInterrupted, errors.New("stream error"), "partial results (analyzed 2 posts)")
+
+	history := &mockHistoryStore{}
+	analyzer := NewRecordingAnalyzer(&mockAnalyzer{result: result, err: streamErr}, history, SourceAPI, testLogger())
+
+	until := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	limits := models.AnalysisLimits{MaxDuration: time.Hour, MaxPosts: 500, Until: until}
+	if _, err := analyzer.AnalyzePosts(context.Background(), limits, "likes", models.AnalysisGrouping{}); err != streamErr {
+		t.Fatalf("expected the error of the wrapped analyzer, got %v", err)
+	}
+
+	if len(history.records) != 1 {
+		t.Fatalf("expected 1 recorded analysis, got %d", len(history.records))
+	}
+
+	// The limits not requested are omitted, the implicit maximum duration is not a requested duration
+	record := history.records[0]
+	if record.Duration != "" || record.MaxPosts != 500 || record.Until == nil || !record.Until.Equal(until) {
+		t.Errorf("unexpected record limits: %+v", record)
+	}
+	if !record.Partial || record.EndedBy != models.EndedByStreamError || len(record.Warnings) != 2 {
+		t.Errorf("expected a partial record with its warnings, got %+v", record)
+	}
+}
+
+func TestRecordingAnalyzer_AnalyzePosts_NotRecorded(t *testing.T) {
+	tests := []struct {
+		name     string
+		analyzer *mockAnalyzer
+		history  *mockHistoryStore
+		isError  bool
+	}{
+		{
+			name:     "failed analysis without result is not recorded",
+			analyzer: &mockAnalyzer{err: errors.New("stream error")},
+			history:  &mockHistoryStore{},
+			isError:  true,
+		},
+		{
+			name:     "history failure does not fail the analysis",
+			analyzer: &mockAnalyzer{result: &models.AnalysisResult{TotalPosts: 1}},
+			history:  &mockHistoryStore{appendErr: errors.New("disk full")},
+			isError:  false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			analyzer := NewRecordingAnalyzer(tc.analyzer, tc.history, SourceAPI, testLogger())
+
+			_, err := analyzer.AnalyzePosts(context.Background(), models.AnalysisLimits{Duration: time.Second}, "likes", models.AnalysisGrouping{})
+			if tc.isError != (err != nil) {
+				t.Errorf("expected error: %v, got %v", tc.isError, err)
+			}
+
+			if len(tc.history.records) != 0 {
+				t.Errorf("expected no recorded analysis, got %d", len(tc.history.records))
+			}
+		})
+	}
+}
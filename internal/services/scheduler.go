@@ -0,0 +1,476 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/logging"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/store"
+)
+
+const (
+	// JobTriggerSchedule marks the runs started by the schedule of a job
+	JobTriggerSchedule = "schedule"
+
+	// JobTriggerManual marks the runs started through the admin endpoints
+	JobTriggerManual = "manual"
+
+	// jobSourcePrefix prefixes the job name in the source of the history records
+	jobSourcePrefix = "job:"
+)
+
+var (
+	// ErrJobNotFound is returned when no job has the requested name
+	ErrJobNotFound = errors.New("job not found")
+
+	// ErrJobRunning is returned when triggering a job that is already running
+	ErrJobRunning = errors.New("job is already running")
+)
+
+// JobSchedule computes the activations of a scheduled job
+type JobSchedule interface {
+	// Next returns the first activation after the given time, or the zero time if there is none
+	Next(after time.Time) time.Time
+	String() string
+}
+
+// IntervalSchedule activates a job at a fixed interval
+type IntervalSchedule time.Duration
+
+// Next returns the activation one interval after the given time
+func (s IntervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(s))
+}
+
+func (s IntervalSchedule) String() string {
+	return "every " + time.Duration(s).String()
+}
+
+// Job is the definition of a scheduled analysis
+type Job struct {
+	Name     string
+	Schedule JobSchedule
+
+	// Duration is how long the stream is analyzed at every run
+	Duration time.Duration
+
+	// Dimensions are analyzed together on the same posts
+	Dimensions []string
+
+	// PostTypes keeps only the posts of these types (all posts when empty)
+	PostTypes []string
+
+	// Sink receives the results of every completed run, on top of the history (none when nil)
+	Sink JobSink
+
+	// Paused jobs skip their scheduled runs but can still be triggered manually
+	Paused bool
+}
+
+// JobManager is implemented by components managing scheduled jobs
+type JobManager interface {
+	Jobs() []models.JobStatus
+	Job(name string) (models.JobStatus, error)
+	Pause(name string) error
+	Resume(name string) error
+	Trigger(name string) error
+}
+
+// scheduledJob is a job and its state
+type scheduledJob struct {
+	Job
+	trigger chan struct{}
+
+	// pausedByConfig is the paused state of the configuration, Paused the current one
+	pausedByConfig bool
+
+	mu       sync.Mutex
+	running  bool
+	nextRun  time.Time
+	runs     int
+	failures int
+	lastRun  *models.JobRun
+
+	// successor is the job replacing this one after a reload, the runs still in progress are counted there
+	successor *scheduledJob
+}
+
+// record counts a completed run in the state of the job, or in that of its successor
+func (j *scheduledJob) record(run *models.JobRun) {
+	j.mu.Lock()
+	successor := j.successor
+	if successor == nil {
+		j.runs++
+		if run.Error != "" {
+			j.failures++
+		}
+		j.lastRun = run
+	}
+	j.mu.Unlock()
+
+	if successor != nil {
+		successor.record(run)
+	}
+}
+
+// Scheduler runs analysis jobs in the background according to their schedule.
+// The results of every completed run are saved in the history store and sent to the job sink.
+type Scheduler struct {
+	stream  StreamService
+	history store.HistoryStore
+	logger  *slog.Logger
+	jobs    []*scheduledJob
+
+	// stopped is closed by Stop
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// Check interface implementation at compile-time
+var _ JobManager = &Scheduler{}
+
+// NewScheduler creates a new scheduler.
+// The history may be nil when the history store is disabled.
+func NewScheduler(stream StreamService, history store.HistoryStore, jobs []Job, logger *slog.Logger) *Scheduler {
+	s := &Scheduler{
+		stream:  stream,
+		history: history,
+		logger:  logger,
+		stopped: make(chan struct{}),
+	}
+
+	for _, job := range jobs {
+		s.jobs = append(s.jobs, &scheduledJob{
+			Job:            job,
+			trigger:        make(chan struct{}, 1),
+			pausedByConfig: job.Paused,
+		})
+	}
+
+	return s
+}
+
+// Inherit carries over the state of the jobs of the previous scheduler, identified by their name: their counters, their last run,
+// their next activation unless the configuration changed their schedule, and their paused state unless the configuration changed it,
+// so that a reload of the configuration neither resumes the paused jobs nor delays the next runs.
+// The runs of the previous scheduler still in progress are counted in this one once over.
+// It must be called before the scheduler runs.
+func (s *Scheduler) Inherit(previous *Scheduler) {
+	for _, job := range s.jobs {
+		prevJob, err := previous.find(job.Name)
+		if err != nil {
+			continue
+		}
+
+		prevJob.mu.Lock()
+		if job.pausedByConfig == prevJob.pausedByConfig {
+			job.Paused = prevJob.Paused
+		}
+		if job.Schedule.String() == prevJob.Schedule.String() {
+			job.nextRun = prevJob.nextRun
+		}
+		job.runs, job.failures, job.lastRun = prevJob.runs, prevJob.failures, prevJob.lastRun
+		prevJob.successor = job
+		prevJob.mu.Unlock()
+	}
+}
+
+// Stop stops scheduling the jobs, the runs in progress finish and are recorded
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopped)
+	})
+}
+
+// Run runs the jobs until the context is cancelled or the scheduler is stopped, and returns once the runs in progress are over.
+// A run in progress when the context is cancelled is abandoned and not recorded.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, job := range s.jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runJob(ctx, job)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// runJob waits for the activations and triggers of a job and runs it, one run at a time.
+// Activations missed while the job is running are skipped.
+func (s *Scheduler) runJob(ctx context.Context, job *scheduledJob) {
+	s.logger.Info("Scheduled job started", "job", job.Name, "schedule", job.Schedule.String())
+
+	// The first activation may be inherited from the previous scheduler
+	job.mu.Lock()
+	next := job.nextRun
+	job.mu.Unlock()
+
+	for {
+		if next.IsZero() {
+			next = job.Schedule.Next(time.Now())
+
+			job.mu.Lock()
+			job.nextRun = next
+			job.mu.Unlock()
+		}
+
+		// Without a next activation, the job only runs when triggered
+		var timer *time.Timer
+		var timerCh <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			timerCh = timer.C
+		}
+
+		trigger := JobTriggerSchedule
+		done := false
+		select {
+		case <-ctx.Done():
+			done = true
+		case <-s.stopped:
+			done = true
+		case <-timerCh:
+		case <-job.trigger:
+			trigger = JobTriggerManual
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+		if done {
+			return
+		}
+		next = time.Time{}
+
+		job.mu.Lock()
+		paused := job.Paused
+		job.mu.Unlock()
+
+		if paused && trigger == JobTriggerSchedule {
+			s.logger.Debug("Skipping paused job", "job", job.Name)
+			continue
+		}
+
+		s.execute(ctx, job, trigger)
+	}
+}
+
+// execute runs a job once and records its outcome
+func (s *Scheduler) execute(ctx context.Context, job *scheduledJob, trigger string) {
+	job.mu.Lock()
+	job.running = true
+	job.mu.Unlock()
+
+	defer func() {
+		job.mu.Lock()
+		job.running = false
+		job.mu.Unlock()
+	}()
+
+	// The identifier of the run is added to its logs, including those of the stream it reads
+	run := &models.JobRun{
+		ID:        logging.NewID(),
+		Trigger:   trigger,
+		StartedAt: time.Now().UTC(),
+	}
+	ctx = logging.WithJobID(ctx, run.ID)
+
+	s.logger.InfoContext(ctx, "Scheduled job run started", "job", job.Name, "trigger", trigger, "duration", job.Duration, "dimensions", job.Dimensions)
+
+	analyzeCtx, cancel := context.WithTimeout(ctx, job.Duration)
+	results, err := analyzeDimensions(analyzeCtx, s.stream, job.Dimensions, job.PostTypes)
+	cancel()
+
+	run.CompletedAt = time.Now().UTC()
+
+	// The server is shutting down, the run is incomplete
+	if ctx.Err() != nil {
+		s.logger.InfoContext(ctx, "Scheduled job run abandoned", "job", job.Name)
+		return
+	}
+
+	if err != nil {
+		run.Error = err.Error()
+		s.logger.ErrorContext(ctx, "Scheduled job run failed", "job", job.Name, "err", err)
+	} else {
+		for i, dimension := range job.Dimensions {
+			record := NewAnalysisRecord(jobSourcePrefix+job.Name, models.AnalysisLimits{Duration: job.Duration}, dimension, run.StartedAt, run.CompletedAt, results[i])
+			run.Records = append(run.Records, record)
+
+			if s.history != nil {
+				if err := s.history.Append(record); err != nil {
+					s.logger.ErrorContext(ctx, "Failed to record job analysis", "job", job.Name, "err", err, "dimension", dimension)
+				}
+			}
+		}
+
+		s.logger.InfoContext(ctx, "Scheduled job run completed", "job", job.Name, "total_posts", results[0].TotalPosts)
+
+		if job.Sink != nil {
+			if err := job.Sink.Write(ctx, job.Name, *run); err != nil {
+				s.logger.ErrorContext(ctx, "Failed to send job results to sink", "job", job.Name, "sink", job.Sink.String(), "err", err)
+			}
+		}
+	}
+
+	job.record(run)
+}
+
+// analyzeDimensions reads the stream until the context is done and analyzes several dimensions on the same posts.
+// Posts whose type is not in postTypes are ignored (all posts are analyzed when postTypes is empty).
+// Returns one result per dimension, in order.
+func analyzeDimensions(ctx context.Context, stream StreamService, dimensions, postTypes []string) ([]*models.AnalysisResult, error) {
+	resultCh, err := stream.ReadEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregators := make([]*aggregator, len(dimensions))
+	for i, dimension := range dimensions {
+		aggregators[i] = newAggregator(dimension, models.AnalysisGrouping{})
+	}
+
+	for result := range resultCh {
+		if result.Err != nil {
+			return nil, fmt.Errorf("stream error after %d posts: %w", aggregators[0].totalPosts, result.Err)
+		}
+
+		if result.Post == nil {
+			continue
+		}
+		if len(postTypes) > 0 && !slices.Contains(postTypes, result.Post.Type) {
+			continue
+		}
+
+		for _, agg := range aggregators {
+			agg.processPost(result.Post)
+		}
+	}
+
+	results := make([]*models.AnalysisResult, len(aggregators))
+	for i, agg := range aggregators {
+		results[i] = agg.getResult()
+	}
+
+	return results, nil
+}
+
+// Jobs returns the status of every job, in configuration order
+func (s *Scheduler) Jobs() []models.JobStatus {
+	statuses := make([]models.JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		statuses = append(statuses, job.status())
+	}
+	return statuses
+}
+
+// Job returns the status of a job
+func (s *Scheduler) Job(name string) (models.JobStatus, error) {
+	job, err := s.find(name)
+	if err != nil {
+		return models.JobStatus{}, err
+	}
+	return job.status(), nil
+}
+
+// Pause stops the scheduled runs of a job, a run in progress is not interrupted
+func (s *Scheduler) Pause(name string) error {
+	return s.setPaused(name, true)
+}
+
+// Resume restarts the scheduled runs of a paused job
+func (s *Scheduler) Resume(name string) error {
+	return s.setPaused(name, false)
+}
+
+func (s *Scheduler) setPaused(name string, paused bool) error {
+	job, err := s.find(name)
+	if err != nil {
+		return err
+	}
+
+	job.mu.Lock()
+	changed := job.Paused != paused
+	job.Paused = paused
+	job.mu.Unlock()
+
+	if changed {
+		s.logger.Info("Scheduled job state changed", "job", name, "paused", paused)
+	}
+
+	return nil
+}
+
+// Trigger starts a run of a job now, even if it is paused
+func (s *Scheduler) Trigger(name string) error {
+	job, err := s.find(name)
+	if err != nil {
+		return err
+	}
+
+	job.mu.Lock()
+	running := job.running
+	job.mu.Unlock()
+
+	if running {
+		return ErrJobRunning
+	}
+
+	select {
+	case job.trigger <- struct{}{}:
+	default:
+		// A trigger is already pending
+		return ErrJobRunning
+	}
+
+	return nil
+}
+
+// find returns the job with the given name
+func (s *Scheduler) find(name string) (*scheduledJob, error) {
+	for _, job := range s.jobs {
+		if job.Name == name {
+			return job, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrJobNotFound, name)
+}
+
+// status returns the status of the job
+func (j *scheduledJob) status() models.JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	status := models.JobStatus{
+		Name:       j.Name,
+		Schedule:   j.Schedule.String(),
+		Duration:   j.Duration.String(),
+		Dimensions: j.Dimensions,
+		PostTypes:  j.PostTypes,
+		Paused:     j.Paused,
+		Running:    j.running,
+		Runs:       j.runs,
+		Failures:   j.failures,
+		LastRun:    j.lastRun,
+	}
+
+	if j.Sink != nil {
+		status.Sink = j.Sink.String()
+	}
+
+	if !j.nextRun.IsZero() && !j.Paused {
+		nextRun := j.nextRun
+		status.NextRun = &nextRun
+	}
+
+	return status
+}
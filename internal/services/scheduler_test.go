@@ -0,0 +1,397 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// testJobPosts are the posts delivered to the scheduled jobs
+var testJobPosts = []models.PostPayload{
+	{Type: "tweet", Data: models.Post{Timestamp: 100, Details: map[string]interface{}{"retweets": float64(10), "likes": float64(1)}}},
+	{Type: "tweet", Data: models.Post{Timestamp: 200, Details: map[string]interface{}{"retweets": float64(30), "likes": float64(3)}}},
+	{Type: "instagram_media", Data: models.Post{Timestamp: 300, Details: map[string]interface{}{"likes": float64(50)}}},
+}
+
+// recordingSink is a job sink keeping the runs it receives
+type recordingSink struct {
+	mu   sync.Mutex
+	runs []models.JobRun
+	done chan struct{}
+}
+
+func (s *recordingSink) Write(ctx context.Context, job string, run models.JobRun) error {
+	s.mu.Lock()
+	s.runs = append(s.runs, run)
+	s.mu.Unlock()
+
+	s.done <- struct{}{}
+	return nil
+}
+
+func (s *recordingSink) String() string {
+	return "recording"
+}
+
+// waitForJob waits until a job run is delivered to the sink
+func waitForJob(t *testing.T, sink *recordingSink) {
+	t.Helper()
+
+	select {
+	case <-sink.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the job to run")
+	}
+}
+
+func TestScheduler_Trigger(t *testing.T) {
+	mockStreamClient := &mockStreamService{
+		readEventsFn: func(ctx context.Context) (<-chan StreamResult, error) {
+			return testStreamResultCh(testJobPosts, nil), nil
+		},
+	}
+
+	history := &mockHistoryStore{}
+	sink := &recordingSink{done: make(chan struct{}, 1)}
+
+	// The schedule never fires on its own during the test
+	job := Job{
+		Name:       "tweets",
+		Schedule:   IntervalSchedule(time.Hour),
+		Duration:   time.Second,
+		Dimensions: []string{"retweets", "likes"},
+		PostTypes:  []string{"tweet"},
+		Sink:       sink,
+		Paused:     true,
+	}
+
+	scheduler := NewScheduler(mockStreamClient, history, []Job{job}, testLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go scheduler.Run(ctx)
+
+	// A paused job can still be triggered manually
+	if err := scheduler.Trigger("tweets"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waitForJob(t, sink)
+
+	// Only the tweets are analyzed, for both dimensions
+	sink.mu.Lock()
+	run := sink.runs[0]
+	sink.mu.Unlock()
+
+	if run.Trigger != JobTriggerManual {
+		t.Errorf("expected a manual run, got %q", run.Trigger)
+	}
+	if len(run.Records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(run.Records))
+	}
+	if run.Records[0].Dimension != "retweets" || run.Records[0].Average != 20 || run.Records[0].TotalPosts != 2 {
+		t.Errorf("unexpected retweets record: %+v", run.Records[0])
+	}
+	if run.Records[1].Dimension != "likes" || run.Records[1].Average != 2 {
+		t.Errorf("unexpected likes record: %+v", run.Records[1])
+	}
+
+	// The results are kept in the history under the job source
+	if len(history.records) != 2 || history.records[0].Source != "job:tweets" {
+		t.Errorf("expected 2 history records from job:tweets, got %+v", history.records)
+	}
+
+	// The status reflects the run once it is recorded
+	deadline := time.Now().Add(5 * time.Second)
+	var status models.JobStatus
+	for time.Now().Before(deadline) {
+		status, _ = scheduler.Job("tweets")
+		if status.Runs == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status.Runs != 1 || status.Failures != 0 || status.LastRun == nil {
+		t.Errorf("unexpected job status: %+v", status)
+	}
+	if !status.Paused || status.NextRun != nil {
+		t.Errorf("expected a paused job without next run, got %+v", status)
+	}
+}
+
+func TestScheduler_Schedule(t *testing.T) {
+	mockStreamClient := &mockStreamService{
+		readEventsFn: func(ctx context.Context) (<-chan StreamResult, error) {
+			return testStreamResultCh(testJobPosts, nil), nil
+		},
+	}
+
+	sink := &recordingSink{done: make(chan struct{}, 10)}
+	job := Job{
+		Name:       "likes",
+		Schedule:   IntervalSchedule(50 * time.Millisecond),
+		Duration:   10 * time.Millisecond,
+		Dimensions: []string{"likes"},
+		Sink:       sink,
+	}
+
+	scheduler := NewScheduler(mockStreamClient, nil, []Job{job}, testLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go scheduler.Run(ctx)
+
+	waitForJob(t, sink)
+
+	sink.mu.Lock()
+	run := sink.runs[0]
+	sink.mu.Unlock()
+
+	if run.Trigger != JobTriggerSchedule {
+		t.Errorf("expected a scheduled run, got %q", run.Trigger)
+	}
+	if run.Records[0].TotalPosts != 3 {
+		t.Errorf("expected all posts to be analyzed without filters, got %d", run.Records[0].TotalPosts)
+	}
+}
+
+func TestScheduler_FailedRun(t *testing.T) {
+	mockStreamClient := &mockStreamService{
+		readEventsFn: func(ctx context.Context) (<-chan StreamResult, error) {
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	history := &mockHistoryStore{}
+	sink := &recordingSink{done: make(chan struct{}, 1)}
+	job := Job{Name: "likes", Schedule: IntervalSchedule(time.Hour), Duration: time.Second, Dimensions: []string{"likes"}, Sink: sink}
+
+	scheduler := NewScheduler(mockStreamClient, history, []Job{job}, testLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go scheduler.Run(ctx)
+
+	scheduler.Trigger("likes")
+
+	deadline := time.Now().Add(5 * time.Second)
+	var status models.JobStatus
+	for time.Now().Before(deadline) {
+		status, _ = scheduler.Job("likes")
+		if status.Runs == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A failed run is counted but neither recorded nor sent to the sink
+	if status.Failures != 1 || status.LastRun == nil || !strings.Contains(status.LastRun.Error, "connection refused") {
+		t.Errorf("expected a failed run, got %+v", status)
+	}
+	if len(history.records) != 0 {
+		t.Errorf("expected no history records, got %d", len(history.records))
+	}
+	if len(sink.runs) != 0 {
+		t.Errorf("expected nothing sent to the sink, got %d runs", len(sink.runs))
+	}
+}
+
+func TestScheduler_Manage(t *testing.T) {
+	job := Job{Name: "likes", Schedule: IntervalSchedule(time.Hour), Duration: time.Second, Dimensions: []string{"likes"}}
+	scheduler := NewScheduler(&mockStreamService{}, nil, []Job{job}, testLogger())
+
+	if err := scheduler.Pause("likes"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if status, _ := scheduler.Job("likes"); !status.Paused {
+		t.Error("expected the job to be paused")
+	}
+
+	if err := scheduler.Resume("likes"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if status, _ := scheduler.Job("likes"); status.Paused {
+		t.Error("expected the job to be resumed")
+	}
+
+	// Without a running scheduler, the first trigger stays pending
+	if err := scheduler.Trigger("likes"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := scheduler.Trigger("likes"); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("expected ErrJobRunning for a pending trigger, got %v", err)
+	}
+
+	for _, action := range []func(string) error{scheduler.Pause, scheduler.Resume, scheduler.Trigger} {
+		if err := action("unknown"); !errors.Is(err, ErrJobNotFound) {
+			t.Errorf("expected ErrJobNotFound, got %v", err)
+		}
+	}
+
+	if jobs := scheduler.Jobs(); len(jobs) != 1 || jobs[0].Schedule != "every 1h0m0s" {
+		t.Errorf("unexpected jobs: %+v", jobs)
+	}
+}
+
+func TestScheduler_Inherit(t *testing.T) {
+	jobs := []Job{
+		{Name: "likes", Schedule: IntervalSchedule(time.Hour), Duration: time.Second, Dimensions: []string{"likes"}},
+		{Name: "comments", Schedule: IntervalSchedule(time.Hour), Duration: time.Second, Dimensions: []string{"comments"}, Paused: true},
+	}
+	previous := NewScheduler(&mockStreamService{}, nil, jobs, testLogger())
+	previous.Pause("likes")
+
+	// The pause of "likes" is kept, the configuration resumes "comments" now and its state follows it
+	jobs[1].Paused = false
+	scheduler := NewScheduler(&mockStreamService{}, nil, jobs, testLogger())
+	scheduler.Inherit(previous)
+
+	if status, _ := scheduler.Job("likes"); !status.Paused {
+		t.Error("expected the paused job to stay paused")
+	}
+	if status, _ := scheduler.Job("comments"); status.Paused {
+		t.Error("expected the job resumed by the configuration to be resumed")
+	}
+}
+
+func TestScheduler_Stop(t *testing.T) {
+	// The run reads the stream until released
+	release := make(chan struct{})
+	mockStreamClient := &mockStreamService{
+		readEventsFn: func(ctx context.Context) (<-chan StreamResult, error) {
+			ch := make(chan StreamResult, len(testJobPosts))
+			for _, post := range testJobPosts {
+				ch <- StreamResult{Post: &post}
+			}
+			go func() {
+				<-release
+				close(ch)
+			}()
+			return ch, nil
+		},
+	}
+
+	history := &mockHistoryStore{}
+	jobs := []Job{{Name: "likes", Schedule: IntervalSchedule(time.Hour), Duration: time.Minute, Dimensions: []string{"likes"}}}
+	previous := NewScheduler(mockStreamClient, history, jobs, testLogger())
+
+	done := make(chan struct{})
+	go func() {
+		previous.Run(context.Background())
+		close(done)
+	}()
+
+	if err := previous.Trigger("likes"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for status, _ := previous.Job("likes"); !status.Running; status, _ = previous.Job("likes") {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the job to run")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The reload keeps the next activation and stops the previous scheduler
+	scheduler := NewScheduler(mockStreamClient, history, jobs, testLogger())
+	scheduler.Inherit(previous)
+	previous.Stop()
+
+	prevStatus, _ := previous.Job("likes")
+	status, _ := scheduler.Job("likes")
+	if status.NextRun == nil || !status.NextRun.Equal(*prevStatus.NextRun) {
+		t.Errorf("expected the next run %v to be kept, got %v", prevStatus.NextRun, status.NextRun)
+	}
+
+	// The run in progress finishes, and is recorded in the new scheduler
+	select {
+	case <-done:
+		t.Fatal("expected the run in progress to keep running")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the scheduler to stop")
+	}
+
+	if status, _ := scheduler.Job("likes"); status.Runs != 1 || status.LastRun == nil || status.LastRun.Trigger != JobTriggerManual {
+		t.Errorf("expected the run to be recorded in the new scheduler, got %+v", status)
+	}
+	if len(history.records) != 1 {
+		t.Errorf("expected 1 history record, got %+v", history.records)
+	}
+}
+
+func TestJobSinks(t *testing.T) {
+	run := models.JobRun{
+		Trigger: JobTriggerSchedule,
+		Records: []models.AnalysisRecord{{Dimension: "likes", TotalPosts: 3, Average: 18}},
+	}
+
+	t.Run("file sink appends JSON lines", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "results.jsonl")
+		sink := NewFileSink(path)
+
+		sink.Write(context.Background(), "likes", run)
+		sink.Write(context.Background(), "likes", run)
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read sink file: %v", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("expected 2 lines, got %d", len(lines))
+		}
+
+		var output map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[0]), &output); err != nil {
+			t.Fatalf("failed to parse sink line: %v", err)
+		}
+		if output["job"] != "likes" || output["trigger"] != JobTriggerSchedule {
+			t.Errorf("unexpected sink line: %v", output)
+		}
+	})
+
+	t.Run("webhook sink posts JSON", func(t *testing.T) {
+		var received map[string]interface{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&received)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		sink := NewWebhookSink(server.URL, server.Client())
+		if err := sink.Write(context.Background(), "likes", run); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if received["job"] != "likes" {
+			t.Errorf("unexpected webhook payload: %v", received)
+		}
+	})
+
+	t.Run("webhook sink fails on error status", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		sink := NewWebhookSink(server.URL, server.Client())
+		if err := sink.Write(context.Background(), "likes", run); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
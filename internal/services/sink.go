@@ -0,0 +1,143 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// JobSink receives the results of every completed run of a scheduled job
+type JobSink interface {
+	Write(ctx context.Context, job string, run models.JobRun) error
+	String() string
+}
+
+// jobOutput is the payload written by the sinks
+type jobOutput struct {
+	Job string `json:"job"`
+	models.JobRun
+}
+
+// LogSink logs the results of the job runs
+type LogSink struct {
+	logger *slog.Logger
+}
+
+// Check interface implementation at compile-time
+var (
+	_ JobSink = &LogSink{}
+	_ JobSink = &FileSink{}
+	_ JobSink = &WebhookSink{}
+)
+
+// NewLogSink creates a new sink logging the job results
+func NewLogSink(logger *slog.Logger) *LogSink {
+	return &LogSink{
+		logger: logger,
+	}
+}
+
+// Write logs one line per analyzed dimension
+func (s *LogSink) Write(ctx context.Context, job string, run models.JobRun) error {
+	for _, record := range run.Records {
+		s.logger.Info("Job result", "job", job, "dimension", record.Dimension, "total_posts", record.TotalPosts, "average", record.Average,
+			"minimum_timestamp", record.MinimumTimestamp, "maximum_timestamp", record.MaximumTimestamp)
+	}
+	return nil
+}
+
+func (s *LogSink) String() string {
+	return "log"
+}
+
+// FileSink appends the results of the job runs to a JSONL file
+type FileSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileSink creates a new sink appending the job results to a file
+func NewFileSink(path string) *FileSink {
+	return &FileSink{
+		path: path,
+	}
+}
+
+// Write appends the run as a single JSON line
+func (s *FileSink) Write(ctx context.Context, job string, run models.JobRun) error {
+	line, err := json.Marshal(jobOutput{Job: job, JobRun: run})
+	if err != nil {
+		return fmt.Errorf("failed to encode job results: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open sink file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(line); err != nil {
+		return fmt.Errorf("failed to write sink file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FileSink) String() string {
+	return "file:" + s.path
+}
+
+// WebhookSink posts the results of the job runs as JSON to a URL
+type WebhookSink struct {
+	url        string
+	httpClient *http.Client
+}
+
+// NewWebhookSink creates a new sink posting the job results to a URL
+func NewWebhookSink(url string, httpClient *http.Client) *WebhookSink {
+	return &WebhookSink{
+		url:        url,
+		httpClient: httpClient,
+	}
+}
+
+// Write posts the run, any status other than 2xx is an error
+func (s *WebhookSink) Write(ctx context.Context, job string, run models.JobRun) error {
+	body, err := json.Marshal(jobOutput{Job: job, JobRun: run})
+	if err != nil {
+		return fmt.Errorf("failed to encode job results: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected webhook status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (s *WebhookSink) String() string {
+	return "webhook:" + s.url
+}
@@ -9,7 +9,9 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/metrics"
 	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
 )
 
@@ -19,30 +21,100 @@ type StreamResult struct {
 	Err  error
 }
 
+// errParse marks events that could not be parsed into a post
+var errParse = errors.New("parse error")
+
 // StreamService defines the stream service interface
 type StreamService interface {
 	ReadEvents(ctx context.Context) (<-chan StreamResult, error)
 }
 
+// ErrStreamStalled is reported when the connection stays open but no data is received for the stall timeout
+var ErrStreamStalled = errors.New("stream stalled")
+
+// Backoff of the reconnections after a stall: the delay between the failed attempts doubles up to the maximum
+const (
+	defaultStallReconnectDelay = 500 * time.Millisecond
+	maxStallReconnectDelay     = 30 * time.Second
+)
+
 // StreamClient manages stream connection and reads events
 type StreamClient struct {
 	url        string
 	logger     *slog.Logger
 	httpClient *http.Client
+	headers    http.Header
+	health     *healthTracker
+
+	// Stall detection (disabled when stallTimeout is zero)
+	stallTimeout   time.Duration
+	stallReconnect bool
+	reconnectDelay time.Duration
 }
 
 // Check interface implementation at compile-time
-var _ StreamService = &StreamClient{}
+var (
+	_ StreamService     = &StreamClient{}
+	_ HealthReporter    = &StreamClient{}
+	_ metrics.Collector = &StreamClient{}
+)
+
+// StreamClientOption configures optional behavior of a StreamClient
+type StreamClientOption func(*StreamClient)
+
+// WithStallDetection enables the idle watchdog.
+// A connection that receives no byte for 'timeout' is considered stalled:
+// it is either re-established (reconnect is true), retrying with backoff until the context is done, or reported as an ErrStreamStalled error.
+func WithStallDetection(timeout time.Duration, reconnect bool) StreamClientOption {
+	return func(c *StreamClient) {
+		c.stallTimeout = timeout
+		c.stallReconnect = reconnect
+	}
+}
+
+// WithHTTPClient replaces the default HTTP client (proxy, TLS and connection timeouts are configured on it).
+// The client must not set an overall timeout, since the stream never ends on its own.
+func WithHTTPClient(httpClient *http.Client) StreamClientOption {
+	return func(c *StreamClient) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithHeaders adds headers (authentication, User-Agent, custom headers) to every stream request
+func WithHeaders(headers http.Header) StreamClientOption {
+	return func(c *StreamClient) {
+		c.headers = headers
+	}
+}
 
 // NewStreamClient creates a new stream client
-func NewStreamClient(url string, logger *slog.Logger) *StreamClient {
-	return &StreamClient{
+func NewStreamClient(url string, logger *slog.Logger, opts ...StreamClientOption) *StreamClient {
+	c := &StreamClient{
 		url:    url,
 		logger: logger,
 
 		// No timeout for streaming connection
 		httpClient: &http.Client{Timeout: 0},
+
+		health:         newHealthTracker(),
+		reconnectDelay: defaultStallReconnectDelay,
+	}
+
+	for _, opt := range opts {
+		opt(c)
 	}
+
+	return c
+}
+
+// StreamHealth returns the current health of the stream connections
+func (c *StreamClient) StreamHealth() models.StreamHealth {
+	return c.health.snapshot(time.Now())
+}
+
+// Collect returns the metrics of the upstream connections
+func (c *StreamClient) Collect() []metrics.Family {
+	return healthFamilies(c.StreamHealth())
 }
 
 // ReadEvents connects to the stream and sends post events to the result channel.
@@ -50,6 +122,23 @@ func NewStreamClient(url string, logger *slog.Logger) *StreamClient {
 // The channel is closed when the context is cancelled or stream ends unexpectedly.
 func (c *StreamClient) ReadEvents(ctx context.Context) (<-chan StreamResult, error) {
 	// Establish connection to the stream
+	body, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.InfoContext(ctx, "Stream connection established")
+
+	// Connection successful, start reading events asynchronously
+	resultCh := make(chan StreamResult, 100)
+
+	go c.readStream(ctx, body, resultCh)
+
+	return resultCh, nil
+}
+
+// connect establishes a connection to the stream and returns the body of the response
+func (c *StreamClient) connect(ctx context.Context) (io.ReadCloser, error) {
 	resp, err := c.getStream(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to stream: %w", err)
@@ -60,14 +149,7 @@ func (c *StreamClient) ReadEvents(ctx context.Context) (<-chan StreamResult, err
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	c.logger.Info("Stream connection established")
-
-	// Connection successful, start reading events asynchronously
-	resultCh := make(chan StreamResult, 100)
-
-	go c.readStream(ctx, resp.Body, resultCh)
-
-	return resultCh, nil
+	return resp.Body, nil
 }
 
 // getStream establishes HTTP connection to Upfluence's SSE stream endpoint
@@ -77,6 +159,11 @@ func (c *StreamClient) getStream(ctx context.Context) (*http.Response, error) {
 		return nil, fmt.Errorf("failed to create request to get events from the stream: %w", err)
 	}
 
+	// Configured headers come first so that they cannot override the protocol headers
+	for name, values := range c.headers {
+		req.Header[name] = values
+	}
+
 	// These headers are needed in case of an SSE
 	req.Header.Set("Accept", "text/event-stream")
 	req.Header.Set("Cache-Control", "no-cache")
@@ -89,34 +176,102 @@ func (c *StreamClient) getStream(ctx context.Context) (*http.Response, error) {
 	return resp, nil
 }
 
-// readStream manages the lifecycle of a single SSE connection.
+// readStream manages the lifecycle of the SSE connection, including reconnections after every stall.
 // Reads events from the stream, parses and sends them to the result channel.
 // The channel is closed when the function exits.
 func (c *StreamClient) readStream(ctx context.Context, body io.ReadCloser, resultCh chan<- StreamResult) {
 	defer close(resultCh)
+
+	for {
+		// Consume events (posts) coming from the stream by parsing and pushing them to the result channel
+		err := c.consumeConnection(ctx, body, resultCh)
+
+		// A stalled connection is replaced by a new one when configured so, however many times it stalls
+		if errors.Is(err, ErrStreamStalled) && c.stallReconnect && ctx.Err() == nil {
+			c.logger.WarnContext(ctx, "Stream stalled, reconnecting", "stall_timeout", c.stallTimeout)
+
+			if body, err = c.reconnect(ctx); err == nil {
+				continue
+			}
+		}
+
+		switch {
+		case err == nil:
+			// Stream ended normally with an EOF (this is not supposed to happen)
+			c.logger.InfoContext(ctx, "Stream ended normally")
+
+		case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+			// Context cancellation is normal and expected (due to 'duration' parameter)
+			c.logger.InfoContext(ctx, "Stream connection stopped", "reason", err.Error())
+
+		default:
+			// Anything else is an unexpected error (parse, scanner, network, stall) and is sent to the analyzer
+			c.logger.ErrorContext(ctx, "Stream error", "err", err.Error())
+			resultCh <- StreamResult{Err: fmt.Errorf("stream error: %w", err)}
+		}
+
+		return
+	}
+}
+
+// reconnect re-establishes the connection after a stall, retrying with exponential backoff until the context is done.
+// The first attempt is immediate, a stalled upstream usually accepts a new connection right away.
+func (c *StreamClient) reconnect(ctx context.Context) (io.ReadCloser, error) {
+	delay := c.reconnectDelay
+
+	for attempt := 1; ; attempt++ {
+		body, err := c.connect(ctx)
+		if err == nil {
+			c.health.reconnects.Add(1)
+			c.logger.InfoContext(ctx, "Stream connection re-established", "attempt", attempt)
+			return body, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		c.logger.WarnContext(ctx, "Stream reconnection failed, retrying", "err", err.Error(), "attempt", attempt, "delay", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		delay = min(2*delay, maxStallReconnectDelay)
+	}
+}
+
+// consumeConnection consumes a single connection, watching it for stalls when enabled.
+// The body is closed when the function returns.
+func (c *StreamClient) consumeConnection(ctx context.Context, body io.ReadCloser, resultCh chan<- StreamResult) error {
 	defer body.Close()
 
-	// Consume events (posts) coming from the stream by parsing and pushing them to the result channel
-	err := c.consumeStream(ctx, body, resultCh)
+	disconnected := c.health.connected()
+	defer disconnected()
 
-	switch {
-	case err == nil:
-		// Stream ended normally with an EOF (this is not supposed to happen)
-		c.logger.Info("Stream ended normally")
+	if c.stallTimeout <= 0 {
+		return c.consumeStream(ctx, body, resultCh)
+	}
+
+	// The watchdog closes the body when the connection goes silent, which unblocks the scanner
+	watchdog := newIdleWatchdog(body, c.stallTimeout)
+	defer watchdog.stop()
 
-	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
-		// Context cancellation is normal and expected (due to 'duration' parameter)
-		c.logger.Info("Stream connection stopped", "reason", err.Error())
+	err := c.consumeStream(ctx, watchdog, resultCh)
 
-	default:
-		// Anything else is an unexpected error (parse, scanner, network) and is sent to the analyzer
-		c.logger.Error("Stream error", "err", err.Error())
-		resultCh <- StreamResult{Err: fmt.Errorf("stream error: %w", err)}
+	if ctx.Err() == nil && watchdog.stalled() {
+		c.health.stalls.Add(1)
+		return fmt.Errorf("%w: no data received for %s", ErrStreamStalled, c.stallTimeout)
 	}
+
+	return err
 }
 
 // consumeStream reads and processes SSE events line by line.
-// Returns nil on normal EOF, context error on cancellation, or other errors (parse, scanner, network).
+// Returns nil on normal EOF, context error on cancellation, or other errors (scanner, network), the malformed events are skipped.
 func (c *StreamClient) consumeStream(ctx context.Context, r io.Reader, resultCh chan<- StreamResult) error {
 	scanner := bufio.NewScanner(r)
 
@@ -137,10 +292,19 @@ func (c *StreamClient) consumeStream(ctx context.Context, r io.Reader, resultCh
 
 		// SSE data lines start with "data: " prefix
 		if event, ok := bytes.CutPrefix(b, []byte("data: ")); ok {
-			// handleEvent respects the context
-			if err := c.handleEvent(ctx, event, resultCh); err != nil {
+			// handleEvent respects the context.
+			// A malformed event is counted and skipped, it must not end the connection shared by every reader.
+			if err := handleEvent(ctx, event, resultCh); err != nil {
+				if errors.Is(err, errParse) {
+					c.health.parseErrors.Add(1)
+					c.logger.DebugContext(ctx, "Skipping malformed event", "err", err.Error())
+					continue
+				}
 				return err
 			}
+
+			c.health.event(time.Now())
+			c.health.queued(len(resultCh))
 		}
 	}
 
@@ -157,14 +321,14 @@ func (c *StreamClient) consumeStream(ctx context.Context, r io.Reader, resultCh
 	return nil
 }
 
-// handleEvent parses a single SSE event and sends it to the result channel.
+// handleEvent parses a single event (SSE data line or WebSocket message) and sends it to the result channel.
 // Returns a non-nil error if parsing fails or the context is cancelled.
 // Blocks until the event is sent or the context is cancelled.
-func (c *StreamClient) handleEvent(ctx context.Context, event []byte, resultCh chan<- StreamResult) error {
+func handleEvent(ctx context.Context, event []byte, resultCh chan<- StreamResult) error {
 	var post models.PostPayload
 
 	if err := post.UnmarshalJSON(event); err != nil {
-		return fmt.Errorf("parse error: %w", err)
+		return fmt.Errorf("%w: %w", errParse, err)
 	}
 
 	// Send post to the channel, respecting context cancellation.
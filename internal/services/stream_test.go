@@ -6,8 +6,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/testutil"
 )
 
 var logger = testLogger()
@@ -213,8 +216,9 @@ func TestStreamClient_ReadEvents_ParseError(t *testing.T) {
 			f.Flush()
 		}
 
-		// Send invalid JSON
+		// Send invalid JSON, then a valid event again
 		w.Write([]byte(`data: {invalid json}` + "\n"))
+		w.Write([]byte(`data: {"tweet":{"timestamp":1554324857,"likes":10}}` + "\n"))
 		if f, ok := w.(http.Flusher); ok {
 			f.Flush()
 		}
@@ -241,24 +245,24 @@ func TestStreamClient_ReadEvents_ParseError(t *testing.T) {
 		t.Errorf("expected first result to have no error, got %v", result1.Err)
 	}
 
-	// Second result should be error
+	// The malformed event is skipped, the stream goes on with the next one
 	result2 := <-resultCh
-	if result2.Err == nil {
-		t.Error("expected second result to have error for invalid JSON")
+	if result2.Err != nil {
+		t.Errorf("expected the malformed event to be skipped, got %v", result2.Err)
 	}
-	if result2.Post != nil {
-		t.Error("expected second result to have no post")
+	if result2.Post == nil || result2.Post.Data.Timestamp != 1554324857 {
+		t.Errorf("expected second result to be the next valid post, got %+v", result2.Post)
 	}
 
-	// Verify error message
-	if !strings.Contains(result2.Err.Error(), "parse error") && !strings.Contains(result2.Err.Error(), "stream error") {
-		t.Errorf("expected error to mention parse/stream error, got: %v", result2.Err)
+	// The channel closes at the end of the stream without error
+	for result := range resultCh {
+		if result.Err != nil {
+			t.Errorf("expected no error after the malformed event, got %v", result.Err)
+		}
 	}
 
-	// Channel should close after error
-	_, ok := <-resultCh
-	if ok {
-		t.Error("expected channel to be closed after parse error")
+	if health := client.StreamHealth(); health.ParseErrors != 1 {
+		t.Errorf("expected 1 parse error, got %d", health.ParseErrors)
 	}
 }
 
@@ -406,3 +410,308 @@ func TestStreamClient_ReadEvents_ChannelBuffer(t *testing.T) {
 		t.Errorf("expected at least 100 posts with buffering, got %d", posts)
 	}
 }
+
+func TestStreamClient_ReadEvents_MockStream(t *testing.T) {
+	server, stream, err := testutil.NewMockStreamServer(testutil.MockStreamOptions{
+		GeneratorOptions:  testutil.GeneratorOptions{Seed: 42},
+		Rate:              500,
+		KeepAliveInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create mock stream: %v", err)
+	}
+	defer server.Close()
+
+	client := NewStreamClient(server.URL, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	resultCh, err := client.ReadEvents(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Keep-alive comments are ignored, every generated post is parsed
+	posts := 0
+	for result := range resultCh {
+		if result.Err != nil {
+			t.Errorf("unexpected error: %v", result.Err)
+			continue
+		}
+		posts++
+	}
+
+	if posts == 0 {
+		t.Error("expected posts from the mock stream")
+	}
+	if int64(posts) > stream.Stats().Events {
+		t.Errorf("received %d posts but only %d events were sent", posts, stream.Stats().Events)
+	}
+}
+
+func TestStreamClient_ReadEvents_StallError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+
+		// Send one event then keep the connection open without sending anything
+		w.Write([]byte(`data: {"tweet":{"timestamp":1554324856,"likes":636938}}` + "\n"))
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client := NewStreamClient(server.URL, logger, WithStallDetection(100*time.Millisecond, false))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	resultCh, err := client.ReadEvents(ctx)
+	if err != nil {
+		t.Fatalf("expected no error on connection, got %v", err)
+	}
+
+	posts := 0
+	var streamErr error
+	for result := range resultCh {
+		if result.Err != nil {
+			streamErr = result.Err
+			continue
+		}
+		posts++
+	}
+
+	if posts != 1 {
+		t.Errorf("expected 1 post before the stall, got %d", posts)
+	}
+	if !errors.Is(streamErr, ErrStreamStalled) {
+		t.Fatalf("expected %v, got: %v", ErrStreamStalled, streamErr)
+	}
+
+	// The stall must be detected well before the analysis deadline
+	if ctx.Err() != nil {
+		t.Error("expected the stall to end the stream before the context deadline")
+	}
+
+	health := client.StreamHealth()
+	if health.Stalls != 1 {
+		t.Errorf("expected 1 stall, got %d", health.Stalls)
+	}
+	if health.Connected {
+		t.Error("expected stream to be disconnected after the stall")
+	}
+}
+
+func TestStreamClient_ReadEvents_StallReconnect(t *testing.T) {
+	var connections atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+
+		// First connection stalls, the following ones send an event
+		if connections.Add(1) > 1 {
+			w.Write([]byte(`data: {"tweet":{"timestamp":1633974046,"likes":386963}}` + "\n"))
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client := NewStreamClient(server.URL, logger, WithStallDetection(100*time.Millisecond, true))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	resultCh, err := client.ReadEvents(ctx)
+	if err != nil {
+		t.Fatalf("expected no error on connection, got %v", err)
+	}
+
+	select {
+	case result := <-resultCh:
+		if result.Post == nil {
+			t.Fatalf("expected a post from the new connection, got %+v", result)
+		}
+	case <-ctx.Done():
+		t.Fatal("expected the stalled connection to be replaced")
+	}
+
+	health := client.StreamHealth()
+	if health.Reconnects < 1 {
+		t.Errorf("expected at least 1 reconnect, got %d", health.Reconnects)
+	}
+	if !health.Connected {
+		t.Error("expected stream to be connected after reconnect")
+	}
+	if health.LastEventAge < 0 {
+		t.Errorf("expected last event age to be set, got %v", health.LastEventAge)
+	}
+}
+
+func TestStreamClient_ReadEvents_StallReconnectBackoff(t *testing.T) {
+	var connections atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The connections stall, fail, stall again, then the fourth one sends an event
+		n := connections.Add(1)
+		if n == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		if n > 3 {
+			w.Write([]byte(`data: {"tweet":{"timestamp":1633974046,"likes":386963}}` + "\n"))
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client := NewStreamClient(server.URL, logger, WithStallDetection(100*time.Millisecond, true))
+	client.reconnectDelay = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	resultCh, err := client.ReadEvents(ctx)
+	if err != nil {
+		t.Fatalf("expected no error on connection, got %v", err)
+	}
+
+	select {
+	case result := <-resultCh:
+		if result.Post == nil {
+			t.Fatalf("expected a post once reconnected, got %+v", result)
+		}
+	case <-ctx.Done():
+		t.Fatal("expected every stall to be recovered")
+	}
+
+	if health := client.StreamHealth(); health.Stalls != 2 || health.Reconnects != 2 {
+		t.Errorf("expected 2 stalls and 2 reconnects, got %d and %d", health.Stalls, health.Reconnects)
+	}
+}
+
+func TestStreamClient_ReadEvents_KeepAlivePreventsStall(t *testing.T) {
+	server, _, err := testutil.NewMockStreamServer(testutil.MockStreamOptions{
+		// A very low rate: only keep-alive comments keep the connection active
+		Rate:              0.1,
+		KeepAliveInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create mock stream: %v", err)
+	}
+	defer server.Close()
+
+	client := NewStreamClient(server.URL, logger, WithStallDetection(100*time.Millisecond, false))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+
+	resultCh, err := client.ReadEvents(ctx)
+	if err != nil {
+		t.Fatalf("expected no error on connection, got %v", err)
+	}
+
+	for result := range resultCh {
+		if result.Err != nil {
+			t.Errorf("unexpected error: %v", result.Err)
+		}
+	}
+
+	if stalls := client.StreamHealth().Stalls; stalls != 0 {
+		t.Errorf("expected no stall with keep-alive comments, got %d", stalls)
+	}
+}
+
+func TestStreamClient_ReadEvents_Headers(t *testing.T) {
+	headersCh := make(chan http.Header, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headersCh <- r.Header.Clone()
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer secret")
+	headers.Set("User-Agent", "stream-analyzer/test")
+	headers.Set("X-Partner", "acme")
+	headers.Set("Accept", "application/json") // Must not override the SSE protocol header
+
+	client := NewStreamClient(server.URL, logger, WithHeaders(headers))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	resultCh, err := client.ReadEvents(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for range resultCh {
+		// Just drain the channel
+	}
+
+	received := <-headersCh
+
+	expected := map[string]string{
+		"Authorization": "Bearer secret",
+		"User-Agent":    "stream-analyzer/test",
+		"X-Partner":     "acme",
+		"Accept":        "text/event-stream",
+	}
+	for name, value := range expected {
+		if received.Get(name) != value {
+			t.Errorf("expected header %s=%q, got %q", name, value, received.Get(name))
+		}
+	}
+}
+
+func TestStreamClient_ReadEvents_CustomHTTPClient(t *testing.T) {
+	// A TLS server whose certificate is only trusted by its own client
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`data: {"tweet":{"timestamp":1554324856,"likes":636938}}` + "\n"))
+	}))
+	defer server.Close()
+
+	// The default client does not trust the test certificate
+	if _, err := NewStreamClient(server.URL, logger).ReadEvents(context.Background()); err == nil {
+		t.Fatal("expected certificate error with the default client")
+	}
+
+	client := NewStreamClient(server.URL, logger, WithHTTPClient(server.Client()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	resultCh, err := client.ReadEvents(ctx)
+	if err != nil {
+		t.Fatalf("expected no error with the custom client, got %v", err)
+	}
+
+	posts := 0
+	for result := range resultCh {
+		if result.Post != nil {
+			posts++
+		}
+	}
+	if posts != 1 {
+		t.Errorf("expected 1 post, got %d", posts)
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// idleWatchdog wraps a connection body and closes it when no byte is read for longer than the timeout.
+// Any received byte counts as activity, including SSE comments and empty keep-alive lines.
+// Only time spent waiting on the upstream counts as idle, a slow consumer never triggers a stall.
+type idleWatchdog struct {
+	body     io.ReadCloser
+	timeout  time.Duration
+	lastRead atomic.Int64 // Unix nanoseconds
+	reading  atomic.Bool
+	fired    atomic.Bool
+	done     chan struct{}
+}
+
+// newIdleWatchdog creates and starts a watchdog on the given body
+func newIdleWatchdog(body io.ReadCloser, timeout time.Duration) *idleWatchdog {
+	w := &idleWatchdog{
+		body:    body,
+		timeout: timeout,
+		done:    make(chan struct{}),
+	}
+
+	w.lastRead.Store(time.Now().UnixNano())
+
+	go w.watch()
+
+	return w
+}
+
+// Read reads from the body and records the activity
+func (w *idleWatchdog) Read(p []byte) (int, error) {
+	w.lastRead.Store(time.Now().UnixNano())
+	w.reading.Store(true)
+
+	n, err := w.body.Read(p)
+
+	w.reading.Store(false)
+	w.lastRead.Store(time.Now().UnixNano())
+
+	return n, err
+}
+
+// watch periodically checks the idle time and closes the body once the timeout is exceeded
+func (w *idleWatchdog) watch() {
+	// Check often enough for the stall to be detected shortly after the timeout
+	ticker := time.NewTicker(max(w.timeout/4, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case now := <-ticker.C:
+			if w.reading.Load() && now.Sub(time.Unix(0, w.lastRead.Load())) >= w.timeout {
+				w.fired.Store(true)
+				w.body.Close()
+				return
+			}
+		}
+	}
+}
+
+// stalled reports whether the watchdog closed the body because of inactivity
+func (w *idleWatchdog) stalled() bool {
+	return w.fired.Load()
+}
+
+// stop stops watching the body
+func (w *idleWatchdog) stop() {
+	close(w.done)
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 signature of a webhook payload, as "sha256=<hex>"
+	SignatureHeader = "X-Signature-256"
+
+	// SignatureTimestampHeader carries the unix time the payload was signed at, which is part of the signed content
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+
+	// DeliveryHeader identifies a notification, it is the same across the retries of a delivery
+	DeliveryHeader = "X-Delivery-ID"
+
+	// defaultWebhookRetryDelay is the delay before the first retry of a failed delivery, doubled at every retry
+	defaultWebhookRetryDelay = time.Second
+)
+
+// Notifier delivers notifications to an external system
+type Notifier interface {
+	Notify(ctx context.Context, payload any) error
+	String() string
+}
+
+// Webhook posts notifications as JSON to a URL.
+// Payloads are signed with HMAC-SHA256 when a secret is set, and failed deliveries are retried with an exponential backoff.
+type Webhook struct {
+	name       string
+	url        string
+	secret     []byte
+	maxRetries int
+	retryDelay time.Duration
+	httpClient *http.Client
+	logger     *slog.Logger
+}
+
+// Check interface implementation at compile-time
+var _ Notifier = &Webhook{}
+
+// NewWebhook creates a new webhook notifier.
+// The payloads are not signed when the secret is empty.
+func NewWebhook(name, url, secret string, maxRetries int, httpClient *http.Client, logger *slog.Logger) *Webhook {
+	return &Webhook{
+		name:       name,
+		url:        url,
+		secret:     []byte(secret),
+		maxRetries: maxRetries,
+		retryDelay: defaultWebhookRetryDelay,
+		httpClient: httpClient,
+		logger:     logger,
+	}
+}
+
+// Notify posts the payload, retrying on network errors, 429 and 5xx responses.
+// Returns the error of the last attempt when every attempt failed.
+func (w *Webhook) Notify(ctx context.Context, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	deliveryID := newRecordID()
+	delay := w.retryDelay
+
+	for attempt := 0; ; attempt++ {
+		retryable, err := w.send(ctx, deliveryID, body)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= w.maxRetries {
+			return fmt.Errorf("webhook %s delivery failed after %d attempts: %w", w.name, attempt+1, err)
+		}
+
+		w.logger.Warn("Webhook delivery failed, retrying", "webhook", w.name, "err", err, "attempt", attempt+1, "retry_in", delay)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("webhook %s delivery cancelled: %w", w.name, ctx.Err())
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+// send makes a single delivery attempt and reports whether a failure is worth retrying
+func (w *Webhook) send(ctx context.Context, deliveryID string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, deliveryID)
+
+	// The payload is signed at every attempt, so that receivers can reject stale timestamps
+	if len(w.secret) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(SignatureTimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, SignPayload(w.secret, timestamp, body))
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retryable, fmt.Errorf("unexpected webhook status code: %d", resp.StatusCode)
+	}
+
+	return false, nil
+}
+
+func (w *Webhook) String() string {
+	return "webhook:" + w.name
+}
+
+// SignPayload returns the signature of a webhook payload: the HMAC-SHA256 of "<timestamp>.<body>", as "sha256=<hex>"
+func SignPayload(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/testutil"
+)
+
+func TestWebhook_Notify(t *testing.T) {
+	payload := map[string]string{"rule": "high-retweets", "state": "firing"}
+
+	t.Run("signs the payload", func(t *testing.T) {
+		receiver := testutil.NewWebhookReceiver("s3cret", 0)
+		defer receiver.Close()
+
+		webhook := NewWebhook("ops", receiver.URL, "s3cret", 0, receiver.Client(), testLogger())
+		if err := webhook.Notify(context.Background(), payload); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		deliveries := receiver.Deliveries()
+		if len(deliveries) != 1 {
+			t.Fatalf("expected 1 delivery, got %d", len(deliveries))
+		}
+		if !deliveries[0].Verified {
+			t.Errorf("expected a valid signature, got %q", deliveries[0].Header.Get(SignatureHeader))
+		}
+
+		var received map[string]string
+		if err := json.Unmarshal(deliveries[0].Body, &received); err != nil {
+			t.Fatalf("failed to parse payload: %v", err)
+		}
+		if received["rule"] != "high-retweets" {
+			t.Errorf("unexpected payload: %v", received)
+		}
+	})
+
+	t.Run("signature does not match another secret", func(t *testing.T) {
+		receiver := testutil.NewWebhookReceiver("s3cret", 0)
+		defer receiver.Close()
+
+		webhook := NewWebhook("ops", receiver.URL, "other", 0, receiver.Client(), testLogger())
+		if err := webhook.Notify(context.Background(), payload); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if deliveries := receiver.Deliveries(); len(deliveries) != 1 || deliveries[0].Verified {
+			t.Errorf("expected 1 unverified delivery, got %+v", deliveries)
+		}
+	})
+
+	t.Run("retries failed deliveries with the same id", func(t *testing.T) {
+		receiver := testutil.NewWebhookReceiver("s3cret", 2)
+		defer receiver.Close()
+
+		webhook := NewWebhook("ops", receiver.URL, "s3cret", 2, receiver.Client(), testLogger())
+		webhook.retryDelay = 0
+
+		if err := webhook.Notify(context.Background(), payload); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if deliveries := receiver.Deliveries(); len(deliveries) != 1 || deliveries[0].Header.Get(DeliveryHeader) == "" {
+			t.Errorf("expected 1 delivery with an id, got %+v", deliveries)
+		}
+	})
+
+	t.Run("gives up after the last retry", func(t *testing.T) {
+		receiver := testutil.NewWebhookReceiver("s3cret", 3)
+		defer receiver.Close()
+
+		webhook := NewWebhook("ops", receiver.URL, "s3cret", 2, receiver.Client(), testLogger())
+		webhook.retryDelay = 0
+
+		if err := webhook.Notify(context.Background(), payload); err == nil {
+			t.Error("expected error, got nil")
+		}
+		if deliveries := receiver.Deliveries(); len(deliveries) != 0 {
+			t.Errorf("expected no delivery, got %d", len(deliveries))
+		}
+	})
+}
@@ -0,0 +1,542 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/metrics"
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// WebSocket protocol constants (RFC 6455)
+const (
+	// websocketGUID is appended to the handshake key to compute Sec-WebSocket-Accept
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	opContinuation byte = 0x0
+	opText         byte = 0x1
+	opBinary       byte = 0x2
+	opClose        byte = 0x8
+	opPing         byte = 0x9
+	opPong         byte = 0xA
+
+	closeNormal uint16 = 1000
+
+	// maxWebSocketMessageSize bounds the size of a single (possibly fragmented) message
+	maxWebSocketMessageSize = 1 << 20
+)
+
+// Default reconnection policy of the WebSocket client
+const (
+	defaultMaxReconnects  = 5
+	defaultReconnectDelay = 500 * time.Millisecond
+)
+
+// errWebSocketClosed is returned when the server closes the WebSocket connection with a close frame
+var errWebSocketClosed = errors.New("websocket closed by server")
+
+// WebSocketClient manages a WebSocket connection to the stream and reads events.
+// Each WebSocket message carries the same post JSON as an SSE data line.
+type WebSocketClient struct {
+	url            string
+	logger         *slog.Logger
+	httpClient     *http.Client
+	headers        http.Header
+	health         *healthTracker
+	maxReconnects  int
+	reconnectDelay time.Duration
+}
+
+// Check interface implementation at compile-time
+var (
+	_ StreamService     = &WebSocketClient{}
+	_ HealthReporter    = &WebSocketClient{}
+	_ metrics.Collector = &WebSocketClient{}
+)
+
+// WebSocketClientOption configures optional behavior of a WebSocketClient
+type WebSocketClientOption func(*WebSocketClient)
+
+// WithWebSocketHTTPClient replaces the default HTTP client used for the opening handshake.
+// Its transport must not negotiate HTTP/2 (see DisableHTTP2) and the client must not set an overall timeout.
+func WithWebSocketHTTPClient(httpClient *http.Client) WebSocketClientOption {
+	return func(c *WebSocketClient) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithWebSocketHeaders adds headers (authentication, User-Agent, custom headers) to every handshake request
+func WithWebSocketHeaders(headers http.Header) WebSocketClientOption {
+	return func(c *WebSocketClient) {
+		c.headers = headers
+	}
+}
+
+// DisableHTTP2 prevents a transport from negotiating HTTP/2.
+// The WebSocket opening handshake relies on the HTTP/1.1 Upgrade mechanism.
+func DisableHTTP2(transport *http.Transport) {
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+}
+
+// NewWebSocketClient creates a new WebSocket stream client
+func NewWebSocketClient(url string, logger *slog.Logger, opts ...WebSocketClientOption) *WebSocketClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	DisableHTTP2(transport)
+
+	c := &WebSocketClient{
+		url:    url,
+		logger: logger,
+
+		// No timeout for streaming connection
+		httpClient: &http.Client{Timeout: 0, Transport: transport},
+
+		health: newHealthTracker(),
+
+		maxReconnects:  defaultMaxReconnects,
+		reconnectDelay: defaultReconnectDelay,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// StreamHealth returns the current health of the WebSocket connections
+func (c *WebSocketClient) StreamHealth() models.StreamHealth {
+	return c.health.snapshot(time.Now())
+}
+
+// Collect returns the metrics of the upstream connections
+func (c *WebSocketClient) Collect() []metrics.Family {
+	return healthFamilies(c.StreamHealth())
+}
+
+// ReadEvents connects to the WebSocket stream and sends post events to the result channel.
+// Returns an error if initial connection to the stream fails.
+// Lost connections are re-established with exponential backoff.
+// The channel is closed when the context is cancelled, a message cannot be parsed or reconnection fails.
+func (c *WebSocketClient) ReadEvents(ctx context.Context) (<-chan StreamResult, error) {
+	// Establish connection to the stream
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to stream: %w", err)
+	}
+
+	c.logger.InfoContext(ctx, "Stream connection established", "transport", "websocket")
+
+	// Connection successful, start reading messages asynchronously
+	resultCh := make(chan StreamResult, 100)
+
+	go c.readSocket(ctx, conn, resultCh)
+
+	return resultCh, nil
+}
+
+// dial performs the WebSocket opening handshake over net/http.
+// On success, the response body of the 101 response is the raw connection.
+func (c *WebSocketClient) dial(ctx context.Context) (*wsConn, error) {
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stream url: %w", err)
+	}
+
+	// net/http only speaks http(s), the WebSocket schemes are mapped accordingly
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported websocket scheme: %s", u.Scheme)
+	}
+
+	key, err := newWebSocketKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate websocket key: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create websocket handshake request: %w", err)
+	}
+
+	// Configured headers come first so that they cannot override the protocol headers
+	for name, values := range c.headers {
+		req.Header[name] = values
+	}
+
+	// These headers are needed for the opening handshake
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send websocket handshake request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		resp.Body.Close()
+		return nil, fmt.Errorf("invalid websocket handshake: unexpected upgrade header %q", resp.Header.Get("Upgrade"))
+	}
+
+	if resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		resp.Body.Close()
+		return nil, fmt.Errorf("invalid websocket handshake: accept key mismatch")
+	}
+
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, fmt.Errorf("invalid websocket handshake: connection is not writable")
+	}
+
+	return newWSConn(rwc), nil
+}
+
+// readSocket manages the lifecycle of the WebSocket connection, including reconnections.
+// Reads messages from the socket, parses and sends them to the result channel.
+// The channel is closed when the function exits.
+func (c *WebSocketClient) readSocket(ctx context.Context, conn *wsConn, resultCh chan<- StreamResult) {
+	defer close(resultCh)
+
+	attempts := 0
+
+	for {
+		delivered, err := c.consumeSocket(ctx, conn, resultCh)
+		conn.Close()
+
+		// The reconnection budget is reset once a connection has delivered posts
+		if delivered {
+			attempts = 0
+		}
+
+		if ctx.Err() != nil {
+			// Context cancellation is normal and expected (due to 'duration' parameter)
+			c.logger.InfoContext(ctx, "Stream connection stopped", "reason", ctx.Err().Error())
+			return
+		}
+
+		// Anything else means the connection was lost (close frame, EOF, network)
+		conn, err = c.reconnect(ctx, &attempts, err)
+		if err != nil {
+			if ctx.Err() != nil {
+				c.logger.InfoContext(ctx, "Stream connection stopped", "reason", ctx.Err().Error())
+				return
+			}
+
+			c.logger.ErrorContext(ctx, "Stream error", "err", err.Error())
+			resultCh <- StreamResult{Err: fmt.Errorf("stream error: %w", err)}
+			return
+		}
+	}
+}
+
+// reconnect re-establishes the WebSocket connection with exponential backoff.
+// Returns the last error once the maximum number of consecutive attempts is reached.
+func (c *WebSocketClient) reconnect(ctx context.Context, attempts *int, cause error) (*wsConn, error) {
+	for *attempts < c.maxReconnects {
+		*attempts++
+
+		delay := c.reconnectDelay << (*attempts - 1)
+		c.logger.WarnContext(ctx, "Stream connection lost, reconnecting", "err", cause.Error(), "attempt", *attempts, "delay", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		conn, err := c.dial(ctx)
+		if err == nil {
+			c.health.reconnects.Add(1)
+			c.logger.InfoContext(ctx, "Stream connection re-established", "transport", "websocket", "attempt", *attempts)
+			return conn, nil
+		}
+
+		cause = err
+	}
+
+	return nil, fmt.Errorf("reconnect failed after %d attempts: %w", c.maxReconnects, cause)
+}
+
+// consumeSocket reads and processes WebSocket messages until the connection ends.
+// Reports whether at least one post was delivered, along with the error that ended the connection.
+func (c *WebSocketClient) consumeSocket(ctx context.Context, conn *wsConn, resultCh chan<- StreamResult) (bool, error) {
+	// Reads block on the connection, closing it is the only way to unblock them on cancellation
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	disconnected := c.health.connected()
+	defer disconnected()
+
+	delivered := false
+
+	for {
+		message, err := conn.readMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return delivered, ctx.Err()
+			}
+			return delivered, err
+		}
+
+		// Skip empty messages (keep-alive)
+		if len(message) == 0 {
+			continue
+		}
+
+		// handleEvent respects the context.
+		// A malformed message is counted and skipped, it must not end the connection shared by every reader.
+		if err := handleEvent(ctx, message, resultCh); err != nil {
+			if errors.Is(err, errParse) {
+				c.health.parseErrors.Add(1)
+				c.logger.DebugContext(ctx, "Skipping malformed message", "err", err.Error())
+				continue
+			}
+			return delivered, err
+		}
+
+		c.health.event(time.Now())
+		c.health.queued(len(resultCh))
+		delivered = true
+	}
+}
+
+// wsConn is the client side of a WebSocket connection.
+// Reads are done by a single goroutine, writes are serialized.
+type wsConn struct {
+	rwc     io.ReadWriteCloser
+	br      *bufio.Reader
+	writeMu sync.Mutex
+
+	// closeSent is set once a close frame is sent, RFC 6455 forbids sending another one. It is guarded by writeMu.
+	closeSent bool
+	closeOnce sync.Once
+}
+
+// newWSConn wraps an upgraded connection
+func newWSConn(rwc io.ReadWriteCloser) *wsConn {
+	return &wsConn{
+		rwc: rwc,
+		br:  bufio.NewReader(rwc),
+	}
+}
+
+// readMessage returns the payload of the next data message, reassembling fragmented messages.
+// Control frames are handled transparently: pings are answered and close frames are acknowledged.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	inMessage := false
+
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, fmt.Errorf("failed to send pong: %w", err)
+			}
+			continue
+
+		case opPong:
+			continue
+
+		case opClose:
+			code := uint16(0)
+			if len(payload) >= 2 {
+				code = binary.BigEndian.Uint16(payload[:2])
+			}
+
+			// Echo the status code back to complete the closing handshake, unless the client started the close
+			c.writeClose(payload[:min(len(payload), 2)])
+			return nil, fmt.Errorf("%w (code %d)", errWebSocketClosed, code)
+
+		case opText, opBinary:
+			if inMessage {
+				return nil, fmt.Errorf("protocol error: new message started before previous one ended")
+			}
+			inMessage = true
+			message = payload
+
+		case opContinuation:
+			if !inMessage {
+				return nil, fmt.Errorf("protocol error: unexpected continuation frame")
+			}
+			if len(message)+len(payload) > maxWebSocketMessageSize {
+				return nil, fmt.Errorf("protocol error: message exceeds %d bytes", maxWebSocketMessageSize)
+			}
+			message = append(message, payload...)
+
+		default:
+			return nil, fmt.Errorf("protocol error: unknown opcode %#x", opcode)
+		}
+
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// readFrame reads a single frame from the connection
+func (c *wsConn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+
+	// No extension is negotiated, so reserved bits must be zero
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, fmt.Errorf("protocol error: reserved bits set")
+	}
+
+	// Frames sent by a server must not be masked
+	if header[1]&0x80 != 0 {
+		return false, 0, nil, fmt.Errorf("protocol error: masked server frame")
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	// Control frames must not be fragmented and are limited to 125 bytes
+	if opcode >= opClose && (!fin || length > 125) {
+		return false, 0, nil, fmt.Errorf("protocol error: invalid control frame")
+	}
+
+	if length > maxWebSocketMessageSize {
+		return false, 0, nil, fmt.Errorf("protocol error: frame exceeds %d bytes", maxWebSocketMessageSize)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// writeFrame writes a single masked frame, as required for frames sent by a client
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return c.writeFrameLocked(opcode, payload)
+}
+
+// writeClose writes a close frame, unless one was already sent on the connection
+func (c *wsConn) writeClose(payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return nil
+	}
+	c.closeSent = true
+
+	return c.writeFrameLocked(opClose, payload)
+}
+
+// writeFrameLocked writes a single masked frame, c.writeMu must be held
+func (c *wsConn) writeFrameLocked(opcode byte, payload []byte) error {
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|opcode)
+
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, 0x80|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return fmt.Errorf("failed to generate frame mask: %w", err)
+	}
+	frame = append(frame, mask[:]...)
+
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, err := c.rwc.Write(frame)
+	return err
+}
+
+// Close sends a normal closure frame (best effort) unless the closing handshake already sent one, and closes the underlying connection
+func (c *wsConn) Close() error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		c.writeClose(binary.BigEndian.AppendUint16(nil, closeNormal))
+		err = c.rwc.Close()
+	})
+
+	return err
+}
+
+// newWebSocketKey generates the random Sec-WebSocket-Key of the opening handshake
+func newWebSocketKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// websocketAccept computes the Sec-WebSocket-Accept value expected for a given key
+func websocketAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,530 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testServerConn is the server side of a WebSocket connection used in tests
+type testServerConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// writeFrame writes an unmasked frame, as sent by a server
+func (c *testServerConn) writeFrame(fin bool, opcode byte, payload []byte) error {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+
+	frame := []byte{first}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	frame = append(frame, payload...)
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// writeText writes a single unfragmented text message
+func (c *testServerConn) writeText(message string) error {
+	return c.writeFrame(true, opText, []byte(message))
+}
+
+// readFrame reads a masked frame sent by the client and unmasks its payload
+func (c *testServerConn) readFrame() (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return 0, nil, err
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return header[0] & 0x0F, payload, nil
+}
+
+// testWebSocketServer creates a server performing the opening handshake and handing the connection to the handler
+func testWebSocketServer(t *testing.T, handler func(conn *testServerConn)) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || r.Header.Get("Sec-WebSocket-Version") != "13" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("response writer does not support hijacking")
+			return
+		}
+
+		conn, rw, err := hijacker.Hijack()
+		if err != nil {
+			t.Errorf("failed to hijack connection: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+		rw.WriteString("Upgrade: websocket\r\n")
+		rw.WriteString("Connection: Upgrade\r\n")
+		rw.WriteString("Sec-WebSocket-Accept: " + websocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		rw.Flush()
+
+		handler(&testServerConn{conn: conn, br: rw.Reader})
+	}))
+}
+
+// testWebSocketURL converts an httptest server URL to a WebSocket URL
+func testWebSocketURL(server *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// drainPosts counts posts and collects errors until the channel closes
+func drainPosts(t *testing.T, resultCh <-chan StreamResult) (int, []error) {
+	t.Helper()
+
+	posts := 0
+	var errs []error
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case result, ok := <-resultCh:
+			if !ok {
+				return posts, errs
+			}
+			if result.Err != nil {
+				errs = append(errs, result.Err)
+			}
+			if result.Post != nil {
+				posts++
+			}
+		case <-timeout:
+			t.Fatal("channel did not close in time")
+		}
+	}
+}
+
+func TestWebSocketClient_NewWebSocketClient(t *testing.T) {
+	url := "wss://example.com/stream"
+
+	client := NewWebSocketClient(url, logger)
+
+	if client == nil {
+		t.Fatal("expected non-nil client")
+	}
+	if client.url != url {
+		t.Errorf("expected url %s, got %s", url, client.url)
+	}
+	if client.httpClient == nil {
+		t.Fatal("expected non-nil http client")
+	}
+	if client.httpClient.Timeout != 0 {
+		t.Errorf("expected zero timeout for streaming, got %v", client.httpClient.Timeout)
+	}
+	if client.maxReconnects != defaultMaxReconnects {
+		t.Errorf("expected %d max reconnects, got %d", defaultMaxReconnects, client.maxReconnects)
+	}
+}
+
+func TestWebSocketClient_ReadEvents_HandshakeError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	client := NewWebSocketClient(testWebSocketURL(server), logger)
+
+	resultCh, err := client.ReadEvents(context.Background())
+
+	if err == nil {
+		t.Fatal("expected handshake error, got nil")
+	}
+	if resultCh != nil {
+		t.Errorf("expected nil channel on handshake error, got %v", resultCh)
+	}
+	if !strings.Contains(err.Error(), "failed to connect to stream") {
+		t.Errorf("expected error to contain %q, got: %v", "failed to connect to stream", err)
+	}
+}
+
+func TestWebSocketClient_ReadEvents_Messages(t *testing.T) {
+	server := testWebSocketServer(t, func(conn *testServerConn) {
+		conn.writeText(`{"tweet":{"timestamp":1554324856,"likes":636938}}`)
+		conn.writeText("") // Keep-alive, should be skipped
+		conn.writeText(`{"instagram_media":{"timestamp":1633974046,"comments":386963}}`)
+
+		// Fragmented message: text frame followed by a continuation frame
+		conn.writeFrame(false, opText, []byte(`{"youtube_video":{"timestamp":`))
+		conn.writeFrame(true, opContinuation, []byte(`1633974046,"likes":12}}`))
+
+		// Block until the client closes the connection
+		for {
+			if _, _, err := conn.readFrame(); err != nil {
+				return
+			}
+		}
+	})
+	defer server.Close()
+
+	client := NewWebSocketClient(testWebSocketURL(server), logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	resultCh, err := client.ReadEvents(ctx)
+	if err != nil {
+		t.Fatalf("expected no error on connection, got %v", err)
+	}
+
+	posts, errs := drainPosts(t, resultCh)
+
+	if len(errs) != 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+	if posts != 3 {
+		t.Errorf("expected 3 posts, got %d", posts)
+	}
+}
+
+func TestWebSocketClient_ReadEvents_PingPong(t *testing.T) {
+	pongCh := make(chan string, 1)
+
+	server := testWebSocketServer(t, func(conn *testServerConn) {
+		conn.writeFrame(true, opPing, []byte("heartbeat"))
+
+		opcode, payload, err := conn.readFrame()
+		if err == nil && opcode == opPong {
+			pongCh <- string(payload)
+		}
+
+		conn.writeText(`{"tweet":{"timestamp":1554324856,"likes":636938}}`)
+
+		for {
+			if _, _, err := conn.readFrame(); err != nil {
+				return
+			}
+		}
+	})
+	defer server.Close()
+
+	client := NewWebSocketClient(testWebSocketURL(server), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resultCh, err := client.ReadEvents(ctx)
+	if err != nil {
+		t.Fatalf("expected no error on connection, got %v", err)
+	}
+
+	select {
+	case payload := <-pongCh:
+		if payload != "heartbeat" {
+			t.Errorf("expected pong payload %q, got %q", "heartbeat", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected pong in response to ping")
+	}
+
+	result := <-resultCh
+	if result.Post == nil {
+		t.Fatalf("expected post after ping/pong, got %+v", result)
+	}
+}
+
+func TestWebSocketClient_ReadEvents_CloseFrameReconnect(t *testing.T) {
+	var connections atomic.Int32
+	closeReplyCh := make(chan uint16, 1)
+	var extraFrames atomic.Int32
+
+	server := testWebSocketServer(t, func(conn *testServerConn) {
+		if connections.Add(1) == 1 {
+			// First connection: send one post, then close with "going away"
+			conn.writeText(`{"tweet":{"timestamp":1554324856,"likes":636938}}`)
+			conn.writeFrame(true, opClose, binary.BigEndian.AppendUint16(nil, 1001))
+
+			opcode, payload, err := conn.readFrame()
+			if err == nil && opcode == opClose && len(payload) >= 2 {
+				closeReplyCh <- binary.BigEndian.Uint16(payload)
+			}
+
+			// Nothing may follow the close reply, the client only closes the connection
+			for {
+				if _, _, err := conn.readFrame(); err != nil {
+					return
+				}
+				extraFrames.Add(1)
+			}
+		}
+
+		// Subsequent connections: send another post
+		conn.writeText(`{"tweet":{"timestamp":1633974046,"likes":386963}}`)
+
+		for {
+			if _, _, err := conn.readFrame(); err != nil {
+				return
+			}
+		}
+	})
+	defer server.Close()
+
+	client := NewWebSocketClient(testWebSocketURL(server), logger)
+	client.reconnectDelay = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	resultCh, err := client.ReadEvents(ctx)
+	if err != nil {
+		t.Fatalf("expected no error on connection, got %v", err)
+	}
+
+	posts, errs := drainPosts(t, resultCh)
+
+	if len(errs) != 0 {
+		t.Errorf("expected no errors after reconnect, got %v", errs)
+	}
+	if posts != 2 {
+		t.Errorf("expected 2 posts across reconnect, got %d", posts)
+	}
+	if connections.Load() != 2 {
+		t.Errorf("expected 2 connections, got %d", connections.Load())
+	}
+
+	select {
+	case code := <-closeReplyCh:
+		if code != 1001 {
+			t.Errorf("expected close reply to echo code 1001, got %d", code)
+		}
+	default:
+		t.Error("expected client to acknowledge the close frame")
+	}
+	if n := extraFrames.Load(); n != 0 {
+		t.Errorf("expected no frame after the close reply, got %d", n)
+	}
+}
+
+func TestWebSocketClient_ReadEvents_ReconnectExhausted(t *testing.T) {
+	var connections atomic.Int32
+
+	upgrader := testWebSocketServer(t, func(conn *testServerConn) {
+		conn.writeFrame(true, opClose, binary.BigEndian.AppendUint16(nil, 1011))
+	})
+	defer upgrader.Close()
+
+	// Only the first handshake succeeds, every reconnection attempt is refused
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if connections.Add(1) == 1 {
+			upgrader.Config.Handler.ServeHTTP(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewWebSocketClient(testWebSocketURL(server), logger)
+	client.maxReconnects = 2
+	client.reconnectDelay = 5 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	resultCh, err := client.ReadEvents(ctx)
+	if err != nil {
+		t.Fatalf("expected no error on connection, got %v", err)
+	}
+
+	_, errs := drainPosts(t, resultCh)
+
+	if len(errs) != 1 {
+		t.Fatalf("expected exactly 1 error, got %v", errs)
+	}
+	if !strings.Contains(errs[0].Error(), "reconnect failed after 2 attempts") {
+		t.Errorf("expected reconnect failure, got: %v", errs[0])
+	}
+	if connections.Load() != 3 {
+		t.Errorf("expected 1 connection and 2 reconnection attempts, got %d", connections.Load())
+	}
+}
+
+func TestWebSocketClient_ReadEvents_ParseError(t *testing.T) {
+	var connections atomic.Int32
+
+	server := testWebSocketServer(t, func(conn *testServerConn) {
+		connections.Add(1)
+
+		conn.writeText(`{"tweet":{"timestamp":1554324856,"likes":636938}}`)
+		conn.writeText(`{invalid json}`)
+		conn.writeText(`{"tweet":{"timestamp":1554324857,"likes":10}}`)
+
+		for {
+			if _, _, err := conn.readFrame(); err != nil {
+				return
+			}
+		}
+	})
+	defer server.Close()
+
+	client := NewWebSocketClient(testWebSocketURL(server), logger)
+	client.reconnectDelay = 5 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	resultCh, err := client.ReadEvents(ctx)
+	if err != nil {
+		t.Fatalf("expected no error on connection, got %v", err)
+	}
+
+	posts, errs := drainPosts(t, resultCh)
+
+	// The malformed message is counted and skipped, on the same connection
+	if posts != 2 {
+		t.Errorf("expected the 2 valid posts, got %d", posts)
+	}
+	if len(errs) != 0 {
+		t.Errorf("expected no error, got %v", errs)
+	}
+	if connections.Load() != 1 {
+		t.Errorf("expected no reconnection on parse error, got %d connections", connections.Load())
+	}
+	if health := client.StreamHealth(); health.ParseErrors != 1 {
+		t.Errorf("expected 1 parse error, got %d", health.ParseErrors)
+	}
+}
+
+func TestWebSocketClient_ReadEvents_ContextCancellation(t *testing.T) {
+	closeCodeCh := make(chan uint16, 1)
+
+	server := testWebSocketServer(t, func(conn *testServerConn) {
+		conn.writeText(`{"tweet":{"timestamp":1554324856,"likes":636938}}`)
+
+		// Wait for the client closing handshake
+		for {
+			opcode, payload, err := conn.readFrame()
+			if err != nil {
+				return
+			}
+			if opcode == opClose && len(payload) >= 2 {
+				closeCodeCh <- binary.BigEndian.Uint16(payload)
+				return
+			}
+		}
+	})
+	defer server.Close()
+
+	client := NewWebSocketClient(testWebSocketURL(server), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	resultCh, err := client.ReadEvents(ctx)
+	if err != nil {
+		t.Fatalf("expected no error on connection, got %v", err)
+	}
+
+	// Read first post
+	result := <-resultCh
+	if result.Post == nil {
+		t.Fatal("expected first post")
+	}
+
+	// Cancel context
+	cancel()
+
+	posts, errs := drainPosts(t, resultCh)
+	if posts != 0 || len(errs) != 0 {
+		t.Errorf("expected channel to close without further results, got %d posts and %v", posts, errs)
+	}
+
+	select {
+	case code := <-closeCodeCh:
+		if code != closeNormal {
+			t.Errorf("expected normal closure code %d, got %d", closeNormal, code)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("expected client to send a close frame on cancellation")
+	}
+}
+
+func TestWebSocketClient_ReadEvents_Headers(t *testing.T) {
+	headersCh := make(chan http.Header, 1)
+
+	upgrader := testWebSocketServer(t, func(conn *testServerConn) {})
+	defer upgrader.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headersCh <- r.Header.Clone()
+		upgrader.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	headers := http.Header{}
+	headers.Set("Authorization", "Basic dXNlcjpwYXNz")
+	headers.Set("Upgrade", "h2c") // Must not override the WebSocket protocol header
+
+	client := NewWebSocketClient(testWebSocketURL(server), logger, WithWebSocketHeaders(headers))
+	client.maxReconnects = 0
+
+	resultCh, err := client.ReadEvents(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error on connection, got %v", err)
+	}
+	drainPosts(t, resultCh)
+
+	received := <-headersCh
+	if received.Get("Authorization") != "Basic dXNlcjpwYXNz" {
+		t.Errorf("expected Authorization header, got %q", received.Get("Authorization"))
+	}
+	if received.Get("Upgrade") != "websocket" {
+		t.Errorf("expected Upgrade header websocket, got %q", received.Get("Upgrade"))
+	}
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"maps"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// windowBucket holds the statistics of the posts received during one second
+type windowBucket struct {
+	second int64
+	posts  int
+	sums   map[string]uint64
+	counts map[string]int
+}
+
+// windowStats are the statistics of the posts received during a window
+type windowStats struct {
+	posts  int
+	sums   map[string]uint64
+	counts map[string]int
+}
+
+// slidingWindow keeps per-second statistics of the recent posts in a ring of buckets,
+// so that the statistics of any window within its span are computed without storing posts
+type slidingWindow struct {
+	buckets []windowBucket
+}
+
+// newSlidingWindow creates a new sliding window covering at least the given span
+func newSlidingWindow(span time.Duration) *slidingWindow {
+	size := int((span+time.Second-1)/time.Second) + 1
+	return &slidingWindow{
+		buckets: make([]windowBucket, size),
+	}
+}
+
+// add records a post received at the given time
+func (w *slidingWindow) add(at time.Time, post *models.PostPayload) {
+	second := at.Unix()
+	bucket := &w.buckets[second%int64(len(w.buckets))]
+
+	// The bucket still holds an older second, recycle it
+	if bucket.second != second || bucket.sums == nil {
+		*bucket = windowBucket{
+			second: second,
+			sums:   make(map[string]uint64),
+			counts: make(map[string]int),
+		}
+	}
+
+	bucket.posts++
+	for dimension := range models.ValidDimensions {
+		if value, ok := post.GetDimensionValue(dimension); ok {
+			bucket.sums[dimension] += value
+			bucket.counts[dimension]++
+		}
+	}
+}
+
+// stats returns the statistics of the window of the given span ending at end (included).
+// The part of the window older than the span of the sliding window is ignored.
+func (w *slidingWindow) stats(end time.Time, span time.Duration) windowStats {
+	stats := windowStats{
+		sums:   make(map[string]uint64),
+		counts: make(map[string]int),
+	}
+
+	last := end.Unix()
+	first := max(last-int64(span/time.Second)+1, last-int64(len(w.buckets))+1)
+
+	for second := first; second <= last; second++ {
+		bucket := &w.buckets[second%int64(len(w.buckets))]
+		if bucket.second != second || bucket.sums == nil {
+			continue
+		}
+
+		stats.posts += bucket.posts
+		for dimension, sum := range bucket.sums {
+			stats.sums[dimension] += sum
+			stats.counts[dimension] += bucket.counts[dimension]
+		}
+	}
+
+	return stats
+}
+
+// metric returns the value of a metric over the window and whether the window has data for it.
+// The metric is "total_posts" or "avg_<dimension>".
+func (s windowStats) metric(metric string) (float64, bool) {
+	if metric == models.MetricTotalPosts {
+		return float64(s.posts), s.posts > 0
+	}
+
+	dimension := metric[len(models.MetricAveragePrefix):]
+	if s.counts[dimension] == 0 {
+		return 0, false
+	}
+	return float64(s.sums[dimension]) / float64(s.counts[dimension]), true
+}
+
+// span returns the span covered by the window
+func (w *slidingWindow) span() time.Duration {
+	return time.Duration(len(w.buckets)-1) * time.Second
+}
+
+// copyFrom copies the buckets of another window, keeping the most recent second of every bucket of this window
+func (w *slidingWindow) copyFrom(other *slidingWindow) {
+	for _, bucket := range other.buckets {
+		if bucket.sums == nil {
+			continue
+		}
+
+		target := &w.buckets[bucket.second%int64(len(w.buckets))]
+		if target.sums != nil && target.second >= bucket.second {
+			continue
+		}
+		*target = windowBucket{
+			second: bucket.second,
+			posts:  bucket.posts,
+			sums:   maps.Clone(bucket.sums),
+			counts: maps.Clone(bucket.counts),
+		}
+	}
+}
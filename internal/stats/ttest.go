@@ -0,0 +1,132 @@
+// Package stats implements the statistical tests used to compare analyses.
+package stats
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrInsufficientData is returned when the samples cannot be compared
+var ErrInsufficientData = errors.New("each sample needs at least 2 values, and the samples cannot both be constant")
+
+// Summary describes a sample by its size, mean and unbiased variance
+type Summary struct {
+	N        int64
+	Mean     float64
+	Variance float64
+}
+
+// TTest is the outcome of a t-test
+type TTest struct {
+	// T is positive when the mean of the second sample is greater
+	T float64
+
+	DegreesOfFreedom float64
+
+	// PValue is the two-sided probability of a difference at least this large if the means were equal
+	PValue float64
+}
+
+// WelchTTest tests whether two samples have the same mean, without assuming they have the same variance.
+// The degrees of freedom are approximated with the Welch-Satterthwaite equation.
+func WelchTTest(a, b Summary) (TTest, error) {
+	if a.N < 2 || b.N < 2 {
+		return TTest{}, ErrInsufficientData
+	}
+
+	varA := a.Variance / float64(a.N)
+	varB := b.Variance / float64(b.N)
+	standardError2 := varA + varB
+	if standardError2 == 0 {
+		return TTest{}, ErrInsufficientData
+	}
+
+	t := (b.Mean - a.Mean) / math.Sqrt(standardError2)
+	df := standardError2 * standardError2 / (varA*varA/float64(a.N-1) + varB*varB/float64(b.N-1))
+
+	return TTest{
+		T:                t,
+		DegreesOfFreedom: df,
+		PValue:           studentTwoSided(t, df),
+	}, nil
+}
+
+// studentTwoSided returns the two-sided p-value of t under a Student's t distribution with df degrees of freedom
+func studentTwoSided(t, df float64) float64 {
+	return regularizedIncompleteBeta(df/(df+t*t), df/2, 0.5)
+}
+
+// regularizedIncompleteBeta returns I_x(a, b), evaluated with a continued fraction (Lentz's method)
+func regularizedIncompleteBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+
+	lgammaA, _ := math.Lgamma(a)
+	lgammaB, _ := math.Lgamma(b)
+	lgammaAB, _ := math.Lgamma(a + b)
+	front := math.Exp(lgammaAB - lgammaA - lgammaB + a*math.Log(x) + b*math.Log(1-x))
+
+	// The continued fraction converges quickly for x below the mean of the distribution, use the symmetry otherwise
+	if x > (a+1)/(a+b+2) {
+		return 1 - front*betaContinuedFraction(1-x, b, a)/b
+	}
+	return front * betaContinuedFraction(x, a, b) / a
+}
+
+// betaContinuedFraction evaluates the continued fraction of the incomplete beta function
+func betaContinuedFraction(x, a, b float64) float64 {
+	const (
+		maxIterations = 300
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	result := d
+
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+
+		// Even step
+		numerator := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		result *= d * c
+
+		// Odd step
+		numerator = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		result *= delta
+
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,75 @@
+package stats
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestStudentTwoSided(t *testing.T) {
+	tests := []struct {
+		t, df    float64
+		expected float64
+	}{
+		{0, 10, 1},
+		{2, 10, 0.07338803},
+		{2.228139, 10, 0.05},
+		{12.706205, 1, 0.05},
+		{1.959964, 1e6, 0.05},
+		{-2, 10, 0.07338803},
+	}
+
+	for _, tt := range tests {
+		if p := studentTwoSided(tt.t, tt.df); math.Abs(p-tt.expected) > 1e-6 {
+			t.Errorf("t=%v df=%v: expected p-value %v, got %v", tt.t, tt.df, tt.expected, p)
+		}
+	}
+}
+
+func TestWelchTTest(t *testing.T) {
+	a := Summary{N: 10, Mean: 20, Variance: 4}
+	b := Summary{N: 10, Mean: 22, Variance: 4}
+
+	result, err := WelchTTest(a, b)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Equal sizes and variances: t = 2 / sqrt(0.8), df = 18
+	if math.Abs(result.T-2.236068) > 1e-6 {
+		t.Errorf("expected t 2.236068, got %v", result.T)
+	}
+	if math.Abs(result.DegreesOfFreedom-18) > 1e-9 {
+		t.Errorf("expected 18 degrees of freedom, got %v", result.DegreesOfFreedom)
+	}
+	if result.PValue < 0.03 || result.PValue > 0.05 {
+		t.Errorf("expected a p-value around 0.038, got %v", result.PValue)
+	}
+
+	// Unequal variances reduce the degrees of freedom
+	result, err = WelchTTest(Summary{N: 10, Mean: 20, Variance: 1}, Summary{N: 30, Mean: 20, Variance: 100})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.T != 0 || result.PValue != 1 || result.DegreesOfFreedom >= 38 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestWelchTTest_InsufficientData(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Summary
+	}{
+		{"single value", Summary{N: 1, Mean: 5}, Summary{N: 10, Mean: 5, Variance: 1}},
+		{"constant samples", Summary{N: 5, Mean: 5}, Summary{N: 5, Mean: 6}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := WelchTTest(tt.a, tt.b); !errors.Is(err, ErrInsufficientData) {
+				t.Errorf("expected ErrInsufficientData, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,514 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+const (
+	// DefaultSegmentDuration is the span of post timestamps covered by a segment when not configured
+	DefaultSegmentDuration = time.Hour
+
+	// Segment files are named after the first post timestamp they cover.
+	// New posts are appended to the active file, compaction merges it into the compacted file.
+	activeSegmentSuffix    = ".jsonl"
+	compactedSegmentSuffix = ".compacted.jsonl"
+)
+
+// PostArchive defines the raw post archive interface
+type PostArchive interface {
+	Append(posts []models.PostPayload) error
+	Scan(ctx context.Context, from, to time.Time, fn func(post *models.PostPayload) error) error
+}
+
+// ArchiveRetention bounds the size of the archive (no bound when zero)
+type ArchiveRetention struct {
+	// MaxAge drops the posts whose timestamp is older than this
+	MaxAge time.Duration
+
+	// MaxBytes drops the oldest segments once the archive grows larger than this
+	MaxBytes int64
+}
+
+// segment is a span of post timestamps [start, start + segment duration) stored in up to two files
+type segment struct {
+	start     int64
+	active    bool
+	compacted bool
+}
+
+// FileArchive is a segmented on-disk post archive.
+// Posts are stored as JSONL in segment files covering a fixed span of post timestamps,
+// so that a time-range query only reads the segments overlapping the range.
+// Posts are appended in arrival order, compaction sorts them by timestamp and drops duplicates.
+type FileArchive struct {
+	dir             string
+	segmentDuration time.Duration
+	retention       ArchiveRetention
+	logger          *slog.Logger
+	now             func() time.Time
+
+	// Appends and compactions take the write lock, scans the read lock while they list the segments and open their files
+	mu       sync.RWMutex
+	segments map[int64]*segment
+}
+
+// Check interface implementation at compile-time
+var _ PostArchive = &FileArchive{}
+
+// OpenFileArchive opens (or creates) the archive directory and lists its segments
+func OpenFileArchive(dir string, segmentDuration time.Duration, retention ArchiveRetention, logger *slog.Logger) (*FileArchive, error) {
+	if segmentDuration <= 0 {
+		segmentDuration = DefaultSegmentDuration
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	a := &FileArchive{
+		dir:             dir,
+		segmentDuration: segmentDuration,
+		retention:       retention,
+		logger:          logger,
+		now:             time.Now,
+		segments:        make(map[int64]*segment),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archive: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		var suffix string
+		switch {
+		case strings.HasSuffix(name, compactedSegmentSuffix):
+			suffix = compactedSegmentSuffix
+		case strings.HasSuffix(name, activeSegmentSuffix):
+			suffix = activeSegmentSuffix
+		default:
+			continue
+		}
+
+		start, err := strconv.ParseInt(strings.TrimSuffix(name, suffix), 10, 64)
+		if err != nil {
+			a.logger.Warn("Ignoring unknown archive file", "path", filepath.Join(dir, name))
+			continue
+		}
+
+		seg := a.segment(start)
+		if suffix == compactedSegmentSuffix {
+			seg.compacted = true
+		} else {
+			seg.active = true
+		}
+	}
+
+	return a, nil
+}
+
+// segment returns the segment starting at start, creating it if needed.
+// Must be called with the write lock held.
+func (a *FileArchive) segment(start int64) *segment {
+	seg, ok := a.segments[start]
+	if !ok {
+		seg = &segment{start: start}
+		a.segments[start] = seg
+	}
+	return seg
+}
+
+// segmentStart returns the start of the segment covering a post timestamp
+func (a *FileArchive) segmentStart(timestamp int64) int64 {
+	span := int64(a.segmentDuration.Seconds())
+	start := timestamp - timestamp%span
+	if timestamp < 0 && timestamp%span != 0 {
+		start -= span
+	}
+	return start
+}
+
+// segmentPath returns the path of a segment file
+func (a *FileArchive) segmentPath(start int64, suffix string) string {
+	return filepath.Join(a.dir, strconv.FormatInt(start, 10)+suffix)
+}
+
+// Append archives a batch of posts.
+// Posts older than the retention max age are dropped, they would be expired anyway.
+func (a *FileArchive) Append(posts []models.PostPayload) error {
+	// Group the posts by segment, so that each segment file is opened once per batch
+	batches := make(map[int64]*bytes.Buffer)
+
+	var cutoff int64
+	if a.retention.MaxAge > 0 {
+		cutoff = a.now().Add(-a.retention.MaxAge).Unix()
+	}
+
+	for _, post := range posts {
+		if post.Data.Timestamp < cutoff {
+			continue
+		}
+
+		line, err := json.Marshal(post)
+		if err != nil {
+			return fmt.Errorf("failed to encode post: %w", err)
+		}
+
+		start := a.segmentStart(post.Data.Timestamp)
+		batch, ok := batches[start]
+		if !ok {
+			batch = &bytes.Buffer{}
+			batches[start] = batch
+		}
+		batch.Write(line)
+		batch.WriteByte('\n')
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for start, batch := range batches {
+		file, err := os.OpenFile(a.segmentPath(start, activeSegmentSuffix), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open archive segment: %w", err)
+		}
+
+		_, err = file.Write(batch.Bytes())
+		closeErr := file.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write archive segment: %w", err)
+		}
+		if closeErr != nil {
+			return fmt.Errorf("failed to close archive segment: %w", closeErr)
+		}
+
+		a.segment(start).active = true
+	}
+
+	return nil
+}
+
+// Scan calls fn for every archived post whose timestamp is in [from, to).
+// A zero from or to leaves the range unbounded on that side.
+// Segments are visited in timestamp order, posts within a segment are in timestamp order once compacted.
+// The read lock is only held to list the segments and to open the files of each one, never while fn runs:
+// an open file outlives its compaction or pruning, so that a slow reader never blocks the appends and the maintenance.
+func (a *FileArchive) Scan(ctx context.Context, from, to time.Time, fn func(post *models.PostPayload) error) error {
+	a.mu.RLock()
+	segments := a.sortedSegments()
+	a.mu.RUnlock()
+
+	span := int64(a.segmentDuration.Seconds())
+
+	for _, seg := range segments {
+		if !from.IsZero() && seg.start+span <= from.Unix() {
+			continue
+		}
+		if !to.IsZero() && seg.start >= to.Unix() {
+			break
+		}
+
+		if err := a.scanSegment(ctx, seg.start, from, to, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanSegment calls fn for every post of the segment starting at start whose timestamp is in [from, to).
+// The files of the segment are opened together under the read lock, so that a compaction in between cannot hide or repeat posts.
+func (a *FileArchive) scanSegment(ctx context.Context, start int64, from, to time.Time, fn func(post *models.PostPayload) error) error {
+	var files []*os.File
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+
+	a.mu.RLock()
+	seg, ok := a.segments[start]
+	if !ok {
+		// Pruned since the segments were listed
+		a.mu.RUnlock()
+		return nil
+	}
+	for _, path := range a.segmentFiles(seg) {
+		file, err := os.Open(path)
+		if err != nil {
+			a.mu.RUnlock()
+			return fmt.Errorf("failed to open archive segment: %w", err)
+		}
+		files = append(files, file)
+	}
+	a.mu.RUnlock()
+
+	for _, file := range files {
+		if err := a.scanPosts(ctx, file, file.Name(), from, to, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sortedSegments returns the segments ordered by start.
+// Must be called with the lock held.
+func (a *FileArchive) sortedSegments() []*segment {
+	segments := make([]*segment, 0, len(a.segments))
+	for _, seg := range a.segments {
+		segments = append(segments, seg)
+	}
+	slices.SortFunc(segments, func(x, y *segment) int {
+		return cmp.Compare(x.start, y.start)
+	})
+	return segments
+}
+
+// segmentFiles returns the paths of the files of a segment
+func (a *FileArchive) segmentFiles(seg *segment) []string {
+	var paths []string
+	if seg.compacted {
+		paths = append(paths, a.segmentPath(seg.start, compactedSegmentSuffix))
+	}
+	if seg.active {
+		paths = append(paths, a.segmentPath(seg.start, activeSegmentSuffix))
+	}
+	return paths
+}
+
+// scanFile calls fn for every post of a segment file whose timestamp is in [from, to).
+// Malformed lines, such as a line truncated by a crash, are skipped.
+func (a *FileArchive) scanFile(ctx context.Context, path string, from, to time.Time, fn func(post *models.PostPayload) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive segment: %w", err)
+	}
+	defer file.Close()
+
+	return a.scanPosts(ctx, file, path, from, to, fn)
+}
+
+// scanPosts calls fn for every post read from r whose timestamp is in [from, to), the path identifies r in the logs
+func (a *FileArchive) scanPosts(ctx context.Context, r io.Reader, path string, from, to time.Time, fn func(post *models.PostPayload) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var post models.PostPayload
+		if err := json.Unmarshal(scanner.Bytes(), &post); err != nil {
+			a.logger.Warn("Skipping malformed archived post", "path", path, "err", err)
+			continue
+		}
+
+		if !from.IsZero() && post.Data.Timestamp < from.Unix() {
+			continue
+		}
+		if !to.IsZero() && post.Data.Timestamp >= to.Unix() {
+			continue
+		}
+
+		if err := fn(&post); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read archive segment: %w", err)
+	}
+
+	return nil
+}
+
+// Compact merges the active file of every segment into its compacted file,
+// sorting the posts by timestamp and dropping duplicates.
+// Returns the number of compacted segments.
+func (a *FileArchive) Compact() (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	compacted := 0
+	for _, seg := range a.sortedSegments() {
+		if !seg.active {
+			continue
+		}
+
+		if err := a.compactSegment(seg); err != nil {
+			return compacted, err
+		}
+		compacted++
+	}
+
+	if compacted > 0 {
+		a.logger.Info("Compacted post archive", "dir", a.dir, "segments", compacted)
+	}
+
+	return compacted, nil
+}
+
+// compactSegment rewrites a segment as a single sorted compacted file.
+// The new file is written next to the old ones and renamed over the compacted file, so that a crash leaves the posts intact.
+// Must be called with the write lock held.
+func (a *FileArchive) compactSegment(seg *segment) error {
+	type archivedPost struct {
+		timestamp int64
+		line      []byte
+	}
+
+	var posts []archivedPost
+	seen := make(map[string]bool)
+
+	for _, path := range a.segmentFiles(seg) {
+		err := a.scanFile(context.Background(), path, time.Time{}, time.Time{}, func(post *models.PostPayload) error {
+			line, err := json.Marshal(post)
+			if err != nil {
+				return fmt.Errorf("failed to encode post: %w", err)
+			}
+			if seen[string(line)] {
+				return nil
+			}
+			seen[string(line)] = true
+			posts = append(posts, archivedPost{timestamp: post.Data.Timestamp, line: line})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	slices.SortStableFunc(posts, func(x, y archivedPost) int {
+		return cmp.Compare(x.timestamp, y.timestamp)
+	})
+
+	tmp, err := os.CreateTemp(a.dir, strconv.FormatInt(seg.start, 10)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create compacted segment: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	for _, post := range posts {
+		writer.Write(post.line)
+		writer.WriteByte('\n')
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write compacted segment: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync compacted segment: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close compacted segment: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), a.segmentPath(seg.start, compactedSegmentSuffix)); err != nil {
+		return fmt.Errorf("failed to replace compacted segment: %w", err)
+	}
+	seg.compacted = true
+
+	// The active posts are in the compacted file now
+	if err := os.Remove(a.segmentPath(seg.start, activeSegmentSuffix)); err != nil {
+		return fmt.Errorf("failed to remove compacted archive segment: %w", err)
+	}
+	seg.active = false
+
+	return nil
+}
+
+// Prune drops the segments outside of the retention policy.
+// Returns the number of dropped segments.
+func (a *FileArchive) Prune() (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	segments := a.sortedSegments()
+	span := int64(a.segmentDuration.Seconds())
+	dropFrom := 0
+
+	// Drop the segments whose posts are all older than the max age
+	if a.retention.MaxAge > 0 {
+		cutoff := a.now().Add(-a.retention.MaxAge).Unix()
+		for dropFrom < len(segments) && segments[dropFrom].start+span <= cutoff {
+			dropFrom++
+		}
+	}
+
+	// Then drop the oldest segments until the archive fits in the max size
+	if a.retention.MaxBytes > 0 {
+		sizes := make([]int64, len(segments))
+		var total int64
+		for i, seg := range segments[dropFrom:] {
+			for _, path := range a.segmentFiles(seg) {
+				if info, err := os.Stat(path); err == nil {
+					sizes[dropFrom+i] += info.Size()
+				}
+			}
+			total += sizes[dropFrom+i]
+		}
+
+		for dropFrom < len(segments) && total > a.retention.MaxBytes {
+			total -= sizes[dropFrom]
+			dropFrom++
+		}
+	}
+
+	for _, seg := range segments[:dropFrom] {
+		for _, path := range a.segmentFiles(seg) {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return 0, fmt.Errorf("failed to remove archive segment: %w", err)
+			}
+		}
+		delete(a.segments, seg.start)
+	}
+
+	if dropFrom > 0 {
+		a.logger.Info("Pruned post archive", "dir", a.dir, "dropped_segments", dropFrom, "kept_segments", len(a.segments))
+	}
+
+	return dropFrom, nil
+}
+
+// RunMaintenance compacts and prunes the archive at every interval until the context is cancelled
+func (a *FileArchive) RunMaintenance(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := a.Prune(); err != nil {
+				a.logger.Error("Failed to prune post archive", "err", err)
+			}
+			if _, err := a.Compact(); err != nil {
+				a.logger.Error("Failed to compact post archive", "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// testPost creates a post with a timestamp and a number of likes
+func testPost(timestamp int64, likes float64) models.PostPayload {
+	return models.PostPayload{
+		Type: "instagram_media",
+		Data: models.Post{
+			Timestamp: timestamp,
+			Details:   map[string]interface{}{"likes": likes},
+		},
+	}
+}
+
+// scanTimestamps returns the timestamps of the archived posts in [from, to), in scan order
+func scanTimestamps(t *testing.T, archive *FileArchive, from, to time.Time) []int64 {
+	t.Helper()
+
+	timestamps := []int64{}
+	err := archive.Scan(context.Background(), from, to, func(post *models.PostPayload) error {
+		timestamps = append(timestamps, post.Data.Timestamp)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	return timestamps
+}
+
+func equalTimestamps(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFileArchive_Scan(t *testing.T) {
+	archive, err := OpenFileArchive(t.TempDir(), time.Hour, ArchiveRetention{}, testLogger())
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+
+	// Posts spread over three one-hour segments, out of order
+	base := int64(1705312800) // 2024-01-15T10:00:00Z
+	posts := []models.PostPayload{
+		testPost(base+7200+10, 5),
+		testPost(base+30, 1),
+		testPost(base+3600+5, 3),
+		testPost(base+10, 2),
+	}
+	if err := archive.Append(posts); err != nil {
+		t.Fatalf("failed to append posts: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		from     time.Time
+		to       time.Time
+		expected []int64
+	}{
+		{
+			name:     "unbounded range",
+			expected: []int64{base + 30, base + 10, base + 3605, base + 7210},
+		},
+		{
+			name:     "range within a segment",
+			from:     time.Unix(base+20, 0),
+			to:       time.Unix(base+3600, 0),
+			expected: []int64{base + 30},
+		},
+		{
+			name:     "range across segments",
+			from:     time.Unix(base+3600, 0),
+			to:       time.Unix(base+7211, 0),
+			expected: []int64{base + 3605, base + 7210},
+		},
+		{
+			name:     "empty range",
+			from:     time.Unix(base+8000, 0),
+			expected: []int64{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			timestamps := scanTimestamps(t, archive, tc.from, tc.to)
+			if !equalTimestamps(timestamps, tc.expected) {
+				t.Errorf("expected timestamps %v, got %v", tc.expected, timestamps)
+			}
+		})
+	}
+}
+
+func TestFileArchive_Scan_RoundTrip(t *testing.T) {
+	archive, err := OpenFileArchive(t.TempDir(), time.Hour, ArchiveRetention{}, testLogger())
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+
+	if err := archive.Append([]models.PostPayload{testPost(1705312800, 42)}); err != nil {
+		t.Fatalf("failed to append posts: %v", err)
+	}
+
+	var got *models.PostPayload
+	archive.Scan(context.Background(), time.Time{}, time.Time{}, func(post *models.PostPayload) error {
+		got = post
+		return nil
+	})
+
+	// Archived posts must come back as they were parsed from the stream
+	if got == nil {
+		t.Fatal("expected an archived post")
+	}
+	if got.Type != "instagram_media" {
+		t.Errorf("expected type instagram_media, got %q", got.Type)
+	}
+	if likes, ok := got.GetDimensionValue("likes"); !ok || likes != 42 {
+		t.Errorf("expected 42 likes, got %d (found: %v)", likes, ok)
+	}
+}
+
+func TestFileArchive_Scan_StopsOnError(t *testing.T) {
+	archive, err := OpenFileArchive(t.TempDir(), time.Hour, ArchiveRetention{}, testLogger())
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	archive.Append([]models.PostPayload{testPost(1705312800, 1), testPost(1705312801, 2)})
+
+	stopErr := errors.New("stop")
+	calls := 0
+	err = archive.Scan(context.Background(), time.Time{}, time.Time{}, func(post *models.PostPayload) error {
+		calls++
+		return stopErr
+	})
+
+	if !errors.Is(err, stopErr) {
+		t.Errorf("expected the callback error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected scan to stop after 1 post, got %d", calls)
+	}
+}
+
+func TestFileArchive_Scan_DoesNotBlockWriters(t *testing.T) {
+	archive, err := OpenFileArchive(t.TempDir(), time.Hour, ArchiveRetention{}, testLogger())
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	base := int64(1705312800) // 2024-01-15T10:00:00Z
+	archive.Append([]models.PostPayload{testPost(base+2, 1), testPost(base+1, 2), testPost(base+3600, 3)})
+
+	// The segments are compacted while the first post is being consumed
+	compacted := false
+	timestamps := []int64{}
+	err = archive.Scan(context.Background(), time.Time{}, time.Time{}, func(post *models.PostPayload) error {
+		timestamps = append(timestamps, post.Data.Timestamp)
+		if compacted {
+			return nil
+		}
+		compacted = true
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := archive.Compact()
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(2 * time.Second):
+			return errors.New("compaction blocked by the scan")
+		}
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// The segment being read is read as it was, the next one as compacted
+	if expected := []int64{base + 2, base + 1, base + 3600}; !equalTimestamps(timestamps, expected) {
+		t.Errorf("expected %v, got %v", expected, timestamps)
+	}
+}
+
+func TestFileArchive_Compact(t *testing.T) {
+	dir := t.TempDir()
+
+	archive, err := OpenFileArchive(dir, time.Hour, ArchiveRetention{}, testLogger())
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+
+	base := int64(1705312800)
+	archive.Append([]models.PostPayload{testPost(base+30, 1), testPost(base+10, 2)})
+
+	// A duplicate, a truncated line and posts arriving after a first compaction
+	if _, err := archive.Compact(); err != nil {
+		t.Fatalf("failed to compact archive: %v", err)
+	}
+	archive.Append([]models.PostPayload{testPost(base+20, 3), testPost(base+10, 2)})
+
+	file, _ := os.OpenFile(filepath.Join(dir, "1705312800.jsonl"), os.O_WRONLY|os.O_APPEND, 0o644)
+	file.WriteString(`{"instagram_media":{"timest`)
+	file.Close()
+
+	compacted, err := archive.Compact()
+	if err != nil {
+		t.Fatalf("failed to compact archive: %v", err)
+	}
+	if compacted != 1 {
+		t.Errorf("expected 1 compacted segment, got %d", compacted)
+	}
+
+	// Only the compacted file remains, sorted and without duplicates
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "1705312800.compacted.jsonl" {
+		t.Errorf("expected a single compacted segment file, got %v", entries)
+	}
+
+	// The segments are found again when the archive is reopened
+	reopened, err := OpenFileArchive(dir, time.Hour, ArchiveRetention{}, testLogger())
+	if err != nil {
+		t.Fatalf("failed to reopen archive: %v", err)
+	}
+
+	timestamps := scanTimestamps(t, reopened, time.Time{}, time.Time{})
+	expected := []int64{base + 10, base + 20, base + 30}
+	if !equalTimestamps(timestamps, expected) {
+		t.Errorf("expected timestamps %v, got %v", expected, timestamps)
+	}
+}
+
+func TestFileArchive_Prune(t *testing.T) {
+	now := time.Unix(1705312800, 0)
+
+	tests := []struct {
+		name            string
+		retention       ArchiveRetention
+		expectedDropped int
+		expected        []int64
+	}{
+		{
+			name:            "max age",
+			retention:       ArchiveRetention{MaxAge: time.Hour},
+			expectedDropped: 1,
+			expected:        []int64{now.Unix() - 3600, now.Unix()},
+		},
+		{
+			name:            "max bytes",
+			retention:       ArchiveRetention{MaxBytes: 1},
+			expectedDropped: 3,
+			expected:        []int64{},
+		},
+		{
+			name:            "no retention",
+			retention:       ArchiveRetention{},
+			expectedDropped: 0,
+			expected:        []int64{now.Unix() - 7200, now.Unix() - 3600, now.Unix()},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Open without retention first, so that the old posts are accepted
+			dir := t.TempDir()
+			archive, _ := OpenFileArchive(dir, time.Hour, ArchiveRetention{}, testLogger())
+			archive.Append([]models.PostPayload{
+				testPost(now.Unix()-7200, 1),
+				testPost(now.Unix()-3600, 2),
+				testPost(now.Unix(), 3),
+			})
+
+			archive, err := OpenFileArchive(dir, time.Hour, tc.retention, testLogger())
+			if err != nil {
+				t.Fatalf("failed to reopen archive: %v", err)
+			}
+			archive.now = func() time.Time { return now }
+
+			dropped, err := archive.Prune()
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if dropped != tc.expectedDropped {
+				t.Errorf("expected %d dropped segments, got %d", tc.expectedDropped, dropped)
+			}
+
+			timestamps := scanTimestamps(t, archive, time.Time{}, time.Time{})
+			if !equalTimestamps(timestamps, tc.expected) {
+				t.Errorf("expected timestamps %v, got %v", tc.expected, timestamps)
+			}
+		})
+	}
+}
+
+func TestFileArchive_Append_DropsExpiredPosts(t *testing.T) {
+	now := time.Unix(1705312800, 0)
+
+	archive, _ := OpenFileArchive(t.TempDir(), time.Hour, ArchiveRetention{MaxAge: time.Hour}, testLogger())
+	archive.now = func() time.Time { return now }
+
+	archive.Append([]models.PostPayload{testPost(now.Unix()-7200, 1), testPost(now.Unix(), 2)})
+
+	timestamps := scanTimestamps(t, archive, time.Time{}, time.Time{})
+	if !equalTimestamps(timestamps, []int64{now.Unix()}) {
+		t.Errorf("expected only the recent post to be archived, got %v", timestamps)
+	}
+}
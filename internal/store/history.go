@@ -0,0 +1,385 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+const (
+	// DefaultHistoryLimit is the page size used when a query does not set one
+	DefaultHistoryLimit = 50
+
+	// MaxHistoryLimit is the largest page size a query may ask for
+	MaxHistoryLimit = 1000
+)
+
+// ErrRecordNotFound is returned when no history record has the requested identifier
+var ErrRecordNotFound = errors.New("analysis record not found")
+
+// HistoryStore defines the analysis history store interface
+type HistoryStore interface {
+	Append(record models.AnalysisRecord) error
+	Query(query models.HistoryQuery) (*models.HistoryPage, error)
+	Get(id string) (models.AnalysisRecord, error)
+}
+
+// Retention bounds the size of the history (no bound when zero)
+type Retention struct {
+	// MaxAge drops the records completed longer ago than this
+	MaxAge time.Duration
+
+	// MaxRecords keeps only the most recent records
+	MaxRecords int
+}
+
+// historyEntry locates a record in the history file, with the fields queries filter on
+type historyEntry struct {
+	offset      int64
+	length      int
+	id          string
+	source      string
+	dimension   string
+	completedAt time.Time
+}
+
+// FileHistory is an append-only JSONL history store.
+// Every record is one line of the file, and an in-memory index of the line offsets
+// (rebuilt when the file is opened) lets queries filter without decoding every record.
+type FileHistory struct {
+	path      string
+	retention Retention
+	logger    *slog.Logger
+	now       func() time.Time
+
+	mu    sync.Mutex
+	file  *os.File
+	size  int64
+	index []historyEntry
+}
+
+// Check interface implementation at compile-time
+var _ HistoryStore = &FileHistory{}
+
+// OpenFileHistory opens (or creates) the history file and indexes its records.
+// A truncated last line, left by a crash in the middle of a write, is discarded.
+func OpenFileHistory(path string, retention Retention, logger *slog.Logger) (*FileHistory, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	h := &FileHistory{
+		path:      path,
+		retention: retention,
+		logger:    logger,
+		now:       time.Now,
+	}
+
+	if err := h.open(); err != nil {
+		return nil, err
+	}
+
+	if _, err := h.Prune(); err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// open opens the history file and rebuilds the index
+func (h *FileHistory) open() error {
+	file, err := os.OpenFile(h.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+
+	index, size, err := h.buildIndex(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	h.file = file
+	h.size = size
+	h.index = index
+
+	return nil
+}
+
+// buildIndex scans the history file and returns the index and the size of its complete lines.
+// The file is truncated after the last complete line.
+func (h *FileHistory) buildIndex(file *os.File) ([]historyEntry, int64, error) {
+	var index []historyEntry
+	var offset int64
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				h.logger.Warn("Discarding truncated history record", "path", h.path, "offset", offset)
+				if err := file.Truncate(offset); err != nil {
+					return nil, 0, fmt.Errorf("failed to truncate history: %w", err)
+				}
+			}
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read history: %w", err)
+		}
+
+		var record models.AnalysisRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			// Keep the line so that offsets stay valid, but never return it
+			h.logger.Warn("Skipping malformed history record", "path", h.path, "offset", offset, "err", err)
+		} else {
+			index = append(index, historyEntry{
+				offset:      offset,
+				length:      len(line),
+				id:          record.ID,
+				source:      record.Source,
+				dimension:   record.Dimension,
+				completedAt: record.CompletedAt,
+			})
+		}
+
+		offset += int64(len(line))
+	}
+
+	return index, offset, nil
+}
+
+// Append saves a record at the end of the history
+func (h *FileHistory) Append(record models.AnalysisRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode history record: %w", err)
+	}
+	line = append(line, '\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, err := h.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write history record: %w", err)
+	}
+
+	h.index = append(h.index, historyEntry{
+		offset:      h.size,
+		length:      len(line),
+		id:          record.ID,
+		source:      record.Source,
+		dimension:   record.Dimension,
+		completedAt: record.CompletedAt,
+	})
+	h.size += int64(len(line))
+
+	return nil
+}
+
+// Query returns a page of the records matching the query, newest first
+func (h *FileHistory) Query(query models.HistoryQuery) (*models.HistoryPage, error) {
+	if query.Limit <= 0 {
+		query.Limit = DefaultHistoryLimit
+	}
+	query.Limit = min(query.Limit, MaxHistoryLimit)
+	query.Offset = max(query.Offset, 0)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	page := &models.HistoryPage{
+		Records: []models.AnalysisRecord{},
+		Offset:  query.Offset,
+		Limit:   query.Limit,
+	}
+
+	// Walk the index backwards, records are appended in completion order
+	for i := len(h.index) - 1; i >= 0; i-- {
+		entry := h.index[i]
+		if !entry.matches(query) {
+			continue
+		}
+
+		page.Total++
+		if page.Total <= query.Offset || len(page.Records) == query.Limit {
+			continue
+		}
+
+		record, err := h.read(entry)
+		if err != nil {
+			return nil, err
+		}
+		page.Records = append(page.Records, record)
+	}
+
+	if next := query.Offset + query.Limit; next < page.Total {
+		page.NextOffset = &next
+	}
+
+	return page, nil
+}
+
+// Get returns the record with the given identifier
+func (h *FileHistory) Get(id string) (models.AnalysisRecord, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := len(h.index) - 1; i >= 0; i-- {
+		if h.index[i].id == id {
+			return h.read(h.index[i])
+		}
+	}
+
+	return models.AnalysisRecord{}, fmt.Errorf("%w: %s", ErrRecordNotFound, id)
+}
+
+// matches reports whether the entry matches the query filters
+func (e historyEntry) matches(query models.HistoryQuery) bool {
+	if query.Source != "" && e.source != query.Source {
+		return false
+	}
+	if query.Dimension != "" && e.dimension != query.Dimension {
+		return false
+	}
+	if !query.From.IsZero() && e.completedAt.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && !e.completedAt.Before(query.To) {
+		return false
+	}
+	return true
+}
+
+// read decodes the record located by the entry.
+// Must be called with the lock held.
+func (h *FileHistory) read(entry historyEntry) (models.AnalysisRecord, error) {
+	var record models.AnalysisRecord
+
+	line := make([]byte, entry.length)
+	if _, err := h.file.ReadAt(line, entry.offset); err != nil {
+		return record, fmt.Errorf("failed to read history record: %w", err)
+	}
+
+	if err := json.Unmarshal(line, &record); err != nil {
+		return record, fmt.Errorf("failed to decode history record: %w", err)
+	}
+
+	return record, nil
+}
+
+// Prune drops the records outside of the retention policy and compacts the file.
+// Returns the number of dropped records.
+func (h *FileHistory) Prune() (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Records are in completion order, so the expired ones are a prefix of the index
+	keepFrom := 0
+	if h.retention.MaxAge > 0 {
+		cutoff := h.now().Add(-h.retention.MaxAge)
+		for keepFrom < len(h.index) && h.index[keepFrom].completedAt.Before(cutoff) {
+			keepFrom++
+		}
+	}
+	if h.retention.MaxRecords > 0 {
+		keepFrom = max(keepFrom, len(h.index)-h.retention.MaxRecords)
+	}
+
+	// Malformed lines are dropped by the compaction as well
+	var indexedSize int64
+	for _, entry := range h.index {
+		indexedSize += int64(entry.length)
+	}
+	if keepFrom == 0 && indexedSize == h.size {
+		return 0, nil
+	}
+
+	if err := h.compact(h.index[keepFrom:]); err != nil {
+		return 0, err
+	}
+
+	h.logger.Info("Pruned analysis history", "path", h.path, "dropped", keepFrom, "kept", len(h.index))
+
+	return keepFrom, nil
+}
+
+// compact rewrites the history file with the given records only.
+// The new file is written next to the old one and renamed over it, so that a crash leaves either of them intact.
+// Must be called with the lock held.
+func (h *FileHistory) compact(keep []historyEntry) error {
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), filepath.Base(h.path)+".compact-*")
+	if err != nil {
+		return fmt.Errorf("failed to create compacted history: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	for _, entry := range keep {
+		line := make([]byte, entry.length)
+		if _, err := h.file.ReadAt(line, entry.offset); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to read history record: %w", err)
+		}
+		if _, err := writer.Write(line); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write compacted history: %w", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write compacted history: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync compacted history: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close compacted history: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), h.path); err != nil {
+		return fmt.Errorf("failed to replace history: %w", err)
+	}
+
+	// Reopen the compacted file, the offsets have changed
+	h.file.Close()
+	return h.open()
+}
+
+// RunRetention prunes the history at every interval until the context is cancelled
+func (h *FileHistory) RunRetention(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := h.Prune(); err != nil {
+				h.logger.Error("Failed to prune analysis history", "err", err)
+			}
+		}
+	}
+}
+
+// Close closes the history file
+func (h *FileHistory) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.file.Close()
+}
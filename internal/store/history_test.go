@@ -0,0 +1,288 @@
+package store
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+// testLogger creates a logger that discards output for testing
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// testRecord creates a history record completed at the given time
+func testRecord(id, dimension string, completedAt time.Time) models.AnalysisRecord {
+	return models.AnalysisRecord{
+		ID:          id,
+		Source:      "api",
+		Dimension:   dimension,
+		Duration:    "5s",
+		StartedAt:   completedAt.Add(-5 * time.Second),
+		CompletedAt: completedAt,
+		Elapsed:     5,
+		TotalPosts:  10,
+		Average:     42,
+	}
+}
+
+// testHistory opens a history in a temporary directory and fills it with the given records
+func testHistory(t *testing.T, retention Retention, records ...models.AnalysisRecord) (*FileHistory, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "history", "history.jsonl")
+
+	history, err := OpenFileHistory(path, retention, testLogger())
+	if err != nil {
+		t.Fatalf("failed to open history: %v", err)
+	}
+	t.Cleanup(func() { history.Close() })
+
+	for _, record := range records {
+		if err := history.Append(record); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	return history, path
+}
+
+// recordIDs returns the IDs of the records of a page
+func recordIDs(page *models.HistoryPage) []string {
+	ids := []string{}
+	for _, record := range page.Records {
+		ids = append(ids, record.ID)
+	}
+	return ids
+}
+
+func TestFileHistory_Query(t *testing.T) {
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	jobRecord := testRecord("b", "comments", base.Add(time.Hour))
+	jobRecord.Source = "job:hourly"
+
+	history, _ := testHistory(t, Retention{},
+		testRecord("a", "likes", base),
+		jobRecord,
+		testRecord("c", "likes", base.Add(2*time.Hour)),
+		testRecord("d", "likes", base.Add(3*time.Hour)),
+	)
+
+	tests := []struct {
+		name          string
+		query         models.HistoryQuery
+		expectedIDs   []string
+		expectedTotal int
+		expectedNext  int
+	}{
+		{
+			name:          "all records newest first",
+			query:         models.HistoryQuery{},
+			expectedIDs:   []string{"d", "c", "b", "a"},
+			expectedTotal: 4,
+		},
+		{
+			name:          "dimension filter",
+			query:         models.HistoryQuery{Dimension: "likes"},
+			expectedIDs:   []string{"d", "c", "a"},
+			expectedTotal: 3,
+		},
+		{
+			name:          "source filter",
+			query:         models.HistoryQuery{Source: "job:hourly"},
+			expectedIDs:   []string{"b"},
+			expectedTotal: 1,
+		},
+		{
+			name:          "time range filter",
+			query:         models.HistoryQuery{From: base.Add(time.Hour), To: base.Add(3 * time.Hour)},
+			expectedIDs:   []string{"c", "b"},
+			expectedTotal: 2,
+		},
+		{
+			name:          "first page",
+			query:         models.HistoryQuery{Limit: 2},
+			expectedIDs:   []string{"d", "c"},
+			expectedTotal: 4,
+			expectedNext:  2,
+		},
+		{
+			name:          "last page",
+			query:         models.HistoryQuery{Limit: 2, Offset: 2},
+			expectedIDs:   []string{"b", "a"},
+			expectedTotal: 4,
+		},
+		{
+			name:          "offset past the end",
+			query:         models.HistoryQuery{Offset: 10},
+			expectedIDs:   []string{},
+			expectedTotal: 4,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := history.Query(tc.query)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			ids := recordIDs(page)
+			if len(ids) != len(tc.expectedIDs) {
+				t.Fatalf("expected records %v, got %v", tc.expectedIDs, ids)
+			}
+			for i := range ids {
+				if ids[i] != tc.expectedIDs[i] {
+					t.Fatalf("expected records %v, got %v", tc.expectedIDs, ids)
+				}
+			}
+
+			if page.Total != tc.expectedTotal {
+				t.Errorf("expected total %d, got %d", tc.expectedTotal, page.Total)
+			}
+
+			if tc.expectedNext == 0 && page.NextOffset != nil {
+				t.Errorf("expected no next offset, got %d", *page.NextOffset)
+			}
+			if tc.expectedNext != 0 && (page.NextOffset == nil || *page.NextOffset != tc.expectedNext) {
+				t.Errorf("expected next offset %d, got %v", tc.expectedNext, page.NextOffset)
+			}
+		})
+	}
+}
+
+func TestFileHistory_Get(t *testing.T) {
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	history, _ := testHistory(t, Retention{},
+		testRecord("a", "likes", base),
+		testRecord("b", "comments", base.Add(time.Hour)),
+	)
+
+	record, err := history.Get("b")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if record.ID != "b" || record.Dimension != "comments" {
+		t.Errorf("unexpected record: %+v", record)
+	}
+
+	if _, err := history.Get("missing"); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestFileHistory_Reopen(t *testing.T) {
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	history, path := testHistory(t, Retention{},
+		testRecord("a", "likes", base),
+		testRecord("b", "likes", base.Add(time.Hour)),
+	)
+	history.Close()
+
+	// Simulate a malformed line and a crash in the middle of a write
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("failed to open history file: %v", err)
+	}
+	file.WriteString("not json\n")
+	file.WriteString(`{"id":"trunc`)
+	file.Close()
+
+	reopened, err := OpenFileHistory(path, Retention{}, testLogger())
+	if err != nil {
+		t.Fatalf("failed to reopen history: %v", err)
+	}
+	defer reopened.Close()
+
+	// Records appended after reopening must not be merged with the truncated line
+	if err := reopened.Append(testRecord("c", "likes", base.Add(2*time.Hour))); err != nil {
+		t.Fatalf("failed to append record: %v", err)
+	}
+
+	page, err := reopened.Query(models.HistoryQuery{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ids := recordIDs(page)
+	if len(ids) != 3 || ids[0] != "c" || ids[1] != "b" || ids[2] != "a" {
+		t.Errorf("expected records [c b a], got %v", ids)
+	}
+}
+
+func TestFileHistory_Prune(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		retention       Retention
+		expectedIDs     []string
+		expectedDropped int
+	}{
+		{
+			name:            "max age",
+			retention:       Retention{MaxAge: 90 * time.Minute},
+			expectedIDs:     []string{"c", "b"},
+			expectedDropped: 1,
+		},
+		{
+			name:            "max records",
+			retention:       Retention{MaxRecords: 1},
+			expectedIDs:     []string{"c"},
+			expectedDropped: 2,
+		},
+		{
+			name:            "no retention",
+			retention:       Retention{},
+			expectedIDs:     []string{"c", "b", "a"},
+			expectedDropped: 0,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			history, path := testHistory(t, tc.retention,
+				testRecord("a", "likes", now.Add(-2*time.Hour)),
+				testRecord("b", "likes", now.Add(-time.Hour)),
+				testRecord("c", "likes", now),
+			)
+			history.now = func() time.Time { return now }
+
+			dropped, err := history.Prune()
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if dropped != tc.expectedDropped {
+				t.Errorf("expected %d dropped records, got %d", tc.expectedDropped, dropped)
+			}
+
+			page, _ := history.Query(models.HistoryQuery{})
+			ids := recordIDs(page)
+			if len(ids) != len(tc.expectedIDs) {
+				t.Fatalf("expected records %v, got %v", tc.expectedIDs, ids)
+			}
+
+			// The pruned records must be gone from the file as well
+			history.Close()
+			reopened, err := OpenFileHistory(path, Retention{}, testLogger())
+			if err != nil {
+				t.Fatalf("failed to reopen history: %v", err)
+			}
+			defer reopened.Close()
+
+			page, _ = reopened.Query(models.HistoryQuery{})
+			if page.Total != len(tc.expectedIDs) {
+				t.Errorf("expected %d records after reopening, got %d", len(tc.expectedIDs), page.Total)
+			}
+		})
+	}
+}
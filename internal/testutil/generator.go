@@ -0,0 +1,233 @@
+package testutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PostTypeDimensions lists the post types emitted by the generator with the dimensions each of them carries.
+// It mirrors the shape of Upfluence's feed, where not every post type has every dimension.
+var PostTypeDimensions = map[string][]string{
+	"pin":             {"likes", "comments"},
+	"instagram_media": {"likes", "comments"},
+	"youtube_video":   {"likes", "comments", "favorites"},
+	"article":         {},
+	"tweet":           {"likes", "retweets", "favorites"},
+	"facebook_status": {"likes", "comments"},
+}
+
+// Distribution describes how the values of a dimension are drawn
+type Distribution struct {
+	// Kind is one of: constant, uniform, normal, lognormal
+	Kind string
+
+	// Parameters, whose meaning depends on Kind:
+	// - constant:  A is the value
+	// - uniform:   A is the minimum, B is the maximum
+	// - normal:    A is the mean, B is the standard deviation
+	// - lognormal: A is mu, B is sigma (of the underlying normal distribution)
+	A float64
+	B float64
+}
+
+// DefaultDistributions returns the long-tailed distributions used when none is configured
+func DefaultDistributions() map[string]Distribution {
+	return map[string]Distribution{
+		"likes":     {Kind: "lognormal", A: 5, B: 1.5},
+		"comments":  {Kind: "lognormal", A: 3, B: 1.2},
+		"favorites": {Kind: "lognormal", A: 4, B: 1.3},
+		"retweets":  {Kind: "lognormal", A: 3, B: 1.5},
+	}
+}
+
+// ParseDistribution parses a "dimension=kind:a[:b]" specification (e.g. "likes=uniform:0:1000")
+func ParseDistribution(spec string) (string, Distribution, error) {
+	dimension, params, ok := strings.Cut(spec, "=")
+	if !ok || dimension == "" {
+		return "", Distribution{}, fmt.Errorf("invalid distribution %q (expected format: dimension=kind:a[:b])", spec)
+	}
+
+	parts := strings.Split(params, ":")
+	dist := Distribution{Kind: parts[0]}
+
+	expected := 3
+	if dist.Kind == "constant" {
+		expected = 2
+	}
+
+	switch dist.Kind {
+	case "constant", "uniform", "normal", "lognormal":
+	default:
+		return "", Distribution{}, fmt.Errorf("unknown distribution kind %q (must be one of: constant, uniform, normal, lognormal)", dist.Kind)
+	}
+
+	if len(parts) != expected {
+		return "", Distribution{}, fmt.Errorf("distribution %q expects %d parameter(s), got %d", dist.Kind, expected-1, len(parts)-1)
+	}
+
+	values := make([]float64, 0, 2)
+	for _, p := range parts[1:] {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return "", Distribution{}, fmt.Errorf("invalid distribution parameter %q: %w", p, err)
+		}
+		values = append(values, v)
+	}
+
+	dist.A = values[0]
+	if len(values) > 1 {
+		dist.B = values[1]
+	}
+
+	return dimension, dist, nil
+}
+
+// sample draws a non-negative integer value from the distribution
+func (d Distribution) sample(rng *rand.Rand) uint64 {
+	var v float64
+
+	switch d.Kind {
+	case "constant":
+		v = d.A
+	case "uniform":
+		v = d.A + rng.Float64()*(d.B-d.A)
+	case "normal":
+		v = d.A + rng.NormFloat64()*d.B
+	case "lognormal":
+		v = math.Exp(d.A + rng.NormFloat64()*d.B)
+	}
+
+	// Engagement counters are never negative
+	if v < 0 || math.IsNaN(v) {
+		return 0
+	}
+
+	return uint64(math.Round(v))
+}
+
+// GeneratorOptions configures the synthetic posts
+type GeneratorOptions struct {
+	// PostTypes restricts the emitted post types (all known types when empty)
+	PostTypes []string
+
+	// Distributions overrides the value distribution of individual dimensions
+	Distributions map[string]Distribution
+
+	// MalformedRatio is the probability (between 0 and 1) that an event is malformed
+	MalformedRatio float64
+
+	// Seed makes the generated sequence reproducible (a random seed is used when zero)
+	Seed uint64
+
+	// Now returns the current time used for post timestamps (time.Now when nil)
+	Now func() time.Time
+}
+
+// Generator produces synthetic post events in the JSON format of Upfluence's stream.
+// It is safe for concurrent use.
+type Generator struct {
+	mu            sync.Mutex
+	rng           *rand.Rand
+	postTypes     []string
+	distributions map[string]Distribution
+	malformed     float64
+	now           func() time.Time
+	nextID        uint64
+}
+
+// NewGenerator creates a new post generator
+func NewGenerator(opts GeneratorOptions) (*Generator, error) {
+	postTypes := slices.Clone(opts.PostTypes)
+	if len(postTypes) == 0 {
+		for postType := range PostTypeDimensions {
+			postTypes = append(postTypes, postType)
+		}
+	}
+
+	for _, postType := range postTypes {
+		if _, ok := PostTypeDimensions[postType]; !ok {
+			return nil, fmt.Errorf("unknown post type: %s", postType)
+		}
+	}
+
+	if opts.MalformedRatio < 0 || opts.MalformedRatio > 1 {
+		return nil, fmt.Errorf("malformed ratio must be between 0 and 1, got %v", opts.MalformedRatio)
+	}
+
+	distributions := DefaultDistributions()
+	for dimension, dist := range opts.Distributions {
+		distributions[dimension] = dist
+	}
+
+	seed := opts.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	// Map iteration order is random, sort for reproducibility with a fixed seed
+	slices.Sort(postTypes)
+
+	return &Generator{
+		rng:           rand.New(rand.NewPCG(seed, seed)),
+		postTypes:     postTypes,
+		distributions: distributions,
+		malformed:     opts.MalformedRatio,
+		now:           now,
+	}, nil
+}
+
+// Next returns the JSON payload of the next event and whether it is malformed
+func (g *Generator) Next() ([]byte, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.nextID++
+
+	if g.rng.Float64() < g.malformed {
+		return g.malformedEvent(), true
+	}
+
+	postType := g.postTypes[g.rng.IntN(len(g.postTypes))]
+
+	details := map[string]any{
+		"id":        strconv.FormatUint(g.nextID, 10),
+		"timestamp": g.now().Unix(),
+	}
+
+	for _, dimension := range PostTypeDimensions[postType] {
+		details[dimension] = g.distributions[dimension].sample(g.rng)
+	}
+
+	event, _ := json.Marshal(map[string]any{postType: details})
+	return event, false
+}
+
+// malformedEvent returns one of the malformed payloads the stream client must reject
+func (g *Generator) malformedEvent() []byte {
+	ts := strconv.FormatInt(g.now().Unix(), 10)
+
+	variants := [][]byte{
+		// Truncated JSON
+		[]byte(`{"tweet":{"timestamp":` + ts + `,"likes":`),
+		// Missing timestamp
+		[]byte(`{"tweet":{"likes":42}}`),
+		// Multiple root keys
+		[]byte(`{"tweet":{"timestamp":` + ts + `},"pin":{"timestamp":` + ts + `}}`),
+		// Negative timestamp
+		[]byte(`{"tweet":{"timestamp":-1}}`),
+	}
+
+	return variants[g.rng.IntN(len(variants))]
+}
@@ -0,0 +1,177 @@
+package testutil
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+)
+
+// MockStreamOptions configures the synthetic SSE feed served by MockStream
+type MockStreamOptions struct {
+	GeneratorOptions
+
+	// Rate is the number of events per second sent on each connection (as fast as possible when zero)
+	Rate float64
+
+	// DisconnectAfter closes each connection after this many events (never when zero)
+	DisconnectAfter int
+
+	// KeepAliveInterval sends an SSE comment line at this interval (disabled when zero)
+	KeepAliveInterval time.Duration
+}
+
+// MockStreamStats reports the activity of a MockStream
+type MockStreamStats struct {
+	Connections int64 `json:"connections"`
+	Active      int64 `json:"active"`
+	Events      int64 `json:"events"`
+	Malformed   int64 `json:"malformed"`
+	Disconnects int64 `json:"disconnects"`
+}
+
+// MockStream is an http.Handler serving a realistic Upfluence-like SSE feed.
+// Every connection gets its own stream of events drawn from a shared generator.
+type MockStream struct {
+	generator *Generator
+	opts      MockStreamOptions
+
+	connections atomic.Int64
+	active      atomic.Int64
+	events      atomic.Int64
+	malformed   atomic.Int64
+	disconnects atomic.Int64
+}
+
+// Check interface implementation at compile-time
+var _ http.Handler = &MockStream{}
+
+// NewMockStream creates a new mock SSE stream
+func NewMockStream(opts MockStreamOptions) (*MockStream, error) {
+	if opts.Rate < 0 {
+		return nil, fmt.Errorf("rate must not be negative, got %v", opts.Rate)
+	}
+
+	if opts.DisconnectAfter < 0 {
+		return nil, fmt.Errorf("disconnect after must not be negative, got %d", opts.DisconnectAfter)
+	}
+
+	generator, err := NewGenerator(opts.GeneratorOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MockStream{
+		generator: generator,
+		opts:      opts,
+	}, nil
+}
+
+// NewMockStreamServer starts an httptest server serving the mock stream.
+// The caller is responsible for closing the server.
+func NewMockStreamServer(opts MockStreamOptions) (*httptest.Server, *MockStream, error) {
+	stream, err := NewMockStream(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return httptest.NewServer(stream), stream, nil
+}
+
+// Stats returns a snapshot of the stream activity
+func (m *MockStream) Stats() MockStreamStats {
+	return MockStreamStats{
+		Connections: m.connections.Load(),
+		Active:      m.active.Load(),
+		Events:      m.events.Load(),
+		Malformed:   m.malformed.Load(),
+		Disconnects: m.disconnects.Load(),
+	}
+}
+
+// ServeHTTP streams events until the client disconnects or the disconnect threshold is reached
+func (m *MockStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	m.connections.Add(1)
+	m.active.Add(1)
+	defer m.active.Add(-1)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Events are paced against the elapsed time rather than one tick per event,
+	// so that high rates are honored despite the ticker resolution
+	tick := 10 * time.Millisecond
+	if m.opts.Rate > 0 {
+		tick = min(tick, time.Duration(float64(time.Second)/m.opts.Rate))
+	}
+
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	var keepAliveCh <-chan time.Time
+	if m.opts.KeepAliveInterval > 0 {
+		keepAlive := time.NewTicker(m.opts.KeepAliveInterval)
+		defer keepAlive.Stop()
+		keepAliveCh = keepAlive.C
+	}
+
+	start := time.Now()
+	sent := 0
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-keepAliveCh:
+			if _, err := w.Write([]byte(": keep-alive\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-ticker.C:
+			due := m.dueEvents(time.Since(start), sent)
+
+			for range due {
+				if m.opts.DisconnectAfter > 0 && sent >= m.opts.DisconnectAfter {
+					// Injected disconnect: end the response abruptly
+					m.disconnects.Add(1)
+					return
+				}
+
+				event, malformed := m.generator.Next()
+				if _, err := fmt.Fprintf(w, "data: %s\n\n", event); err != nil {
+					return
+				}
+
+				sent++
+				m.events.Add(1)
+				if malformed {
+					m.malformed.Add(1)
+				}
+			}
+
+			flusher.Flush()
+		}
+	}
+}
+
+// dueEvents returns how many events should be sent now to keep up with the configured rate
+func (m *MockStream) dueEvents(elapsed time.Duration, sent int) int {
+	// Without a rate, send a batch per tick
+	if m.opts.Rate == 0 {
+		return 100
+	}
+
+	return max(int(elapsed.Seconds()*m.opts.Rate)-sent, 0)
+}
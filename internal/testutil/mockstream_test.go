@@ -0,0 +1,190 @@
+package testutil
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hasanbasricaglayan/upfluence-stream-analyzer/internal/models"
+)
+
+func TestParseDistribution(t *testing.T) {
+	tests := []struct {
+		name              string
+		spec              string
+		isError           bool
+		expectedDimension string
+		expectedDist      Distribution
+	}{
+		{
+			name:              "constant",
+			spec:              "likes=constant:42",
+			expectedDimension: "likes",
+			expectedDist:      Distribution{Kind: "constant", A: 42},
+		},
+		{
+			name:              "uniform",
+			spec:              "comments=uniform:0:1000",
+			expectedDimension: "comments",
+			expectedDist:      Distribution{Kind: "uniform", A: 0, B: 1000},
+		},
+		{
+			name:              "lognormal",
+			spec:              "retweets=lognormal:3:1.5",
+			expectedDimension: "retweets",
+			expectedDist:      Distribution{Kind: "lognormal", A: 3, B: 1.5},
+		},
+		{name: "missing dimension", spec: "uniform:0:1", isError: true},
+		{name: "unknown kind", spec: "likes=zipf:1:2", isError: true},
+		{name: "missing parameter", spec: "likes=normal:10", isError: true},
+		{name: "invalid parameter", spec: "likes=constant:abc", isError: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dimension, dist, err := ParseDistribution(tc.spec)
+
+			if tc.isError {
+				if err == nil {
+					t.Error("expected error but got nil")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if dimension != tc.expectedDimension {
+				t.Errorf("expected dimension %q, got %q", tc.expectedDimension, dimension)
+			}
+			if dist != tc.expectedDist {
+				t.Errorf("expected distribution %+v, got %+v", tc.expectedDist, dist)
+			}
+		})
+	}
+}
+
+func TestGenerator_Next_ValidPosts(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	generator, err := NewGenerator(GeneratorOptions{
+		Seed:          1,
+		Distributions: map[string]Distribution{"likes": {Kind: "constant", A: 7}},
+		Now:           func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	seenTypes := map[string]bool{}
+
+	for range 500 {
+		event, malformed := generator.Next()
+		if malformed {
+			t.Fatal("expected no malformed event with a zero ratio")
+		}
+
+		// Every generated event must be accepted by the stream parser
+		var post models.PostPayload
+		if err := post.UnmarshalJSON(event); err != nil {
+			t.Fatalf("failed to parse generated event %s: %v", event, err)
+		}
+
+		seenTypes[post.Type] = true
+
+		if post.Data.Timestamp != now.Unix() {
+			t.Errorf("expected timestamp %d, got %d", now.Unix(), post.Data.Timestamp)
+		}
+
+		if likes, ok := post.GetDimensionValue("likes"); ok && likes != 7 {
+			t.Errorf("expected constant likes 7, got %d", likes)
+		}
+	}
+
+	if len(seenTypes) != len(PostTypeDimensions) {
+		t.Errorf("expected every post type to be generated, got %v", seenTypes)
+	}
+}
+
+func TestGenerator_Next_MalformedRatio(t *testing.T) {
+	generator, err := NewGenerator(GeneratorOptions{Seed: 1, MalformedRatio: 1})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for range 50 {
+		event, malformed := generator.Next()
+		if !malformed {
+			t.Fatal("expected every event to be malformed with a ratio of 1")
+		}
+
+		var post models.PostPayload
+		if err := post.UnmarshalJSON(event); err == nil {
+			t.Errorf("expected malformed event %s to be rejected by the parser", event)
+		}
+	}
+}
+
+func TestNewGenerator_InvalidOptions(t *testing.T) {
+	if _, err := NewGenerator(GeneratorOptions{PostTypes: []string{"myspace_post"}}); err == nil {
+		t.Error("expected error for unknown post type")
+	}
+
+	if _, err := NewGenerator(GeneratorOptions{MalformedRatio: 1.5}); err == nil {
+		t.Error("expected error for malformed ratio above 1")
+	}
+}
+
+func TestMockStream_DisconnectAndKeepAlive(t *testing.T) {
+	server, stream, err := NewMockStreamServer(MockStreamOptions{
+		GeneratorOptions:  GeneratorOptions{Seed: 1, PostTypes: []string{"tweet"}},
+		Rate:              200,
+		DisconnectAfter:   10,
+		KeepAliveInterval: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("failed to connect to mock stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected Content-Type text/event-stream, got %s", ct)
+	}
+
+	// The connection ends on its own after the configured number of events
+	events, comments := 0, 0
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		switch {
+		case bytes.HasPrefix(line, []byte("data: ")):
+			events++
+			if !strings.Contains(string(line), `"tweet"`) {
+				t.Errorf("expected only tweets, got %s", line)
+			}
+		case bytes.HasPrefix(line, []byte(":")):
+			comments++
+		}
+	}
+
+	if events != 10 {
+		t.Errorf("expected 10 events before disconnect, got %d", events)
+	}
+	if comments == 0 {
+		t.Error("expected at least one keep-alive comment")
+	}
+
+	stats := stream.Stats()
+	if stats.Connections != 1 || stats.Disconnects != 1 || stats.Events != 10 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
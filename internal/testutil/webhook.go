@@ -0,0 +1,97 @@
+package testutil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// WebhookDelivery is a request received by a WebhookReceiver
+type WebhookDelivery struct {
+	Header http.Header
+	Body   []byte
+
+	// Verified tells whether the signature of the payload matches the secret of the receiver
+	Verified bool
+}
+
+// WebhookReceiver is a local HTTP server recording the webhook notifications it receives.
+// It verifies their "X-Signature-256" HMAC-SHA256 signature of "<X-Signature-Timestamp>.<body>".
+type WebhookReceiver struct {
+	*httptest.Server
+
+	secret []byte
+
+	mu         sync.Mutex
+	deliveries []WebhookDelivery
+	failures   int
+
+	// Received gets every recorded delivery, deliveries are dropped from it when its buffer is full
+	Received chan WebhookDelivery
+}
+
+// NewWebhookReceiver starts a new webhook receiver.
+// The first failures requests are answered with a 503 status, to exercise the retries of the sender.
+// The receiver must be closed with Close.
+func NewWebhookReceiver(secret string, failures int) *WebhookReceiver {
+	r := &WebhookReceiver{
+		secret:   []byte(secret),
+		failures: failures,
+		Received: make(chan WebhookDelivery, 100),
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.handle))
+	return r
+}
+
+func (r *WebhookReceiver) handle(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	if r.failures > 0 {
+		r.failures--
+		r.mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	delivery := WebhookDelivery{
+		Header:   req.Header.Clone(),
+		Body:     body,
+		Verified: r.verify(req.Header, body),
+	}
+	r.deliveries = append(r.deliveries, delivery)
+	r.mu.Unlock()
+
+	select {
+	case r.Received <- delivery:
+	default:
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verify checks the signature of a payload
+func (r *WebhookReceiver) verify(header http.Header, body []byte) bool {
+	mac := hmac.New(sha256.New, r.secret)
+	mac.Write([]byte(header.Get("X-Signature-Timestamp") + "."))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(header.Get("X-Signature-256")))
+}
+
+// Deliveries returns the recorded deliveries, in order of arrival
+func (r *WebhookReceiver) Deliveries() []WebhookDelivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]WebhookDelivery(nil), r.deliveries...)
+}